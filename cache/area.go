@@ -1,10 +1,12 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"omo.msa.organization/proxy"
 	"omo.msa.organization/proxy/nosql"
+	"sync"
 	"time"
 )
 
@@ -32,12 +34,18 @@ type AreaInfo struct {
 	Sources  []*proxy.PairInfo //定制资源配置
 	Displays []string
 	Assets   []string
+	//保护导出的字段，Owner以及UID不会修改
+	lock sync.RWMutex
 }
 
-func (mine *cacheContext) CreateArea(name, remark, owner, parent, operator string, assets []string) (*AreaInfo, error) {
+func (mine *cacheContext) CreateArea(ctx context.Context, name, remark, owner, parent, operator string, assets []string) (*AreaInfo, error) {
 	db := new(nosql.Area)
 	db.UID = primitive.NewObjectID()
-	db.ID = nosql.GetAreaNextID()
+	id, err := store.GetAreaNextID()
+	if err != nil {
+		return nil, err
+	}
+	db.ID = id
 	db.CreatedTime = time.Now()
 	db.Creator = operator
 	db.Name = name
@@ -60,7 +68,7 @@ func (mine *cacheContext) CreateArea(name, remark, owner, parent, operator strin
 	db.Modules = make([]*proxy.PairInfo, 0, 1)
 	db.Sources = make([]*proxy.PairInfo, 0, 1)
 
-	err := nosql.CreateArea(db)
+	err = store.CreateArea(ctx, db)
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +81,7 @@ func (mine *cacheContext) GetArea(uid string) (*AreaInfo, error) {
 	if len(uid) < 2 {
 		return nil, errors.New("the area uid is empty")
 	}
-	db, err := nosql.GetArea(uid)
+	db, err := store.GetArea(uid)
 	if err != nil {
 		return nil, err
 	}
@@ -86,7 +94,7 @@ func (mine *cacheContext) GetAreaByDevice(uid string) (*AreaInfo, error) {
 	if len(uid) < 2 {
 		return nil, errors.New("the area device uid is empty")
 	}
-	db, err := nosql.GetAreaByDevice(uid)
+	db, err := store.GetAreaByDevice(uid)
 	if err != nil {
 		return nil, err
 	}
@@ -99,16 +107,32 @@ func (mine *cacheContext) GetAreaBySN(sn string) (*AreaInfo, error) {
 	if len(sn) < 2 {
 		return nil, errors.New("the area sn is empty")
 	}
-	db, err := nosql.GetDeviceBySN(sn)
+	//索引命中后需要校验区域仍然绑定该设备
+	entry := mine.lookupArea(sn)
+	if entry != nil {
+		db, err := store.GetArea(entry.area)
+		if err == nil && db.DeleteTime.IsZero() && db.Device == entry.device {
+			info := new(AreaInfo)
+			info.initInfo(db)
+			return info, nil
+		}
+		mine.unindexArea(entry.area)
+	}
+	dev, err := mine.GetDeviceBySN(sn)
 	if err != nil {
 		return nil, err
 	}
-	return mine.GetAreaByDevice(db.UID.Hex())
+	info, err := mine.GetAreaByDevice(dev.UID)
+	if err != nil {
+		return nil, err
+	}
+	mine.indexArea(sn, info.Device, info.UID)
+	return info, nil
 }
 
 func (mine *cacheContext) GetAreasByParent(parent string) []*AreaInfo {
 	list := make([]*AreaInfo, 0, 20)
-	array, err := nosql.GetAreasByParent(parent)
+	array, err := store.GetAreasByParent(parent)
 	if err != nil {
 		return list
 	}
@@ -121,7 +145,7 @@ func (mine *cacheContext) GetAreasByParent(parent string) []*AreaInfo {
 }
 
 func (mine *cacheContext) GetAreasByScene(uid string) ([]*AreaInfo, error) {
-	array, err := nosql.GetAreasByOwner(uid)
+	array, err := store.GetAreasByOwner(uid)
 	if err != nil {
 		return make([]*AreaInfo, 0, 0), err
 	}
@@ -135,7 +159,7 @@ func (mine *cacheContext) GetAreasByScene(uid string) ([]*AreaInfo, error) {
 }
 
 func (mine *cacheContext) GetAreasByTemplate(owner, template string) []*AreaInfo {
-	array, err := nosql.GetAreasByTemplate(owner, template)
+	array, err := store.GetAreasByTemplate(owner, template)
 	if err != nil {
 		return make([]*AreaInfo, 0, 0)
 	}
@@ -154,7 +178,7 @@ func (mine *cacheContext) GetAreaList(array []string) []*AreaInfo {
 	}
 	list := make([]*AreaInfo, 0, len(array))
 	for i := 0; i < len(array); i += 1 {
-		db, err := nosql.GetArea(array[i])
+		db, err := store.GetArea(array[i])
 		if err == nil {
 			info := new(AreaInfo)
 			info.initInfo(db)
@@ -189,161 +213,242 @@ func (mine *AreaInfo) initInfo(db *nosql.Area) {
 	mine.Assets = db.Assets
 }
 
+// update 写数据库成功后修改缓存的字段，读取字段需要持有读锁或者使用Clone
+func (mine *AreaInfo) update(operator string, fun func()) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	fun()
+	if len(operator) > 0 {
+		mine.Operator = operator
+	}
+}
+
+// Clone 字段以及配置的副本，用于返回给调用者，不能用于修改
+func (mine *AreaInfo) Clone() *AreaInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	tmp := new(AreaInfo)
+	tmp.baseInfo = mine.baseInfo
+	tmp.Remark = mine.Remark
+	tmp.Owner = mine.Owner
+	tmp.Parent = mine.Parent
+	tmp.Template = mine.Template
+	tmp.Type = mine.Type
+	tmp.Width = mine.Width
+	tmp.Height = mine.Height
+	tmp.LimitNum = mine.LimitNum
+	tmp.Device = mine.Device
+	tmp.Question = mine.Question
+	tmp.Catalog = mine.Catalog
+	tmp.deviceInfo = mine.deviceInfo
+	tmp.Modules = append(make([]*proxy.PairInfo, 0, len(mine.Modules)), mine.Modules...)
+	tmp.Sources = append(make([]*proxy.PairInfo, 0, len(mine.Sources)), mine.Sources...)
+	tmp.Displays = append(make([]string, 0, len(mine.Displays)), mine.Displays...)
+	tmp.Assets = append(make([]string, 0, len(mine.Assets)), mine.Assets...)
+	return tmp
+}
+
+func (mine *AreaInfo) device() string {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.Device
+}
+
+// terminal 第一次访问时读取绑定的设备，修改设备后重新读取
+func (mine *AreaInfo) terminal() *DeviceInfo {
+	mine.lock.RLock()
+	info := mine.deviceInfo
+	uid := mine.Device
+	mine.lock.RUnlock()
+	if info != nil {
+		return info
+	}
+	info, _ = cacheCtx.GetDevice(uid)
+	if info != nil {
+		mine.update("", func() {
+			if mine.Device == uid {
+				mine.deviceInfo = info
+			}
+		})
+	}
+	return info
+}
+
 func (mine *AreaInfo) DeviceInfo() (*DeviceInfo, error) {
-	return cacheCtx.GetDevice(mine.Device)
+	return cacheCtx.GetDevice(mine.device())
 }
 
 func (mine *AreaInfo) DeviceSN() string {
-	if mine.deviceInfo == nil {
-		mine.deviceInfo, _ = cacheCtx.GetDevice(mine.Device)
-	}
-
-	if mine.deviceInfo == nil {
+	info := mine.terminal()
+	if info == nil {
 		return ""
 	}
-	return mine.deviceInfo.SN
+	return info.keys().sn
 }
 
 func (mine *AreaInfo) GetAspect() string {
-	if mine.deviceInfo == nil {
-		mine.deviceInfo, _ = cacheCtx.GetDevice(mine.Device)
-	}
-
-	if mine.deviceInfo == nil {
+	info := mine.terminal()
+	if info == nil {
 		return ""
 	}
-	return mine.deviceInfo.Aspect
+	return info.Clone().Aspect
 }
 
-func (mine *AreaInfo) UpdateBase(name, remark, operator string) error {
-	err := nosql.UpdateAreaBase(mine.UID, name, remark, operator)
+func (mine *AreaInfo) UpdateBase(ctx context.Context, name, remark, operator string) error {
+	err := store.UpdateAreaBase(ctx, mine.UID, name, remark, operator)
 	if err == nil {
-		mine.Name = name
-		mine.Remark = remark
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Name = name
+			mine.Remark = remark
+		})
 	}
 	return err
 }
 
-func (mine *AreaInfo) UpdateTemplate(template, operator string) error {
-	err := nosql.UpdateAreaTemplate(mine.UID, template, operator)
+func (mine *AreaInfo) UpdateTemplate(ctx context.Context, template, operator string) error {
+	err := store.UpdateAreaTemplate(ctx, mine.UID, template, operator)
 	if err == nil {
-		mine.Template = template
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Template = template
+		})
 	}
 	return err
 }
 
-func (mine *AreaInfo) UpdateLimitCount(operator string, num uint32) error {
-	if mine.LimitNum == num {
+func (mine *AreaInfo) UpdateLimitCount(ctx context.Context, operator string, num uint32) error {
+	mine.lock.RLock()
+	limit := mine.LimitNum
+	mine.lock.RUnlock()
+	if limit == num {
 		return nil
 	}
-	err := nosql.UpdateAreaLimit(mine.UID, operator, num)
+	err := store.UpdateAreaLimit(ctx, mine.UID, operator, num)
 	if err == nil {
-		mine.LimitNum = num
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.LimitNum = num
+		})
 	}
 	return err
 }
 
-func (mine *AreaInfo) UpdateDevice(device, operator string, tp uint32) error {
-	err := nosql.UpdateAreaDevice(mine.UID, device, operator, tp)
+func (mine *AreaInfo) UpdateDevice(ctx context.Context, device, operator string, tp uint32) error {
+	err := store.UpdateAreaDevice(ctx, mine.UID, device, operator, tp)
 	if err == nil {
-		mine.Device = device
-		mine.Type = tp
-		mine.Operator = operator
+		cacheCtx.unindexArea(mine.UID)
+		mine.update(operator, func() {
+			mine.Device = device
+			mine.Type = tp
+			mine.deviceInfo = nil
+		})
 	}
 	return err
 }
 
-func (mine *AreaInfo) UpdateDisplays(operator string, list []string) error {
-	err := nosql.UpdateAreaDisplays(mine.UID, operator, list)
+func (mine *AreaInfo) UpdateDisplays(ctx context.Context, operator string, list []string) error {
+	err := store.UpdateAreaDisplays(ctx, mine.UID, operator, list)
 	if err == nil {
-		mine.Displays = list
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Displays = list
+		})
 	}
 	return err
 }
 
-func (mine *AreaInfo) UpdateAssets(operator string, list []string) error {
-	err := nosql.UpdateAreaAssets(mine.UID, operator, list)
+func (mine *AreaInfo) UpdateAssets(ctx context.Context, operator string, list []string) error {
+	err := store.UpdateAreaAssets(ctx, mine.UID, operator, list)
 	if err == nil {
-		mine.Assets = list
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Assets = list
+		})
 	}
 	return err
 }
 
-func (mine *AreaInfo) UpdateDevice2(sn, operator string) error {
-	err := nosql.UpdateAreaDevice2(mine.UID, sn, operator)
+func (mine *AreaInfo) UpdateDevice2(ctx context.Context, sn, operator string) error {
+	err := store.UpdateAreaDevice2(ctx, mine.UID, sn, operator)
 	if err == nil {
-		mine.Device = sn
-		mine.Operator = operator
+		cacheCtx.unindexArea(mine.UID)
+		mine.update(operator, func() {
+			mine.Device = sn
+			mine.deviceInfo = nil
+		})
 	}
 	return err
 }
 
-func (mine *AreaInfo) UpdateType(tp uint32, operator string) error {
-	err := nosql.UpdateAreaType(mine.UID, operator, tp)
+func (mine *AreaInfo) UpdateType(ctx context.Context, tp uint32, operator string) error {
+	err := store.UpdateAreaType(ctx, mine.UID, operator, tp)
 	if err == nil {
-		mine.Type = tp
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Type = tp
+		})
 	}
 	return err
 }
 
-func (mine *AreaInfo) UpdateCatalog(catalog, operator string) error {
-	err := nosql.UpdateAreaCatalog(mine.UID, catalog, operator)
+func (mine *AreaInfo) UpdateCatalog(ctx context.Context, catalog, operator string) error {
+	err := store.UpdateAreaCatalog(ctx, mine.UID, catalog, operator)
 	if err == nil {
-		mine.Catalog = catalog
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Catalog = catalog
+		})
 	}
 	return err
 }
 
-func (mine *AreaInfo) UpdateQuestion(question, operator string) error {
-	err := nosql.UpdateAreaQuestion(mine.UID, question, operator)
+func (mine *AreaInfo) UpdateQuestion(ctx context.Context, question, operator string) error {
+	err := store.UpdateAreaQuestion(ctx, mine.UID, question, operator)
 	if err == nil {
-		mine.Question = question
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Question = question
+		})
 	}
 	return err
 }
 
-func (mine *AreaInfo) Remove(operator string) error {
-	return nosql.RemoveArea(mine.UID, operator)
+func (mine *AreaInfo) Remove(ctx context.Context, operator string) error {
+	err := store.RemoveArea(ctx, mine.UID, operator)
+	if err == nil {
+		cacheCtx.unindexArea(mine.UID)
+	}
+	return err
 }
 
-func (mine *AreaInfo) UpdateModule(key, value, operator string) error {
-	arr := make([]*proxy.PairInfo, 0, len(mine.Modules))
-	arr = append(arr, mine.Modules...)
-	ok := false
-	for _, info := range arr {
-		if info.Key == key {
-			info.Value = value
-			ok = true
-			break
-		}
+// UpdateModule 存储层按照key原子修改，避免并发修改时覆盖其他key
+func (mine *AreaInfo) UpdateModule(ctx context.Context, key, value, operator string) error {
+	err := store.SetAreaModule(ctx, mine.UID, operator, key, value)
+	if err == nil {
+		mine.update(operator, func() {
+			mine.Modules = setPair(mine.Modules, key, value)
+		})
 	}
-	if !ok {
-		arr = append(arr, &proxy.PairInfo{Key: key, Value: value})
+	return err
+}
+
+func (mine *AreaInfo) UpdateCustomSource(ctx context.Context, key, value, operator string) error {
+	err := store.SetAreaSource(ctx, mine.UID, operator, key, value)
+	if err == nil {
+		mine.update(operator, func() {
+			mine.Sources = setPair(mine.Sources, key, value)
+		})
 	}
-	return nosql.UpdateAreaModules(mine.UID, operator, arr)
+	return err
 }
 
-func (mine *AreaInfo) UpdateCustomSource(key, value, operator string) error {
-	arr := make([]*proxy.PairInfo, 0, len(mine.Sources))
-	arr = append(arr, mine.Sources...)
+// setPair 返回新的数组，不修改原有的元素
+func setPair(list []*proxy.PairInfo, key, value string) []*proxy.PairInfo {
+	arr := make([]*proxy.PairInfo, 0, len(list)+1)
 	ok := false
-	for _, info := range arr {
+	for _, info := range list {
 		if info.Key == key {
-			info.Value = value
+			arr = append(arr, &proxy.PairInfo{Key: key, Value: value})
 			ok = true
-			break
+		} else {
+			arr = append(arr, info)
 		}
 	}
 	if !ok {
 		arr = append(arr, &proxy.PairInfo{Key: key, Value: value})
 	}
-	return nosql.UpdateAreaSources(mine.UID, operator, arr)
+	return arr
 }
@@ -0,0 +1,910 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/micro/go-micro/v2/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy"
+	"omo.msa.organization/proxy/nosql"
+	"sort"
+	"time"
+)
+
+/**
+审计记录，包装存储接口，写操作前读取对象，修改后的对象由存储在写入的同一次操作中返回，
+场景、房间、区域树以及区域同时保存修改后的历史版本，
+调用路径通过context从grpc的wrapper传递到存储接口，后台任务以及命令行使用自己的路径
+*/
+
+// auditIgnores 每次修改都会变化的字段不记录
+var auditIgnores = map[string]bool{"UID": true, "updatedAt": true, "version": true, "operator": true}
+
+type pathKey struct{}
+
+type auditTarget struct {
+	table  string
+	uid    string
+	action string
+	ops    []*nosql.WriteOp //写入的字段，存储没有返回修改后的对象时使用
+}
+
+// changed 修改的字段，key和模型的json标签一致
+func changed(table, uid string, fields bson.M) *auditTarget {
+	op := &nosql.WriteOp{Table: table, UID: uid, Fields: fields}
+	return &auditTarget{table: table, uid: uid, action: nosql.AuditUpdate, ops: []*nosql.WriteOp{op}}
+}
+
+func opTarget(action string, op *nosql.WriteOp) *auditTarget {
+	return &auditTarget{table: op.Table, uid: op.UID, action: action, ops: []*nosql.WriteOp{op}}
+}
+
+func (mine *auditTarget) add(field string, list []string) *auditTarget {
+	mine.ops[0].Adds = map[string][]string{field: list}
+	return mine
+}
+
+func (mine *auditTarget) pull(field string, list []string) *auditTarget {
+	mine.ops[0].Pulls = map[string][]string{field: list}
+	return mine
+}
+
+// opTargets 同一个文档的多个写操作合并，删除时间不为空的是删除，清空的是恢复
+func opTargets(ops []*nosql.WriteOp) []*auditTarget {
+	targets := make([]*auditTarget, 0, len(ops))
+	docs := make(map[string]*auditTarget, len(ops))
+	for _, op := range ops {
+		if target, ok := docs[op.Table+"/"+op.UID]; ok {
+			target.ops = append(target.ops, op)
+			continue
+		}
+		action := nosql.AuditUpdate
+		if stamp, ok := op.Fields["deleteAt"].(time.Time); ok {
+			if stamp.IsZero() {
+				action = nosql.AuditRestore
+			} else {
+				action = nosql.AuditRemove
+			}
+		}
+		target := opTarget(action, op)
+		docs[op.Table+"/"+op.UID] = target
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+type auditStore struct {
+	nosql.Storage
+}
+
+// wrapAudit 已经包装的存储不重复包装
+func wrapAudit(storage nosql.Storage) nosql.Storage {
+	if _, ok := storage.(*auditStore); ok {
+		return storage
+	}
+	return &auditStore{Storage: storage}
+}
+
+// InsertMany 内部的存储支持时批量写入，成功的行记录审计
+func (mine *auditStore) InsertMany(ctx context.Context, table string, list []interface{}) (map[int]string, error) {
+	batcher, ok := mine.Storage.(nosql.BatchStore)
+	if !ok {
+		return nil, nosql.ErrBatchUnsupported
+	}
+	failed, err := batcher.InsertMany(ctx, table, list)
+	if err != nil {
+		return nil, err
+	}
+	for i, info := range list {
+		if _, ok := failed[i]; ok {
+			continue
+		}
+		after := toAuditMap(info)
+		creator, _ := after["creator"].(string)
+		target := &auditTarget{table: table, uid: nosql.ModelUID(info), action: nosql.AuditCreate}
+		cacheCtx.searches().mark(table, target.uid)
+		mine.record(target, creator, pathOf(ctx), nil, after, true)
+	}
+	return failed, nil
+}
+
+// isMongoStore 只有mongo支持快照以及变化通知
+func isMongoStore() bool {
+	if tmp, ok := store.(*auditStore); ok {
+		return tmp.Storage == nosql.MongoStorage()
+	}
+	return store == nosql.MongoStorage()
+}
+
+// WithPath 审计记录的调用路径，grpc的wrapper使用接口名称
+func WithPath(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, pathKey{}, path)
+}
+
+func pathOf(ctx context.Context) string {
+	path, _ := ctx.Value(pathKey{}).(string)
+	return path
+}
+
+// GetAudits 审计记录，按照时间倒序
+func GetAudits(filter *nosql.AuditFilter) ([]*nosql.Audit, error) {
+	if filter == nil {
+		return nil, errors.New("the audit filter is nil")
+	}
+	if len(filter.Scene) < 1 && len(filter.Target) < 1 && len(filter.Operator) < 1 {
+		return nil, errors.New("the audit filter is empty")
+	}
+	if filter.Limit < 1 || filter.Limit > 1000 {
+		filter.Limit = 1000
+	}
+	return store.GetAudits(filter)
+}
+
+//region Record
+func (mine *auditStore) track(ctx context.Context, target *auditTarget, operator string, fun func(ctx context.Context) error) error {
+	return mine.trackMany(ctx, []*auditTarget{target}, operator, fun)
+}
+
+// trackMany 写操作成功后才记录，审计失败不影响写操作
+func (mine *auditStore) trackMany(ctx context.Context, targets []*auditTarget, operator string, fun func(ctx context.Context) error) error {
+	befores := make([]map[string]interface{}, 0, len(targets))
+	for _, target := range targets {
+		befores = append(befores, mine.snapshot(target.table, target.uid))
+	}
+	tmp, afters := nosql.WithAfters(ctx)
+	err := fun(tmp)
+	if err != nil {
+		return err
+	}
+	path := pathOf(ctx)
+	for i, target := range targets {
+		cacheCtx.searches().mark(target.table, target.uid)
+		after, exact := mine.result(target, befores[i], afters)
+		mine.record(target, operator, path, befores[i], after, exact)
+	}
+	return nil
+}
+
+// result 优先使用存储在写入时返回的对象，不会混入其他并发的写入，此时exact为true，
+// 存储没有返回时在写入前的字段上依次应用写操作，每次写操作版本加1，无法计算时重新读取
+func (mine *auditStore) result(target *auditTarget, before map[string]interface{}, afters *nosql.Afters) (map[string]interface{}, bool) {
+	if target.action == nosql.AuditPurge {
+		return nil, false
+	}
+	if doc := afters.Get(target.table, target.uid); doc != nil {
+		return toAuditMap(doc), true
+	}
+	if before == nil || len(target.ops) < 1 {
+		return mine.snapshot(target.table, target.uid), false
+	}
+	after := make(map[string]interface{}, len(before))
+	for key, value := range before {
+		after[key] = value
+	}
+	for _, op := range target.ops {
+		for key, value := range toAuditMap(op.Fields) {
+			after[key] = value
+		}
+		for key, list := range op.Pulls {
+			after[key] = pullAuditItems(after[key], list)
+		}
+		for key, list := range op.Adds {
+			after[key] = addAuditItems(after[key], list)
+		}
+		if num, ok := after["version"].(float64); ok {
+			after["version"] = num + 1
+		}
+	}
+	return after, false
+}
+
+func addAuditItems(value interface{}, list []string) []interface{} {
+	items, _ := value.([]interface{})
+	arr := make([]interface{}, 0, len(items)+len(list))
+	arr = append(arr, items...)
+	for _, item := range list {
+		had := false
+		for _, tmp := range arr {
+			if tmp == item {
+				had = true
+				break
+			}
+		}
+		if !had {
+			arr = append(arr, item)
+		}
+	}
+	return arr
+}
+
+func pullAuditItems(value interface{}, list []string) []interface{} {
+	items, _ := value.([]interface{})
+	arr := make([]interface{}, 0, len(items))
+	for _, tmp := range items {
+		had := false
+		for _, item := range list {
+			if tmp == item {
+				had = true
+				break
+			}
+		}
+		if !had {
+			arr = append(arr, tmp)
+		}
+	}
+	return arr
+}
+
+func (mine *auditStore) created(ctx context.Context, table, uid, operator string, info interface{}) {
+	target := &auditTarget{table: table, uid: uid, action: nosql.AuditCreate}
+	cacheCtx.searches().mark(table, uid)
+	mine.record(target, operator, pathOf(ctx), nil, toAuditMap(info), true)
+}
+
+// record exact为false时after是计算的结果，可能混入或者缺少并发的写入，只记录审计不记录历史版本
+func (mine *auditStore) record(target *auditTarget, operator, path string, before, after map[string]interface{}, exact bool) {
+	changes := diffAudit(before, after)
+	if len(changes) < 1 && target.action == nosql.AuditUpdate {
+		return
+	}
+	info := &nosql.Audit{UID: primitive.NewObjectID(), CreatedTime: time.Now(), Table: target.table, Target: target.uid,
+		Action: target.action, Operator: operator, Path: path, Changes: changes}
+	info.Scene = auditScene(target, before, after)
+	err := mine.Storage.CreateAudit(info)
+	if err != nil {
+		logger.Warnf("record the audit of %s failed that err = %s", target.uid, err.Error())
+	}
+	if after == nil || !nosql.IsRevisionTable(target.table) {
+		return
+	}
+	if exact {
+		mine.revision(info, after)
+	} else {
+		logger.Warnf("the store not return the document of %s so skip the revision", target.uid)
+	}
+}
+
+// revision 保存存储返回的修改后的完整文档，版本号和文档一致
+func (mine *auditStore) revision(audit *nosql.Audit, after map[string]interface{}) {
+	data, err := json.Marshal(after)
+	if err != nil {
+		return
+	}
+	info := &nosql.Revision{UID: primitive.NewObjectID(), CreatedTime: audit.CreatedTime, Table: audit.Table,
+		Target: audit.Target, Scene: audit.Scene, Action: audit.Action, Operator: audit.Operator, Path: audit.Path,
+		Data: string(data)}
+	if num, ok := after["version"].(float64); ok {
+		info.Version = uint32(num)
+	}
+	err = mine.Storage.CreateRevision(info)
+	if err != nil {
+		logger.Warnf("record the revision of %s failed that err = %s", audit.Target, err.Error())
+	}
+}
+
+// snapshot 对象当前的字段，不存在时为nil
+func (mine *auditStore) snapshot(table, uid string) map[string]interface{} {
+	return snapshotOf(mine.Storage, table, uid)
+}
+
+func snapshotOf(storage nosql.Storage, table, uid string) map[string]interface{} {
+	var info interface{}
+	var err error
+	switch table {
+	case nosql.TableScene:
+		info, err = storage.GetScene(uid)
+	case nosql.TableGroup:
+		info, err = storage.GetGroup(uid)
+	case nosql.TableRoom:
+		info, err = storage.GetRoom(uid)
+	case nosql.TableRegion:
+		info, err = storage.GetRegion(uid)
+	case nosql.TableArea:
+		info, err = storage.GetArea(uid)
+	case nosql.TableDevice:
+		info, err = storage.GetDevice(uid)
+	case nosql.TableMaintain:
+		info, err = storage.GetMaintain(uid)
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	return toAuditMap(info)
+}
+
+func toAuditMap(info interface{}) map[string]interface{} {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil
+	}
+	kv := make(map[string]interface{}, 20)
+	if json.Unmarshal(data, &kv) != nil {
+		return nil
+	}
+	return kv
+}
+
+// auditScene 场景使用自己的uid，解绑场景的设备使用修改前的场景
+func auditScene(target *auditTarget, before, after map[string]interface{}) string {
+	if target.table == nosql.TableScene {
+		return target.uid
+	}
+	for _, kv := range []map[string]interface{}{after, before} {
+		if scene, ok := kv["scene"].(string); ok && len(scene) > 0 {
+			return scene
+		}
+	}
+	return ""
+}
+
+// diffAudit 按照字段名排序，新建时忽略空值
+func diffAudit(before, after map[string]interface{}) []*nosql.AuditChange {
+	keys := make(map[string]bool, len(after)+len(before))
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+	list := make([]*nosql.AuditChange, 0, 5)
+	for key := range keys {
+		if auditIgnores[key] {
+			continue
+		}
+		old := auditValue(before, key)
+		now := auditValue(after, key)
+		if old == now {
+			continue
+		}
+		if before == nil && isBlankValue(now) {
+			continue
+		}
+		list = append(list, &nosql.AuditChange{Field: key, Before: old, After: now})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Field < list[j].Field
+	})
+	return list
+}
+
+func auditValue(kv map[string]interface{}, key string) string {
+	if kv == nil {
+		return ""
+	}
+	value, ok := kv[key]
+	if !ok || value == nil {
+		return ""
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func isBlankValue(value string) bool {
+	switch value {
+	case "", "null", `""`, "0", "false", "[]", "{}", `"0001-01-01T00:00:00Z"`:
+		return true
+	}
+	return false
+}
+
+//endregion
+
+//region Scene
+func (mine *auditStore) CreateScene(ctx context.Context, info *nosql.Scene) error {
+	err := mine.Storage.CreateScene(ctx, info)
+	if err == nil {
+		mine.created(ctx, nosql.TableScene, info.UID.Hex(), info.Creator, info)
+	}
+	return err
+}
+
+func (mine *auditStore) UpdateSceneBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"name": name, "remark": remark, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateSceneBase(ctx, uid, name, remark, operator)
+	})
+}
+
+func (mine *auditStore) UpdateSceneMaster(ctx context.Context, uid, master, operator string) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"master": master, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateSceneMaster(ctx, uid, master, operator)
+	})
+}
+
+func (mine *auditStore) UpdateSceneCover(ctx context.Context, uid, icon, operator string) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"cover": icon, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateSceneCover(ctx, uid, icon, operator)
+	})
+}
+
+func (mine *auditStore) UpdateSceneType(ctx context.Context, uid, operator string, tp uint8) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"type": tp, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateSceneType(ctx, uid, operator, tp)
+	})
+}
+
+func (mine *auditStore) UpdateSceneLocal(ctx context.Context, uid, local, operator string) error {
+	geo, _ := nosql.ParseGeoPoint(local)
+	target := changed(nosql.TableScene, uid, bson.M{"location": local, "geo": geo, "operator": operator})
+	return mine.track(ctx, target, operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateSceneLocal(ctx, uid, local, operator)
+	})
+}
+
+func (mine *auditStore) UpdateSceneAddress(ctx context.Context, uid, operator string, address nosql.AddressInfo) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"address": address, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateSceneAddress(ctx, uid, operator, address)
+	})
+}
+
+func (mine *auditStore) UpdateSceneStatus(ctx context.Context, uid string, status uint8, operator string) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"status": status, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateSceneStatus(ctx, uid, status, operator)
+	})
+}
+
+func (mine *auditStore) AppendSceneQuestions(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"operator": operator}).add("questions", arr), operator, func(ctx context.Context) error {
+		return mine.Storage.AppendSceneQuestions(ctx, uid, operator, arr)
+	})
+}
+
+func (mine *auditStore) SubtractSceneQuestions(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"operator": operator}).pull("questions", arr), operator, func(ctx context.Context) error {
+		return mine.Storage.SubtractSceneQuestions(ctx, uid, operator, arr)
+	})
+}
+
+func (mine *auditStore) UpdateSceneLimit(ctx context.Context, uid, operator string, limit uint16) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"limit": limit, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateSceneLimit(ctx, uid, operator, limit)
+	})
+}
+
+func (mine *auditStore) UpdateSceneShort(ctx context.Context, uid, operator, name string) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"short": name, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateSceneShort(ctx, uid, operator, name)
+	})
+}
+
+func (mine *auditStore) UpdateSceneSupporter(ctx context.Context, uid, supporter, operator string) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"supporter": supporter, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateSceneSupporter(ctx, uid, supporter, operator)
+	})
+}
+
+func (mine *auditStore) UpdateSceneParents(ctx context.Context, uid, operator string, list []string) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, bson.M{"parents": list, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateSceneParents(ctx, uid, operator, list)
+	})
+}
+
+func (mine *auditStore) RemoveScene(ctx context.Context, uid, operator string) error {
+	return mine.track(ctx, opTarget(nosql.AuditRemove, nosql.RemoveOp(nosql.TableScene, uid, operator, time.Now())), operator, func(ctx context.Context) error {
+		return mine.Storage.RemoveScene(ctx, uid, operator)
+	})
+}
+
+func (mine *auditStore) RemoveSceneCascade(ctx context.Context, depends *nosql.SceneDepends, detach bool, operator string, stamp time.Time) error {
+	targets := opTargets(nosql.CascadeOps(depends, detach, operator, stamp))
+	return mine.trackMany(ctx, targets, operator, func(ctx context.Context) error {
+		return mine.Storage.RemoveSceneCascade(ctx, depends, detach, operator, stamp)
+	})
+}
+
+func (mine *auditStore) AppendSceneMember(ctx context.Context, uid string, member string) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, nil).add("members", []string{member}), "", func(ctx context.Context) error {
+		return mine.Storage.AppendSceneMember(ctx, uid, member)
+	})
+}
+
+func (mine *auditStore) SubtractSceneMember(ctx context.Context, uid, member string) error {
+	return mine.track(ctx, changed(nosql.TableScene, uid, nil).pull("members", []string{member}), "", func(ctx context.Context) error {
+		return mine.Storage.SubtractSceneMember(ctx, uid, member)
+	})
+}
+
+//endregion
+
+//region Group
+func (mine *auditStore) CreateGroup(ctx context.Context, info *nosql.Group) error {
+	err := mine.Storage.CreateGroup(ctx, info)
+	if err == nil {
+		mine.created(ctx, nosql.TableGroup, info.UID.Hex(), info.Creator, info)
+	}
+	return err
+}
+
+func (mine *auditStore) RemoveGroup(ctx context.Context, uid, operator string) error {
+	return mine.track(ctx, opTarget(nosql.AuditRemove, nosql.RemoveOp(nosql.TableGroup, uid, operator, time.Now())), operator, func(ctx context.Context) error {
+		return mine.Storage.RemoveGroup(ctx, uid, operator)
+	})
+}
+
+func (mine *auditStore) UpdateGroupBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.track(ctx, changed(nosql.TableGroup, uid, bson.M{"name": name, "remark": remark, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateGroupBase(ctx, uid, name, remark, operator)
+	})
+}
+
+func (mine *auditStore) UpdateGroupCover(ctx context.Context, uid, cover, operator string) error {
+	return mine.track(ctx, changed(nosql.TableGroup, uid, bson.M{"cover": cover, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateGroupCover(ctx, uid, cover, operator)
+	})
+}
+
+func (mine *auditStore) UpdateGroupMembers(ctx context.Context, uid, operator string, members []string) error {
+	return mine.track(ctx, changed(nosql.TableGroup, uid, bson.M{"members": members, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateGroupMembers(ctx, uid, operator, members)
+	})
+}
+
+func (mine *auditStore) UpdateGroupAddress(ctx context.Context, uid, operator string, address nosql.AddressInfo) error {
+	return mine.track(ctx, changed(nosql.TableGroup, uid, bson.M{"address": address, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateGroupAddress(ctx, uid, operator, address)
+	})
+}
+
+func (mine *auditStore) UpdateGroupLocation(ctx context.Context, uid, location, operator string) error {
+	geo, _ := nosql.ParseGeoPoint(location)
+	target := changed(nosql.TableGroup, uid, bson.M{"location": location, "geo": geo, "operator": operator})
+	return mine.track(ctx, target, operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateGroupLocation(ctx, uid, location, operator)
+	})
+}
+
+func (mine *auditStore) UpdateGroupContact(ctx context.Context, uid, phone, operator string) error {
+	return mine.track(ctx, changed(nosql.TableGroup, uid, bson.M{"contact": phone, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateGroupContact(ctx, uid, phone, operator)
+	})
+}
+
+func (mine *auditStore) UpdateGroupMaster(ctx context.Context, uid, member, operator string) error {
+	return mine.track(ctx, changed(nosql.TableGroup, uid, bson.M{"master": member, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateGroupMaster(ctx, uid, member, operator)
+	})
+}
+
+func (mine *auditStore) UpdateGroupAssistant(ctx context.Context, uid, member, operator string) error {
+	return mine.track(ctx, changed(nosql.TableGroup, uid, bson.M{"assistant": member, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateGroupAssistant(ctx, uid, member, operator)
+	})
+}
+
+func (mine *auditStore) AppendGroupMember(ctx context.Context, uid, member string) error {
+	return mine.track(ctx, changed(nosql.TableGroup, uid, nil).add("members", []string{member}), "", func(ctx context.Context) error {
+		return mine.Storage.AppendGroupMember(ctx, uid, member)
+	})
+}
+
+func (mine *auditStore) SubtractGroupMember(ctx context.Context, uid string, member string) error {
+	return mine.track(ctx, changed(nosql.TableGroup, uid, nil).pull("members", []string{member}), "", func(ctx context.Context) error {
+		return mine.Storage.SubtractGroupMember(ctx, uid, member)
+	})
+}
+
+//endregion
+
+//region Room
+func (mine *auditStore) CreateRoom(ctx context.Context, info *nosql.Room) error {
+	err := mine.Storage.CreateRoom(ctx, info)
+	if err == nil {
+		mine.created(ctx, nosql.TableRoom, info.UID.Hex(), info.Creator, info)
+	}
+	return err
+}
+
+func (mine *auditStore) RemoveRoom(ctx context.Context, uid, operator string) error {
+	return mine.track(ctx, opTarget(nosql.AuditRemove, nosql.RemoveOp(nosql.TableRoom, uid, operator, time.Now())), operator, func(ctx context.Context) error {
+		return mine.Storage.RemoveRoom(ctx, uid, operator)
+	})
+}
+
+func (mine *auditStore) UpdateRoomBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.track(ctx, changed(nosql.TableRoom, uid, bson.M{"name": name, "remark": remark, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateRoomBase(ctx, uid, name, remark, operator)
+	})
+}
+
+func (mine *auditStore) UpdateRoomDisplays(ctx context.Context, uid, operator string, list []*proxy.DisplayInfo) error {
+	return mine.track(ctx, changed(nosql.TableRoom, uid, bson.M{"displays": list, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateRoomDisplays(ctx, uid, operator, list)
+	})
+}
+
+func (mine *auditStore) AppendRoomQuotes(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.track(ctx, opTarget(nosql.AuditUpdate, nosql.RoomQuotesAddOp(uid, operator, arr)), operator, func(ctx context.Context) error {
+		return mine.Storage.AppendRoomQuotes(ctx, uid, operator, arr)
+	})
+}
+
+func (mine *auditStore) SubtractRoomQuotes(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.track(ctx, opTarget(nosql.AuditUpdate, nosql.RoomQuotesPullOp(uid, operator, arr)), operator, func(ctx context.Context) error {
+		return mine.Storage.SubtractRoomQuotes(ctx, uid, operator, arr)
+	})
+}
+
+//endregion
+
+//region Region
+func (mine *auditStore) CreateRegion(ctx context.Context, info *nosql.Region) error {
+	err := mine.Storage.CreateRegion(ctx, info)
+	if err == nil {
+		mine.created(ctx, nosql.TableRegion, info.UID.Hex(), info.Creator, info)
+	}
+	return err
+}
+
+func (mine *auditStore) RemoveRegion(ctx context.Context, uid, operator string) error {
+	return mine.track(ctx, opTarget(nosql.AuditRemove, nosql.RemoveOp(nosql.TableRegion, uid, operator, time.Now())), operator, func(ctx context.Context) error {
+		return mine.Storage.RemoveRegion(ctx, uid, operator)
+	})
+}
+
+func (mine *auditStore) UpdateRegionBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.track(ctx, changed(nosql.TableRegion, uid, bson.M{"name": name, "remark": remark, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateRegionBase(ctx, uid, name, remark, operator)
+	})
+}
+
+func (mine *auditStore) UpdateRegionMaster(ctx context.Context, uid, master, operator string) error {
+	return mine.track(ctx, changed(nosql.TableRegion, uid, bson.M{"master": master, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateRegionMaster(ctx, uid, master, operator)
+	})
+}
+
+func (mine *auditStore) UpdateRegionEntity(ctx context.Context, uid, entity, operator string) error {
+	return mine.track(ctx, changed(nosql.TableRegion, uid, bson.M{"entity": entity, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateRegionEntity(ctx, uid, entity, operator)
+	})
+}
+
+func (mine *auditStore) UpdateRegionParent(ctx context.Context, uid, parent, operator string) error {
+	return mine.track(ctx, changed(nosql.TableRegion, uid, bson.M{"parent": parent, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateRegionParent(ctx, uid, parent, operator)
+	})
+}
+
+func (mine *auditStore) UpdateRegionAddress(ctx context.Context, uid, operator string, address nosql.AddressInfo) error {
+	return mine.track(ctx, changed(nosql.TableRegion, uid, bson.M{"address": address, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateRegionAddress(ctx, uid, operator, address)
+	})
+}
+
+func (mine *auditStore) UpdateRegionLocation(ctx context.Context, uid, location, operator string) error {
+	geo, _ := nosql.ParseGeoPoint(location)
+	target := changed(nosql.TableRegion, uid, bson.M{"location": location, "geo": geo, "operator": operator})
+	return mine.track(ctx, target, operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateRegionLocation(ctx, uid, location, operator)
+	})
+}
+
+func (mine *auditStore) AppendRegionMember(ctx context.Context, uid string, member string) error {
+	return mine.track(ctx, changed(nosql.TableRegion, uid, nil).add("members", []string{member}), "", func(ctx context.Context) error {
+		return mine.Storage.AppendRegionMember(ctx, uid, member)
+	})
+}
+
+func (mine *auditStore) SubtractRegionMember(ctx context.Context, uid, member string) error {
+	return mine.track(ctx, changed(nosql.TableRegion, uid, nil).pull("members", []string{member}), "", func(ctx context.Context) error {
+		return mine.Storage.SubtractRegionMember(ctx, uid, member)
+	})
+}
+
+//endregion
+
+//region Area
+func (mine *auditStore) CreateArea(ctx context.Context, info *nosql.Area) error {
+	err := mine.Storage.CreateArea(ctx, info)
+	if err == nil {
+		mine.created(ctx, nosql.TableArea, info.UID.Hex(), info.Creator, info)
+	}
+	return err
+}
+
+func (mine *auditStore) UpdateAreaBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.track(ctx, changed(nosql.TableArea, uid, bson.M{"name": name, "remark": remark, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateAreaBase(ctx, uid, name, remark, operator)
+	})
+}
+
+func (mine *auditStore) UpdateAreaAssets(ctx context.Context, uid, operator string, assets []string) error {
+	return mine.track(ctx, changed(nosql.TableArea, uid, bson.M{"assets": assets, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateAreaAssets(ctx, uid, operator, assets)
+	})
+}
+
+func (mine *auditStore) UpdateAreaTemplate(ctx context.Context, uid, template, operator string) error {
+	return mine.track(ctx, changed(nosql.TableArea, uid, bson.M{"template": template, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateAreaTemplate(ctx, uid, template, operator)
+	})
+}
+
+func (mine *auditStore) UpdateAreaDevice(ctx context.Context, uid, device, operator string, tp uint32) error {
+	return mine.track(ctx, opTarget(nosql.AuditUpdate, nosql.AreaDeviceOp(uid, device, operator, tp)), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateAreaDevice(ctx, uid, device, operator, tp)
+	})
+}
+
+func (mine *auditStore) UpdateAreaCatalog(ctx context.Context, uid, catalog, operator string) error {
+	return mine.track(ctx, changed(nosql.TableArea, uid, bson.M{"catalog": catalog, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateAreaCatalog(ctx, uid, catalog, operator)
+	})
+}
+
+func (mine *auditStore) UpdateAreaDevice2(ctx context.Context, uid, device, operator string) error {
+	return mine.track(ctx, changed(nosql.TableArea, uid, bson.M{"device": device, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateAreaDevice2(ctx, uid, device, operator)
+	})
+}
+
+func (mine *auditStore) UpdateAreaType(ctx context.Context, uid, operator string, tp uint32) error {
+	return mine.track(ctx, changed(nosql.TableArea, uid, bson.M{"type": tp, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateAreaType(ctx, uid, operator, tp)
+	})
+}
+
+func (mine *auditStore) UpdateAreaQuestion(ctx context.Context, uid, question, operator string) error {
+	return mine.track(ctx, changed(nosql.TableArea, uid, bson.M{"question": question, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateAreaQuestion(ctx, uid, question, operator)
+	})
+}
+
+func (mine *auditStore) UpdateAreaLimit(ctx context.Context, uid, operator string, num uint32) error {
+	return mine.track(ctx, changed(nosql.TableArea, uid, bson.M{"limit": num, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateAreaLimit(ctx, uid, operator, num)
+	})
+}
+
+func (mine *auditStore) UpdateAreaDisplays(ctx context.Context, uid, operator string, displays []string) error {
+	return mine.track(ctx, changed(nosql.TableArea, uid, bson.M{"displays": displays, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateAreaDisplays(ctx, uid, operator, displays)
+	})
+}
+
+func (mine *auditStore) SetAreaModule(ctx context.Context, uid, operator, key, value string) error {
+	return mine.track(ctx, &auditTarget{table: nosql.TableArea, uid: uid, action: nosql.AuditUpdate}, operator, func(ctx context.Context) error {
+		return mine.Storage.SetAreaModule(ctx, uid, operator, key, value)
+	})
+}
+
+func (mine *auditStore) SetAreaSource(ctx context.Context, uid, operator, key, value string) error {
+	return mine.track(ctx, &auditTarget{table: nosql.TableArea, uid: uid, action: nosql.AuditUpdate}, operator, func(ctx context.Context) error {
+		return mine.Storage.SetAreaSource(ctx, uid, operator, key, value)
+	})
+}
+
+func (mine *auditStore) RemoveArea(ctx context.Context, uid, operator string) error {
+	return mine.track(ctx, opTarget(nosql.AuditRemove, nosql.RemoveOp(nosql.TableArea, uid, operator, time.Now())), operator, func(ctx context.Context) error {
+		return mine.Storage.RemoveArea(ctx, uid, operator)
+	})
+}
+
+//endregion
+
+//region Device
+func (mine *auditStore) CreateDevice(ctx context.Context, info *nosql.Invite) error {
+	err := mine.Storage.CreateDevice(ctx, info)
+	if err == nil {
+		mine.created(ctx, nosql.TableDevice, info.UID.Hex(), info.Creator, info)
+	}
+	return err
+}
+
+func (mine *auditStore) RemoveDevice(ctx context.Context, uid, operator string) error {
+	return mine.track(ctx, opTarget(nosql.AuditRemove, nosql.RemoveOp(nosql.TableDevice, uid, operator, time.Now())), operator, func(ctx context.Context) error {
+		return mine.Storage.RemoveDevice(ctx, uid, operator)
+	})
+}
+
+func (mine *auditStore) UpdateDeviceBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.track(ctx, changed(nosql.TableDevice, uid, bson.M{"name": name, "remark": remark, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateDeviceBase(ctx, uid, name, remark, operator)
+	})
+}
+
+func (mine *auditStore) UpdateDeviceTime(ctx context.Context, uid, operator string, act, expiry uint64) error {
+	return mine.track(ctx, changed(nosql.TableDevice, uid, bson.M{"activated": act, "expiry": expiry, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateDeviceTime(ctx, uid, operator, act, expiry)
+	})
+}
+
+func (mine *auditStore) UpdateDeviceCertificate(ctx context.Context, uid, data, operator string) error {
+	return mine.track(ctx, changed(nosql.TableDevice, uid, bson.M{"certificate": data, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateDeviceCertificate(ctx, uid, data, operator)
+	})
+}
+
+func (mine *auditStore) UpdateDeviceScene(ctx context.Context, uid, data, operator string) error {
+	return mine.track(ctx, changed(nosql.TableDevice, uid, bson.M{"scene": data, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateDeviceScene(ctx, uid, data, operator)
+	})
+}
+
+func (mine *auditStore) UpdateDeviceAspect(ctx context.Context, uid, data, operator string) error {
+	return mine.track(ctx, changed(nosql.TableDevice, uid, bson.M{"aspect": data, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateDeviceAspect(ctx, uid, data, operator)
+	})
+}
+
+func (mine *auditStore) BindDevice(ctx context.Context, uid, quote, os, operator string, act, expiry uint64) error {
+	return mine.track(ctx, changed(nosql.TableDevice, uid, bson.M{"quote": quote, "os": os, "activated": act, "expiry": expiry,
+		"operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.BindDevice(ctx, uid, quote, os, operator, act, expiry)
+	})
+}
+
+func (mine *auditStore) UpdateDeviceStatus(ctx context.Context, uid, operator string, st uint8) error {
+	return mine.track(ctx, changed(nosql.TableDevice, uid, bson.M{"status": st, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateDeviceStatus(ctx, uid, operator, st)
+	})
+}
+
+func (mine *auditStore) UpdateDeviceMeta(ctx context.Context, uid, meta, operator string) error {
+	return mine.track(ctx, changed(nosql.TableDevice, uid, bson.M{"meta": meta, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateDeviceMeta(ctx, uid, meta, operator)
+	})
+}
+
+func (mine *auditStore) UpdateDeviceAuto(ctx context.Context, uid, operator string, auto proxy.AutoInfo) error {
+	return mine.track(ctx, changed(nosql.TableDevice, uid, bson.M{"auto": auto, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateDeviceAuto(ctx, uid, operator, auto)
+	})
+}
+
+func (mine *auditStore) UpdateDeviceType(ctx context.Context, uid, operator string, tp uint8) error {
+	return mine.track(ctx, changed(nosql.TableDevice, uid, bson.M{"type": tp, "operator": operator}), operator, func(ctx context.Context) error {
+		return mine.Storage.UpdateDeviceType(ctx, uid, operator, tp)
+	})
+}
+
+//endregion
+
+//region Maintain
+func (mine *auditStore) CreateMaintain(ctx context.Context, info *nosql.Maintain) error {
+	err := mine.Storage.CreateMaintain(ctx, info)
+	if err == nil {
+		mine.created(ctx, nosql.TableMaintain, info.UID.Hex(), info.Creator, info)
+	}
+	return err
+}
+
+func (mine *auditStore) RemoveMaintain(ctx context.Context, uid, operator string) error {
+	return mine.track(ctx, opTarget(nosql.AuditRemove, nosql.RemoveOp(nosql.TableMaintain, uid, operator, time.Now())), operator, func(ctx context.Context) error {
+		return mine.Storage.RemoveMaintain(ctx, uid, operator)
+	})
+}
+
+//endregion
+
+//region Recycle
+func (mine *auditStore) RestoreRecycle(ctx context.Context, table, uid, operator string) error {
+	return mine.track(ctx, opTarget(nosql.AuditRestore, nosql.RestoreOp(table, uid, operator)), operator, func(ctx context.Context) error {
+		return mine.Storage.RestoreRecycle(ctx, table, uid, operator)
+	})
+}
+
+func (mine *auditStore) PurgeRecycle(ctx context.Context, table, uid string) error {
+	return mine.track(ctx, &auditTarget{table: table, uid: uid, action: nosql.AuditPurge}, "", func(ctx context.Context) error {
+		return mine.Storage.PurgeRecycle(ctx, table, uid)
+	})
+}
+
+// RunTransaction 同一个文档的多个写操作只记录一次
+func (mine *auditStore) RunTransaction(ctx context.Context, ops []*nosql.WriteOp) error {
+	operator := ""
+	for _, op := range ops {
+		if name, ok := op.Fields["operator"].(string); ok && len(name) > 0 {
+			operator = name
+			break
+		}
+	}
+	return mine.trackMany(ctx, opTargets(ops), operator, func(ctx context.Context) error {
+		return mine.Storage.RunTransaction(ctx, ops)
+	})
+}
+
+//endregion
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
+	"omo.msa.organization/proxy/memory"
+	"omo.msa.organization/proxy/nosql"
+)
+
+func TestAuditChanges(t *testing.T) {
+	initMemory(t)
+	scene := createScene(t, "museum", "")
+	ctx := WithPath(context.Background(), "SceneService.UpdateBase")
+	if err := scene.UpdateBase(ctx, "museum-2", "remark", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err := scene.UpdateQuestions(ctx, "tester", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := GetAudits(&nosql.AuditFilter{Scene: scene.UID, Table: nosql.TableScene})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("the audits number should be 3 but %d", len(list))
+	}
+	questions, base := list[0], list[1]
+	if base.Path != "SceneService.UpdateBase" || questions.Path != "SceneService.UpdateBase" {
+		t.Fatalf("the audit path is error: %s, %s", base.Path, questions.Path)
+	}
+	if list[2].Action != nosql.AuditCreate || len(list[2].Path) > 0 {
+		t.Fatalf("the create audit is error: %s, %s", list[2].Action, list[2].Path)
+	}
+	if len(base.Changes) != 2 || base.Changes[0].Field != "name" || base.Changes[0].After != `"museum-2"` ||
+		base.Changes[1].Field != "remark" {
+		t.Fatalf("the changes of base is error: %v", base.Changes)
+	}
+	if len(questions.Changes) != 1 || questions.Changes[0].After != `["a","b"]` {
+		t.Fatalf("the changes of questions is error: %v", questions.Changes)
+	}
+}
+
+// racingStore 读取修改前的对象之后，写入之前有其他的写入
+type racingStore struct {
+	*memory.Storage
+}
+
+func (mine *racingStore) UpdateRoomBase(ctx context.Context, uid, name, remark, operator string) error {
+	if err := mine.Storage.AppendRoomQuotes(context.Background(), uid, "other", []string{"quote"}); err != nil {
+		return err
+	}
+	return mine.Storage.UpdateRoomBase(ctx, uid, name, remark, operator)
+}
+
+func TestAuditAfterWrite(t *testing.T) {
+	ctx := context.Background()
+	if err := InitDataBy(&racingStore{Storage: memory.NewStorage()}); err != nil {
+		t.Fatal(err)
+	}
+	scene := createScene(t, "museum", "")
+	room, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "room", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = room.UpdateBase(ctx, "room-2", "", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	//修改后的对象是存储写入时返回的，包含其他的写入
+	list, err := GetAudits(&nosql.AuditFilter{Target: room.UID})
+	if err != nil || len(list) != 2 {
+		t.Fatalf("the audits of room is error: %v, %d", err, len(list))
+	}
+	changes := make(map[string]string, 2)
+	for _, item := range list[0].Changes {
+		changes[item.Field] = item.After
+	}
+	if changes["name"] != `"room-2"` || changes["quotes"] != `["quote"]` {
+		t.Fatalf("the changes should be read from the written room but %v", changes)
+	}
+	revisions, err := cacheCtx.GetRevisions(nosql.TableRoom, room.UID, 10)
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("the revisions of room is error: %v, %d", err, len(revisions))
+	}
+	if revisions[0].Version != 2 || !strings.Contains(revisions[0].Data, `"quotes":["quote"]`) {
+		t.Fatalf("the revision should be the written room but %d, %s", revisions[0].Version, revisions[0].Data)
+	}
+}
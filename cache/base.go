@@ -1,9 +1,13 @@
 package cache
 
 import (
+	"errors"
 	"github.com/micro/go-micro/v2/logger"
 	"omo.msa.organization/config"
+	"omo.msa.organization/proxy/memory"
+	"omo.msa.organization/proxy/mysql"
 	"omo.msa.organization/proxy/nosql"
+	"sync"
 	"time"
 )
 
@@ -17,64 +21,346 @@ type baseInfo struct {
 	UpdateTime time.Time
 }
 
+/**
+缓存上下文，所有的集合以及索引由lock保护，
+加锁顺序：可以在持有SceneInfo.lock时获取cacheContext.lock，反之不可以
+*/
 type cacheContext struct {
-	scenes []*SceneInfo
+	lock     sync.RWMutex
+	scenes   []*SceneInfo            //保持加载顺序，用于分页
+	sceneMap map[string]*SceneInfo   //uid -> scene
+	masters  map[string]*SceneInfo   //master -> scene
+	members  map[string][]*SceneInfo //member -> scenes
+	rooms    map[string]*RoomInfo    //room uid -> room
+	regions  map[string]*RegionInfo  //region uid -> region
+	devices  map[string]*areaIndex   //device sn -> area
+	areas    map[string]string       //area uid -> device sn
+	registry *deviceRegistry         //终端注册表
+	search   *searchIndex            //全文搜索
 }
 
-var cacheCtx *cacheContext
+type areaIndex struct {
+	device string
+	area   string
+}
 
-func InitData() error {
-	cacheCtx = &cacheContext{}
-	cacheCtx.scenes = make([]*SceneInfo, 0, 200)
+var cacheCtx = newCacheContext()
+
+var store nosql.Storage
 
-	err := nosql.InitDB(config.Schema.Database.IP, config.Schema.Database.Port, config.Schema.Database.Name, config.Schema.Database.Type)
+func InitData() error {
+	conf := config.Schema.Database
+	if conf.Type == "memory" {
+		return InitDataBy(memory.NewStorage())
+	} else if conf.Type == mysql.KindMysql || conf.Type == mysql.KindSqlite {
+		storage, err := mysql.Open(conf.Type, conf.User, conf.Password, conf.IP, conf.Port, conf.Name)
+		if nil != err {
+			return err
+		}
+		return initWarm(storage)
+	}
+	err := nosql.InitDB(connectOptions(&conf), conf.Name, conf.Type)
 	if nil != err {
 		return err
 	}
+	return initWarm(nosql.MongoStorage())
+}
 
-	scenes, err := nosql.GetAllScenes()
+func connectOptions(conf *config.DBConfig) *nosql.ConnectOptions {
+	return &nosql.ConnectOptions{
+		URI:        conf.URI,
+		Hosts:      nosql.ParseHosts(conf.IP, conf.Port),
+		User:       conf.User,
+		Password:   conf.Password,
+		AuthSource: conf.AuthSource,
+		Replica:    conf.Replica,
+		TLS:        conf.TLS.Enable,
+		CAFile:     conf.TLS.CA,
+		CertFile:   conf.TLS.Cert,
+		KeyFile:    conf.TLS.Key,
+		Insecure:   conf.TLS.Insecure,
+		MaxPool:    conf.Pool.Max,
+		MinPool:    conf.Pool.Min,
+		IdleTime:   time.Duration(conf.Pool.Idle) * time.Second,
+		Threshold:  time.Duration(conf.Pool.Threshold) * time.Millisecond,
+		Timeout:    time.Duration(conf.Pool.Timeout) * time.Second,
+	}
+}
+
+// InitDataBy 使用指定的存储初始化缓存，单元测试或者本地演示时可以传入内存存储
+func InitDataBy(storage nosql.Storage) error {
+	err := useStorage(storage)
+	if err != nil {
+		return err
+	}
+	list := make([]*SceneInfo, 0, 200)
+	scenes, err := store.GetAllScenes()
 	if err == nil {
 		for _, scene := range scenes {
 			tmp := new(SceneInfo)
 			tmp.initInfo(scene)
-			cacheCtx.scenes = append(cacheCtx.scenes, tmp)
+			list = append(list, tmp)
 		}
 	}
-	logger.Infof("init scenes that number = %d", len(cacheCtx.scenes))
+	cacheCtx.reset(list)
+	logger.Infof("init scenes that number = %d", len(list))
 
 	return nil
 }
 
-func Context() *cacheContext {
-	return cacheCtx
+// useStorage 包装审计并且修复落后的序列
+func useStorage(storage nosql.Storage) error {
+	if storage == nil {
+		return errors.New("the storage is nil")
+	}
+	store = wrapAudit(storage)
+	repairs, err := store.RepairSequences()
+	if err != nil {
+		logger.Warnf("check the sequences failed that err = %s", err.Error())
+	}
+	for _, item := range repairs {
+		logger.Warnf("repair the sequence %s from %d to %d", item.Name, item.Count, item.Max)
+	}
+	return nil
+}
+
+func newCacheContext() *cacheContext {
+	tmp := new(cacheContext)
+	tmp.reset(nil)
+	return tmp
+}
+
+// reset 重新加载时替换全部的集合以及索引
+func (mine *cacheContext) reset(list []*SceneInfo) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	mine.scenes = make([]*SceneInfo, 0, len(list)+10)
+	mine.sceneMap = make(map[string]*SceneInfo, len(list)+10)
+	mine.masters = make(map[string]*SceneInfo, len(list)+10)
+	mine.members = make(map[string][]*SceneInfo, 100)
+	mine.rooms = make(map[string]*RoomInfo, 100)
+	mine.regions = make(map[string]*RegionInfo, 100)
+	mine.devices = make(map[string]*areaIndex, 100)
+	mine.areas = make(map[string]string, 100)
+	mine.registry = newDeviceRegistry()
+	mine.search = newSearchIndex()
+	for _, info := range list {
+		mine.addSceneLocked(info)
+	}
+}
+
+// addScene 添加到缓存，已经存在时返回缓存中的
+func (mine *cacheContext) addScene(info *SceneInfo) *SceneInfo {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.addSceneLocked(info)
+}
+
+func (mine *cacheContext) addSceneLocked(info *SceneInfo) *SceneInfo {
+	if tmp, ok := mine.sceneMap[info.UID]; ok {
+		return tmp
+	}
+	mine.scenes = append(mine.scenes, info)
+	mine.sceneMap[info.UID] = info
+	if len(info.Master) > 0 {
+		mine.masters[info.Master] = info
+	}
+	for _, member := range info.members {
+		mine.members[member] = append(mine.members[member], info)
+	}
+	return info
+}
+
+func (mine *cacheContext) removeScene(info *SceneInfo) {
+	info.lock.RLock()
+	defer info.lock.RUnlock()
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	delete(mine.sceneMap, info.UID)
+	for i := 0; i < len(mine.scenes); i += 1 {
+		if mine.scenes[i].UID == info.UID {
+			mine.scenes = append(mine.scenes[:i:i], mine.scenes[i+1:]...)
+			break
+		}
+	}
+	if mine.masters[info.Master] == info {
+		delete(mine.masters, info.Master)
+	}
+	for _, member := range info.members {
+		mine.unindexMemberLocked(member, info)
+	}
+	for _, room := range info.rooms {
+		delete(mine.rooms, room.UID)
+	}
+	for _, region := range info.regions {
+		delete(mine.regions, region.UID)
+	}
+}
+
+// reindexScene 场景同步后使用修改前的管理员以及成员更新索引
+func (mine *cacheContext) reindexScene(info *SceneInfo, master string, members []string) {
+	info.lock.RLock()
+	defer info.lock.RUnlock()
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if mine.sceneMap[info.UID] != info {
+		return
+	}
+	if master != info.Master && mine.masters[master] == info {
+		delete(mine.masters, master)
+	}
+	if len(info.Master) > 0 {
+		mine.masters[info.Master] = info
+	}
+	for _, member := range members {
+		mine.unindexMemberLocked(member, info)
+	}
+	for _, member := range info.members {
+		mine.members[member] = append(mine.members[member], info)
+	}
+}
+
+func (mine *cacheContext) lookupScene(uid string) *SceneInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.sceneMap[uid]
+}
+
+// allScenes 返回场景列表的副本，调用者可以安全的遍历
+func (mine *cacheContext) allScenes() []*SceneInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	list := make([]*SceneInfo, len(mine.scenes))
+	copy(list, mine.scenes)
+	return list
 }
 
-func checkPage[T any](page, number uint32, all []T) (uint32, uint32, []T) {
-	if len(all) < 1 {
-		return 0, 0, make([]T, 0, 1)
+// claimMaster 占用管理员，已经被其他场景占用时返回false
+func (mine *cacheContext) claimMaster(master string, info *SceneInfo) bool {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if tmp, ok := mine.masters[master]; ok && tmp != info {
+		return false
 	}
-	if number < 1 {
-		number = 10
+	mine.masters[master] = info
+	return true
+}
+
+func (mine *cacheContext) releaseMaster(master string, info *SceneInfo) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if mine.masters[master] == info {
+		delete(mine.masters, master)
 	}
-	total := uint32(len(all))
-	if len(all) <= int(number) {
-		return total, 1, all
+}
+
+func (mine *cacheContext) indexMember(member string, info *SceneInfo) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	mine.members[member] = append(mine.members[member], info)
+}
+
+func (mine *cacheContext) unindexMember(member string, info *SceneInfo) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	mine.unindexMemberLocked(member, info)
+}
+
+func (mine *cacheContext) unindexMemberLocked(member string, info *SceneInfo) {
+	arr := mine.members[member]
+	for i := 0; i < len(arr); i += 1 {
+		if arr[i] == info {
+			arr = append(arr[:i:i], arr[i+1:]...)
+			break
+		}
 	}
-	maxPage := total/number + 1
-	if page < 1 {
-		return total, maxPage, all
+	if len(arr) < 1 {
+		delete(mine.members, member)
+	} else {
+		mine.members[member] = arr
 	}
-	if page > maxPage {
-		page = maxPage
+}
+
+func (mine *cacheContext) indexRooms(list ...*RoomInfo) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	for _, room := range list {
+		mine.rooms[room.UID] = room
 	}
-	var start = (page - 1) * number
-	var end = start + number
-	if end >= total {
-		end = total
+}
+
+func (mine *cacheContext) unindexRoom(uid string) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	delete(mine.rooms, uid)
+}
+
+func (mine *cacheContext) lookupRoom(uid string) *RoomInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.rooms[uid]
+}
+
+func (mine *cacheContext) indexRegions(list ...*RegionInfo) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	for _, region := range list {
+		mine.regions[region.UID] = region
 	}
-	list := make([]T, 0, number)
-	list = append(all[start:end])
-	return total, maxPage, list
+}
+
+func (mine *cacheContext) unindexRegion(uid string) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	delete(mine.regions, uid)
+}
+
+func (mine *cacheContext) lookupRegion(uid string) *RegionInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.regions[uid]
+}
+
+func (mine *cacheContext) terminals() *deviceRegistry {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.registry
+}
+
+func (mine *cacheContext) searches() *searchIndex {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.search
+}
+
+func (mine *cacheContext) lookupArea(sn string) *areaIndex {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.devices[sn]
+}
+
+func (mine *cacheContext) indexArea(sn, device, area string) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if old, ok := mine.areas[area]; ok {
+		delete(mine.devices, old)
+	}
+	mine.devices[sn] = &areaIndex{device: device, area: area}
+	mine.areas[area] = sn
+}
+
+// unindexArea 区域的设备变化或者删除后移除索引
+func (mine *cacheContext) unindexArea(area string) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if sn, ok := mine.areas[area]; ok {
+		delete(mine.devices, sn)
+		delete(mine.areas, area)
+	}
+}
+
+func Context() *cacheContext {
+	return cacheCtx
 }
 
 //func SwitchAreaToProduct(info *AreaInfo) *pb.ProductInfo {
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
+	"omo.msa.organization/proxy/memory"
+	"omo.msa.organization/proxy/nosql"
+)
+
+// initMemory 每个测试使用独立的内存存储
+func initMemory(t *testing.T) nosql.Storage {
+	t.Helper()
+	storage := memory.NewStorage()
+	if err := InitDataBy(storage); err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+// createScene 创建时不保存管理员，需要单独设置
+func createScene(t *testing.T, name, master string) *SceneInfo {
+	t.Helper()
+	ctx := context.Background()
+	info := new(SceneInfo)
+	info.Name = name
+	info.Creator = "tester"
+	info.Operator = "tester"
+	if err := cacheCtx.CreateScene(ctx, info); err != nil {
+		t.Fatal(err)
+	}
+	if len(master) > 0 {
+		if err := info.UpdateMaster(ctx, master, "tester"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return info
+}
+
+func TestMemoryStorageReload(t *testing.T) {
+	ctx := context.Background()
+	storage := initMemory(t)
+	scene := createScene(t, "museum", "master-1")
+	if err := scene.UpdateBase(ctx, "museum-2", "remark", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err := scene.AppendMember(ctx, "member-1"); err != nil {
+		t.Fatal(err)
+	}
+	room, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "room", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = scene.CreateGroup(ctx, &pb.ReqGroupAdd{Scene: scene.UID, Name: "group", Operator: "tester"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = scene.CreateRegion(ctx, &pb.ReqRegionAdd{Scene: scene.UID, Name: "region", Operator: "tester"}); err != nil {
+		t.Fatal(err)
+	}
+
+	//重新加载后和写入的数据一致
+	if err = InitDataBy(storage); err != nil {
+		t.Fatal(err)
+	}
+	info := cacheCtx.GetScene(scene.UID)
+	if info == nil {
+		t.Fatal("not found the scene after reload")
+	}
+	if info.Name != "museum-2" || info.Remark != "remark" {
+		t.Fatalf("the scene base not saved: %s %s", info.Name, info.Remark)
+	}
+	if cacheCtx.GetSceneByMember("member-1") != info || !IsMasterUsed("master-1") {
+		t.Fatal("the member or master index not rebuilt")
+	}
+	if info.GetRoom(room.UID) == nil || len(info.groupList()) != 1 || len(info.regionList()) != 1 {
+		t.Fatal("the children not loaded from the storage")
+	}
+	if cacheCtx.GetRoom(room.UID) == nil {
+		t.Fatal("the room index not rebuilt")
+	}
+}
+
+func TestMemoryStorageRemove(t *testing.T) {
+	ctx := context.Background()
+	initMemory(t)
+	scene := createScene(t, "museum", "")
+	if err := RemoveScene(ctx, scene.UID, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if cacheCtx.GetScene(scene.UID) != nil {
+		t.Fatal("the scene still in the cache")
+	}
+	db, err := store.GetScene(scene.UID)
+	if err != nil || db.DeleteTime.IsZero() {
+		t.Fatal("the scene not marked as deleted")
+	}
+}
+
+func TestSceneRemoveModes(t *testing.T) {
+	ctx := context.Background()
+	initMemory(t)
+	scene := createScene(t, "museum", "")
+	room, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "room", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	depends, err := GetSceneDepends(scene.UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depends.Total() != 1 {
+		t.Fatalf("the depends should be 1 but %d", depends.Total())
+	}
+	if _, err = RemoveSceneBy(ctx, scene.UID, "tester", SceneRemoveStrict); err != ErrSceneDepends {
+		t.Fatalf("the strict mode should refuse but %v", err)
+	}
+	//默认只删除场景，房间保持不变
+	if _, err = RemoveSceneBy(ctx, scene.UID, "tester", SceneRemoveOnly); err != nil {
+		t.Fatal(err)
+	}
+	db, err := store.GetRoom(room.UID)
+	if err != nil || !db.DeleteTime.IsZero() {
+		t.Fatal("the room should not be removed")
+	}
+}
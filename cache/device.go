@@ -1,9 +1,12 @@
 package cache
 
 import (
+	"context"
+	"errors"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"omo.msa.organization/proxy"
 	"omo.msa.organization/proxy/nosql"
+	"sync"
 	"time"
 )
 
@@ -32,6 +35,8 @@ type DeviceInfo struct {
 	Meta        string         //终端配置
 	Auto        proxy.AutoInfo //自动开关机
 	Assets      []string       //照片
+	//保护导出的字段，UID以及CreateTime不会修改，注册表建立索引时也需要持有读锁
+	lock sync.RWMutex
 }
 
 func (mine *DeviceInfo) initInfo(db *nosql.Invite) {
@@ -43,6 +48,7 @@ func (mine *DeviceInfo) initInfo(db *nosql.Invite) {
 	mine.Operator = db.Operator
 	mine.Name = db.Name
 	mine.Remark = db.Remark
+	mine.Status = db.Status
 	mine.Scene = db.Scene
 	mine.OS = db.OS
 	mine.Quote = db.Quote
@@ -57,124 +63,183 @@ func (mine *DeviceInfo) initInfo(db *nosql.Invite) {
 
 }
 
-func (mine *DeviceInfo) UpdateBase(name, remark, operator string) error {
-	err := nosql.UpdateDeviceBase(mine.UID, name, remark, operator)
-	if err == nil {
-		mine.Name = name
-		mine.Remark = remark
+// update 写数据库成功后修改缓存的字段，读取字段需要持有读锁或者使用Clone
+func (mine *DeviceInfo) update(operator string, fun func()) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	fun()
+	if len(operator) > 0 {
 		mine.Operator = operator
 	}
-	return err
 }
 
-func (mine *DeviceInfo) UpdateCertificate(data, operator string) error {
-	err := nosql.UpdateDeviceCertificate(mine.UID, data, operator)
+// Clone 字段以及引用的副本，用于返回给调用者，不能用于修改
+func (mine *DeviceInfo) Clone() *DeviceInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	tmp := new(DeviceInfo)
+	tmp.baseInfo = mine.baseInfo
+	tmp.Status = mine.Status
+	tmp.Type = mine.Type
+	tmp.Remark = mine.Remark
+	tmp.Scene = mine.Scene
+	tmp.OS = mine.OS
+	tmp.Quote = mine.Quote
+	tmp.SN = mine.SN
+	tmp.Aspect = mine.Aspect
+	tmp.ActiveTime = mine.ActiveTime
+	tmp.Expired = mine.Expired
+	tmp.Certificate = mine.Certificate
+	tmp.Meta = mine.Meta
+	tmp.Auto = mine.Auto
+	tmp.Assets = append(make([]string, 0, len(mine.Assets)), mine.Assets...)
+	return tmp
+}
+
+// keys 建立索引以及计算状态使用的字段
+func (mine *DeviceInfo) keys() deviceKeys {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return deviceKeys{sn: mine.SN, scene: mine.Scene, quote: mine.Quote, status: mine.Status}
+}
+
+func (mine *DeviceInfo) UpdateBase(ctx context.Context, name, remark, operator string) error {
+	err := store.UpdateDeviceBase(ctx, mine.UID, name, remark, operator)
 	if err == nil {
-		mine.Certificate = data
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Name = name
+			mine.Remark = remark
+		})
 	}
 	return err
 }
 
-func (mine *DeviceInfo) UpdateScene(data, operator string) error {
-	err := nosql.UpdateDeviceScene(mine.UID, data, operator)
+func (mine *DeviceInfo) UpdateCertificate(ctx context.Context, data, operator string) error {
+	err := store.UpdateDeviceCertificate(ctx, mine.UID, data, operator)
 	if err == nil {
-		mine.Scene = data
-		mine.Operator = operator
-		mine.updateStatus(operator)
+		mine.update(operator, func() {
+			mine.Certificate = data
+		})
 	}
 	return err
 }
 
-func (mine *DeviceInfo) UpdateAspect(data, operator string) error {
-	err := nosql.UpdateDeviceAspect(mine.UID, data, operator)
+func (mine *DeviceInfo) UpdateScene(ctx context.Context, data, operator string) error {
+	keys := mine.keys()
+	st := nextStatus(keys.status, data, keys.quote)
+	err := store.RunTransaction(ctx, []*nosql.WriteOp{nosql.DeviceSceneOp(mine.UID, data, operator, st)})
 	if err == nil {
-		mine.Aspect = data
-		mine.Operator = operator
-		mine.UpdateTime = time.Now()
+		mine.update(operator, func() {
+			mine.Scene = data
+			mine.Status = st
+		})
+		cacheCtx.terminals().update(mine)
 	}
 	return err
 }
 
-func (mine *DeviceInfo) updateStatus(operator string) {
-	if mine.Status == DeviceDiscard {
-		return
+func (mine *DeviceInfo) UpdateAspect(ctx context.Context, data, operator string) error {
+	err := store.UpdateDeviceAspect(ctx, mine.UID, data, operator)
+	if err == nil {
+		mine.update(operator, func() {
+			mine.Aspect = data
+			mine.UpdateTime = time.Now()
+		})
 	}
-	st := DeviceIdle
-	if len(mine.Scene) > 2 && len(mine.Quote) > 2 {
-		st = DeviceUsing
-	} else if len(mine.Scene) > 2 && len(mine.Quote) < 2 {
-		st = DevicePendSleep
-	} else if len(mine.Scene) < 2 && len(mine.Quote) > 2 {
-		st = DeviceAwake
-	} else {
-		return
+	return err
+}
+
+// nextStatus 根据场景以及激活状态计算设备状态，废弃的设备保持不变
+func nextStatus(old uint8, scene, quote string) uint8 {
+	if old == DeviceDiscard {
+		return old
 	}
-	er := nosql.UpdateDeviceStatus(mine.UID, operator, uint8(st))
-	if er == nil {
-		mine.Status = uint8(st)
+	if len(scene) > 2 && len(quote) > 2 {
+		return DeviceUsing
+	} else if len(scene) > 2 && len(quote) < 2 {
+		return DevicePendSleep
+	} else if len(scene) < 2 && len(quote) > 2 {
+		return DeviceAwake
 	}
+	return old
 }
 
-func (mine *DeviceInfo) UpdateType(operator string, tp uint8) error {
-	err := nosql.UpdateDeviceType(mine.UID, operator, tp)
+func (mine *DeviceInfo) UpdateType(ctx context.Context, operator string, tp uint8) error {
+	err := store.UpdateDeviceType(ctx, mine.UID, operator, tp)
 	if err == nil {
-		mine.Type = tp
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Type = tp
+		})
 	}
 	return err
 }
 
-func (mine *DeviceInfo) UpdateStatus(operator string, st uint8) error {
-	err := nosql.UpdateDeviceStatus(mine.UID, operator, st)
+func (mine *DeviceInfo) UpdateStatus(ctx context.Context, operator string, st uint8) error {
+	err := store.UpdateDeviceStatus(ctx, mine.UID, operator, st)
 	if err == nil {
-		mine.Status = st
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Status = st
+		})
+		cacheCtx.terminals().update(mine)
 	}
 	return err
 }
 
-func (mine *DeviceInfo) UpdateAuto(operator, begin, end string) error {
+func (mine *DeviceInfo) UpdateAuto(ctx context.Context, operator, begin, end string) error {
 	auto := proxy.AutoInfo{Begin: begin, Stop: end}
-	err := nosql.UpdateDeviceAuto(mine.UID, operator, auto)
+	err := store.UpdateDeviceAuto(ctx, mine.UID, operator, auto)
 	if err == nil {
-		mine.Auto = auto
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Auto = auto
+		})
 	}
 	return err
 }
 
-func (mine *DeviceInfo) UpdateMeta(operator, meta string) error {
-	err := nosql.UpdateDeviceMeta(mine.UID, meta, operator)
+func (mine *DeviceInfo) UpdateMeta(ctx context.Context, operator, meta string) error {
+	err := store.UpdateDeviceMeta(ctx, mine.UID, meta, operator)
 	if err == nil {
-		mine.Meta = meta
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Meta = meta
+		})
 	}
 	return err
 }
 
-func (mine *DeviceInfo) Bind(quote, os, operator string, act, expired uint64) error {
-	err := nosql.BindDevice(mine.UID, quote, os, operator, act, expired)
+func (mine *DeviceInfo) Bind(ctx context.Context, quote, os, operator string, act, expired uint64) error {
+	keys := mine.keys()
+	st := nextStatus(keys.status, keys.scene, quote)
+	err := store.RunTransaction(ctx, []*nosql.WriteOp{nosql.DeviceBindOp(mine.UID, quote, os, operator, act, expired, st)})
 	if err == nil {
-		mine.Quote = quote
-		mine.OS = os
-		mine.ActiveTime = int64(act)
-		mine.Expired = uint32(expired)
-		mine.Operator = operator
-		mine.updateStatus(operator)
+		mine.update(operator, func() {
+			mine.Quote = quote
+			mine.OS = os
+			mine.ActiveTime = int64(act)
+			mine.Expired = uint32(expired)
+			mine.Status = st
+		})
+		cacheCtx.terminals().update(mine)
 	}
 	return err
 }
 
-func (mine *DeviceInfo) Remove(operator string) error {
-	return nosql.RemoveDevice(mine.UID, operator)
+func (mine *DeviceInfo) Remove(ctx context.Context, operator string) error {
+	err := store.RemoveDevice(ctx, mine.UID, operator)
+	if err == nil {
+		cacheCtx.terminals().drop(mine.UID)
+	}
+	return err
 	//return nosql.UpdateDeviceStatus(mine.UID, operator, DeviceDiscard)
 }
 
-func (mine *cacheContext) CreateDevice(scene, name, sn, remark, operator string, tp uint8) (*DeviceInfo, error) {
+func (mine *cacheContext) CreateDevice(ctx context.Context, scene, name, sn, remark, operator string, tp uint8) (*DeviceInfo, error) {
 	db := new(nosql.Invite)
 	db.UID = primitive.NewObjectID()
-	db.ID = nosql.GetRoomNextID()
+	id, err := store.GetDeviceNextID()
+	if err != nil {
+		return nil, err
+	}
+	db.ID = id
 	db.CreatedTime = time.Now()
 	db.UpdatedTime = time.Now()
 	db.Operator = operator
@@ -197,41 +262,77 @@ func (mine *cacheContext) CreateDevice(scene, name, sn, remark, operator string,
 		Stop:  "",
 	}
 
-	err := nosql.CreateDevice(db)
+	err = store.CreateDevice(ctx, db)
 	if err == nil {
 		tmp := new(DeviceInfo)
 		tmp.initInfo(db)
+		cacheCtx.terminals().put(tmp)
 		return tmp, nil
 	}
 	return nil, err
 }
 
+// GetDevice 优先使用注册表，没有命中时读取数据库，已经删除的设备不加入注册表
 func (mine *cacheContext) GetDevice(uid string) (*DeviceInfo, error) {
-	db, err := nosql.GetDevice(uid)
+	registry := mine.terminals()
+	if registry.load() == nil {
+		if info := registry.get(uid); info != nil {
+			return info, nil
+		}
+	}
+	db, err := store.GetDevice(uid)
 	if err != nil {
 		return nil, err
 	}
-	tmp := new(DeviceInfo)
-	tmp.initInfo(db)
-	return tmp, nil
+	return mine.cacheDevice(db), nil
 }
 
 func (mine *cacheContext) GetDeviceCount() int64 {
-	return nosql.GetDeviceCount()
+	return store.GetDeviceCount()
 }
 
 func (mine *cacheContext) GetDeviceBySN(sn string) (*DeviceInfo, error) {
-	db, err := nosql.GetDeviceBySN(sn)
+	registry := mine.terminals()
+	if registry.load() == nil {
+		if info := registry.getBySN(sn); info != nil {
+			return info, nil
+		}
+	}
+	db, err := store.GetDeviceBySN(sn)
 	if err != nil {
 		return nil, err
 	}
+	return mine.cacheDevice(db), nil
+}
+
+// cacheDevice 其他实例创建的设备在收到通知之前也可能没有命中
+func (mine *cacheContext) cacheDevice(db *nosql.Invite) *DeviceInfo {
 	tmp := new(DeviceInfo)
 	tmp.initInfo(db)
-	return tmp, nil
+	if db.DeleteTime.IsZero() {
+		mine.terminals().put(tmp)
+	}
+	return tmp
+}
+
+// syncDevice 不通过DeviceInfo的写操作完成后重新读取
+func (mine *cacheContext) syncDevice(uid string) {
+	db, err := store.GetDevice(uid)
+	if err != nil || !db.DeleteTime.IsZero() {
+		mine.terminals().drop(uid)
+		return
+	}
+	tmp := new(DeviceInfo)
+	tmp.initInfo(db)
+	mine.terminals().put(tmp)
 }
 
 func (mine *cacheContext) GetDevicesByScene(owner string) ([]*DeviceInfo, error) {
-	dbs, err := nosql.GetDevicesByScene(owner)
+	registry := mine.terminals()
+	if registry.load() == nil {
+		return registry.getByScene(owner), nil
+	}
+	dbs, err := store.GetDevicesByScene(owner)
 	if err != nil {
 		return nil, err
 	}
@@ -245,6 +346,19 @@ func (mine *cacheContext) GetDevicesByScene(owner string) ([]*DeviceInfo, error)
 	return list, nil
 }
 
+// GetDevicesByQuote 激活码对应的设备
+func (mine *cacheContext) GetDevicesByQuote(quote string) ([]*DeviceInfo, error) {
+	if len(quote) < 1 {
+		return nil, errors.New("the device quote is empty")
+	}
+	registry := mine.terminals()
+	err := registry.load()
+	if err != nil {
+		return nil, err
+	}
+	return registry.getByQuote(quote), nil
+}
+
 func (mine *cacheContext) GetUsableDevicesByScene(scene string) ([]*DeviceInfo, error) {
 	arr, err := mine.GetAreasByScene(scene)
 	if err != nil {
@@ -261,13 +375,41 @@ func (mine *cacheContext) GetUsableDevicesByScene(scene string) ([]*DeviceInfo,
 	return list, nil
 }
 
+// GetAllDevices 全部未删除的设备
+func (mine *cacheContext) GetAllDevices() ([]*DeviceInfo, error) {
+	registry := mine.terminals()
+	if registry.load() == nil {
+		return registry.getAll(), nil
+	}
+	dbs, err := store.GetAllDevices()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*DeviceInfo, 0, len(dbs))
+	for _, db := range dbs {
+		if db.DeleteTime.IsZero() {
+			tmp := new(DeviceInfo)
+			tmp.initInfo(db)
+			list = append(list, tmp)
+		}
+	}
+	return list, nil
+}
+
 func (mine *cacheContext) GetDevicesByStatus(st int32) ([]*DeviceInfo, error) {
+	registry := mine.terminals()
+	if registry.load() == nil {
+		if st < 0 {
+			return registry.getExcept(DeviceDiscard), nil
+		}
+		return registry.getByStatus(uint8(st)), nil
+	}
 	var dbs []*nosql.Invite
 	var err error
 	if st < 0 {
-		dbs, err = nosql.GetAllDevicesExcept(DeviceDiscard)
+		dbs, err = store.GetAllDevicesExcept(DeviceDiscard)
 	} else {
-		dbs, err = nosql.GetDevicesByStatus(uint8(st))
+		dbs, err = store.GetDevicesByStatus(uint8(st))
 	}
 
 	if err != nil {
@@ -286,11 +428,9 @@ func (mine *cacheContext) GetDevicesByStatus(st int32) ([]*DeviceInfo, error) {
 func (mine *cacheContext) GetDevicesByArray(arr []string) ([]*DeviceInfo, error) {
 	list := make([]*DeviceInfo, 0, len(arr))
 	for _, uid := range arr {
-		db, _ := nosql.GetDevice(uid)
-		if db != nil {
-			tmp := new(DeviceInfo)
-			tmp.initInfo(db)
-			list = append(list, tmp)
+		info, _ := mine.GetDevice(uid)
+		if info != nil {
+			list = append(list, info)
 		}
 	}
 
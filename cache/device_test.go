@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
+	"omo.msa.organization/proxy/memory"
+	"omo.msa.organization/proxy/nosql"
+)
+
+func TestDeviceSequence(t *testing.T) {
+	ctx := context.Background()
+	storage := initMemory(t)
+	scene := createScene(t, "museum", "")
+	var lock sync.Mutex
+	ids := make(map[string]map[uint64]bool, 2)
+	ids[nosql.TableDevice] = make(map[uint64]bool, 20)
+	ids[nosql.TableRoom] = make(map[uint64]bool, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			info, err := cacheCtx.CreateDevice(ctx, scene.UID, "device", fmt.Sprintf("sn-%d", i), "", "tester", 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			lock.Lock()
+			ids[nosql.TableDevice][info.ID] = true
+			lock.Unlock()
+		}(i)
+		go func() {
+			defer wg.Done()
+			info, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "room", Operator: "tester"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			lock.Lock()
+			ids[nosql.TableRoom][info.ID] = true
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	//设备和房间使用各自的计数，ID都是连续的
+	for table, list := range ids {
+		count, _ := storage.GetSequenceCount(table)
+		if len(list) != 20 || count != 20 || !list[1] || !list[20] {
+			t.Fatalf("the ids of %s should be 1 to 20 but %d, %d", table, len(list), count)
+		}
+	}
+}
+
+// failedSequence 分配ID失败的存储
+type failedSequence struct {
+	*memory.Storage
+}
+
+func (mine *failedSequence) GetDeviceNextID() (uint64, error) {
+	return 0, errors.New("the sequence is unavailable")
+}
+
+func (mine *failedSequence) GetRoomNextID() (uint64, error) {
+	return 0, errors.New("the sequence is unavailable")
+}
+
+func TestNextIDFailed(t *testing.T) {
+	ctx := context.Background()
+	storage := &failedSequence{Storage: memory.NewStorage()}
+	if err := InitDataBy(storage); err != nil {
+		t.Fatal(err)
+	}
+	scene := createScene(t, "museum", "")
+	if _, err := cacheCtx.CreateDevice(ctx, scene.UID, "device", "sn", "", "tester", 0); err == nil {
+		t.Fatal("the device should not be created without id")
+	}
+	if _, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "room", Operator: "tester"}); err == nil {
+		t.Fatal("the room should not be created without id")
+	}
+	if list, _ := storage.GetRoomsByScene(scene.UID); len(list) > 0 {
+		t.Fatal("the room with id 0 should not be saved")
+	}
+	if _, err := storage.GetDeviceBySN("sn"); err == nil {
+		t.Fatal("the device with id 0 should not be saved")
+	}
+}
+
+// 注册表的查询和设备的修改同时进行，使用go test -race检查
+func TestDeviceConcurrentUpdate(t *testing.T) {
+	ctx := context.Background()
+	initMemory(t)
+	first := createScene(t, "first", "")
+	second := createScene(t, "second", "")
+	//先加载注册表，创建的设备直接加入索引
+	if _, err := cacheCtx.GetAllDevices(); err != nil {
+		t.Fatal(err)
+	}
+	list := make([]*DeviceInfo, 0, 4)
+	for i := 0; i < 4; i++ {
+		info, err := cacheCtx.CreateDevice(ctx, first.UID, "device", fmt.Sprintf("sn-%d", i), "", "tester", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, info)
+	}
+	var wg sync.WaitGroup
+	for _, device := range list {
+		wg.Add(2)
+		go func(info *DeviceInfo) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				scene := first.UID
+				if j%2 == 0 {
+					scene = second.UID
+				}
+				_ = info.UpdateScene(ctx, scene, "tester")
+				_ = info.UpdateBase(ctx, fmt.Sprintf("device-%d", j), "", "tester")
+				_ = info.Bind(ctx, fmt.Sprintf("quote-%d", j), "android", "tester", 1, 2)
+				_ = info.UpdateStatus(ctx, "tester", DeviceAwake)
+			}
+			_ = info.UpdateScene(ctx, second.UID, "tester")
+		}(device)
+		go func(info *DeviceInfo) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				devices, _ := cacheCtx.GetDevicesByScene(first.UID)
+				all, _ := cacheCtx.GetAllDevices()
+				using, _ := cacheCtx.GetDevicesByStatus(DeviceUsing)
+				for _, item := range append(append(devices, all...), using...) {
+					_ = item.Clone()
+					_ = item.filterValue("quote")
+				}
+				_, _ = cacheCtx.GetDevicesByStatus(-1)
+				_, _ = cacheCtx.GetDeviceBySN(info.keys().sn)
+			}
+		}(device)
+	}
+	wg.Wait()
+	//索引和设备最后的字段一致
+	devices, _ := cacheCtx.GetDevicesByScene(second.UID)
+	if len(devices) != 4 {
+		t.Fatalf("the devices of second scene should be 4 but %d", len(devices))
+	}
+	if devices, _ = cacheCtx.GetDevicesByScene(first.UID); len(devices) != 0 {
+		t.Fatalf("the devices of first scene should be empty but %d", len(devices))
+	}
+	for _, device := range list {
+		info := device.Clone()
+		quoted, _ := cacheCtx.GetDevicesByQuote("quote-9")
+		if info.Name != "device-9" || info.Quote != "quote-9" || len(quoted) != 4 {
+			t.Fatalf("the device is error: %s, %s, %d", info.Name, info.Quote, len(quoted))
+		}
+	}
+}
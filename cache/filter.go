@@ -0,0 +1,714 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"omo.msa.organization/proxy/nosql"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+组合过滤条件，json格式为{"where":{"and":[{"field":"type","op":"eq","value":3},{"field":"device","op":"empty"}]},"sort":["-createdAt","name"]}，
+字段必须在对象的白名单中，条件可以在缓存中计算，也可以转换为mongo的查询
+*/
+
+const (
+	filterString = iota + 1
+	filterNumber
+	filterTime
+	filterList //字符串数组，eq以及contains表示包含某个元素
+)
+
+// filterLimit 条件的最大数量以及最大嵌套层数
+const (
+	filterMaxConditions = 50
+	filterMaxDepth      = 5
+)
+
+type filterField struct {
+	column string //数据库的字段名
+	kind   int
+}
+
+type filterFields map[string]filterField
+
+// filterOps 每种字段支持的操作
+var filterOps = map[string][]int{
+	"eq":       {filterString, filterNumber, filterTime, filterList},
+	"ne":       {filterString, filterNumber, filterTime, filterList},
+	"gt":       {filterString, filterNumber, filterTime},
+	"gte":      {filterString, filterNumber, filterTime},
+	"lt":       {filterString, filterNumber, filterTime},
+	"lte":      {filterString, filterNumber, filterTime},
+	"in":       {filterString, filterNumber},
+	"nin":      {filterString, filterNumber},
+	"contains": {filterString, filterList},
+	"prefix":   {filterString},
+	"empty":    {filterString, filterNumber, filterTime, filterList},
+}
+
+func withBaseFields(fields filterFields) filterFields {
+	fields["name"] = filterField{column: "name", kind: filterString}
+	fields["creator"] = filterField{column: "creator", kind: filterString}
+	fields["operator"] = filterField{column: "operator", kind: filterString}
+	fields["createdAt"] = filterField{column: "createdAt", kind: filterTime}
+	fields["updatedAt"] = filterField{column: "updatedAt", kind: filterTime}
+	return fields
+}
+
+//region Fields
+var sceneFilters = withBaseFields(filterFields{
+	"type":      {column: "type", kind: filterNumber},
+	"status":    {column: "status", kind: filterNumber},
+	"short":     {column: "short", kind: filterString},
+	"remark":    {column: "remark", kind: filterString},
+	"master":    {column: "master", kind: filterString},
+	"entity":    {column: "entity", kind: filterString},
+	"supporter": {column: "supporter", kind: filterString},
+	"location":  {column: "location", kind: filterString},
+	"province":  {column: "address.province", kind: filterString},
+	"city":      {column: "address.city", kind: filterString},
+	"parents":   {column: "parents", kind: filterList},
+})
+
+var roomFilters = withBaseFields(filterFields{
+	"scene":  {column: "scene", kind: filterString},
+	"remark": {column: "remark", kind: filterString},
+	"quotes": {column: "quotes", kind: filterList},
+})
+
+var regionFilters = withBaseFields(filterFields{
+	"scene":    {column: "scene", kind: filterString},
+	"parent":   {column: "parent", kind: filterString},
+	"master":   {column: "master", kind: filterString},
+	"entity":   {column: "entity", kind: filterString},
+	"remark":   {column: "remark", kind: filterString},
+	"code":     {column: "code", kind: filterString},
+	"location": {column: "location", kind: filterString},
+	"province": {column: "address.province", kind: filterString},
+	"city":     {column: "address.city", kind: filterString},
+	"members":  {column: "members", kind: filterList},
+})
+
+var areaFilters = withBaseFields(filterFields{
+	"scene":    {column: "scene", kind: filterString},
+	"parent":   {column: "parent", kind: filterString},
+	"template": {column: "template", kind: filterString},
+	"type":     {column: "type", kind: filterNumber},
+	"device":   {column: "device", kind: filterString},
+	"remark":   {column: "remark", kind: filterString},
+	"question": {column: "question", kind: filterString},
+	"catalog":  {column: "catalog", kind: filterString},
+	"width":    {column: "width", kind: filterNumber},
+	"height":   {column: "height", kind: filterNumber},
+	"limit":    {column: "limit", kind: filterNumber},
+	"assets":   {column: "assets", kind: filterList},
+})
+
+var deviceFilters = withBaseFields(filterFields{
+	"scene":     {column: "scene", kind: filterString},
+	"type":      {column: "type", kind: filterNumber},
+	"status":    {column: "status", kind: filterNumber},
+	"sn":        {column: "sn", kind: filterString},
+	"quote":     {column: "quote", kind: filterString},
+	"os":        {column: "os", kind: filterString},
+	"aspect":    {column: "aspect", kind: filterString},
+	"remark":    {column: "remark", kind: filterString},
+	"activated": {column: "activated", kind: filterNumber},
+})
+
+var maintainFilters = withBaseFields(filterFields{
+	"scene":       {column: "scene", kind: filterString},
+	"type":        {column: "type", kind: filterNumber},
+	"area":        {column: "area", kind: filterString},
+	"device":      {column: "device", kind: filterString},
+	"date":        {column: "date", kind: filterString},
+	"submitter":   {column: "submitter", kind: filterString},
+	"contacts":    {column: "contacts", kind: filterString},
+	"remark":      {column: "remark", kind: filterString},
+	"maintainers": {column: "maintainers", kind: filterList},
+})
+
+// filterTables 表对应的字段白名单
+var filterTables = map[string]filterFields{
+	nosql.TableScene:    sceneFilters,
+	nosql.TableRoom:     roomFilters,
+	nosql.TableRegion:   regionFilters,
+	nosql.TableArea:     areaFilters,
+	nosql.TableDevice:   deviceFilters,
+	nosql.TableMaintain: maintainFilters,
+}
+
+func (mine *baseInfo) baseValue(field string) interface{} {
+	switch field {
+	case "name":
+		return mine.Name
+	case "creator":
+		return mine.Creator
+	case "operator":
+		return mine.Operator
+	case "createdAt":
+		return mine.CreateTime
+	case "updatedAt":
+		return mine.UpdateTime
+	}
+	return nil
+}
+
+func (mine *SceneInfo) filterValue(field string) interface{} {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	switch field {
+	case "type":
+		return float64(mine.Type)
+	case "status":
+		return float64(mine.Status)
+	case "short":
+		return mine.ShortName
+	case "remark":
+		return mine.Remark
+	case "master":
+		return mine.Master
+	case "entity":
+		return mine.Entity
+	case "supporter":
+		return mine.Supporter
+	case "location":
+		return mine.Location
+	case "province":
+		return mine.Address.Province
+	case "city":
+		return mine.Address.City
+	case "parents":
+		return mine.parents
+	}
+	return mine.baseValue(field)
+}
+
+func (mine *RoomInfo) filterValue(field string) interface{} {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	switch field {
+	case "scene":
+		return mine.Scene
+	case "remark":
+		return mine.Remark
+	case "quotes":
+		return mine.Quotes
+	}
+	return mine.baseValue(field)
+}
+
+func (mine *RegionInfo) filterValue(field string) interface{} {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	switch field {
+	case "scene":
+		return mine.Scene
+	case "parent":
+		return mine.Parent
+	case "master":
+		return mine.Master
+	case "entity":
+		return mine.Entity
+	case "remark":
+		return mine.Remark
+	case "code":
+		return mine.Code
+	case "location":
+		return mine.Location
+	case "province":
+		return mine.Address.Province
+	case "city":
+		return mine.Address.City
+	case "members":
+		return mine.Members
+	}
+	return mine.baseValue(field)
+}
+
+func (mine *AreaInfo) filterValue(field string) interface{} {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	switch field {
+	case "scene":
+		return mine.Owner
+	case "parent":
+		return mine.Parent
+	case "template":
+		return mine.Template
+	case "type":
+		return float64(mine.Type)
+	case "device":
+		return mine.Device
+	case "remark":
+		return mine.Remark
+	case "question":
+		return mine.Question
+	case "catalog":
+		return mine.Catalog
+	case "width":
+		return float64(mine.Width)
+	case "height":
+		return float64(mine.Height)
+	case "limit":
+		return float64(mine.LimitNum)
+	case "assets":
+		return mine.Assets
+	}
+	return mine.baseValue(field)
+}
+
+func (mine *DeviceInfo) filterValue(field string) interface{} {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	switch field {
+	case "scene":
+		return mine.Scene
+	case "type":
+		return float64(mine.Type)
+	case "status":
+		return float64(mine.Status)
+	case "sn":
+		return mine.SN
+	case "quote":
+		return mine.Quote
+	case "os":
+		return mine.OS
+	case "aspect":
+		return mine.Aspect
+	case "remark":
+		return mine.Remark
+	case "activated":
+		return float64(mine.ActiveTime)
+	}
+	return mine.baseValue(field)
+}
+
+func (mine *MaintainInfo) filterValue(field string) interface{} {
+	switch field {
+	case "scene":
+		return mine.Scene
+	case "type":
+		return float64(mine.Type)
+	case "area":
+		return mine.Area
+	case "device":
+		return mine.Device
+	case "date":
+		return mine.Date
+	case "submitter":
+		return mine.Submitter
+	case "contacts":
+		return mine.Contacts
+	case "remark":
+		return mine.Remark
+	case "maintainers":
+		return mine.Maintainers
+	}
+	return mine.baseValue(field)
+}
+
+//endregion
+
+//region Parse
+// FilterExpr field不为空时为比较条件，否则为and或者or的组合
+type FilterExpr struct {
+	Field string        `json:"field"`
+	Op    string        `json:"op"`
+	Value interface{}   `json:"value"`
+	And   []*FilterExpr `json:"and"`
+	Or    []*FilterExpr `json:"or"`
+	kind  int
+	value interface{} //按照字段类型转换后的值
+}
+
+// FilterQuery sort为字段名，以-开头时倒序，排序相同的按照创建时间以及uid
+type FilterQuery struct {
+	Where  *FilterExpr `json:"where"`
+	Sort   []string    `json:"sort"`
+	fields filterFields
+}
+
+// ParseFilter 解析并且按照表的白名单检查字段、操作以及值
+func ParseFilter(table, data string) (*FilterQuery, error) {
+	fields, ok := filterTables[table]
+	if !ok {
+		return nil, errors.New("the table not support filter of " + table)
+	}
+	if len(data) < 1 {
+		return nil, errors.New("the filter is empty")
+	}
+	query := new(FilterQuery)
+	err := json.Unmarshal([]byte(data), query)
+	if err != nil {
+		return nil, errors.New("the filter format is error")
+	}
+	query.fields = fields
+	if query.Where != nil {
+		count := 0
+		err = query.Where.check(fields, 1, &count)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range query.Sort {
+		field, ok := fields[strings.TrimPrefix(item, "-")]
+		if !ok || field.kind == filterList {
+			return nil, errors.New("the sort field not support of " + item)
+		}
+	}
+	return query, nil
+}
+
+func (mine *FilterExpr) check(fields filterFields, depth int, count *int) error {
+	if depth > filterMaxDepth {
+		return errors.New("the filter is too deep")
+	}
+	*count += 1
+	if *count > filterMaxConditions {
+		return errors.New("the filter has too many conditions")
+	}
+	if len(mine.Field) < 1 {
+		if len(mine.And) > 0 && len(mine.Or) > 0 {
+			return errors.New("the filter can not use and with or together")
+		}
+		if len(mine.And)+len(mine.Or) < 1 {
+			return errors.New("the filter condition is empty")
+		}
+		for _, item := range append(mine.And, mine.Or...) {
+			if item == nil {
+				return errors.New("the filter condition is empty")
+			}
+			if err := item.check(fields, depth+1, count); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	field, ok := fields[mine.Field]
+	if !ok {
+		return errors.New("the filter field not support of " + mine.Field)
+	}
+	kinds, ok := filterOps[mine.Op]
+	if !ok || !hasKind(kinds, field.kind) {
+		return fmt.Errorf("the filter op %s not support of %s", mine.Op, mine.Field)
+	}
+	mine.kind = field.kind
+	value, err := filterConvert(mine.Op, field.kind, mine.Value)
+	if err != nil {
+		return fmt.Errorf("the filter value of %s is error that %s", mine.Field, err.Error())
+	}
+	mine.value = value
+	return nil
+}
+
+func hasKind(kinds []int, kind int) bool {
+	for _, item := range kinds {
+		if item == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// filterConvert in以及nin的值为数组，empty的值为bool并且默认为true
+func filterConvert(op string, kind int, value interface{}) (interface{}, error) {
+	if op == "empty" {
+		if value == nil {
+			return true, nil
+		}
+		if flag, ok := value.(bool); ok {
+			return flag, nil
+		}
+		return nil, errors.New("need a bool")
+	}
+	if op == "in" || op == "nin" {
+		arr, ok := value.([]interface{})
+		if !ok {
+			return nil, errors.New("need an array")
+		}
+		list := make([]interface{}, 0, len(arr))
+		for _, item := range arr {
+			tmp, err := filterScalar(kind, item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, tmp)
+		}
+		return list, nil
+	}
+	return filterScalar(kind, value)
+}
+
+// filterScalar 时间可以是秒数或者RFC3339格式，数字可以是字符串
+func filterScalar(kind int, value interface{}) (interface{}, error) {
+	switch kind {
+	case filterString, filterList:
+		if str, ok := value.(string); ok {
+			return str, nil
+		}
+		return nil, errors.New("need a string")
+	case filterNumber:
+		switch tmp := value.(type) {
+		case float64:
+			return tmp, nil
+		case string:
+			return strconv.ParseFloat(tmp, 64)
+		}
+		return nil, errors.New("need a number")
+	case filterTime:
+		switch tmp := value.(type) {
+		case float64:
+			return time.Unix(int64(tmp), 0), nil
+		case string:
+			return time.Parse(time.RFC3339, tmp)
+		}
+		return nil, errors.New("need a time")
+	}
+	return nil, errors.New("the kind not defined")
+}
+
+//endregion
+
+//region Evaluate
+type filterable interface {
+	pageable
+	filterValue(field string) interface{}
+}
+
+func (mine *FilterQuery) Sorted() bool {
+	return len(mine.Sort) > 0
+}
+
+// Apply 在缓存中过滤并且排序
+func Apply[T filterable](query *FilterQuery, all []T) []T {
+	list := make([]T, 0, len(all))
+	for _, item := range all {
+		if query.Where == nil || query.Where.match(item) {
+			list = append(list, item)
+		}
+	}
+	if !query.Sorted() {
+		return list
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		for _, item := range query.Sort {
+			field := strings.TrimPrefix(item, "-")
+			kind := query.fields[field].kind
+			ret := compareFilter(kind, list[i].filterValue(field), list[j].filterValue(field))
+			if ret == 0 {
+				continue
+			}
+			if strings.HasPrefix(item, "-") {
+				return ret > 0
+			}
+			return ret < 0
+		}
+		return list[i].pageKey().less(list[j].pageKey())
+	})
+	return list
+}
+
+// QueryList 过滤、排序以及分页，query为空时不过滤，pager为空时不分页，没有排序字段时可以使用游标
+func QueryList[T filterable](query *FilterQuery, pager *Pager, all []T) (uint32, uint32, []T, error) {
+	list := all
+	if query != nil {
+		list = Apply(query, all)
+	}
+	if pager == nil {
+		return uint32(len(list)), 1, list, nil
+	}
+	if query == nil || !query.Sorted() {
+		total, maxPage, arr := PageList(pager, list)
+		return total, maxPage, arr, nil
+	}
+	return PageSorted(pager, list)
+}
+
+func (mine *FilterExpr) match(item filterable) bool {
+	if len(mine.Field) < 1 {
+		if len(mine.And) > 0 {
+			for _, sub := range mine.And {
+				if !sub.match(item) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, sub := range mine.Or {
+			if sub.match(item) {
+				return true
+			}
+		}
+		return false
+	}
+	value := item.filterValue(mine.Field)
+	switch mine.Op {
+	case "empty":
+		return isEmptyFilter(mine.kind, value) == mine.value.(bool)
+	case "eq":
+		if mine.kind == filterList {
+			return hasFilterItem(value, mine.value.(string))
+		}
+		return compareFilter(mine.kind, value, mine.value) == 0
+	case "ne":
+		if mine.kind == filterList {
+			return !hasFilterItem(value, mine.value.(string))
+		}
+		return compareFilter(mine.kind, value, mine.value) != 0
+	case "gt":
+		return compareFilter(mine.kind, value, mine.value) > 0
+	case "gte":
+		return compareFilter(mine.kind, value, mine.value) >= 0
+	case "lt":
+		return compareFilter(mine.kind, value, mine.value) < 0
+	case "lte":
+		return compareFilter(mine.kind, value, mine.value) <= 0
+	case "in", "nin":
+		found := false
+		for _, tmp := range mine.value.([]interface{}) {
+			if compareFilter(mine.kind, value, tmp) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (mine.Op == "in")
+	case "contains":
+		if mine.kind == filterList {
+			return hasFilterItem(value, mine.value.(string))
+		}
+		str, _ := value.(string)
+		return strings.Contains(strings.ToLower(str), strings.ToLower(mine.value.(string)))
+	case "prefix":
+		str, _ := value.(string)
+		return strings.HasPrefix(str, mine.value.(string))
+	}
+	return false
+}
+
+func compareFilter(kind int, a, b interface{}) int {
+	switch kind {
+	case filterNumber:
+		x, _ := a.(float64)
+		y, _ := b.(float64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case filterTime:
+		x, _ := a.(time.Time)
+		y, _ := b.(time.Time)
+		if x.Before(y) {
+			return -1
+		} else if x.After(y) {
+			return 1
+		}
+		return 0
+	}
+	x, _ := a.(string)
+	y, _ := b.(string)
+	return strings.Compare(x, y)
+}
+
+func isEmptyFilter(kind int, value interface{}) bool {
+	switch kind {
+	case filterNumber:
+		num, _ := value.(float64)
+		return num == 0
+	case filterTime:
+		stamp, _ := value.(time.Time)
+		return stamp.IsZero()
+	case filterList:
+		arr, _ := value.([]string)
+		return len(arr) < 1
+	}
+	str, _ := value.(string)
+	return len(str) < 1
+}
+
+func hasFilterItem(value interface{}, item string) bool {
+	arr, _ := value.([]string)
+	for _, tmp := range arr {
+		if tmp == item {
+			return true
+		}
+	}
+	return false
+}
+
+//endregion
+
+//region Mongo
+// Bson 转换为mongo的查询条件，没有条件时返回空的条件
+func (mine *FilterQuery) Bson() bson.M {
+	if mine.Where == nil {
+		return bson.M{}
+	}
+	return mine.Where.bson(mine.fields)
+}
+
+func (mine *FilterQuery) SortBson() bson.D {
+	list := make(bson.D, 0, len(mine.Sort)+2)
+	for _, item := range mine.Sort {
+		order := 1
+		if strings.HasPrefix(item, "-") {
+			order = -1
+		}
+		list = append(list, bson.E{Key: mine.fields[strings.TrimPrefix(item, "-")].column, Value: order})
+	}
+	return append(list, bson.E{Key: "createdAt", Value: 1}, bson.E{Key: "_id", Value: 1})
+}
+
+func (mine *FilterExpr) bson(fields filterFields) bson.M {
+	if len(mine.Field) < 1 {
+		key, subs := "$and", mine.And
+		if len(mine.Or) > 0 {
+			key, subs = "$or", mine.Or
+		}
+		arr := make([]bson.M, 0, len(subs))
+		for _, sub := range subs {
+			arr = append(arr, sub.bson(fields))
+		}
+		return bson.M{key: arr}
+	}
+	column := fields[mine.Field].column
+	switch mine.Op {
+	case "empty":
+		var empty bson.M
+		switch mine.kind {
+		case filterNumber:
+			empty = bson.M{column: bson.M{"$in": bson.A{0, nil}}}
+		case filterTime:
+			empty = bson.M{column: bson.M{"$in": bson.A{time.Time{}, nil}}}
+		case filterList:
+			empty = bson.M{"$or": bson.A{bson.M{column: nil}, bson.M{column: bson.M{"$size": 0}}}}
+		default:
+			empty = bson.M{column: bson.M{"$in": bson.A{"", nil}}}
+		}
+		if mine.value.(bool) {
+			return empty
+		}
+		return bson.M{"$nor": bson.A{empty}}
+	case "eq":
+		return bson.M{column: mine.value}
+	case "contains":
+		if mine.kind == filterList {
+			return bson.M{column: mine.value}
+		}
+		return bson.M{column: bson.M{"$regex": regexp.QuoteMeta(mine.value.(string)), "$options": "i"}}
+	case "prefix":
+		return bson.M{column: bson.M{"$regex": "^" + regexp.QuoteMeta(mine.value.(string))}}
+	}
+	return bson.M{column: bson.M{"$" + mine.Op: mine.value}}
+}
+
+//endregion
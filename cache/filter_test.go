@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy/nosql"
+)
+
+func TestParseFilter(t *testing.T) {
+	valid := []string{
+		`{"where":{"field":"type","op":"eq","value":"3"}}`,
+		`{"where":{"field":"device","op":"empty"}}`,
+		`{"where":{"field":"createdAt","op":"gt","value":"2024-01-01T00:00:00Z"}}`,
+		`{"where":{"or":[{"field":"area","op":"in","value":["a1","a2"]},{"field":"maintainers","op":"contains","value":"bob"}]}}`,
+		`{"sort":["-createdAt","name"]}`,
+	}
+	for _, item := range valid {
+		if _, err := ParseFilter(nosql.TableMaintain, item); err != nil {
+			t.Fatalf("the filter %s should be valid but %v", item, err)
+		}
+	}
+	query, _ := ParseFilter(nosql.TableMaintain, valid[0])
+	if query.Where.value != float64(3) {
+		t.Fatalf("the number string should be converted but %v", query.Where.value)
+	}
+	deep := `{"field":"type","op":"eq","value":1}`
+	for i := 0; i < filterMaxDepth; i++ {
+		deep = `{"and":[` + deep + `]}`
+	}
+	many := make([]string, 0, filterMaxConditions)
+	for i := 0; i < filterMaxConditions; i++ {
+		many = append(many, `{"field":"type","op":"eq","value":1}`)
+	}
+	malformed := map[string]string{
+		"":  "the filter is empty",
+		"{": "the filter format is error",
+		`{"where":{"field":"secret","op":"eq","value":"a"}}`:            "field not support",
+		`{"where":{"field":"maintainers","op":"gt","value":"a"}}`:       "op gt not support",
+		`{"where":{"field":"type","op":"eq","value":"abc"}}`:            "the filter value of type",
+		`{"where":{"field":"area","op":"in","value":"a1"}}`:             "need an array",
+		`{"where":{"field":"area","op":"empty","value":"yes"}}`:         "need a bool",
+		`{"where":{"field":"createdAt","op":"gt","value":"yesterday"}}`: "the filter value of createdAt",
+		`{"where":{"field":"name","op":"like","value":"a"}}`:            "op like not support",
+		`{"where":{}}`:             "the filter condition is empty",
+		`{"where":{"and":[null]}}`: "the filter condition is empty",
+		`{"where":{"and":[` + many[0] + `],"or":[` + many[0] + `]}}`: "and with or",
+		`{"where":` + deep + `}`:                             "too deep",
+		`{"where":{"or":[` + strings.Join(many, ",") + `]}}`: "too many conditions",
+		`{"sort":["maintainers"]}`:                           "sort field not support",
+		`{"sort":["-secret"]}`:                               "sort field not support",
+	}
+	for data, msg := range malformed {
+		_, err := ParseFilter(nosql.TableMaintain, data)
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Fatalf("the filter %s should fail with %s but %v", data, msg, err)
+		}
+	}
+	if _, err := ParseFilter(nosql.TableGroup, valid[0]); err == nil {
+		t.Fatal("the group should not support filter")
+	}
+}
+
+// maintainFixtures 创建时间精确到秒，和mongo保存的精度一致
+func maintainFixtures(scene string) []*nosql.Maintain {
+	stamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	list := []*nosql.Maintain{
+		{Type: 1, Name: "Pump check", Area: "a1", Date: "2024-01-02", Submitter: "alice",
+			Maintainers: []string{"bob", "carl"}, CreatedTime: stamp.Add(time.Second)},
+		{Type: 2, Name: "pump repair", Area: "a2", Device: "d1", Date: "2024-01-05", Submitter: "bob",
+			Maintainers: []string{}, Remark: "urgent", CreatedTime: stamp.Add(2 * time.Second)},
+		{Type: 3, Name: "screen", Area: "a1", Device: "d2", Date: "2024-02-01", Submitter: "alice",
+			Maintainers: []string{"carl"}, CreatedTime: stamp.Add(2 * time.Second)},
+		{Type: 0, Name: "light", Device: "d3", Remark: "r", CreatedTime: stamp.Add(3 * time.Second),
+			UpdatedTime: stamp.Add(5 * time.Second)},
+	}
+	for i, item := range list {
+		item.UID = primitive.NewObjectID()
+		item.ID = uint64(i + 1)
+		item.Scene = scene
+	}
+	return list
+}
+
+// 缓存中的过滤和转换为mongo条件后的过滤结果以及顺序一致
+func TestFilterBsonAgree(t *testing.T) {
+	storage := initMemory(t)
+	ctx := context.Background()
+	fixtures := maintainFixtures("scene")
+	fixtures = append(fixtures, maintainFixtures("other")...)
+	infos := make([]*MaintainInfo, 0, len(fixtures))
+	for _, item := range fixtures {
+		if err := storage.CreateMaintain(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+		if item.Scene == "scene" {
+			info := new(MaintainInfo)
+			info.initInfo(item)
+			infos = append(infos, info)
+		}
+	}
+	created := time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC).Unix()
+	cases := []struct {
+		data  string
+		count int
+	}{
+		{`{"where":{"field":"type","op":"gte","value":2}}`, 2},
+		{`{"where":{"field":"type","op":"empty"}}`, 1},
+		{`{"where":{"field":"type","op":"nin","value":["1",3]}}`, 2},
+		{`{"where":{"field":"name","op":"contains","value":"PUMP"}}`, 2},
+		{`{"where":{"field":"name","op":"prefix","value":"pump"}}`, 1},
+		{`{"where":{"field":"maintainers","op":"eq","value":"carl"}}`, 2},
+		{`{"where":{"field":"maintainers","op":"ne","value":"carl"}}`, 2},
+		{`{"where":{"field":"maintainers","op":"empty"}}`, 2},
+		{`{"where":{"field":"device","op":"empty","value":false}}`, 3},
+		{`{"where":{"field":"area","op":"in","value":["a1",""]}}`, 3},
+		{`{"where":{"field":"date","op":"gte","value":"2024-01-05"}}`, 2},
+		{fmt.Sprintf(`{"where":{"field":"createdAt","op":"gt","value":%d}}`, created), 3},
+		{`{"where":{"field":"updatedAt","op":"empty"}}`, 3},
+		{`{"where":{"or":[{"field":"submitter","op":"eq","value":"bob"},{"and":[{"field":"area","op":"eq","value":"a1"},{"field":"type","op":"lt","value":3}]}]}}`, 2},
+		{`{"sort":["-type"]}`, 4},
+		{`{"where":{"field":"area","op":"ne","value":"a1"},"sort":["submitter","-name"]}`, 2},
+		{`{"sort":["createdAt"]}`, 4},
+	}
+	for _, item := range cases {
+		query, err := ParseFilter(nosql.TableMaintain, item.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		local := Apply(query, infos)
+		remote, err := cacheCtx.QueryMaintains("scene", query)
+		if err != nil {
+			t.Fatalf("the filter %s failed that %v", item.data, err)
+		}
+		if len(local) != item.count || len(remote) != item.count {
+			t.Fatalf("the filter %s should match %d but %d, %d", item.data, item.count, len(local), len(remote))
+		}
+		for i := range local {
+			if local[i].UID != remote[i].UID {
+				t.Fatalf("the order of filter %s is different at %d: %s, %s", item.data, i, local[i].Name, remote[i].Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/micro/go-micro/v2/logger"
+	"math"
+	"omo.msa.organization/proxy/nosql"
+	"sort"
+)
+
+/**
+地理位置查询，附近按照球面距离计算，矩形以及多边形按照经纬度平面判断，
+聚合时按照固定大小的经纬度网格统计数量，用于地图显示；
+mongo存储时有中心的查询先通过2dsphere索引筛选，只有矩形或者多边形时遍历缓存
+*/
+
+const (
+	GeoModeNear    = "near"
+	GeoModeBox     = "box"
+	GeoModePolygon = "polygon"
+	GeoModeCluster = "cluster"
+)
+
+const (
+	earthRadius      = 6371008.8 //地球平均半径，单位米
+	maxPolygonPoints = 500
+	defaultGeoCell   = 1.0
+	minGeoCell       = 0.0001
+)
+
+// GeoQuery 多个条件同时满足，center为[经度,纬度]，和radius限定附近的范围，box为[最小经度,最小纬度,最大经度,最大纬度]，
+// 最小经度大于最大经度时表示跨越180度经线，polygon为多个[经度,纬度]
+type GeoQuery struct {
+	Mode    string      `json:"mode"`
+	Center  []float64   `json:"center"`
+	Radius  float64     `json:"radius"` //单位米
+	Box     []float64   `json:"box"`
+	Polygon [][]float64 `json:"polygon"`
+	Cell    float64     `json:"cell"`  //聚合网格的大小，单位度
+	Limit   int         `json:"limit"` //为0时不限制
+	center  *nosql.GeoPoint
+}
+
+// GeoHit 查询结果，distance为和中心的距离，单位米，没有指定中心时为0
+type GeoHit struct {
+	Type     string  `json:"type"`
+	UID      string  `json:"uid"`
+	Scene    string  `json:"scene"`
+	Name     string  `json:"name"`
+	Lng      float64 `json:"lng"`
+	Lat      float64 `json:"lat"`
+	Distance float64 `json:"distance"`
+}
+
+// GeoCluster 一个网格内的数量，位置为网格内对象的平均位置，只有一个对象时返回uid
+type GeoCluster struct {
+	Lng    float64    `json:"lng"`
+	Lat    float64    `json:"lat"`
+	Bounds [4]float64 `json:"bounds"`
+	Count  int        `json:"count"`
+	UID    string     `json:"uid,omitempty"`
+}
+
+type geoLocated interface {
+	pageable
+	geoPoint() *nosql.GeoPoint
+	geoHit() *GeoHit
+}
+
+// geoMatch 位置可能被并发修改，匹配时记录当时的点
+type geoMatch[T geoLocated] struct {
+	item     T
+	point    *nosql.GeoPoint
+	distance float64
+}
+
+// ParseGeoQuery mode为空时使用data中的mode
+func ParseGeoQuery(mode, data string) (*GeoQuery, error) {
+	query := new(GeoQuery)
+	if len(data) > 0 {
+		if err := json.Unmarshal([]byte(data), query); err != nil {
+			return nil, errors.New("the geo query format is error")
+		}
+	}
+	if len(mode) > 0 {
+		query.Mode = mode
+	}
+	switch query.Mode {
+	case GeoModeNear:
+		if len(query.Center) < 1 {
+			return nil, errors.New("the center is empty")
+		}
+	case GeoModeBox:
+		if len(query.Box) < 1 {
+			return nil, errors.New("the box is empty")
+		}
+	case GeoModePolygon:
+		if len(query.Polygon) < 1 {
+			return nil, errors.New("the polygon is empty")
+		}
+	case GeoModeCluster:
+	default:
+		return nil, errors.New("the geo mode not support of " + query.Mode)
+	}
+	if len(query.Center) > 0 {
+		if len(query.Center) != 2 {
+			return nil, errors.New("the center format is error")
+		}
+		point, err := nosql.NewGeoPoint(query.Center[0], query.Center[1])
+		if err != nil {
+			return nil, err
+		}
+		if query.Radius <= 0 || query.Radius > math.Pi*earthRadius {
+			return nil, errors.New("the radius is out of range")
+		}
+		query.center = point
+	}
+	if len(query.Box) > 0 {
+		if len(query.Box) != 4 || query.Box[1] > query.Box[3] {
+			return nil, errors.New("the box format is error")
+		}
+		for i := 0; i < 4; i += 2 {
+			if _, err := nosql.NewGeoPoint(query.Box[i], query.Box[i+1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(query.Polygon) > 0 {
+		for _, item := range query.Polygon {
+			if len(item) != 2 {
+				return nil, errors.New("the polygon format is error")
+			}
+			if _, err := nosql.NewGeoPoint(item[0], item[1]); err != nil {
+				return nil, err
+			}
+		}
+		//GeoJSON的多边形首尾相同
+		first, last := query.Polygon[0], query.Polygon[len(query.Polygon)-1]
+		if len(query.Polygon) > 1 && first[0] == last[0] && first[1] == last[1] {
+			query.Polygon = query.Polygon[:len(query.Polygon)-1]
+		}
+		if len(query.Polygon) < 3 || len(query.Polygon) > maxPolygonPoints {
+			return nil, errors.New("the polygon format is error")
+		}
+	}
+	if query.Cell == 0 {
+		query.Cell = defaultGeoCell
+	}
+	if query.Cell < minGeoCell || query.Cell > 90 {
+		return nil, errors.New("the cell is out of range")
+	}
+	if query.Limit < 0 {
+		query.Limit = 0
+	}
+	return query, nil
+}
+
+// match 返回是否满足条件以及和中心的距离
+func (mine *GeoQuery) match(point *nosql.GeoPoint) (bool, float64) {
+	if point == nil {
+		return false, 0
+	}
+	var distance float64
+	if mine.center != nil {
+		distance = geoDistance(mine.center, point)
+		if distance > mine.Radius {
+			return false, distance
+		}
+	}
+	if len(mine.Box) > 0 && !inBox(mine.Box, point.Lng(), point.Lat()) {
+		return false, distance
+	}
+	if len(mine.Polygon) > 0 && !inPolygon(mine.Polygon, point.Lng(), point.Lat()) {
+		return false, distance
+	}
+	return true, distance
+}
+
+// geoDistance 球面上两点的距离，单位米
+func geoDistance(from, to *nosql.GeoPoint) float64 {
+	lat1 := from.Lat() * math.Pi / 180
+	lat2 := to.Lat() * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (to.Lng() - from.Lng()) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func inBox(box []float64, lng, lat float64) bool {
+	if lat < box[1] || lat > box[3] {
+		return false
+	}
+	if box[0] <= box[2] {
+		return lng >= box[0] && lng <= box[2]
+	}
+	return lng >= box[0] || lng <= box[2]
+}
+
+// inPolygon 射线法判断点是否在多边形内
+func inPolygon(polygon [][]float64, lng, lat float64) bool {
+	in := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		xi, yi := polygon[i][0], polygon[i][1]
+		xj, yj := polygon[j][0], polygon[j][1]
+		if (yi > lat) != (yj > lat) && lng < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			in = !in
+		}
+	}
+	return in
+}
+
+// geoSelect 附近查询按照距离由近到远排序，其他按照创建时间排序
+func geoSelect[T geoLocated](query *GeoQuery, all []T) []geoMatch[T] {
+	list := make([]geoMatch[T], 0, len(all))
+	for _, item := range all {
+		point := item.geoPoint()
+		if ok, distance := query.match(point); ok {
+			list = append(list, geoMatch[T]{item: item, point: point, distance: distance})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if query.Mode == GeoModeNear && list[i].distance != list[j].distance {
+			return list[i].distance < list[j].distance
+		}
+		return list[i].item.pageKey().less(list[j].item.pageKey())
+	})
+	return list
+}
+
+// geoPage 附近查询按照距离排序，只能使用页码分页
+func geoPage[T geoLocated](query *GeoQuery, pager *Pager, all []T) (uint32, uint32, []T, error) {
+	if query.Mode == GeoModeCluster {
+		return 0, 0, nil, errors.New("the cluster not support the list")
+	}
+	matched := geoSelect(query, all)
+	items := make([]T, 0, len(matched))
+	for _, item := range matched {
+		items = append(items, item.item)
+	}
+	if query.Mode == GeoModeNear {
+		return PageSorted(pager, items)
+	}
+	total, max, list := PageList(pager, items)
+	return total, max, list, nil
+}
+
+// geoResult 聚合时返回[]*GeoCluster，其他返回[]*GeoHit
+func geoResult[T geoLocated](query *GeoQuery, all []T) interface{} {
+	matched := geoSelect(query, all)
+	if query.Mode == GeoModeCluster {
+		return geoClusters(query, matched)
+	}
+	if query.Limit > 0 && len(matched) > query.Limit {
+		matched = matched[:query.Limit]
+	}
+	list := make([]*GeoHit, 0, len(matched))
+	for _, item := range matched {
+		hit := item.item.geoHit()
+		hit.Lng = item.point.Lng()
+		hit.Lat = item.point.Lat()
+		if query.center != nil {
+			hit.Distance = math.Round(item.distance*10) / 10
+		}
+		list = append(list, hit)
+	}
+	return list
+}
+
+// geoClusters 按照网格统计，数量多的在前面
+func geoClusters[T geoLocated](query *GeoQuery, matched []geoMatch[T]) []*GeoCluster {
+	cells := make(map[[2]int]*GeoCluster, 20)
+	list := make([]*GeoCluster, 0, 20)
+	for _, item := range matched {
+		lng, lat := item.point.Lng(), item.point.Lat()
+		x := int(math.Floor((lng + 180) / query.Cell))
+		y := int(math.Floor((lat + 90) / query.Cell))
+		cluster, ok := cells[[2]int{x, y}]
+		if !ok {
+			cluster = &GeoCluster{UID: item.item.geoHit().UID, Bounds: [4]float64{
+				float64(x)*query.Cell - 180, float64(y)*query.Cell - 90,
+				math.Min(float64(x+1)*query.Cell-180, 180), math.Min(float64(y+1)*query.Cell-90, 90),
+			}}
+			cells[[2]int{x, y}] = cluster
+			list = append(list, cluster)
+		}
+		//先累加，最后求平均值
+		cluster.Lng += lng
+		cluster.Lat += lat
+		cluster.Count += 1
+	}
+	for _, cluster := range list {
+		cluster.Lng /= float64(cluster.Count)
+		cluster.Lat /= float64(cluster.Count)
+		if cluster.Count > 1 {
+			cluster.UID = ""
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		if list[i].Bounds[1] != list[j].Bounds[1] {
+			return list[i].Bounds[1] < list[j].Bounds[1]
+		}
+		return list[i].Bounds[0] < list[j].Bounds[0]
+	})
+	if query.Limit > 0 && len(list) > query.Limit {
+		list = list[:query.Limit]
+	}
+	return list
+}
+
+// geoNear 通过索引查询中心附近的uid，没有中心、不是mongo或者查询失败时返回false，由缓存判断全部对象
+func geoNear(table, scene string, query *GeoQuery) ([]string, bool) {
+	if query.center == nil || !isMongoStore() {
+		return nil, false
+	}
+	list, err := nosql.GetGeoWithin(table, scene, query.center, query.Radius/earthRadius)
+	if err != nil {
+		logger.Warnf("query the geo of %s failed that err = %s", table, err.Error())
+		return nil, false
+	}
+	return list, true
+}
+
+// geoScenes 索引筛选后的场景仍然需要按照条件判断
+func (mine *cacheContext) geoScenes(query *GeoQuery) []*SceneInfo {
+	uids, ok := geoNear(nosql.TableScene, "", query)
+	if !ok {
+		return mine.allScenes()
+	}
+	return mine.GetScenesByArray(uids)
+}
+
+func (mine *SceneInfo) geoRegions(query *GeoQuery) []*RegionInfo {
+	all := mine.regionList()
+	uids, ok := geoNear(nosql.TableRegion, mine.UID, query)
+	if !ok {
+		return all
+	}
+	near := make(map[string]bool, len(uids))
+	for _, uid := range uids {
+		near[uid] = true
+	}
+	list := make([]*RegionInfo, 0, len(uids))
+	for _, item := range all {
+		if near[item.UID] {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// GeoSearch table为scene或者region，区域需要指定场景
+func GeoSearch(table, scene string, query *GeoQuery) (interface{}, error) {
+	switch table {
+	case "", "scene":
+		return geoResult(query, cacheCtx.geoScenes(query)), nil
+	case "region":
+		info := cacheCtx.GetScene(scene)
+		if info == nil {
+			return nil, errors.New("not found the scene of " + scene)
+		}
+		return geoResult(query, info.geoRegions(query)), nil
+	}
+	return nil, errors.New("the geo type not support of " + table)
+}
+
+// parseLocation 位置为空时geo为nil，保存时统一为"经度,纬度"，格式和范围的检查见nosql.ParseGeoPoint
+func parseLocation(location string) (string, *nosql.GeoPoint, error) {
+	geo, err := nosql.ParseGeoPoint(location)
+	if err != nil || geo == nil {
+		return "", nil, err
+	}
+	return geo.String(), geo, nil
+}
+
+// geoOf 原来的数据没有geo时根据location解析，不能解析时为nil
+func geoOf(geo *nosql.GeoPoint, location string) *nosql.GeoPoint {
+	if geo != nil {
+		return geo
+	}
+	geo, _ = nosql.ParseGeoPoint(location)
+	return geo
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseGeoQuery(t *testing.T) {
+	query, err := ParseGeoQuery("", `{"mode":"polygon","polygon":[[0,0],[10,0],[10,10],[0,0]]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//首尾相同的点只保留一个
+	if len(query.Polygon) != 3 || query.Cell != defaultGeoCell {
+		t.Fatalf("the polygon query is error: %v, %f", query.Polygon, query.Cell)
+	}
+	query, err = ParseGeoQuery(GeoModeNear, `{"center":[116.4,39.9],"radius":1000,"limit":-1}`)
+	if err != nil || query.center == nil || query.center.Lng() != 116.4 || query.Limit != 0 {
+		t.Fatalf("the near query is error: %v", err)
+	}
+	malformed := []string{
+		`{"mode":"circle"}`,
+		`{"mode":"near"}`,
+		`{"mode":"near","center":[116.4],"radius":1000}`,
+		`{"mode":"near","center":[39.9,116.4],"radius":1000}`,
+		`{"mode":"near","center":[116.4,39.9]}`,
+		`{"mode":"near","center":[116.4,39.9],"radius":30000000}`,
+		`{"mode":"box"}`,
+		`{"mode":"box","box":[0,10,10,0]}`,
+		`{"mode":"box","box":[0,0,190,10]}`,
+		`{"mode":"box","box":[0,0,10]}`,
+		`{"mode":"polygon","polygon":[[0,0],[10,0],[0,0]]}`,
+		`{"mode":"polygon","polygon":[[0,0],[10],[10,10]]}`,
+		`{"mode":"cluster","cell":0.00001}`,
+		`{"mode":"cluster","cell":91}`,
+		`{"mode":`,
+	}
+	for _, data := range malformed {
+		if _, err = ParseGeoQuery("", data); err == nil {
+			t.Fatalf("the geo query %s should be rejected", data)
+		}
+	}
+}
+
+// geoHits 查询场景，结果按照顺序返回uid
+func geoHits(t *testing.T, data string) []*GeoHit {
+	t.Helper()
+	query, err := ParseGeoQuery("", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := GeoSearch("scene", "", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.([]*GeoHit)
+}
+
+// 内存存储没有2dsphere索引，有中心的查询遍历缓存中的全部场景
+func TestGeoSearch(t *testing.T) {
+	ctx := context.Background()
+	initMemory(t)
+	locations := []string{"116.397,39.918", "116.397,39.908", "121.47,31.23", "0,0", "179.5,0", ""}
+	scenes := make([]*SceneInfo, 0, len(locations))
+	for _, location := range locations {
+		scene := createScene(t, "scene-"+location, "")
+		if err := scene.UpdateLocation(ctx, location, "tester"); err != nil {
+			t.Fatal(err)
+		}
+		scenes = append(scenes, scene)
+	}
+	//附近按照距离排序
+	hits := geoHits(t, `{"mode":"near","center":[116.397,39.908],"radius":2000}`)
+	if len(hits) != 2 || hits[0].UID != scenes[1].UID || hits[1].UID != scenes[0].UID {
+		t.Fatalf("the near scenes is error: %d", len(hits))
+	}
+	if hits[0].Distance != 0 || hits[1].Distance < 1100 || hits[1].Distance > 1125 || hits[1].Lat != 39.918 {
+		t.Fatalf("the distance is error: %f, %f", hits[0].Distance, hits[1].Distance)
+	}
+	if hits = geoHits(t, `{"mode":"near","center":[116.397,39.908],"radius":2000,"limit":1}`); len(hits) != 1 {
+		t.Fatalf("the limit is error: %d", len(hits))
+	}
+	//矩形按照创建时间排序，最小经度大于最大经度时跨越180度经线
+	if hits = geoHits(t, `{"mode":"box","box":[116,39,117,40]}`); len(hits) != 2 || hits[0].UID != scenes[0].UID {
+		t.Fatalf("the box scenes is error: %d", len(hits))
+	}
+	if hits = geoHits(t, `{"mode":"box","box":[170,-10,-170,10]}`); len(hits) != 1 || hits[0].UID != scenes[4].UID {
+		t.Fatalf("the box across 180 is error: %d", len(hits))
+	}
+	if hits = geoHits(t, `{"mode":"box","box":[-1,-1,1,1]}`); len(hits) != 1 || hits[0].UID != scenes[3].UID {
+		t.Fatalf("the scene at 0,0 should be found: %d", len(hits))
+	}
+	hits = geoHits(t, `{"mode":"polygon","polygon":[[120,30],[123,30],[121.5,33]]}`)
+	if len(hits) != 1 || hits[0].UID != scenes[2].UID {
+		t.Fatalf("the polygon scenes is error: %d", len(hits))
+	}
+	//多个条件同时满足
+	if hits = geoHits(t, `{"mode":"near","center":[116.397,39.908],"radius":2000,"box":[116,39.91,117,40]}`); len(hits) != 1 {
+		t.Fatalf("the near in box is error: %d", len(hits))
+	}
+	//聚合的网格内只有一个对象时返回uid
+	query, _ := ParseGeoQuery(GeoModeCluster, `{"box":[100,20,130,50]}`)
+	result, err := GeoSearch("", "", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusters := result.([]*GeoCluster)
+	if len(clusters) != 2 || clusters[0].Count != 2 || len(clusters[0].UID) > 0 || clusters[1].UID != scenes[2].UID {
+		t.Fatalf("the clusters is error: %d", len(clusters))
+	}
+	if clusters[0].Lat != (39.918+39.908)/2 || clusters[0].Bounds != [4]float64{116, 39, 117, 40} {
+		t.Fatalf("the cluster position is error: %f, %v", clusters[0].Lat, clusters[0].Bounds)
+	}
+	if _, _, _, err = cacheCtx.GeoScenes(query, NewPager(1, 10)); err == nil {
+		t.Fatal("the cluster should not support the list")
+	}
+	near, _ := ParseGeoQuery(GeoModeNear, `{"center":[116.397,39.908],"radius":2000}`)
+	if total, _, list, er := cacheCtx.GeoScenes(near, NewPager(1, 1)); er != nil || total != 2 || list[0].UID != scenes[1].UID {
+		t.Fatalf("the near page is error: %v, %d", er, total)
+	}
+	if _, err = GeoSearch("region", "none", near); err == nil {
+		t.Fatal("the region search should need the scene")
+	}
+	if _, err = GeoSearch("group", "", near); err == nil {
+		t.Fatal("the group not support the geo search")
+	}
+}
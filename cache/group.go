@@ -1,8 +1,10 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"omo.msa.organization/proxy/nosql"
+	"sync"
 )
 
 type GroupInfo struct {
@@ -14,13 +16,15 @@ type GroupInfo struct {
 	Assistant string
 	Address   nosql.AddressInfo
 	Location  string
+	Geo       *nosql.GeoPoint
 	Scene     string
 	members   []string
+	//保护导出的字段，Scene以及UID不会修改
+	lock sync.RWMutex
 }
 
 func (mine *cacheContext) GetGroup(uid string) *GroupInfo {
-	for _, scene := range mine.scenes {
-		scene.initGroups()
+	for _, scene := range mine.allScenes() {
 		group := scene.GetGroup(uid)
 		if group != nil {
 			return group
@@ -31,9 +35,8 @@ func (mine *cacheContext) GetGroup(uid string) *GroupInfo {
 
 func (mine *cacheContext) GetGroupByMember(uid string) []*GroupInfo {
 	list := make([]*GroupInfo, 0, 5)
-	for _, scene := range mine.scenes {
-		scene.initGroups()
-		for _, group := range scene.groups {
+	for _, scene := range mine.allScenes() {
+		for _, group := range scene.groupList() {
 			if group.HadMember(uid) {
 				list = append(list, group)
 			}
@@ -44,10 +47,9 @@ func (mine *cacheContext) GetGroupByMember(uid string) []*GroupInfo {
 
 func (mine *cacheContext) GetGroupByContact(phone string) []*GroupInfo {
 	list := make([]*GroupInfo, 0, 5)
-	for _, scene := range mine.scenes {
-		scene.initGroups()
-		for _, group := range scene.groups {
-			if group.Contact == phone {
+	for _, scene := range mine.allScenes() {
+		for _, group := range scene.groupList() {
+			if group.contact() == phone {
 				list = append(list, group)
 			}
 		}
@@ -55,11 +57,10 @@ func (mine *cacheContext) GetGroupByContact(phone string) []*GroupInfo {
 	return list
 }
 
-func (mine *cacheContext) RemoveGroup(uid, operator string) error {
-	for _, scene := range mine.scenes {
-		scene.initGroups()
+func (mine *cacheContext) RemoveGroup(ctx context.Context, uid, operator string) error {
+	for _, scene := range mine.allScenes() {
 		if scene.HadGroup(uid) {
-			return scene.RemoveGroup(uid, operator)
+			return scene.RemoveGroup(ctx, uid, operator)
 		}
 	}
 	return nil
@@ -77,6 +78,7 @@ func (mine *GroupInfo) initInfo(db *nosql.Group) {
 	mine.Remark = db.Remark
 	mine.Master = db.Master
 	mine.Location = db.Location
+	mine.Geo = geoOf(db.Geo, db.Location)
 	mine.Assistant = db.Assistant
 	mine.Contact = db.Contact
 	mine.members = db.Members
@@ -84,78 +86,153 @@ func (mine *GroupInfo) initInfo(db *nosql.Group) {
 	mine.Scene = db.Scene
 }
 
-func (mine *GroupInfo) UpdateBase(name, remark, operator string) error {
+// syncInfo 其他实例修改后在原有的对象上同步字段，持有旧指针的调用者也能看到
+func (mine *GroupInfo) syncInfo(db *nosql.Group) {
+	geo := geoOf(db.Geo, db.Location)
+	mine.update(db.Operator, func() {
+		mine.UpdateTime = db.UpdatedTime
+		mine.Name = db.Name
+		mine.Cover = db.Cover
+		mine.Remark = db.Remark
+		mine.Master = db.Master
+		mine.Location = db.Location
+		mine.Geo = geo
+		mine.Assistant = db.Assistant
+		mine.Contact = db.Contact
+		mine.members = db.Members
+		mine.Address = db.Address
+	})
+}
+
+// update 写数据库成功后修改缓存的字段，读取字段需要持有读锁或者使用Clone
+func (mine *GroupInfo) update(operator string, fun func()) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	fun()
+	if len(operator) > 0 {
+		mine.Operator = operator
+	}
+}
+
+// Clone 字段以及成员的副本，用于返回给调用者，不能用于修改
+func (mine *GroupInfo) Clone() *GroupInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	tmp := new(GroupInfo)
+	tmp.baseInfo = mine.baseInfo
+	tmp.Remark = mine.Remark
+	tmp.Contact = mine.Contact
+	tmp.Cover = mine.Cover
+	tmp.Master = mine.Master
+	tmp.Assistant = mine.Assistant
+	tmp.Address = mine.Address
+	tmp.Location = mine.Location
+	tmp.Geo = mine.Geo
+	tmp.Scene = mine.Scene
+	tmp.members = append(make([]string, 0, len(mine.members)), mine.members...)
+	return tmp
+}
+
+func (mine *GroupInfo) name() string {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.Name
+}
+
+func (mine *GroupInfo) contact() string {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.Contact
+}
+
+func (mine *GroupInfo) UpdateBase(ctx context.Context, name, remark, operator string) error {
+	mine.lock.RLock()
 	if len(name) < 1 {
 		name = mine.Name
 	}
 	if len(remark) < 1 {
 		remark = mine.Remark
 	}
-	err := nosql.UpdateGroupBase(mine.UID, name, remark, operator)
+	mine.lock.RUnlock()
+	err := store.UpdateGroupBase(ctx, mine.UID, name, remark, operator)
 	if err == nil {
-		mine.Name = name
-		mine.Remark = remark
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Name = name
+			mine.Remark = remark
+		})
 	}
 	return err
 }
 
-func (mine *GroupInfo) UpdateContact(phone, operator string) error {
-	err := nosql.UpdateGroupContact(mine.UID, phone, operator)
+func (mine *GroupInfo) UpdateContact(ctx context.Context, phone, operator string) error {
+	err := store.UpdateGroupContact(ctx, mine.UID, phone, operator)
 	if err == nil {
-		mine.Contact = phone
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Contact = phone
+		})
 	}
 	return err
 }
 
-func (mine *GroupInfo) UpdateMaster(master, operator string) error {
-	err := nosql.UpdateGroupMaster(mine.UID, master, operator)
+func (mine *GroupInfo) UpdateMaster(ctx context.Context, master, operator string) error {
+	err := store.UpdateGroupMaster(ctx, mine.UID, master, operator)
 	if err == nil {
-		mine.Master = master
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Master = master
+		})
 	}
 	return err
 }
 
-func (mine *GroupInfo) UpdateAssistant(uid, operator string) error {
-	err := nosql.UpdateGroupAssistant(mine.UID, uid, operator)
+func (mine *GroupInfo) UpdateAssistant(ctx context.Context, uid, operator string) error {
+	err := store.UpdateGroupAssistant(ctx, mine.UID, uid, operator)
 	if err == nil {
-		mine.Assistant = uid
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Assistant = uid
+		})
 	}
 	return err
 }
 
-func (mine *GroupInfo) UpdateCover(cover, operator string) error {
-	err := nosql.UpdateGroupCover(mine.UID, cover, operator)
+func (mine *GroupInfo) UpdateCover(ctx context.Context, cover, operator string) error {
+	err := store.UpdateGroupCover(ctx, mine.UID, cover, operator)
 	if err == nil {
-		mine.Cover = cover
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Cover = cover
+		})
 	}
 	return err
 }
 
-func (mine *GroupInfo) UpdateLocation(local, operator string) error {
-	err := nosql.UpdateGroupLocation(mine.UID, local, operator)
+func (mine *GroupInfo) UpdateLocation(ctx context.Context, local, operator string) error {
+	local, geo, err := parseLocation(local)
+	if err != nil {
+		return err
+	}
+	err = store.UpdateGroupLocation(ctx, mine.UID, local, operator)
 	if err == nil {
-		mine.Location = local
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Location = local
+			mine.Geo = geo
+		})
 	}
 	return err
 }
 
-func (mine *GroupInfo) UpdateAddress(country, province, city, zone, operator string) error {
+func (mine *GroupInfo) UpdateAddress(ctx context.Context, country, province, city, zone, operator string) error {
 	addr := nosql.AddressInfo{Country: country, Province: province, City: city, Zone: zone}
-	err := nosql.UpdateGroupAddress(mine.UID, operator, addr)
+	err := store.UpdateGroupAddress(ctx, mine.UID, operator, addr)
 	if err == nil {
-		mine.Address = addr
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Address = addr
+		})
 	}
 	return err
 }
 
 func (mine *GroupInfo) HadMember(member string) bool {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
 	if mine.Master == member || mine.Assistant == member {
 		return true
 	}
@@ -168,36 +245,40 @@ func (mine *GroupInfo) HadMember(member string) bool {
 }
 
 func (mine *GroupInfo) AllMembers() []string {
-	return mine.members
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	list := make([]string, len(mine.members))
+	copy(list, mine.members)
+	return list
 }
 
-func (mine *GroupInfo) AppendMember(member string) error {
+func (mine *GroupInfo) AppendMember(ctx context.Context, member string) error {
 	if mine.HadMember(member) {
 		return errors.New("the member had existed")
 	}
-	err := nosql.AppendGroupMember(mine.UID, member)
+	err := store.AppendGroupMember(ctx, mine.UID, member)
 	if err == nil {
-		mine.members = append(mine.members, member)
+		mine.update("", func() {
+			mine.members = append(mine.members[:len(mine.members):len(mine.members)], member)
+		})
 	}
 	return err
 }
 
-func (mine *GroupInfo) SubtractMember(member string) error {
+func (mine *GroupInfo) SubtractMember(ctx context.Context, member string) error {
 	if !mine.HadMember(member) {
 		return errors.New("the member not existed")
 	}
-	err := nosql.SubtractGroupMember(mine.UID, member)
+	err := store.SubtractGroupMember(ctx, mine.UID, member)
 	if err == nil {
-		for i := 0; i < len(mine.members); i += 1 {
-			if mine.members[i] == member {
-				if i == len(mine.members)-1 {
-					mine.members = append(mine.members[:i])
-				} else {
-					mine.members = append(mine.members[:i], mine.members[i+1:]...)
+		mine.update("", func() {
+			for i := 0; i < len(mine.members); i += 1 {
+				if mine.members[i] == member {
+					mine.members = append(mine.members[:i:i], mine.members[i+1:]...)
+					break
 				}
-				break
 			}
-		}
+		})
 	}
 	return err
 }
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"errors"
+	"github.com/micro/go-micro/v2/logger"
+	"omo.msa.organization/config"
+	"sync"
+	"time"
+)
+
+/**
+数据库连接的监控，连接断开时进入只读模式，只使用缓存提供查询，恢复后自动退出
+*/
+
+type DBState uint8
+
+const (
+	DBStateOnline DBState = iota
+	DBStateOffline
+)
+
+const (
+	defaultPingInterval = 5 * time.Second
+	minRetryDelay       = time.Second
+	maxRetryDelay       = time.Minute
+)
+
+var ErrReadOnly = errors.New("the database is unavailable and the service is read only now")
+
+// HealthInfo 数据库连接的状态
+type HealthInfo struct {
+	State    DBState   `json:"state"`
+	Since    time.Time `json:"since"`    //状态变化的时间
+	Checked  time.Time `json:"checked"`  //最后一次检查的时间
+	Failures int       `json:"failures"` //连续失败的次数
+	Error    string    `json:"error"`
+}
+
+var health = struct {
+	lock sync.RWMutex
+	info HealthInfo
+}{info: HealthInfo{State: DBStateOnline, Since: time.Now()}}
+
+// IsReadOnly 数据库不可用时拒绝写操作
+func IsReadOnly() bool {
+	health.lock.RLock()
+	defer health.lock.RUnlock()
+	return health.info.State == DBStateOffline
+}
+
+func GetHealth() HealthInfo {
+	health.lock.RLock()
+	defer health.lock.RUnlock()
+	return health.info
+}
+
+// CheckHealth 检查一次数据库连接并且更新状态
+func CheckHealth() HealthInfo {
+	err := store.Ping()
+	health.lock.Lock()
+	defer health.lock.Unlock()
+	now := time.Now()
+	health.info.Checked = now
+	if err != nil {
+		health.info.Failures += 1
+		health.info.Error = err.Error()
+		if health.info.State == DBStateOnline {
+			health.info.State = DBStateOffline
+			health.info.Since = now
+			logger.Errorf("the database is unavailable and switch to read only that err = %s", err.Error())
+		}
+	} else {
+		if health.info.State == DBStateOffline {
+			logger.Infof("the database is recovered after %d failures", health.info.Failures)
+			health.info.State = DBStateOnline
+			health.info.Since = now
+		}
+		health.info.Failures = 0
+		health.info.Error = ""
+	}
+	return health.info
+}
+
+// Supervise 按照配置的间隔检查数据库连接
+func Supervise() {
+	interval := time.Duration(config.Schema.Database.Ping) * time.Second
+	if interval < time.Second {
+		interval = defaultPingInterval
+	}
+	go func() {
+		for {
+			time.Sleep(interval)
+			CheckHealth()
+		}
+	}()
+}
+
+// InitDataRetry 启动时数据库不可用则按照退避间隔重试，retry小于1时一直重试
+func InitDataRetry(retry int) error {
+	delay := minRetryDelay
+	for i := 1; ; i++ {
+		err := InitData()
+		if err == nil {
+			return nil
+		}
+		if retry > 0 && i >= retry {
+			return err
+		}
+		logger.Warnf("init the data failed and retry after %s that times = %d, err = %s", delay.String(), i, err.Error())
+		time.Sleep(delay)
+		delay = delay * 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
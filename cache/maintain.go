@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"omo.msa.organization/proxy"
@@ -22,10 +23,14 @@ type MaintainInfo struct {
 	Contents    []proxy.MaintainContent //内容，原因
 }
 
-func (mine *cacheContext) CreateMaintain(in *pb.ReqMaintainAdd, device string) (*MaintainInfo, error) {
+func (mine *cacheContext) CreateMaintain(ctx context.Context, in *pb.ReqMaintainAdd, device string) (*MaintainInfo, error) {
 	db := new(nosql.Maintain)
 	db.UID = primitive.NewObjectID()
-	db.ID = nosql.GetMaintainNextID()
+	id, err := store.GetMaintainNextID()
+	if err != nil {
+		return nil, err
+	}
+	db.ID = id
 	db.CreatedTime = time.Now()
 	db.Creator = in.Operator
 	db.Name = in.Name
@@ -45,7 +50,7 @@ func (mine *cacheContext) CreateMaintain(in *pb.ReqMaintainAdd, device string) (
 	for _, item := range in.Contents {
 		db.Contents = append(db.Contents, proxy.MaintainContent{Type: item.Type, Content: item.Content, Assets: item.Assets})
 	}
-	err := nosql.CreateMaintain(db)
+	err = store.CreateMaintain(ctx, db)
 	if err == nil {
 		info := new(MaintainInfo)
 		info.initInfo(db)
@@ -55,7 +60,7 @@ func (mine *cacheContext) CreateMaintain(in *pb.ReqMaintainAdd, device string) (
 }
 
 func (mine *cacheContext) GetMaintain(uid string) (*MaintainInfo, error) {
-	db, err := nosql.GetMaintain(uid)
+	db, err := store.GetMaintain(uid)
 	if err == nil {
 		info := new(MaintainInfo)
 		info.initInfo(db)
@@ -65,7 +70,7 @@ func (mine *cacheContext) GetMaintain(uid string) (*MaintainInfo, error) {
 }
 
 func (mine *cacheContext) GetMaintainByScene(uid string) ([]*MaintainInfo, error) {
-	dbs, err := nosql.GetMaintainsByOwner(uid)
+	dbs, err := store.GetMaintainsByOwner(uid)
 	list := make([]*MaintainInfo, 0, len(dbs))
 	if err == nil {
 		for _, db := range dbs {
@@ -78,7 +83,21 @@ func (mine *cacheContext) GetMaintainByScene(uid string) ([]*MaintainInfo, error
 }
 
 func (mine *cacheContext) GetMaintainByArea(scene, area string) ([]*MaintainInfo, error) {
-	dbs, err := nosql.GetMaintainsByArea(scene, area)
+	dbs, err := store.GetMaintainsByArea(scene, area)
+	list := make([]*MaintainInfo, 0, len(dbs))
+	if err == nil {
+		for _, db := range dbs {
+			info := new(MaintainInfo)
+			info.initInfo(db)
+			list = append(list, info)
+		}
+	}
+	return list, err
+}
+
+// QueryMaintains 存储按照组合条件过滤以及排序
+func (mine *cacheContext) QueryMaintains(scene string, query *FilterQuery) ([]*MaintainInfo, error) {
+	dbs, err := store.GetMaintainsByFilter(scene, query.Bson(), query.SortBson())
 	list := make([]*MaintainInfo, 0, len(dbs))
 	if err == nil {
 		for _, db := range dbs {
@@ -96,12 +115,14 @@ func (mine *MaintainInfo) initInfo(db *nosql.Maintain) {
 	mine.Name = db.Name
 	mine.Type = db.Type
 	mine.CreateTime = db.CreatedTime
+	mine.UpdateTime = db.UpdatedTime
 	mine.Creator = db.Creator
 	mine.Operator = db.Operator
 	mine.Scene = db.Scene
 	mine.Remark = db.Remark
 	mine.Date = db.Date
 	mine.Area = db.Area
+	mine.Device = db.Device
 	mine.Submitter = db.Submitter
 	mine.Contacts = db.Contacts
 	mine.Maintainers = db.Maintainers
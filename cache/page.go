@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"omo.msa.organization/config"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+分页，列表按照创建时间以及uid排序，游标记录上一页最后一个对象的排序值，
+下一页从排序值之后开始，缓存中新加入的对象不会让已经返回的对象重复或者遗漏
+*/
+
+const defaultPageNumber = 10
+
+type pageKey struct {
+	stamp int64
+	uid   string
+}
+
+func (mine pageKey) less(other pageKey) bool {
+	if mine.stamp == other.stamp {
+		return mine.uid < other.uid
+	}
+	return mine.stamp < other.stamp
+}
+
+func (mine pageKey) token() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", mine.stamp, mine.uid)))
+}
+
+func (mine *baseInfo) pageKey() pageKey {
+	return pageKey{stamp: mine.CreateTime.UnixNano(), uid: mine.UID}
+}
+
+type pageable interface {
+	pageKey() pageKey
+}
+
+// Pager 分页参数，cursor为空时使用页码
+type Pager struct {
+	Page   uint32
+	Number uint32
+	Next   string //下一页的游标，没有下一页时为空
+	cursor *pageKey
+}
+
+// NewPager 页码从1开始，小于1时为第一页
+func NewPager(page, number uint32) *Pager {
+	if page < 1 {
+		page = 1
+	}
+	return &Pager{Page: page, Number: pageNumber(number)}
+}
+
+// NewCursorPager token为空或者first时从第一页开始
+func NewCursorPager(token string, number uint32) (*Pager, error) {
+	tmp := &Pager{Page: 1, Number: pageNumber(number), cursor: &pageKey{}}
+	if len(token) < 1 || token == "first" {
+		return tmp, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("the cursor format is error")
+	}
+	arr := strings.SplitN(string(data), ":", 2)
+	if len(arr) != 2 || len(arr[1]) < 1 {
+		return nil, errors.New("the cursor format is error")
+	}
+	stamp, err := strconv.ParseInt(arr[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("the cursor format is error")
+	}
+	tmp.cursor = &pageKey{stamp: stamp, uid: arr[1]}
+	return tmp, nil
+}
+
+func (mine *Pager) Cursored() bool {
+	return mine.cursor != nil
+}
+
+// start 页码对应的起始位置，使用uint64计算，页码很大时不会溢出
+func (mine *Pager) start() uint64 {
+	if mine.Page < 1 {
+		return 0
+	}
+	return uint64(mine.Page-1) * uint64(mine.Number)
+}
+
+// pageNumber 每页的数量不能超过配置的上限
+func pageNumber(number uint32) uint32 {
+	if number < 1 {
+		number = defaultPageNumber
+	}
+	max := config.Schema.Database.Page
+	if max > 0 && number > uint32(max) {
+		number = uint32(max)
+	}
+	return number
+}
+
+// PageList 返回总数、总页数以及当前页，游标分页时同时计算当前的页码
+func PageList[T pageable](pager *Pager, all []T) (uint32, uint32, []T) {
+	sorted := make([]T, len(all))
+	copy(sorted, all)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].pageKey().less(sorted[j].pageKey())
+	})
+	var start uint64
+	if pager.cursor != nil {
+		start = uint64(sort.Search(len(sorted), func(i int) bool {
+			return pager.cursor.less(sorted[i].pageKey())
+		}))
+		pager.Page = uint32(start/uint64(pager.Number) + 1)
+	} else {
+		start = pager.start()
+	}
+	total, maxPage, list, more := pageSlice(pager, sorted, start)
+	pager.Next = ""
+	if more {
+		pager.Next = list[len(list)-1].pageKey().token()
+	}
+	return total, maxPage, list
+}
+
+// PageSorted 按照指定字段排序的列表只能使用页码分页
+func PageSorted[T any](pager *Pager, sorted []T) (uint32, uint32, []T, error) {
+	if pager.cursor != nil {
+		return 0, 0, nil, errors.New("the cursor not support the sort fields")
+	}
+	total, maxPage, list, _ := pageSlice(pager, sorted, pager.start())
+	pager.Next = ""
+	return total, maxPage, list, nil
+}
+
+// pageSlice 最后一个返回值表示是否有下一页，起始位置超过总数时返回空的一页
+func pageSlice[T any](pager *Pager, sorted []T, start uint64) (uint32, uint32, []T, bool) {
+	total := uint64(len(sorted))
+	if total < 1 {
+		return 0, 0, make([]T, 0, 1), false
+	}
+	number := uint64(pager.Number)
+	maxPage := uint32((total + number - 1) / number)
+	if start >= total {
+		return uint32(total), maxPage, make([]T, 0, 1), false
+	}
+	end := start + number
+	if end >= total {
+		return uint32(total), maxPage, sorted[start:total], false
+	}
+	return uint32(total), maxPage, sorted[start:end], true
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// pageItems 创建时间依次增加，same之后的对象和前一个使用相同的创建时间
+func pageItems(count, same int) []*baseInfo {
+	stamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	list := make([]*baseInfo, 0, count)
+	for i := 0; i < count; i++ {
+		if i < same || same < 1 {
+			stamp = stamp.Add(time.Second)
+		}
+		list = append(list, &baseInfo{UID: fmt.Sprintf("uid-%02d", i), CreateTime: stamp})
+	}
+	return list
+}
+
+func TestPageList(t *testing.T) {
+	cases := []struct {
+		name    string
+		total   int
+		page    uint32
+		number  uint32
+		maxPage uint32
+		first   string
+		length  int
+	}{
+		{name: "empty", total: 0, page: 1, number: 10, maxPage: 0, length: 0},
+		{name: "exact", total: 20, page: 2, number: 10, maxPage: 2, first: "uid-10", length: 10},
+		{name: "partial", total: 25, page: 3, number: 10, maxPage: 3, first: "uid-20", length: 5},
+		{name: "past end", total: 25, page: 4, number: 10, maxPage: 3, length: 0},
+		{name: "max page", total: 25, page: math.MaxUint32, number: 10, maxPage: 3, length: 0},
+		//uint32计算时起始位置溢出为10
+		{name: "overflow", total: 25, page: 1<<31 + 2, number: 10, maxPage: 3, length: 0},
+		{name: "zero page", total: 25, page: 0, number: 10, maxPage: 3, first: "uid-00", length: 10},
+	}
+	for _, item := range cases {
+		pager := NewPager(item.page, item.number)
+		total, maxPage, list := PageList(pager, pageItems(item.total, 0))
+		if total != uint32(item.total) || maxPage != item.maxPage || len(list) != item.length {
+			t.Fatalf("the page of %s is error: %d, %d, %d", item.name, total, maxPage, len(list))
+		}
+		if len(list) > 0 && list[0].UID != item.first {
+			t.Fatalf("the first of %s should be %s but %s", item.name, item.first, list[0].UID)
+		}
+		if _, _, sorted, _ := PageSorted(pager, pageItems(item.total, 0)); len(sorted) != item.length {
+			t.Fatalf("the sorted page of %s should be %d but %d", item.name, item.length, len(sorted))
+		}
+	}
+}
+
+func TestPageCursor(t *testing.T) {
+	//后面的对象创建时间相同，按照uid排序
+	all := pageItems(7, 2)
+	seen := make(map[string]bool, len(all))
+	token := ""
+	for page := uint32(1); page <= 4; page++ {
+		pager, err := NewCursorPager(token, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total, maxPage, list := PageList(pager, all)
+		if total != 7 || maxPage != 4 || pager.Page != page {
+			t.Fatalf("the cursor page is error: %d, %d, %d", total, maxPage, pager.Page)
+		}
+		for _, info := range list {
+			if seen[info.UID] {
+				t.Fatalf("the %s is repeated in page %d", info.UID, page)
+			}
+			seen[info.UID] = true
+		}
+		token = pager.Next
+		if (page < 4) != (len(token) > 0) {
+			t.Fatalf("the next cursor of page %d is error: %s", page, token)
+		}
+	}
+	if len(seen) != 7 {
+		t.Fatalf("the cursor pages should return all but %d", len(seen))
+	}
+	//游标所在的对象之后加入的相同时间的对象仍然可以返回
+	pager, _ := NewCursorPager(pageKey{stamp: all[4].CreateTime.UnixNano(), uid: all[4].UID}.token(), 2)
+	_, _, list := PageList(pager, all)
+	if len(list) != 2 || list[0].UID != "uid-05" || list[1].UID != "uid-06" {
+		t.Fatalf("the page after the same time is error: %v", len(list))
+	}
+	if _, err := NewCursorPager("bad", 2); err == nil {
+		t.Fatal("the bad cursor should be rejected")
+	}
+	if _, _, _, err := PageSorted(pager, all); err == nil {
+		t.Fatal("the cursor should not support the sorted list")
+	}
+}
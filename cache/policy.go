@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"errors"
+	"github.com/micro/go-micro/v2/logger"
+	"omo.msa.organization/config"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+/**
+缓存策略，场景的子集合（小组、房间、区域）超过有效期后重新加载，
+加载了子集合的场景超过上限时按照最近使用淘汰最久未使用的子集合。
+场景本身不淘汰：场景列表的分页、管理员以及成员索引、搜索以及缓存快照都需要全部的场景，
+启动时加载全部未删除的场景，GetScene只补充其他实例新建的场景，删除时移除，
+所以缓存的场景数量和数据库中未删除的场景一致，不会因为访问而增长；
+不带子集合的场景只有基本字段以及成员，内存主要由子集合占用，所以上限只限制子集合
+*/
+
+// CacheStats 缓存的数量以及命中率
+type CacheStats struct {
+	Scenes    int     `json:"scenes"`   //缓存的场景
+	Resident  int     `json:"resident"` //加载了子集合的场景
+	Capacity  int     `json:"capacity"`
+	Groups    int     `json:"groups"`
+	Rooms     int     `json:"rooms"`
+	Regions   int     `json:"regions"`
+	Devices   int     `json:"devices"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	Expires   uint64  `json:"expires"` //超过有效期重新加载的次数
+	Evicts    uint64  `json:"evicts"`  //淘汰的次数
+	HitRate   float64 `json:"hitRate"`
+	HeapBytes uint64  `json:"heapBytes"`
+}
+
+var counters struct {
+	hits    uint64
+	misses  uint64
+	expires uint64
+	evicts  uint64
+}
+
+func countHit(hit bool) {
+	if hit {
+		atomic.AddUint64(&counters.hits, 1)
+	} else {
+		atomic.AddUint64(&counters.misses, 1)
+	}
+}
+
+func countExpire(expired bool) {
+	if expired {
+		atomic.AddUint64(&counters.expires, 1)
+	}
+}
+
+// fresh 子集合已经加载并且没有超过有效期，ttl为0时一直有效
+func fresh(stamp time.Time) bool {
+	if stamp.IsZero() {
+		return false
+	}
+	ttl := time.Duration(config.Schema.Database.TTL) * time.Second
+	return ttl <= 0 || time.Since(stamp) < ttl
+}
+
+func (mine *SceneInfo) touch() {
+	atomic.StoreInt64(&mine.used, time.Now().UnixNano())
+}
+
+func (mine *SceneInfo) resident() bool {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.groups != nil || mine.rooms != nil || mine.regions != nil
+}
+
+// dropChildren 释放子集合以及索引，下次访问时重新加载
+func (mine *SceneInfo) dropChildren() {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	for _, room := range mine.rooms {
+		cacheCtx.unindexRoom(room.UID)
+	}
+	for _, region := range mine.regions {
+		cacheCtx.unindexRegion(region.UID)
+	}
+	mine.groups = nil
+	mine.rooms = nil
+	mine.regions = nil
+	mine.groupsAt = time.Time{}
+	mine.roomsAt = time.Time{}
+	mine.regionsAt = time.Time{}
+}
+
+// checkResident 超过上限时释放最久未使用的场景的子集合，不释放当前加载的场景
+func (mine *cacheContext) checkResident(current *SceneInfo) {
+	capacity := config.Schema.Database.Capacity
+	if capacity < 1 {
+		return
+	}
+	list := make([]*SceneInfo, 0, capacity+1)
+	for _, scene := range mine.allScenes() {
+		if scene != current && scene.resident() {
+			list = append(list, scene)
+		}
+	}
+	over := len(list) + 1 - capacity
+	if over < 1 {
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return atomic.LoadInt64(&list[i].used) < atomic.LoadInt64(&list[j].used)
+	})
+	for i := 0; i < over; i += 1 {
+		list[i].dropChildren()
+		atomic.AddUint64(&counters.evicts, 1)
+	}
+	logger.Infof("evict the children of scenes that number = %d", over)
+}
+
+// Invalidate 释放场景的子集合，scene为空时释放全部场景
+func Invalidate(scene string) error {
+	if len(scene) < 1 {
+		for _, info := range cacheCtx.allScenes() {
+			info.dropChildren()
+		}
+		return nil
+	}
+	info := cacheCtx.lookupScene(scene)
+	if info == nil {
+		return errors.New("the scene not found in cache of " + scene)
+	}
+	info.dropChildren()
+	return nil
+}
+
+// GetCacheStats 读取内存统计会短暂的暂停所有协程，只在需要时调用
+func GetCacheStats() CacheStats {
+	info := CacheStats{Capacity: config.Schema.Database.Capacity}
+	for _, scene := range cacheCtx.allScenes() {
+		info.Scenes += 1
+		scene.lock.RLock()
+		if scene.groups != nil || scene.rooms != nil || scene.regions != nil {
+			info.Resident += 1
+		}
+		info.Groups += len(scene.groups)
+		info.Rooms += len(scene.rooms)
+		info.Regions += len(scene.regions)
+		scene.lock.RUnlock()
+	}
+	registry := cacheCtx.terminals()
+	registry.lock.RLock()
+	info.Devices = len(registry.devices)
+	registry.lock.RUnlock()
+	info.Hits = atomic.LoadUint64(&counters.hits)
+	info.Misses = atomic.LoadUint64(&counters.misses)
+	info.Expires = atomic.LoadUint64(&counters.expires)
+	info.Evicts = atomic.LoadUint64(&counters.evicts)
+	if total := info.Hits + info.Misses; total > 0 {
+		info.HitRate = float64(info.Hits) / float64(total)
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	info.HeapBytes = mem.HeapAlloc
+	return info
+}
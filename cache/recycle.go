@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/micro/go-micro/v2/logger"
+	"omo.msa.organization/config"
+	"omo.msa.organization/proxy/nosql"
+	"sort"
+	"time"
+)
+
+/**
+回收站，软删除的对象可以恢复，超过保留天数后彻底删除
+*/
+
+// GetRecycles 场景下删除的对象，最近删除的在前面
+func (mine *cacheContext) GetRecycles(scene string) ([]*nosql.RecycleInfo, error) {
+	if len(scene) < 1 {
+		return nil, errors.New("the scene uid is empty")
+	}
+	list, err := store.GetRecycles(scene)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Deleted.After(list[j].Deleted)
+	})
+	return list, nil
+}
+
+// Restore 恢复删除的对象，上级对象必须存在
+func (mine *cacheContext) Restore(ctx context.Context, table, uid, operator string) error {
+	if len(uid) < 1 {
+		return errors.New("the recycle uid is empty")
+	}
+	switch table {
+	case nosql.TableScene:
+		return mine.restoreScene(ctx, uid, operator)
+	case nosql.TableRoom:
+		db, err := store.GetRoom(uid)
+		if err != nil {
+			return err
+		}
+		scene, err := mine.checkRecycle(db.DeleteTime, db.Scene)
+		if err != nil {
+			return err
+		}
+		if scene.HadRoomByName(db.Name) {
+			return errors.New("the room name is repeated")
+		}
+		err = store.RestoreRecycle(ctx, table, uid, operator)
+		if err == nil {
+			db.DeleteTime = time.Time{}
+			scene.syncRoom(db)
+		}
+		return err
+	case nosql.TableGroup:
+		db, err := store.GetGroup(uid)
+		if err != nil {
+			return err
+		}
+		scene, err := mine.checkRecycle(db.DeleteTime, db.Scene)
+		if err != nil {
+			return err
+		}
+		err = store.RestoreRecycle(ctx, table, uid, operator)
+		if err == nil {
+			db.DeleteTime = time.Time{}
+			scene.syncGroup(db)
+		}
+		return err
+	case nosql.TableRegion:
+		db, err := store.GetRegion(uid)
+		if err != nil {
+			return err
+		}
+		scene, err := mine.checkRecycle(db.DeleteTime, db.Scene)
+		if err != nil {
+			return err
+		}
+		if len(db.Parent) > 0 {
+			parent, er := store.GetRegion(db.Parent)
+			if er != nil || !parent.DeleteTime.IsZero() {
+				return errors.New("the parent region not found")
+			}
+		}
+		err = store.RestoreRecycle(ctx, table, uid, operator)
+		if err == nil {
+			db.DeleteTime = time.Time{}
+			scene.syncRegion(db)
+		}
+		return err
+	case nosql.TableArea:
+		db, err := store.GetArea(uid)
+		if err != nil {
+			return err
+		}
+		_, err = mine.checkRecycle(db.DeleteTime, db.Scene)
+		if err != nil {
+			return err
+		}
+		if len(db.Parent) > 0 && mine.GetRoom(db.Parent) == nil {
+			return errors.New("the parent room not found")
+		}
+		return store.RestoreRecycle(ctx, table, uid, operator)
+	case nosql.TableDevice:
+		db, err := store.GetDevice(uid)
+		if err != nil {
+			return err
+		}
+		if db.DeleteTime.IsZero() {
+			return errors.New("the device is not deleted")
+		}
+		if len(db.Scene) > 0 && mine.GetScene(db.Scene) == nil {
+			return errors.New("the scene of device not found")
+		}
+		other, er := store.GetDeviceBySN(db.SN)
+		if er == nil && other.UID != db.UID && other.DeleteTime.IsZero() {
+			return errors.New("the device sn is repeated")
+		}
+		err = store.RestoreRecycle(ctx, table, uid, operator)
+		if err == nil {
+			mine.syncDevice(uid)
+		}
+		return err
+	case nosql.TableMaintain:
+		db, err := store.GetMaintain(uid)
+		if err != nil {
+			return err
+		}
+		_, err = mine.checkRecycle(db.DeleteTime, db.Scene)
+		if err != nil {
+			return err
+		}
+		return store.RestoreRecycle(ctx, table, uid, operator)
+	}
+	return errors.New("the table not support recycle of " + table)
+}
+
+// checkRecycle 对象必须处于删除状态并且所属场景存在
+func (mine *cacheContext) checkRecycle(deleted time.Time, scene string) (*SceneInfo, error) {
+	if deleted.IsZero() {
+		return nil, errors.New("the object is not deleted")
+	}
+	info := mine.GetScene(scene)
+	if info == nil {
+		return nil, errors.New("the scene not found of " + scene)
+	}
+	return info, nil
+}
+
+// restoreScene 同一次级联删除的子对象使用相同的删除时间，恢复场景时一起恢复
+func (mine *cacheContext) restoreScene(ctx context.Context, uid, operator string) error {
+	db, err := store.GetScene(uid)
+	if err != nil {
+		return err
+	}
+	if db.DeleteTime.IsZero() {
+		return errors.New("the scene is not deleted")
+	}
+	if len(db.Master) > 0 && IsMasterUsed(db.Master) {
+		return errors.New("the scene master had used by other scene")
+	}
+	list, err := store.GetRecycles(uid)
+	if err != nil {
+		return err
+	}
+	var stamp time.Time
+	for _, item := range list {
+		if item.Table == nosql.TableScene {
+			stamp = item.Deleted
+		}
+	}
+	ops := []*nosql.WriteOp{nosql.RestoreOp(nosql.TableScene, uid, operator)}
+	for _, item := range list {
+		if item.Table == nosql.TableScene || !item.Deleted.Equal(stamp) {
+			continue
+		}
+		ops = append(ops, nosql.RestoreOp(item.Table, item.UID, operator))
+	}
+	err = store.RunTransaction(ctx, ops)
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if op.Table == nosql.TableDevice {
+			mine.syncDevice(op.UID)
+		}
+	}
+	if mine.GetScene(uid) == nil {
+		return errors.New("the scene not found after restore")
+	}
+	return nil
+}
+
+// PurgeRecycles 彻底删除超过保留天数的对象，days小于1时不删除
+func PurgeRecycles(ctx context.Context, days int) ([]*nosql.RecycleInfo, error) {
+	if days < 1 {
+		return make([]*nosql.RecycleInfo, 0, 1), nil
+	}
+	stamp := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	list, err := store.GetRecyclesBefore(stamp)
+	if err != nil {
+		return nil, err
+	}
+	purged := make([]*nosql.RecycleInfo, 0, len(list))
+	for _, item := range list {
+		er := store.PurgeRecycle(ctx, item.Table, item.UID)
+		if er != nil {
+			logger.Warnf("purge the %s of %s failed that err = %s", item.Table, item.UID, er.Error())
+			continue
+		}
+		purged = append(purged, item)
+	}
+	return purged, nil
+}
+
+// CheckRecycles 按照配置的保留天数每天清理一次回收站
+func CheckRecycles() {
+	days := config.Schema.Database.Retention
+	if days < 1 {
+		return
+	}
+	go func() {
+		ctx := WithPath(context.Background(), "recycle.purge")
+		for {
+			if IsReadOnly() {
+				logger.Warn("skip purge the recycles because the database is unavailable")
+			} else if list, err := PurgeRecycles(ctx, days); err != nil {
+				logger.Warnf("purge the recycles failed that err = %s", err.Error())
+			} else if len(list) > 0 {
+				logger.Infof("purge the recycles that number = %d", len(list))
+			}
+			time.Sleep(24 * time.Hour)
+		}
+	}()
+}
@@ -1,8 +1,10 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"omo.msa.organization/proxy/nosql"
+	"sync"
 )
 
 type RegionInfo struct {
@@ -14,41 +16,54 @@ type RegionInfo struct {
 	Master string
 	Code string
 	Location string
+	Geo *nosql.GeoPoint
 	Address nosql.AddressInfo
 	Members []string
+	//保护导出的字段，Scene以及UID不会修改
+	lock sync.RWMutex
 }
 
+// GetRegion 区域缓存在所属的场景中，第一次访问时加载场景的所有区域
 func (mine *cacheContext)GetRegion(uid string) (*RegionInfo,error) {
-	db,err := nosql.GetRegion(uid)
-	if err == nil {
-		info := new(RegionInfo)
-		info.initInfo(db)
+	if info := mine.lookupRegion(uid);info != nil {
 		return info,nil
 	}
-	return nil, err
+	db,err := store.GetRegion(uid)
+	if err != nil {
+		return nil, err
+	}
+	if !db.DeleteTime.IsZero() {
+		return nil, errors.New("the region had deleted of " + uid)
+	}
+	scene := mine.GetScene(db.Scene)
+	if scene == nil {
+		return nil, errors.New("not found the scene of region " + uid)
+	}
+	return scene.GetRegion(uid)
 }
 
 func (mine *cacheContext)GetRegionsByScene(scene string) []*RegionInfo {
-	list := make([]*RegionInfo, 0, 10)
-	dbs,err := nosql.GetRegionsByScene(scene)
-	if err == nil {
-		for _, db := range dbs {
-			info := new(RegionInfo)
-			info.initInfo(db)
-			list = append(list, info)
-		}
+	info := mine.GetScene(scene)
+	if info == nil {
+		return make([]*RegionInfo, 0, 1)
 	}
-	return list
+	return info.regionList()
 }
 
+// GetRegionsByParent 上级是缓存的区域时使用区域树，上级已经删除或者不是区域时从存储中查询下级
 func (mine *cacheContext)GetRegionsByParent(parent string) []*RegionInfo {
-	list := make([]*RegionInfo, 0, 10)
-	dbs,err := nosql.GetRegionsByParent(parent)
+	info,err := mine.GetRegion(parent)
 	if err == nil {
-		for _, db := range dbs {
-			info := new(RegionInfo)
-			info.initInfo(db)
-			list = append(list, info)
+		return info.Children()
+	}
+	list := make([]*RegionInfo, 0, 1)
+	dbs,err := store.GetRegionsByParent(parent)
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		if tmp,er := mine.GetRegion(db.UID.Hex());er == nil {
+			list = append(list, tmp)
 		}
 	}
 	return list
@@ -69,6 +84,7 @@ func (mine *RegionInfo)initInfo(db *nosql.Region)  {
 	mine.Master = db.Master
 	mine.Entity = db.Entity
 	mine.Location = db.Location
+	mine.Geo = geoOf(db.Geo, db.Location)
 	mine.Address = db.Address
 	mine.Members = db.Members
 	if mine.Members == nil {
@@ -76,84 +92,207 @@ func (mine *RegionInfo)initInfo(db *nosql.Region)  {
 	}
 }
 
-func (mine *RegionInfo)UpdateBase(name, remark, operator string) error {
+// syncInfo 其他实例修改后在原有的对象上同步字段，持有旧指针的调用者也能看到
+func (mine *RegionInfo)syncInfo(db *nosql.Region) {
+	tmp := new(RegionInfo)
+	tmp.initInfo(db)
+	mine.update(tmp.Operator, func() {
+		mine.UpdateTime = tmp.UpdateTime
+		mine.Name = tmp.Name
+		mine.Remark = tmp.Remark
+		mine.Code = tmp.Code
+		mine.Parent = tmp.Parent
+		mine.Master = tmp.Master
+		mine.Entity = tmp.Entity
+		mine.Location = tmp.Location
+		mine.Geo = tmp.Geo
+		mine.Address = tmp.Address
+		mine.Members = tmp.Members
+	})
+}
+
+// update 写数据库成功后修改缓存的字段，读取字段需要持有读锁或者使用Clone
+func (mine *RegionInfo)update(operator string, fun func()) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	fun()
+	if len(operator) > 0 {
+		mine.Operator = operator
+	}
+}
+
+// Clone 字段以及成员的副本，用于返回给调用者，不能用于修改
+func (mine *RegionInfo)Clone() *RegionInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	tmp := new(RegionInfo)
+	tmp.baseInfo = mine.baseInfo
+	tmp.Entity = mine.Entity
+	tmp.Remark = mine.Remark
+	tmp.Scene = mine.Scene
+	tmp.Parent = mine.Parent
+	tmp.Master = mine.Master
+	tmp.Code = mine.Code
+	tmp.Location = mine.Location
+	tmp.Geo = mine.Geo
+	tmp.Address = mine.Address
+	tmp.Members = append(make([]string, 0, len(mine.Members)), mine.Members...)
+	return tmp
+}
+
+func (mine *RegionInfo)parent() string {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.Parent
+}
+
+func (mine *RegionInfo)AllMembers() []string {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	list := make([]string, len(mine.Members))
+	copy(list, mine.Members)
+	return list
+}
+
+func (mine *RegionInfo)UpdateBase(ctx context.Context, name, remark, operator string) error {
+	mine.lock.RLock()
 	if len(name) < 1 {
 		name = mine.Name
 	}
 	if len(remark) < 1 {
 		remark = mine.Remark
 	}
-	err := nosql.UpdateRegionBase(mine.UID, name, remark, operator)
+	mine.lock.RUnlock()
+	err := store.UpdateRegionBase(ctx, mine.UID, name, remark, operator)
 	if err == nil {
-		mine.Name = name
-		mine.Remark = remark
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Name = name
+			mine.Remark = remark
+		})
 	}
 	return err
 }
 
-func (mine *RegionInfo)Remove(operator string) error {
+func (mine *RegionInfo)Remove(ctx context.Context, operator string) error {
 	if mine.HadChildren() {
 		return errors.New("the region had children")
 	}
-	return nosql.RemoveRegion(mine.UID, operator)
+	err := store.RemoveRegion(ctx, mine.UID, operator)
+	if err == nil {
+		if scene := cacheCtx.GetScene(mine.Scene);scene != nil {
+			scene.dropRegion(mine.UID)
+		}
+		cacheCtx.unindexRegion(mine.UID)
+	}
+	return err
 }
 
 func (mine *RegionInfo)HadChildren() bool {
-	list := cacheCtx.GetRegionsByParent(mine.UID)
-	if len(list) > 0 {
-		return true
-	}
-	return false
+	return len(mine.Children()) > 0
 }
 
-func (mine *RegionInfo)UpdateMaster(master, operator string) error {
-	err := nosql.UpdateRegionMaster(mine.UID, master, operator)
+func (mine *RegionInfo)UpdateMaster(ctx context.Context, master, operator string) error {
+	err := store.UpdateRegionMaster(ctx, mine.UID, master, operator)
 	if err == nil {
-		mine.Master = master
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Master = master
+		})
 	}
 	return err
 }
 
-func (mine *RegionInfo)UpdateParent(parent, operator string) error {
-	err := nosql.UpdateRegionParent(mine.UID, parent, operator)
+// UpdateParent 移动区域以及下级区域，新的上级不能是自己或者下级，移动后的层数不能超过MaxRegionDepth
+func (mine *RegionInfo)UpdateParent(ctx context.Context, parent, operator string) error {
+	if mine.parent() == parent {
+		return nil
+	}
+	if mine.UID == parent {
+		return errors.New("the region can not be the parent of itself")
+	}
+	scene := cacheCtx.GetScene(mine.Scene)
+	if scene == nil {
+		return errors.New("not found the scene of region " + mine.UID)
+	}
+	scene.move.Lock()
+	defer scene.move.Unlock()
+	if len(parent) > 0 {
+		target := scene.findRegion(parent)
+		if target == nil {
+			return errors.New("the parent region not found")
+		}
+		for _, item := range append(target.Ancestors(), target) {
+			if item.UID == mine.UID {
+				return errors.New("the parent region is a descendant of the region")
+			}
+		}
+		if target.Depth()+mine.Height() > MaxRegionDepth {
+			return errors.New("the region tree is too deep")
+		}
+	}
+	err := store.UpdateRegionParent(ctx, mine.UID, parent, operator)
 	if err == nil {
-		mine.Parent = parent
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Parent = parent
+		})
 	}
 	return err
 }
 
-func (mine *RegionInfo)UpdateLocation(local, operator string) error {
-	err := nosql.UpdateRegionLocation(mine.UID, local, operator)
+func (mine *RegionInfo)geoPoint() *nosql.GeoPoint {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.Geo
+}
+
+func (mine *RegionInfo)geoHit() *GeoHit {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return &GeoHit{Type: "region", UID: mine.UID, Scene: mine.Scene, Name: mine.Name}
+}
+
+func (mine *RegionInfo)UpdateLocation(ctx context.Context, local, operator string) error {
+	local, geo, err := parseLocation(local)
+	if err != nil {
+		return err
+	}
+	err = store.UpdateRegionLocation(ctx, mine.UID, local, operator)
 	if err == nil {
-		mine.Location = local
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Location = local
+			mine.Geo = geo
+		})
 	}
 	return err
 }
 
-func (mine *RegionInfo)UpdateEntity(entity, operator string) error {
-	err := nosql.UpdateRegionEntity(mine.UID, entity, operator)
+func (mine *RegionInfo)UpdateEntity(ctx context.Context, entity, operator string) error {
+	err := store.UpdateRegionEntity(ctx, mine.UID, entity, operator)
 	if err == nil {
-		mine.Entity = entity
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Entity = entity
+		})
 	}
 	return err
 }
 
-func (mine *RegionInfo)UpdateAddress(country, province, city, zone, operator string) error {
+func (mine *RegionInfo)UpdateAddress(ctx context.Context, country, province, city, zone, operator string) error {
 	addr := nosql.AddressInfo{Country: country, Province: province, City: city, Zone: zone}
-	err := nosql.UpdateRegionAddress(mine.UID, operator, addr)
+	err := store.UpdateRegionAddress(ctx, mine.UID, operator, addr)
 	if err == nil {
-		mine.Address = addr
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Address = addr
+		})
 	}
 	return err
 }
 
 func (mine *RegionInfo)HadMember(member string) bool {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.hadMember(member)
+}
+
+func (mine *RegionInfo)hadMember(member string) bool {
 	if mine.Master == member  {
 		return true
 	}
@@ -165,35 +304,180 @@ func (mine *RegionInfo)HadMember(member string) bool {
 	return false
 }
 
-func (mine *RegionInfo)AppendMember(member string) error {
+func (mine *RegionInfo)AppendMember(ctx context.Context, member string) error {
 	if mine.HadMember(member){
 		return nil
 	}
-	err := nosql.AppendRegionMember(mine.UID, member)
+	err := store.AppendRegionMember(ctx, mine.UID, member)
 	if err == nil {
-		mine.Members = append(mine.Members, member)
+		mine.update("", func() {
+			if !mine.hadMember(member) {
+				mine.Members = append(mine.Members, member)
+			}
+		})
 	}
 	return err
 }
 
-func (mine *RegionInfo)SubtractMember(member string) error {
+func (mine *RegionInfo)SubtractMember(ctx context.Context, member string) error {
 	if !mine.HadMember(member){
 		return nil
 	}
-	err := nosql.SubtractRegionMember(mine.UID, member)
+	err := store.SubtractRegionMember(ctx, mine.UID, member)
 	if err == nil {
-		for i := 0;i < len(mine.Members);i += 1 {
-			if mine.Members[i] == member {
-				if i == len(mine.Members) - 1 {
-					mine.Members = append(mine.Members[:i])
-				}else{
-					mine.Members = append(mine.Members[:i], mine.Members[i+1:]...)
+		mine.update("", func() {
+			for i := 0;i < len(mine.Members);i += 1 {
+				if mine.Members[i] == member {
+					mine.Members = append(mine.Members[:i:i], mine.Members[i+1:]...)
+					break
 				}
-
-				break
 			}
-		}
+		})
 	}
 	return err
 }
 
+
+//region Tree
+// MaxRegionDepth 区域树的最大层数，根节点为第一层
+const MaxRegionDepth = 10
+
+// RegionNode 区域树的节点
+type RegionNode struct {
+	*RegionInfo
+	Depth    int
+	Children []*RegionNode
+}
+
+// Flatten 先序遍历，上级在下级的前面
+func (mine *RegionNode)Flatten() []*RegionInfo {
+	list := []*RegionInfo{mine.RegionInfo}
+	for _, child := range mine.Children {
+		list = append(list, child.Flatten()...)
+	}
+	return list
+}
+
+// GetRegionTree 场景的区域树，上级不存在的区域作为根节点
+func (mine *SceneInfo)GetRegionTree() []*RegionNode {
+	all := mine.regionList()
+	kids := make(map[string][]*RegionInfo, len(all))
+	exists := make(map[string]bool, len(all))
+	for _, item := range all {
+		exists[item.UID] = true
+	}
+	roots := make([]*RegionNode, 0, 5)
+	for _, item := range all {
+		if parent := item.parent(); len(parent) > 0 && exists[parent] {
+			kids[parent] = append(kids[parent], item)
+		} else {
+			roots = append(roots, &RegionNode{RegionInfo: item, Depth: 1})
+		}
+	}
+	for _, root := range roots {
+		buildRegionNode(root, kids)
+	}
+	return roots
+}
+
+func buildRegionNode(node *RegionNode, kids map[string][]*RegionInfo) {
+	for _, item := range kids[node.UID] {
+		child := &RegionNode{RegionInfo: item, Depth: node.Depth + 1}
+		node.Children = append(node.Children, child)
+		if child.Depth <= MaxRegionDepth {
+			buildRegionNode(child, kids)
+		}
+	}
+}
+
+// Children 直接下级
+func (mine *RegionInfo)Children() []*RegionInfo {
+	list := make([]*RegionInfo, 0, 5)
+	scene := cacheCtx.GetScene(mine.Scene)
+	if scene == nil {
+		return list
+	}
+	for _, item := range scene.regionList() {
+		if item.parent() == mine.UID {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Ancestors 所有上级，最近的在前面
+func (mine *RegionInfo)Ancestors() []*RegionInfo {
+	list := make([]*RegionInfo, 0, 5)
+	scene := cacheCtx.GetScene(mine.Scene)
+	if scene == nil {
+		return list
+	}
+	parent := mine.parent()
+	for len(parent) > 0 && len(list) < MaxRegionDepth {
+		item := scene.findRegion(parent)
+		if item == nil || item.UID == mine.UID {
+			break
+		}
+		list = append(list, item)
+		parent = item.parent()
+	}
+	return list
+}
+
+// Descendants 所有下级，先序遍历
+func (mine *RegionInfo)Descendants() []*RegionInfo {
+	list := make([]*RegionInfo, 0, 10)
+	scene := cacheCtx.GetScene(mine.Scene)
+	if scene == nil {
+		return list
+	}
+	for _, root := range scene.GetRegionTree() {
+		if node := root.find(mine.UID); node != nil {
+			return node.Flatten()[1:]
+		}
+	}
+	return list
+}
+
+func (mine *RegionNode)find(uid string) *RegionNode {
+	if mine.UID == uid {
+		return mine
+	}
+	for _, child := range mine.Children {
+		if node := child.find(uid); node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+// Depth 所在的层数，根节点为1
+func (mine *RegionInfo)Depth() int {
+	return len(mine.Ancestors()) + 1
+}
+
+// Height 包含自己的子树的层数，不在树中时为1
+func (mine *RegionInfo)Height() int {
+	scene := cacheCtx.GetScene(mine.Scene)
+	if scene == nil {
+		return 1
+	}
+	for _, root := range scene.GetRegionTree() {
+		if node := root.find(mine.UID); node != nil {
+			return node.height()
+		}
+	}
+	return 1
+}
+
+func (mine *RegionNode)height() int {
+	num := 0
+	for _, child := range mine.Children {
+		if h := child.height(); h > num {
+			num = h
+		}
+	}
+	return num + 1
+}
+
+//endregion
@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+)
+
+/**
+终端注册表，第一次使用时加载全部未删除的设备，按照uid、SN、场景、状态以及激活码建立索引，
+设备的写操作成功后同步索引，多个实例之间通过变化通知同步
+*/
+
+// deviceKeys 建立索引时的值，修改后用于移除旧的索引
+type deviceKeys struct {
+	sn     string
+	scene  string
+	quote  string
+	status uint8
+}
+
+type deviceRegistry struct {
+	lock    sync.RWMutex
+	loaded  bool
+	devices map[string]*DeviceInfo            //uid -> device
+	keys    map[string]deviceKeys             //uid -> keys
+	sns     map[string]*DeviceInfo            //sn -> device
+	scenes  map[string]map[string]*DeviceInfo //scene -> uid -> device
+	quotes  map[string]map[string]*DeviceInfo //quote -> uid -> device
+	status  map[uint8]map[string]*DeviceInfo  //status -> uid -> device
+}
+
+func newDeviceRegistry() *deviceRegistry {
+	tmp := new(deviceRegistry)
+	tmp.devices = make(map[string]*DeviceInfo, 200)
+	tmp.keys = make(map[string]deviceKeys, 200)
+	tmp.sns = make(map[string]*DeviceInfo, 200)
+	tmp.scenes = make(map[string]map[string]*DeviceInfo, 50)
+	tmp.quotes = make(map[string]map[string]*DeviceInfo, 50)
+	tmp.status = make(map[uint8]map[string]*DeviceInfo, 5)
+	return tmp
+}
+
+// load 加载期间持有写锁，避免加载前读取的旧数据覆盖并发写入的新数据
+func (mine *deviceRegistry) load() error {
+	mine.lock.RLock()
+	loaded := mine.loaded
+	mine.lock.RUnlock()
+	if loaded {
+		return nil
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if mine.loaded {
+		return nil
+	}
+	dbs, err := store.GetAllDevices()
+	if err != nil {
+		return err
+	}
+	for _, db := range dbs {
+		if !db.DeleteTime.IsZero() {
+			continue
+		}
+		tmp := new(DeviceInfo)
+		tmp.initInfo(db)
+		mine.putLocked(tmp)
+	}
+	mine.loaded = true
+	return nil
+}
+
+// fill 使用快照中的设备，之后不再从数据库加载
+func (mine *deviceRegistry) fill(list []*DeviceInfo) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	for _, info := range list {
+		mine.putLocked(info)
+	}
+	mine.loaded = true
+}
+
+// put 添加或者替换设备，没有加载时忽略，加载时会从数据库读取
+func (mine *deviceRegistry) put(info *DeviceInfo) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if !mine.loaded {
+		return
+	}
+	mine.putLocked(info)
+}
+
+// update 缓存中的设备修改后重建索引，不在缓存中的对象忽略
+func (mine *deviceRegistry) update(info *DeviceInfo) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if mine.devices[info.UID] != info {
+		return
+	}
+	mine.putLocked(info)
+}
+
+func (mine *deviceRegistry) drop(uid string) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	mine.dropLocked(uid)
+}
+
+func (mine *deviceRegistry) putLocked(info *DeviceInfo) {
+	mine.dropLocked(info.UID)
+	keys := info.keys()
+	mine.devices[info.UID] = info
+	mine.keys[info.UID] = keys
+	if len(keys.sn) > 0 {
+		mine.sns[keys.sn] = info
+	}
+	addDeviceKey(mine.scenes, keys.scene, info)
+	addDeviceKey(mine.quotes, keys.quote, info)
+	if mine.status[keys.status] == nil {
+		mine.status[keys.status] = make(map[string]*DeviceInfo, 50)
+	}
+	mine.status[keys.status][info.UID] = info
+}
+
+func (mine *deviceRegistry) dropLocked(uid string) {
+	keys, ok := mine.keys[uid]
+	if !ok {
+		return
+	}
+	if mine.sns[keys.sn] == mine.devices[uid] {
+		delete(mine.sns, keys.sn)
+	}
+	removeDeviceKey(mine.scenes, keys.scene, uid)
+	removeDeviceKey(mine.quotes, keys.quote, uid)
+	if arr, ok := mine.status[keys.status]; ok {
+		delete(arr, uid)
+		if len(arr) < 1 {
+			delete(mine.status, keys.status)
+		}
+	}
+	delete(mine.devices, uid)
+	delete(mine.keys, uid)
+}
+
+func addDeviceKey(index map[string]map[string]*DeviceInfo, key string, info *DeviceInfo) {
+	if len(key) < 1 {
+		return
+	}
+	if index[key] == nil {
+		index[key] = make(map[string]*DeviceInfo, 20)
+	}
+	index[key][info.UID] = info
+}
+
+func removeDeviceKey(index map[string]map[string]*DeviceInfo, key, uid string) {
+	arr, ok := index[key]
+	if !ok {
+		return
+	}
+	delete(arr, uid)
+	if len(arr) < 1 {
+		delete(index, key)
+	}
+}
+
+func (mine *deviceRegistry) get(uid string) *DeviceInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.devices[uid]
+}
+
+func (mine *deviceRegistry) getBySN(sn string) *DeviceInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.sns[sn]
+}
+
+func (mine *deviceRegistry) getByScene(scene string) []*DeviceInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return sortDevices(mine.scenes[scene])
+}
+
+func (mine *deviceRegistry) getByQuote(quote string) []*DeviceInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return sortDevices(mine.quotes[quote])
+}
+
+func (mine *deviceRegistry) getByStatus(st uint8) []*DeviceInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return sortDevices(mine.status[st])
+}
+
+// cached 已经加载时返回全部设备，用于缓存快照
+func (mine *deviceRegistry) cached() ([]*DeviceInfo, bool) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	if !mine.loaded {
+		return nil, false
+	}
+	return sortDevices(mine.devices), true
+}
+
+func (mine *deviceRegistry) getAll() []*DeviceInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return sortDevices(mine.devices)
+}
+
+// getExcept 除了指定状态之外的全部设备
+func (mine *deviceRegistry) getExcept(st uint8) []*DeviceInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	all := make(map[string]*DeviceInfo, len(mine.devices))
+	for uid, info := range mine.devices {
+		if mine.keys[uid].status != st {
+			all[uid] = info
+		}
+	}
+	return sortDevices(all)
+}
+
+// sortDevices 和数据库的插入顺序保持一致，创建时间以及uid不会修改，不需要设备的锁
+func sortDevices(arr map[string]*DeviceInfo) []*DeviceInfo {
+	list := make([]*DeviceInfo, 0, len(arr))
+	for _, info := range arr {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreateTime.Equal(list[j].CreateTime) {
+			return list[i].UID < list[j].UID
+		}
+		return list[i].CreateTime.Before(list[j].CreateTime)
+	})
+	return list
+}
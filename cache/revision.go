@@ -0,0 +1,373 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"omo.msa.organization/proxy"
+	"omo.msa.organization/proxy/nosql"
+	"omo.msa.organization/tool"
+	"time"
+)
+
+/**
+场景、房间、区域树以及区域的历史版本，可以查看某个时间的文档、比较两个版本以及恢复到某个版本，
+恢复时只修改配置字段，成员、管理员以及设备绑定不恢复
+*/
+
+// GetRevisions 对象的历史版本，最近的在前面
+func (mine *cacheContext) GetRevisions(table, uid string, limit int64) ([]*nosql.Revision, error) {
+	if len(uid) < 1 {
+		return nil, errors.New("the revision target is empty")
+	}
+	if !nosql.IsRevisionTable(table) {
+		return nil, errors.New("the table not support revision of " + table)
+	}
+	if limit < 1 || limit > 200 {
+		limit = 200
+	}
+	return store.GetRevisions(&nosql.RevisionFilter{Table: table, Target: uid, Limit: limit})
+}
+
+func (mine *cacheContext) GetRevision(uid string) (*nosql.Revision, error) {
+	if len(uid) < 1 {
+		return nil, errors.New("the revision uid is empty")
+	}
+	return store.GetRevision(uid)
+}
+
+// GetRevisionAt 指定时间的文档，即在这个时间之前的最后一个版本
+func (mine *cacheContext) GetRevisionAt(table, uid string, stamp time.Time) (*nosql.Revision, error) {
+	if len(uid) < 1 {
+		return nil, errors.New("the revision target is empty")
+	}
+	if !nosql.IsRevisionTable(table) {
+		return nil, errors.New("the table not support revision of " + table)
+	}
+	list, err := store.GetRevisions(&nosql.RevisionFilter{Table: table, Target: uid, Before: stamp, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(list) < 1 {
+		return nil, errors.New("not found the revision before the time")
+	}
+	return list[0], nil
+}
+
+// DiffRevisions 比较两个版本，to为空时和当前的文档比较
+func (mine *cacheContext) DiffRevisions(from, to string) ([]*nosql.AuditChange, error) {
+	if len(from) < 1 {
+		return nil, errors.New("the revision uid is empty")
+	}
+	old, err := store.GetRevision(from)
+	if err != nil {
+		return nil, err
+	}
+	before := make(map[string]interface{}, 20)
+	err = json.Unmarshal([]byte(old.Data), &before)
+	if err != nil {
+		return nil, err
+	}
+	var after map[string]interface{}
+	if len(to) < 1 {
+		after = snapshotOf(store, old.Table, old.Target)
+		if after == nil {
+			return nil, errors.New("not found the target of " + old.Target)
+		}
+	} else {
+		now, er := store.GetRevision(to)
+		if er != nil {
+			return nil, er
+		}
+		if now.Table != old.Table || now.Target != old.Target {
+			return nil, errors.New("the revisions not belong to the same target")
+		}
+		after = make(map[string]interface{}, 20)
+		er = json.Unmarshal([]byte(now.Data), &after)
+		if er != nil {
+			return nil, er
+		}
+	}
+	return diffAudit(before, after), nil
+}
+
+// RevertRevision 通过对象的修改接口恢复和历史版本不同的字段，使用和接口相同的检查，
+// context中没有期望的版本时使用当前的版本，恢复期间对象被其他请求修改时返回版本冲突，中途失败时已经恢复的字段不回滚
+func (mine *cacheContext) RevertRevision(ctx context.Context, uid, operator string) error {
+	info, err := mine.GetRevision(uid)
+	if err != nil {
+		return err
+	}
+	if !nosql.IsRevisionTable(info.Table) {
+		return errors.New("the table not support revision of " + info.Table)
+	}
+	if nosql.ExpectOf(ctx, info.Table, info.Target) == nil {
+		version, er := GetVersion(info.Table, info.Target)
+		if er != nil {
+			return er
+		}
+		ctx, _ = nosql.WithExpect(ctx, info.Table, info.Target, version)
+	}
+	var steps []func() error
+	data := []byte(info.Data)
+	switch info.Table {
+	case nosql.TableScene:
+		steps, err = mine.revertScene(ctx, info.Target, data, operator)
+	case nosql.TableRoom:
+		steps, err = mine.revertRoom(ctx, info.Target, data, operator)
+	case nosql.TableRegion:
+		steps, err = mine.revertRegion(ctx, info.Target, data, operator)
+	case nosql.TableArea:
+		steps, err = mine.revertArea(ctx, info.Target, data, operator)
+	}
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		if err = step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revertScene 先检查位置以及上级，然后比较需要恢复的字段
+func (mine *cacheContext) revertScene(ctx context.Context, uid string, data []byte, operator string) ([]func() error, error) {
+	scene := mine.GetScene(uid)
+	if scene == nil {
+		return nil, errors.New("not found the scene of " + uid)
+	}
+	db := new(nosql.Scene)
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, err
+	}
+	local, _, err := parseLocation(db.Location)
+	if err != nil {
+		return nil, err
+	}
+	if db.Parents == nil {
+		db.Parents = make([]string, 0)
+	}
+	scene.lock.RLock()
+	defer scene.lock.RUnlock()
+	steps := make([]func() error, 0, 10)
+	if scene.Name != db.Name || scene.Remark != db.Remark {
+		steps = append(steps, func() error {
+			return scene.UpdateBase(ctx, db.Name, db.Remark, operator)
+		})
+	}
+	if scene.Cover != db.Cover {
+		steps = append(steps, func() error {
+			return scene.UpdateCover(ctx, db.Cover, operator)
+		})
+	}
+	if uint8(scene.Type) != db.Type {
+		steps = append(steps, func() error {
+			return scene.UpdateType(ctx, operator, db.Type)
+		})
+	}
+	if uint8(scene.Status) != db.Status {
+		steps = append(steps, func() error {
+			return scene.UpdateStatus(ctx, SceneStatus(db.Status), operator)
+		})
+	}
+	if scene.Limit != db.Limit {
+		steps = append(steps, func() error {
+			return scene.UpdateLimit(ctx, operator, int(db.Limit))
+		})
+	}
+	if scene.ShortName != db.Short {
+		steps = append(steps, func() error {
+			return scene.UpdateShortName(ctx, db.Short, operator)
+		})
+	}
+	if scene.Location != local {
+		steps = append(steps, func() error {
+			return scene.UpdateLocation(ctx, local, operator)
+		})
+	}
+	if scene.Supporter != db.Supporter {
+		steps = append(steps, func() error {
+			return scene.UpdateSupporter(ctx, db.Supporter, operator)
+		})
+	}
+	if scene.Address != db.Address {
+		addr := db.Address
+		steps = append(steps, func() error {
+			return scene.UpdateAddress(ctx, addr.Country, addr.Province, addr.City, addr.Zone, operator)
+		})
+	}
+	if removes, adds := tool.DiffItems(scene.Questions, db.Questions); len(removes) > 0 || len(adds) > 0 {
+		steps = append(steps, func() error {
+			return scene.UpdateQuestions(ctx, operator, db.Questions)
+		})
+	}
+	if !sameItems(scene.parents, db.Parents) {
+		steps = append(steps, func() error {
+			return scene.UpdateParents(ctx, operator, db.Parents)
+		})
+	}
+	return steps, nil
+}
+
+// revertRoom 和场景中的其他房间不能重名
+func (mine *cacheContext) revertRoom(ctx context.Context, uid string, data []byte, operator string) ([]func() error, error) {
+	room := mine.GetRoom(uid)
+	if room == nil {
+		return nil, errors.New("not found the room of " + uid)
+	}
+	db := new(nosql.Room)
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, err
+	}
+	room.lock.RLock()
+	same := room.Name == db.Name && room.Remark == db.Remark
+	renamed := room.Name != db.Name
+	room.lock.RUnlock()
+	if same {
+		return nil, nil
+	}
+	if renamed {
+		if scene := mine.GetScene(room.Scene); scene != nil && scene.HadRoomByName(db.Name) {
+			return nil, errors.New("the room name is repeated")
+		}
+	}
+	return []func() error{func() error {
+		return room.UpdateBase(ctx, db.Name, db.Remark, operator)
+	}}, nil
+}
+
+// revertRegion 上级按照移动区域检查，不能形成环以及超过最大层数
+func (mine *cacheContext) revertRegion(ctx context.Context, uid string, data []byte, operator string) ([]func() error, error) {
+	region, err := mine.GetRegion(uid)
+	if err != nil {
+		return nil, err
+	}
+	db := new(nosql.Region)
+	if err = json.Unmarshal(data, db); err != nil {
+		return nil, err
+	}
+	local, _, err := parseLocation(db.Location)
+	if err != nil {
+		return nil, err
+	}
+	region.lock.RLock()
+	defer region.lock.RUnlock()
+	steps := make([]func() error, 0, 5)
+	if region.Name != db.Name || region.Remark != db.Remark {
+		steps = append(steps, func() error {
+			return region.UpdateBase(ctx, db.Name, db.Remark, operator)
+		})
+	}
+	if region.Entity != db.Entity {
+		steps = append(steps, func() error {
+			return region.UpdateEntity(ctx, db.Entity, operator)
+		})
+	}
+	if region.Parent != db.Parent {
+		steps = append(steps, func() error {
+			return region.UpdateParent(ctx, db.Parent, operator)
+		})
+	}
+	if region.Location != local {
+		steps = append(steps, func() error {
+			return region.UpdateLocation(ctx, local, operator)
+		})
+	}
+	if region.Address != db.Address {
+		addr := db.Address
+		steps = append(steps, func() error {
+			return region.UpdateAddress(ctx, addr.Country, addr.Province, addr.City, addr.Zone, operator)
+		})
+	}
+	return steps, nil
+}
+
+// revertArea 模块以及定制资源按照key修改，历史版本中没有的key保留
+func (mine *cacheContext) revertArea(ctx context.Context, uid string, data []byte, operator string) ([]func() error, error) {
+	current, err := store.GetArea(uid)
+	if err != nil || !current.DeleteTime.IsZero() {
+		return nil, errors.New("not found the area of " + uid)
+	}
+	area := new(AreaInfo)
+	area.initInfo(current)
+	db := new(nosql.Area)
+	if err = json.Unmarshal(data, db); err != nil {
+		return nil, err
+	}
+	steps := make([]func() error, 0, 10)
+	if area.Name != db.Name || area.Remark != db.Remark {
+		steps = append(steps, func() error {
+			return area.UpdateBase(ctx, db.Name, db.Remark, operator)
+		})
+	}
+	if area.Template != db.Template {
+		steps = append(steps, func() error {
+			return area.UpdateTemplate(ctx, db.Template, operator)
+		})
+	}
+	if area.LimitNum != db.Limit {
+		steps = append(steps, func() error {
+			return area.UpdateLimitCount(ctx, operator, db.Limit)
+		})
+	}
+	if area.Question != db.Question {
+		steps = append(steps, func() error {
+			return area.UpdateQuestion(ctx, db.Question, operator)
+		})
+	}
+	if area.Catalog != db.Catalog {
+		steps = append(steps, func() error {
+			return area.UpdateCatalog(ctx, db.Catalog, operator)
+		})
+	}
+	if !sameItems(area.Displays, db.Displays) {
+		steps = append(steps, func() error {
+			return area.UpdateDisplays(ctx, operator, db.Displays)
+		})
+	}
+	if !sameItems(area.Assets, db.Assets) {
+		steps = append(steps, func() error {
+			return area.UpdateAssets(ctx, operator, db.Assets)
+		})
+	}
+	for _, item := range db.Modules {
+		if value, ok := pairValue(area.Modules, item.Key); !ok || value != item.Value {
+			key, value := item.Key, item.Value
+			steps = append(steps, func() error {
+				return area.UpdateModule(ctx, key, value, operator)
+			})
+		}
+	}
+	for _, item := range db.Sources {
+		if value, ok := pairValue(area.Sources, item.Key); !ok || value != item.Value {
+			key, value := item.Key, item.Value
+			steps = append(steps, func() error {
+				return area.UpdateCustomSource(ctx, key, value, operator)
+			})
+		}
+	}
+	return steps, nil
+}
+
+// sameItems 顺序也相同
+func sameItems(from, to []string) bool {
+	if len(from) != len(to) {
+		return false
+	}
+	for i := range from {
+		if from[i] != to[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func pairValue(list []*proxy.PairInfo, key string) (string, bool) {
+	for _, item := range list {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return "", false
+}
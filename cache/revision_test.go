@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
+	"omo.msa.organization/proxy/nosql"
+)
+
+func TestRevertScene(t *testing.T) {
+	ctx := context.Background()
+	storage := initMemory(t)
+	scene := createScene(t, "museum", "")
+	if err := scene.UpdateQuestions(ctx, "tester", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := cacheCtx.GetRevisions(nosql.TableScene, scene.UID, 10)
+	if err != nil || len(list) < 1 {
+		t.Fatalf("the revisions of scene is error: %v", err)
+	}
+	revision := list[0].UID.Hex()
+	if err = scene.UpdateQuestions(ctx, "tester", []string{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = scene.UpdateBase(ctx, "museum-2", "", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	current, _ := GetVersion(nosql.TableScene, scene.UID)
+	stale, _ := nosql.WithExpect(ctx, nosql.TableScene, scene.UID, current-1)
+	err = cacheCtx.RevertRevision(stale, revision, "admin")
+	if _, ok := err.(*nosql.VersionConflict); !ok {
+		t.Fatalf("the stale version should conflict but %v", err)
+	}
+	if err = cacheCtx.RevertRevision(ctx, revision, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if scene.Name != "museum" || len(scene.Questions) != 2 || scene.Questions[0] != "a" {
+		t.Fatalf("the scene should be reverted but %s, %v", scene.Name, scene.Questions)
+	}
+	db, err := storage.GetScene(scene.UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Name != "museum" || len(db.Questions) != 2 || db.Operator != "admin" {
+		t.Fatalf("the stored scene should be reverted but %s, %v", db.Name, db.Questions)
+	}
+}
+
+func TestRevertRegion(t *testing.T) {
+	ctx := context.Background()
+	initMemory(t)
+	scene := createScene(t, "museum", "")
+	first, err := scene.CreateRegion(ctx, &pb.ReqRegionAdd{Scene: scene.UID, Name: "first", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := scene.CreateRegion(ctx, &pb.ReqRegionAdd{Scene: scene.UID, Name: "second", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = first.UpdateParent(ctx, second.UID, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err = first.UpdateEntity(ctx, "entity", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	list, err := cacheCtx.GetRevisions(nosql.TableRegion, first.UID, 10)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("the revisions of region is error: %v, %d", err, len(list))
+	}
+	moved := list[0].UID.Hex()
+	//恢复到创建时的版本
+	if err = cacheCtx.RevertRevision(ctx, list[2].UID.Hex(), "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if first.Parent != "" || first.Entity != "" {
+		t.Fatalf("the region should be reverted but %s, %s", first.Parent, first.Entity)
+	}
+	//上级的检查和移动区域一致，不能形成环
+	if err = second.UpdateParent(ctx, first.UID, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err = cacheCtx.RevertRevision(ctx, moved, "admin"); err == nil {
+		t.Fatal("the revert should fail because of the cycle")
+	}
+	if first.Parent != "" {
+		t.Fatalf("the parent should not change but %s", first.Parent)
+	}
+}
+
+func TestRevisionConcurrent(t *testing.T) {
+	ctx := context.Background()
+	storage := initMemory(t)
+	scene := createScene(t, "museum", "")
+	room, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "room", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//两个请求同时修改同一个房间的不同字段
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			if er := room.UpdateBase(ctx, fmt.Sprintf("room-%d", i), "", "first"); er != nil {
+				t.Error(er)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		quotes := make([]string, 0, 10)
+		for i := 0; i < 10; i++ {
+			quotes = append(quotes, fmt.Sprintf("quote-%d", i))
+			if er := room.UpdateQuotes(ctx, "second", quotes); er != nil {
+				t.Error(er)
+			}
+		}
+	}()
+	wg.Wait()
+	list, err := cacheCtx.GetRevisions(nosql.TableRoom, room.UID, 100)
+	if err != nil || len(list) != 21 {
+		t.Fatalf("the revisions of room is error: %v, %d", err, len(list))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	//每个版本都是写入后的文档，版本号连续并且引用只会增加
+	docs := make([]*nosql.Room, 0, len(list))
+	for i, item := range list {
+		db := new(nosql.Room)
+		if err = json.Unmarshal([]byte(item.Data), db); err != nil {
+			t.Fatal(err)
+		}
+		if item.Version != uint32(i) || db.Version != item.Version {
+			t.Fatalf("the revision version is error: %d, %d, %d", i, item.Version, db.Version)
+		}
+		if i > 0 && len(db.Quotes) < len(docs[i-1].Quotes) {
+			t.Fatalf("the quotes of version %d lost the concurrent write: %v", i, db.Quotes)
+		}
+		docs = append(docs, db)
+	}
+	last := docs[len(docs)-1]
+	if last.Name != "room-9" || len(last.Quotes) != 10 {
+		t.Fatalf("the last revision is error: %s, %v", last.Name, last.Quotes)
+	}
+	//恢复到中间的版本
+	index := 0
+	for docs[index].Name != "room-4" {
+		index++
+	}
+	middle := docs[index]
+	if err = cacheCtx.RevertRevision(ctx, list[index].UID.Hex(), "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if room.Name != middle.Name || len(room.Quotes) != 10 {
+		t.Fatalf("the room should be reverted to %s but %s, %v", middle.Name, room.Name, room.Quotes)
+	}
+	db, err := storage.GetRoom(room.UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Name != middle.Name || db.Operator != "admin" || db.Version != 21 {
+		t.Fatalf("the stored room should be reverted but %s, %s, %d", db.Name, db.Operator, db.Version)
+	}
+}
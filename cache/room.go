@@ -1,9 +1,11 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"omo.msa.organization/proxy/nosql"
 	"omo.msa.organization/tool"
+	"sync"
 )
 
 //房间大厅
@@ -12,21 +14,29 @@ type RoomInfo struct {
 	Remark string
 	Scene  string
 	Quotes []string
+	//保护导出的字段，Scene以及UID不会修改
+	lock sync.RWMutex
 }
 
 func (mine *cacheContext) GetRoom(uid string) *RoomInfo {
-	for _, scene := range mine.scenes {
-		info := scene.GetRoom(uid)
-		if info != nil {
-			return info
-		}
+	info := mine.lookupRoom(uid)
+	if info != nil {
+		return info
 	}
-	return nil
+	db, err := store.GetRoom(uid)
+	if err != nil || !db.DeleteTime.IsZero() {
+		return nil
+	}
+	scene := mine.GetScene(db.Scene)
+	if scene == nil {
+		return nil
+	}
+	return scene.GetRoom(uid)
 }
 
 func (mine *cacheContext) GetRoomsByDevice(device string) []*RoomInfo {
 	list := make([]*RoomInfo, 0, 10)
-	for _, scene := range mine.scenes {
+	for _, scene := range mine.allScenes() {
 		arr := scene.GetRoomsByDevice(device)
 		if arr != nil && len(arr) > 0 {
 			list = append(list, arr...)
@@ -37,7 +47,7 @@ func (mine *cacheContext) GetRoomsByDevice(device string) []*RoomInfo {
 
 func (mine *cacheContext) GetRoomsByQuote(quote string) []*RoomInfo {
 	list := make([]*RoomInfo, 0, 10)
-	for _, scene := range mine.scenes {
+	for _, scene := range mine.allScenes() {
 		arr := scene.GetRoomsByQuote(quote)
 		if arr != nil && len(arr) > 0 {
 			list = append(list, arr...)
@@ -47,7 +57,7 @@ func (mine *cacheContext) GetRoomsByQuote(quote string) []*RoomInfo {
 }
 
 func (mine *cacheContext) HadBindDeviceInRoom(device string) bool {
-	for _, scene := range mine.scenes {
+	for _, scene := range mine.allScenes() {
 		arr := scene.GetRoomsByDevice(device)
 		if arr != nil && len(arr) > 0 {
 			return true
@@ -57,21 +67,23 @@ func (mine *cacheContext) HadBindDeviceInRoom(device string) bool {
 }
 
 func (mine *cacheContext) GetRoomBy(scene, uid string) *RoomInfo {
-	for _, item := range mine.scenes {
-		if item.UID == scene {
-			return item.GetRoom(uid)
-		}
+	info := mine.GetScene(scene)
+	if info == nil {
+		return nil
 	}
-	return nil
+	return info.GetRoom(uid)
 }
 
-func (mine *cacheContext) RemoveRoom(uid, operator string) error {
-	for _, scene := range mine.scenes {
-		if scene.HadRoom(uid) {
-			return scene.RemoveRoom(uid, operator)
-		}
+func (mine *cacheContext) RemoveRoom(ctx context.Context, uid, operator string) error {
+	info := mine.GetRoom(uid)
+	if info == nil {
+		return nil
 	}
-	return nil
+	scene := mine.GetScene(info.Scene)
+	if scene == nil {
+		return nil
+	}
+	return scene.RemoveRoom(ctx, uid, operator)
 }
 
 func (mine *RoomInfo) initInfo(db *nosql.Room) {
@@ -90,18 +102,71 @@ func (mine *RoomInfo) initInfo(db *nosql.Room) {
 	}
 }
 
-func (mine *RoomInfo) UpdateBase(name, remark, operator string) error {
+// syncInfo 其他实例修改后在原有的对象上同步字段，持有旧指针的调用者也能看到
+func (mine *RoomInfo) syncInfo(db *nosql.Room) {
+	quotes := db.Quotes
+	if quotes == nil {
+		quotes = make([]string, 0, 1)
+	}
+	mine.update(db.Operator, func() {
+		mine.UpdateTime = db.UpdatedTime
+		mine.Name = db.Name
+		mine.Remark = db.Remark
+		mine.Quotes = quotes
+	})
+}
+
+// update 写数据库成功后修改缓存的字段，读取字段需要持有读锁或者使用Clone
+func (mine *RoomInfo) update(operator string, fun func()) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	fun()
+	if len(operator) > 0 {
+		mine.Operator = operator
+	}
+}
+
+// Clone 字段以及引用的副本，用于返回给调用者，不能用于修改
+func (mine *RoomInfo) Clone() *RoomInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	tmp := new(RoomInfo)
+	tmp.baseInfo = mine.baseInfo
+	tmp.Remark = mine.Remark
+	tmp.Scene = mine.Scene
+	tmp.Quotes = append(make([]string, 0, len(mine.Quotes)), mine.Quotes...)
+	return tmp
+}
+
+func (mine *RoomInfo) name() string {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.Name
+}
+
+func (mine *RoomInfo) quotes() []string {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	list := make([]string, len(mine.Quotes))
+	copy(list, mine.Quotes)
+	return list
+}
+
+func (mine *RoomInfo) UpdateBase(ctx context.Context, name, remark, operator string) error {
+	mine.lock.RLock()
 	if len(name) < 1 {
 		name = mine.Name
 	}
 	if len(remark) < 1 {
 		remark = mine.Remark
 	}
-	err := nosql.UpdateRoomBase(mine.UID, name, remark, operator)
+	mine.lock.RUnlock()
+	err := store.UpdateRoomBase(ctx, mine.UID, name, remark, operator)
 	if err == nil {
-		mine.Name = name
-		mine.Remark = remark
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Name = name
+			mine.Remark = remark
+		})
 	}
 	return err
 }
@@ -118,7 +183,7 @@ func (mine *RoomInfo) UpdateBase(name, remark, operator string) error {
 //}
 
 func (mine *RoomInfo) Areas() []*AreaInfo {
-	dbs, _ := nosql.GetAreasBy(mine.Scene, mine.UID)
+	dbs, _ := store.GetAreasBy(mine.Scene, mine.UID)
 	areas := make([]*AreaInfo, 0, 5)
 	for _, db := range dbs {
 		tmp := new(AreaInfo)
@@ -128,20 +193,34 @@ func (mine *RoomInfo) Areas() []*AreaInfo {
 	return areas
 }
 
-func (mine *RoomInfo) UpdateQuotes(operator string, list []string) error {
+// UpdateQuotes 只提交移除以及追加的引用，不替换整个数组
+func (mine *RoomInfo) UpdateQuotes(ctx context.Context, operator string, list []string) error {
 	if list == nil {
 		list = make([]string, 0, 1)
 	}
-
-	err := nosql.UpdateRoomQuotes(mine.UID, operator, list)
-	if err == nil {
-		mine.Quotes = list
-		mine.Operator = operator
+	removes, adds := tool.DiffItems(mine.quotes(), list)
+	if len(removes) > 0 {
+		err := store.SubtractRoomQuotes(ctx, mine.UID, operator, removes)
+		if err != nil {
+			return err
+		}
 	}
-	return err
+	if len(adds) > 0 {
+		err := store.AppendRoomQuotes(ctx, mine.UID, operator, adds)
+		if err != nil {
+			return err
+		}
+	}
+	list = append(make([]string, 0, len(list)), list...)
+	mine.update(operator, func() {
+		mine.Quotes = list
+	})
+	return nil
 }
 
 func (mine *RoomInfo) HadQuote(quote string) bool {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
 	for i := 0; i < len(mine.Quotes); i += 1 {
 		if mine.Quotes[i] == quote {
 			return true
@@ -151,6 +230,8 @@ func (mine *RoomInfo) HadQuote(quote string) bool {
 }
 
 func (mine *RoomInfo) HadQuotes(quotes []string) bool {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
 	for i := 0; i < len(mine.Quotes); i += 1 {
 		if tool.HasItem(quotes, mine.Quotes[i]) {
 			return true
@@ -159,7 +240,7 @@ func (mine *RoomInfo) HadQuotes(quotes []string) bool {
 	return false
 }
 
-func (mine *RoomInfo) UpdateDisplays(area, operator string, displays []string) error {
+func (mine *RoomInfo) UpdateDisplays(ctx context.Context, area, operator string, displays []string) error {
 	info := mine.GetAreaBy(area)
 	if info == nil {
 		return errors.New("the device had not found by sn")
@@ -167,7 +248,7 @@ func (mine *RoomInfo) UpdateDisplays(area, operator string, displays []string) e
 	if displays == nil {
 		displays = make([]string, 0, 1)
 	}
-	return info.UpdateDisplays(operator, displays)
+	return info.UpdateDisplays(ctx, operator, displays)
 }
 
 func (mine *RoomInfo) HadDevice(device string) bool {
@@ -237,17 +318,35 @@ func (mine *RoomInfo) GetAreaBy(uid string) *AreaInfo {
 	return nil
 }
 
-func (mine *RoomInfo) AppendDevice(area, device, remark, operator string, tp uint32) error {
+func (mine *RoomInfo) AppendDevice(ctx context.Context, area, device, remark, operator string, tp uint32) error {
 	if mine.HadDevice(device) {
 		return nil
 	}
 	info := mine.GetAreaBy(area)
-	if info != nil {
-		return info.UpdateDevice(device, operator, tp)
+	if info == nil {
+		//info, err := cacheCtx.checkDevice(mine.Scene, mine.UID, area, device, remark, operator, tp)
+		//if err == nil {
+		//	return info.UpdateRoom(mine.UID, area, operator)
+		//}
+		return nil
 	}
-	//info, err := cacheCtx.checkDevice(mine.Scene, mine.UID, area, device, remark, operator, tp)
-	//if err == nil {
-	//	return info.UpdateRoom(mine.UID, area, operator)
-	//}
-	return nil
+	//设备不属于当前场景时一起修改
+	ops := []*nosql.WriteOp{nosql.AreaDeviceOp(info.UID, device, operator, tp)}
+	dev, er := cacheCtx.GetDevice(device)
+	if er == nil && dev.Scene != mine.Scene {
+		ops = append(ops, nosql.DeviceSceneOp(dev.UID, mine.Scene, operator, nextStatus(dev.Status, mine.Scene, dev.Quote)))
+	}
+	err := store.RunTransaction(ctx, ops)
+	if err == nil {
+		cacheCtx.unindexArea(info.UID)
+		if len(ops) > 1 {
+			cacheCtx.syncDevice(dev.UID)
+		}
+		info.update(operator, func() {
+			info.Device = device
+			info.Type = tp
+			info.deviceInfo = nil
+		})
+	}
+	return err
 }
@@ -1,11 +1,13 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"omo.msa.organization/proxy/nosql"
 	"omo.msa.organization/tool"
+	"sync"
 	"time"
 )
 
@@ -23,16 +25,30 @@ const (
 	SceneStatusFroze SceneStatus = 1
 )
 
+const (
+	SceneRemoveOnly    SceneRemoveMode = 0 //只删除场景，依赖对象保持不变
+	SceneRemoveStrict  SceneRemoveMode = 1 //存在依赖对象时拒绝删除
+	SceneRemoveCascade SceneRemoveMode = 2 //依赖对象一起删除
+	SceneRemoveDetach  SceneRemoveMode = 3 //设备恢复为未绑定，其他依赖对象一起删除
+)
+
+var ErrSceneDepends = errors.New("the scene had depends")
+
 type SceneType uint8
 
+type SceneRemoveMode uint8
+
 type SceneStatus uint8
 
 type SceneInfo struct {
+	//最近一次访问子集合的时间，原子操作，放在开头保证64位对齐
+	used int64
 	baseInfo
 	Type      SceneType
 	Status    SceneStatus
 	Limit     uint16
 	Location  string
+	Geo       *nosql.GeoPoint //location对应的点，没有位置时为nil
 	Cover     string
 	Remark    string
 	Master    string
@@ -47,13 +63,30 @@ type SceneInfo struct {
 	//Domains   []proxy.DomainInfo
 	groups []*GroupInfo
 	rooms  []*RoomInfo
+	//区域树，通过Parent关联
+	regions []*RegionInfo
+	//子集合加载的时间，超过有效期后重新加载
+	groupsAt  time.Time
+	roomsAt   time.Time
+	regionsAt time.Time
+	//保护导出的字段、members, parents, groups, rooms, regions以及加载时间
+	lock sync.RWMutex
+	//移动区域时串行检查，避免并发移动形成环
+	move sync.Mutex
 }
 
-func (mine *cacheContext) CreateScene(info *SceneInfo) error {
+func (mine *cacheContext) CreateScene(ctx context.Context, info *SceneInfo) error {
+	local, geo, err := parseLocation(info.Location)
+	if err != nil {
+		return err
+	}
 	db := new(nosql.Scene)
 	db.UID = primitive.NewObjectID()
 	db.Type = uint8(info.Type)
-	db.ID = nosql.GetSceneNextID()
+	db.ID, err = store.GetSceneNextID()
+	if err != nil {
+		return err
+	}
 	db.CreatedTime = time.Now()
 	db.UpdatedTime = time.Now()
 	db.Operator = info.Operator
@@ -64,7 +97,8 @@ func (mine *cacheContext) CreateScene(info *SceneInfo) error {
 	db.Entity = info.Entity
 	db.Short = info.ShortName
 	db.Status = uint8(SceneStatusIdle)
-	db.Location = info.Location
+	db.Location = local
+	db.Geo = geo
 	db.Address = info.Address
 	//db.Bucket = info.Bucket
 	db.Limit = info.Limit
@@ -73,10 +107,10 @@ func (mine *cacheContext) CreateScene(info *SceneInfo) error {
 	db.Questions = make([]string, 0, 1)
 	//db.Domains = make([]proxy.DomainInfo, 0, 1)
 	db.Supporter = ""
-	err := nosql.CreateScene(db)
+	err = store.CreateScene(ctx, db)
 	if err == nil {
 		info.initInfo(db)
-		cacheCtx.scenes = append(cacheCtx.scenes, info)
+		mine.addScene(info)
 	}
 	return err
 }
@@ -85,46 +119,41 @@ func (mine *cacheContext) GetScene(uid string) *SceneInfo {
 	if len(uid) < 2 {
 		return nil
 	}
-	for i := 0; i < len(cacheCtx.scenes); i += 1 {
-		if cacheCtx.scenes[i].UID == uid {
-			return cacheCtx.scenes[i]
-		}
+	info := mine.lookupScene(uid)
+	countHit(info != nil)
+	if info != nil {
+		return info
 	}
-	db, err := nosql.GetScene(uid)
-	if err == nil {
-		info := new(SceneInfo)
+	db, err := store.GetScene(uid)
+	if err == nil && db.DeleteTime.IsZero() {
+		info = new(SceneInfo)
 		info.initInfo(db)
-		cacheCtx.scenes = append(cacheCtx.scenes, info)
-		return info
+		return mine.addScene(info)
 	}
 	return nil
 }
 
 func (mine *cacheContext) GetSceneByMember(uid string) *SceneInfo {
-	for i := 0; i < len(cacheCtx.scenes); i += 1 {
-		if cacheCtx.scenes[i].HadMember(uid) {
-			return cacheCtx.scenes[i]
-		}
+	mine.lock.RLock()
+	info := mine.masters[uid]
+	if info == nil && len(mine.members[uid]) > 0 {
+		info = mine.members[uid][0]
 	}
-	db, err := nosql.GetSceneByMaster(uid)
-	if err == nil {
-		info := new(SceneInfo)
-		info.initInfo(db)
-		cacheCtx.scenes = append(cacheCtx.scenes, info)
+	mine.lock.RUnlock()
+	if info != nil {
 		return info
 	}
+	db, err := store.GetSceneByMaster(uid)
+	if err == nil && db.DeleteTime.IsZero() {
+		info = new(SceneInfo)
+		info.initInfo(db)
+		return mine.addScene(info)
+	}
 	return nil
 }
 
-func (mine *cacheContext) GetScenes(page, number uint32) (uint32, uint32, []*SceneInfo) {
-	if number < 1 {
-		number = 10
-	}
-	if len(mine.scenes) < 1 {
-		return 0, 0, make([]*SceneInfo, 0, 1)
-	}
-	total, maxPage, list := checkPage(page, number, mine.scenes)
-	return total, maxPage, list
+func (mine *cacheContext) GetScenes(pager *Pager) (uint32, uint32, []*SceneInfo) {
+	return PageList(pager, mine.allScenes())
 }
 
 func (mine *cacheContext) GetScenesByArray(array []string) []*SceneInfo {
@@ -139,34 +168,36 @@ func (mine *cacheContext) GetScenesByArray(array []string) []*SceneInfo {
 }
 
 func (mine *cacheContext) GetSceneBySN(sn string) (*SceneInfo, error) {
-	db, err := nosql.GetDeviceBySN(sn)
+	db, err := mine.GetDeviceBySN(sn)
 	if err != nil {
 		return nil, err
 	}
 	return mine.GetScene(db.Scene), nil
 }
 
-func (mine *cacheContext) GetScenesByParent(parent string, page, number uint32) (uint32, uint32, []*SceneInfo) {
-	if number < 1 {
-		number = 10
-	}
-	if len(mine.scenes) < 1 {
-		return 0, 0, make([]*SceneInfo, 0, 1)
-	}
+func (mine *cacheContext) QueryScenes(query *FilterQuery, pager *Pager) (uint32, uint32, []*SceneInfo, error) {
+	return QueryList(query, pager, mine.allScenes())
+}
+
+// GeoScenes 附近、矩形或者多边形范围内的场景，附近查询按照距离排序
+func (mine *cacheContext) GeoScenes(query *GeoQuery, pager *Pager) (uint32, uint32, []*SceneInfo, error) {
+	return geoPage(query, pager, mine.geoScenes(query))
+}
+
+func (mine *cacheContext) GetScenesByParent(parent string, pager *Pager) (uint32, uint32, []*SceneInfo) {
 	all := make([]*SceneInfo, 0, 100)
-	for _, scene := range mine.scenes {
+	for _, scene := range mine.allScenes() {
 		if scene.HadParent(parent) {
 			all = append(all, scene)
 		}
 	}
-	total, maxPage, list := checkPage(page, number, all)
-	return total, maxPage, list
+	return PageList(pager, all)
 }
 
 func (mine *cacheContext) GetScenesByType(tp uint8) []*SceneInfo {
 	list := make([]*SceneInfo, 0, 10)
-	for _, scene := range mine.scenes {
-		if uint8(scene.Type) == tp {
+	for _, scene := range mine.allScenes() {
+		if uint8(scene.sceneType()) == tp {
 			list = append(list, scene)
 		}
 	}
@@ -174,32 +205,79 @@ func (mine *cacheContext) GetScenesByType(tp uint8) []*SceneInfo {
 }
 
 func GetAllScenes() []*SceneInfo {
-	return cacheCtx.scenes
+	return cacheCtx.allScenes()
 }
 
 func IsMasterUsed(uid string) bool {
-	for i := 0; i < len(cacheCtx.scenes); i += 1 {
-		if cacheCtx.scenes[i].Master == uid {
-			return true
-		}
+	if len(uid) < 1 {
+		return false
 	}
-	return false
+	cacheCtx.lock.RLock()
+	defer cacheCtx.lock.RUnlock()
+	_, ok := cacheCtx.masters[uid]
+	return ok
+}
+
+func RemoveScene(ctx context.Context, uid, operator string) error {
+	_, err := RemoveSceneBy(ctx, uid, operator, SceneRemoveOnly)
+	return err
 }
 
-func RemoveScene(uid, operator string) error {
+// GetSceneDepends 删除前预览场景的依赖对象，不修改数据
+func GetSceneDepends(uid string) (*nosql.SceneDepends, error) {
 	if len(uid) < 1 {
-		return errors.New("the scene uid is empty")
+		return nil, errors.New("the scene uid is empty")
 	}
-	err := nosql.RemoveScene(uid, operator)
-	if err == nil {
-		for i := 0; i < len(cacheCtx.scenes); i += 1 {
-			if cacheCtx.scenes[i].UID == uid {
-				cacheCtx.scenes = append(cacheCtx.scenes[:i], cacheCtx.scenes[i+1:]...)
-				break
-			}
+	db, err := store.GetScene(uid)
+	if err != nil {
+		return nil, err
+	}
+	if !db.DeleteTime.IsZero() {
+		return nil, errors.New("the scene had removed")
+	}
+	return nosql.GetSceneDepends(store, uid)
+}
+
+// RemoveSceneBy 按照模式删除场景，返回依赖报告，只删除场景时没有报告，严格模式下存在依赖时返回ErrSceneDepends
+func RemoveSceneBy(ctx context.Context, uid, operator string, mode SceneRemoveMode) (*nosql.SceneDepends, error) {
+	if mode > SceneRemoveDetach {
+		return nil, errors.New("the remove mode is unknown")
+	}
+	if mode == SceneRemoveOnly {
+		if len(uid) < 1 {
+			return nil, errors.New("the scene uid is empty")
+		}
+		err := store.RemoveScene(ctx, uid, operator)
+		if err != nil {
+			return nil, err
+		}
+		if info := cacheCtx.lookupScene(uid); info != nil {
+			cacheCtx.removeScene(info)
 		}
+		return nil, nil
 	}
-	return err
+	depends, err := GetSceneDepends(uid)
+	if err != nil {
+		return nil, err
+	}
+	if mode == SceneRemoveStrict && depends.Total() > 0 {
+		return depends, ErrSceneDepends
+	}
+	err = store.RemoveSceneCascade(ctx, depends, mode == SceneRemoveDetach, operator, time.Now())
+	if err != nil {
+		return depends, err
+	}
+	info := cacheCtx.lookupScene(uid)
+	if info != nil {
+		cacheCtx.removeScene(info)
+	}
+	for _, area := range depends.Areas {
+		cacheCtx.unindexArea(area)
+	}
+	for _, device := range depends.Devices {
+		cacheCtx.syncDevice(device)
+	}
+	return depends, nil
 }
 
 func (mine *SceneInfo) initInfo(db *nosql.Scene) {
@@ -214,6 +292,7 @@ func (mine *SceneInfo) initInfo(db *nosql.Scene) {
 	mine.Remark = db.Remark
 	mine.Master = db.Master
 	mine.Location = db.Location
+	mine.Geo = geoOf(db.Geo, db.Location)
 	mine.Entity = db.Entity
 	mine.Limit = db.Limit
 
@@ -235,11 +314,23 @@ func (mine *SceneInfo) initInfo(db *nosql.Scene) {
 	//}
 }
 
+// initGroups 没有加载或者超过有效期时读取数据库，过期后读取失败时继续使用旧的列表
 func (mine *SceneInfo) initGroups() {
-	if mine.groups != nil {
+	mine.touch()
+	mine.lock.RLock()
+	had := mine.groups != nil && fresh(mine.groupsAt)
+	mine.lock.RUnlock()
+	countHit(had)
+	if had {
 		return
 	}
-	groups, err := nosql.GetGroupsByScene(mine.UID)
+	groups, err := store.GetGroupsByScene(mine.UID)
+	mine.lock.Lock()
+	if mine.groups != nil && fresh(mine.groupsAt) {
+		mine.lock.Unlock()
+		return
+	}
+	countExpire(mine.groups != nil)
 	if err == nil {
 		mine.groups = make([]*GroupInfo, 0, len(groups))
 		for i := 0; i < len(groups); i += 1 {
@@ -247,88 +338,237 @@ func (mine *SceneInfo) initGroups() {
 			tmp.initInfo(groups[i])
 			mine.groups = append(mine.groups, tmp)
 		}
-	} else {
+		mine.groupsAt = time.Now()
+	} else if mine.groups == nil {
 		mine.groups = make([]*GroupInfo, 0, 1)
 	}
+	mine.lock.Unlock()
+	cacheCtx.checkResident(mine)
+}
+
+// groupList 返回小组列表的副本
+func (mine *SceneInfo) groupList() []*GroupInfo {
+	mine.initGroups()
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	list := make([]*GroupInfo, len(mine.groups))
+	copy(list, mine.groups)
+	return list
 }
 
 func (mine *SceneInfo) initRooms() {
-	if mine.rooms != nil {
+	mine.touch()
+	mine.lock.RLock()
+	had := mine.rooms != nil && fresh(mine.roomsAt)
+	mine.lock.RUnlock()
+	countHit(had)
+	if had {
+		return
+	}
+	list, err := store.GetRoomsByScene(mine.UID)
+	mine.lock.Lock()
+	if mine.rooms != nil && fresh(mine.roomsAt) {
+		mine.lock.Unlock()
 		return
 	}
-	list, err := nosql.GetRoomsByScene(mine.UID)
+	countExpire(mine.rooms != nil)
 	if err == nil {
+		for _, room := range mine.rooms {
+			cacheCtx.unindexRoom(room.UID)
+		}
 		mine.rooms = make([]*RoomInfo, 0, len(list))
 		for i := 0; i < len(list); i += 1 {
 			tmp := new(RoomInfo)
 			tmp.initInfo(list[i])
 			mine.rooms = append(mine.rooms, tmp)
 		}
-	} else {
+		mine.roomsAt = time.Now()
+	} else if mine.rooms == nil {
 		mine.rooms = make([]*RoomInfo, 0, 1)
 	}
+	cacheCtx.indexRooms(mine.rooms...)
+	mine.lock.Unlock()
+	cacheCtx.checkResident(mine)
+}
+
+// roomList 返回房间列表的副本
+func (mine *SceneInfo) roomList() []*RoomInfo {
+	mine.initRooms()
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	list := make([]*RoomInfo, len(mine.rooms))
+	copy(list, mine.rooms)
+	return list
+}
+
+// update 写数据库成功后修改缓存的字段，读取字段需要持有读锁或者使用Clone
+func (mine *SceneInfo) update(operator string, fun func()) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	fun()
+	mine.Operator = operator
+}
+
+// Clone 字段以及成员、上级的副本，用于返回给调用者，不能用于修改
+func (mine *SceneInfo) Clone() *SceneInfo {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	tmp := new(SceneInfo)
+	tmp.baseInfo = mine.baseInfo
+	tmp.Type = mine.Type
+	tmp.Status = mine.Status
+	tmp.Limit = mine.Limit
+	tmp.Location = mine.Location
+	tmp.Geo = mine.Geo
+	tmp.Cover = mine.Cover
+	tmp.Remark = mine.Remark
+	tmp.Master = mine.Master
+	tmp.Entity = mine.Entity
+	tmp.Supporter = mine.Supporter
+	tmp.ShortName = mine.ShortName
+	tmp.Address = mine.Address
+	tmp.members = append(make([]string, 0, len(mine.members)), mine.members...)
+	tmp.parents = append(make([]string, 0, len(mine.parents)), mine.parents...)
+	tmp.Questions = append(make([]string, 0, len(mine.Questions)), mine.Questions...)
+	return tmp
 }
 
-func (mine *SceneInfo) UpdateBase(name, remark, operator string) error {
+// syncInfo 其他实例修改后在原有的对象上同步字段，子集合以及加载时间保留
+func (mine *SceneInfo) syncInfo(db *nosql.Scene) {
+	tmp := new(SceneInfo)
+	tmp.initInfo(db)
+	var master string
+	var members []string
+	mine.update(tmp.Operator, func() {
+		master = mine.Master
+		members = mine.members
+		mine.UpdateTime = tmp.UpdateTime
+		mine.Name = tmp.Name
+		mine.Cover = tmp.Cover
+		mine.Remark = tmp.Remark
+		mine.Master = tmp.Master
+		mine.Location = tmp.Location
+		mine.Geo = tmp.Geo
+		mine.Entity = tmp.Entity
+		mine.Limit = tmp.Limit
+		mine.ShortName = tmp.ShortName
+		mine.Type = tmp.Type
+		mine.Status = tmp.Status
+		mine.members = tmp.members
+		mine.Address = tmp.Address
+		mine.Supporter = tmp.Supporter
+		mine.Questions = tmp.Questions
+		mine.parents = tmp.parents
+	})
+	cacheCtx.reindexScene(mine, master, members)
+}
+
+func (mine *SceneInfo) master() string {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.Master
+}
+
+func (mine *SceneInfo) sceneType() SceneType {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.Type
+}
+
+func (mine *SceneInfo) UpdateBase(ctx context.Context, name, remark, operator string) error {
+	mine.lock.RLock()
 	if len(name) < 1 {
 		name = mine.Name
 	}
 	if len(remark) < 1 {
 		remark = mine.Remark
 	}
-	err := nosql.UpdateSceneBase(mine.UID, name, remark, operator)
+	mine.lock.RUnlock()
+	err := store.UpdateSceneBase(ctx, mine.UID, name, remark, operator)
 	if err == nil {
-		mine.Name = name
-		mine.Remark = remark
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Name = name
+			mine.Remark = remark
+		})
 	}
 	return err
 }
 
-func (mine *SceneInfo) UpdateMaster(master, operator string) error {
-	if mine.Master == master {
+func (mine *SceneInfo) UpdateMaster(ctx context.Context, master, operator string) error {
+	if mine.master() == master {
 		return nil
 	}
-	if IsMasterUsed(master) {
+	if len(master) > 0 && !cacheCtx.claimMaster(master, mine) {
 		return errors.New("the master had used by other scene")
 	}
-	err := nosql.UpdateSceneMaster(mine.UID, master, operator)
+	err := store.UpdateSceneMaster(ctx, mine.UID, master, operator)
 	if err == nil {
-		mine.Master = master
-		mine.Operator = operator
+		old := ""
+		mine.update(operator, func() {
+			old = mine.Master
+			mine.Master = master
+		})
+		if old != master {
+			cacheCtx.releaseMaster(old, mine)
+		}
+	} else {
+		cacheCtx.releaseMaster(master, mine)
 	}
 	return err
 }
 
-func (mine *SceneInfo) UpdateCover(cover, operator string) error {
-	if mine.Cover == cover {
+func (mine *SceneInfo) UpdateCover(ctx context.Context, cover, operator string) error {
+	mine.lock.RLock()
+	same := mine.Cover == cover
+	mine.lock.RUnlock()
+	if same {
 		return nil
 	}
-	err := nosql.UpdateSceneCover(mine.UID, cover, operator)
+	err := store.UpdateSceneCover(ctx, mine.UID, cover, operator)
 	if err == nil {
-		mine.Cover = cover
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Cover = cover
+		})
 	}
 	return err
 }
 
-func (mine *SceneInfo) UpdateType(operator string, tp uint8) error {
-	if uint8(mine.Type) == tp {
+func (mine *SceneInfo) UpdateType(ctx context.Context, operator string, tp uint8) error {
+	if uint8(mine.sceneType()) == tp {
 		return nil
 	}
-	err := nosql.UpdateSceneType(mine.UID, operator, tp)
+	err := store.UpdateSceneType(ctx, mine.UID, operator, tp)
 	if err == nil {
-		mine.Type = SceneType(tp)
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Type = SceneType(tp)
+		})
 	}
 	return err
 }
 
-func (mine *SceneInfo) UpdateLocation(local, operator string) error {
-	err := nosql.UpdateSceneLocal(mine.UID, local, operator)
+func (mine *SceneInfo) geoPoint() *nosql.GeoPoint {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.Geo
+}
+
+func (mine *SceneInfo) geoHit() *GeoHit {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return &GeoHit{Type: "scene", UID: mine.UID, Scene: mine.UID, Name: mine.Name}
+}
+
+func (mine *SceneInfo) UpdateLocation(ctx context.Context, local, operator string) error {
+	local, geo, err := parseLocation(local)
+	if err != nil {
+		return err
+	}
+	err = store.UpdateSceneLocal(ctx, mine.UID, local, operator)
 	if err == nil {
-		mine.Location = local
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Location = local
+			mine.Geo = geo
+		})
 	}
 	return err
 }
@@ -342,20 +582,35 @@ func (mine *SceneInfo) UpdateLocation(local, operator string) error {
 //	return err
 //}
 
-func (mine *SceneInfo) UpdateQuestions(operator string, arr []string) error {
-	err := nosql.UpdateSceneQuestions(mine.UID, operator, arr)
-	if err == nil {
-		mine.Questions = arr
-		mine.Operator = operator
+// UpdateQuestions 只提交移除以及追加的问题，不替换整个数组
+func (mine *SceneInfo) UpdateQuestions(ctx context.Context, operator string, arr []string) error {
+	mine.lock.RLock()
+	removes, adds := tool.DiffItems(mine.Questions, arr)
+	mine.lock.RUnlock()
+	if len(removes) > 0 {
+		err := store.SubtractSceneQuestions(ctx, mine.UID, operator, removes)
+		if err != nil {
+			return err
+		}
 	}
-	return err
+	if len(adds) > 0 {
+		err := store.AppendSceneQuestions(ctx, mine.UID, operator, adds)
+		if err != nil {
+			return err
+		}
+	}
+	mine.update(operator, func() {
+		mine.Questions = arr
+	})
+	return nil
 }
 
-func (mine *SceneInfo) UpdateLimit(operator string, limit int) error {
-	err := nosql.UpdateSceneLimit(mine.UID, operator, uint16(limit))
+func (mine *SceneInfo) UpdateLimit(ctx context.Context, operator string, limit int) error {
+	err := store.UpdateSceneLimit(ctx, mine.UID, operator, uint16(limit))
 	if err == nil {
-		mine.Limit = uint16(limit)
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Limit = uint16(limit)
+		})
 	}
 	return err
 }
@@ -369,44 +624,54 @@ func (mine *SceneInfo) UpdateLimit(operator string, limit int) error {
 //	return err
 //}
 
-func (mine *SceneInfo) UpdateShortName(name, operator string) error {
-	err := nosql.UpdateSceneShort(mine.UID, operator, name)
+func (mine *SceneInfo) UpdateShortName(ctx context.Context, name, operator string) error {
+	err := store.UpdateSceneShort(ctx, mine.UID, operator, name)
 	if err == nil {
-		mine.ShortName = name
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.ShortName = name
+		})
 	}
 	return err
 }
 
-func (mine *SceneInfo) UpdateAddress(country, province, city, zone, operator string) error {
+func (mine *SceneInfo) UpdateAddress(ctx context.Context, country, province, city, zone, operator string) error {
 	addr := nosql.AddressInfo{Country: country, Province: province, City: city, Zone: zone}
-	err := nosql.UpdateSceneAddress(mine.UID, operator, addr)
+	err := store.UpdateSceneAddress(ctx, mine.UID, operator, addr)
 	if err == nil {
-		mine.Address = addr
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Address = addr
+		})
 	}
 	return err
 }
 
-func (mine *SceneInfo) UpdateStatus(st SceneStatus, operator string) error {
-	err := nosql.UpdateSceneStatus(mine.UID, uint8(st), operator)
+func (mine *SceneInfo) UpdateStatus(ctx context.Context, st SceneStatus, operator string) error {
+	err := store.UpdateSceneStatus(ctx, mine.UID, uint8(st), operator)
 	if err == nil {
-		mine.Status = st
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Status = st
+		})
 	}
 	return err
 }
 
-func (mine *SceneInfo) UpdateSupporter(supporter, operator string) error {
-	err := nosql.UpdateSceneSupporter(mine.UID, supporter, operator)
+func (mine *SceneInfo) UpdateSupporter(ctx context.Context, supporter, operator string) error {
+	err := store.UpdateSceneSupporter(ctx, mine.UID, supporter, operator)
 	if err == nil {
-		mine.Supporter = supporter
-		mine.Operator = operator
+		mine.update(operator, func() {
+			mine.Supporter = supporter
+		})
 	}
 	return err
 }
 
 func (mine *SceneInfo) HadMember(member string) bool {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.hadMember(member)
+}
+
+func (mine *SceneInfo) hadMember(member string) bool {
 	if mine.Master == member {
 		return true
 	}
@@ -419,59 +684,68 @@ func (mine *SceneInfo) HadMember(member string) bool {
 }
 
 func (mine *SceneInfo) AllMembers() []string {
-	return mine.members
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	list := make([]string, len(mine.members))
+	copy(list, mine.members)
+	return list
 }
 
-func (mine *SceneInfo) AppendMember(member string) error {
-	if mine.HadMember(member) {
+func (mine *SceneInfo) AppendMember(ctx context.Context, member string) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if mine.hadMember(member) {
 		return errors.New("the member had existed")
 	}
-	err := nosql.AppendSceneMember(mine.UID, member)
+	err := store.AppendSceneMember(ctx, mine.UID, member)
 	if err == nil {
 		mine.members = append(mine.members, member)
+		cacheCtx.indexMember(member, mine)
 	}
 	return err
 }
 
-func (mine *SceneInfo) SubtractMember(member string) error {
-	if !mine.HadMember(member) {
+func (mine *SceneInfo) SubtractMember(ctx context.Context, member string) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if !mine.hadMember(member) {
 		return errors.New("the member not existed")
 	}
-	err := nosql.SubtractSceneMember(mine.UID, member)
+	err := store.SubtractSceneMember(ctx, mine.UID, member)
 	if err == nil {
 		for i := 0; i < len(mine.members); i += 1 {
 			if mine.members[i] == member {
-				if i == len(mine.members)-1 {
-					mine.members = append(mine.members[:i])
-				} else {
-					mine.members = append(mine.members[:i], mine.members[i+1:]...)
-				}
+				mine.members = append(mine.members[:i:i], mine.members[i+1:]...)
 				break
 			}
 		}
+		cacheCtx.unindexMember(member, mine)
 	}
 	return err
 }
 
 func (mine *SceneInfo) Parents() []string {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
 	return mine.parents
 }
 
-func (mine *SceneInfo) UpdateParents(operator string, list []string) error {
+func (mine *SceneInfo) UpdateParents(ctx context.Context, operator string, list []string) error {
 	if list == nil {
 		return errors.New("the children is nil")
 	}
-	err := nosql.UpdateSceneParents(mine.UID, operator, list)
+	err := store.UpdateSceneParents(ctx, mine.UID, operator, list)
 	if err == nil {
+		mine.lock.Lock()
 		mine.parents = list
+		mine.lock.Unlock()
 	}
 	return err
 }
 
 func (mine *SceneInfo) HadParent(uid string) bool {
-	if mine.parents == nil {
-		return false
-	}
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
 	for _, item := range mine.parents {
 		if item == uid {
 			return true
@@ -481,11 +755,18 @@ func (mine *SceneInfo) HadParent(uid string) bool {
 }
 
 //region Group Fun
-func (mine *SceneInfo) CreateGroup(info *pb.ReqGroupAdd) (*GroupInfo, error) {
+func (mine *SceneInfo) CreateGroup(ctx context.Context, info *pb.ReqGroupAdd) (*GroupInfo, error) {
+	local, geo, err := parseLocation(info.Location)
+	if err != nil {
+		return nil, err
+	}
 	mine.initGroups()
 	db := new(nosql.Group)
 	db.UID = primitive.NewObjectID()
-	db.ID = nosql.GetGroupNextID()
+	db.ID, err = store.GetGroupNextID()
+	if err != nil {
+		return nil, err
+	}
 	db.CreatedTime = time.Now()
 	db.UpdatedTime = time.Now()
 	db.Operator = info.Operator
@@ -493,40 +774,74 @@ func (mine *SceneInfo) CreateGroup(info *pb.ReqGroupAdd) (*GroupInfo, error) {
 	db.Name = info.Name
 	db.Cover = info.Cover
 	db.Remark = info.Remark
-	db.Location = info.Location
+	db.Location = local
+	db.Geo = geo
 	db.Contact = info.Contact
 	db.Scene = info.Scene
-	db.Address = nosql.AddressInfo{
-		Country:  info.Address.Country,
-		Province: info.Address.Province,
-		City:     info.Address.City,
-		Zone:     info.Address.Zone,
+	if info.Address != nil {
+		db.Address = nosql.AddressInfo{
+			Country:  info.Address.Country,
+			Province: info.Address.Province,
+			City:     info.Address.City,
+			Zone:     info.Address.Zone,
+		}
 	}
 	db.Members = make([]string, 0, 1)
-	err := nosql.CreateGroup(db)
+	err = store.CreateGroup(ctx, db)
 	if err == nil {
 		tmp := new(GroupInfo)
 		tmp.initInfo(db)
+		mine.lock.Lock()
 		mine.groups = append(mine.groups, tmp)
+		mine.lock.Unlock()
 		return tmp, nil
 	}
 	return nil, err
 }
 
-func (mine *SceneInfo) HadGroup(uid string) bool {
-	mine.initGroups()
-	for _, group := range mine.groups {
-		if group.UID == uid {
-			return true
+// syncGroup 回收站恢复或者其他实例修改后同步到缓存，删除的移除，没有加载时等待initGroups
+func (mine *SceneInfo) syncGroup(db *nosql.Group) {
+	uid := db.UID.Hex()
+	if !db.DeleteTime.IsZero() {
+		mine.dropGroup(uid)
+		return
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if mine.groups == nil {
+		return
+	}
+	//已有的小组在原对象上修改，不替换指针
+	for i := 0; i < len(mine.groups); i++ {
+		if mine.groups[i].UID == uid {
+			mine.groups[i].syncInfo(db)
+			return
+		}
+	}
+	tmp := new(GroupInfo)
+	tmp.initInfo(db)
+	mine.groups = append(mine.groups, tmp)
+}
+
+// dropGroup 只从缓存中移除
+func (mine *SceneInfo) dropGroup(uid string) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	for i := 0; i < len(mine.groups); i++ {
+		if mine.groups[i].UID == uid {
+			mine.groups = append(mine.groups[:i:i], mine.groups[i+1:]...)
+			break
 		}
 	}
-	return false
+}
+
+func (mine *SceneInfo) HadGroup(uid string) bool {
+	return mine.GetGroup(uid) != nil
 }
 
 func (mine *SceneInfo) HadGroupByName(name string) bool {
-	mine.initGroups()
-	for _, group := range mine.groups {
-		if group.Name == name {
+	for _, group := range mine.groupList() {
+		if group.name() == name {
 			return true
 		}
 	}
@@ -534,8 +849,7 @@ func (mine *SceneInfo) HadGroupByName(name string) bool {
 }
 
 func (mine *SceneInfo) GetGroup(uid string) *GroupInfo {
-	mine.initGroups()
-	for _, group := range mine.groups {
+	for _, group := range mine.groupList() {
 		if group.UID == uid {
 			return group
 		}
@@ -543,53 +857,43 @@ func (mine *SceneInfo) GetGroup(uid string) *GroupInfo {
 	return nil
 }
 
-func (mine *SceneInfo) RemoveGroup(uid, operator string) error {
-	mine.initGroups()
+func (mine *SceneInfo) RemoveGroup(ctx context.Context, uid, operator string) error {
 	if !mine.HadGroup(uid) {
 		return nil
 	}
-	err := nosql.RemoveGroup(uid, operator)
+	err := store.RemoveGroup(ctx, uid, operator)
 	if err == nil {
-		for i := 0; i < len(mine.groups); i++ {
-			if mine.groups[i].UID == uid {
-				if i == len(mine.groups)-1 {
-					mine.groups = append(mine.groups[:i])
-				} else {
-					mine.groups = append(mine.groups[:i], mine.groups[i+1:]...)
-				}
-				break
-			}
-		}
+		mine.dropGroup(uid)
 	}
 	return err
 }
 
-func (mine *SceneInfo) GetGroups(number, page uint32) (uint32, uint32, []*GroupInfo) {
-	mine.initGroups()
-	if number < 1 {
-		number = 10
-	}
-	if len(mine.groups) < 1 {
-		return 0, 0, make([]*GroupInfo, 0, 1)
-	}
-	total, maxPage, list := checkPage(page, number, mine.groups)
-	return total, maxPage, list
+func (mine *SceneInfo) GetGroups(pager *Pager) (uint32, uint32, []*GroupInfo) {
+	return PageList(pager, mine.groupList())
 }
 
 //endregion
 
 //region Region
-func (mine *SceneInfo) CreateRegion(info *pb.ReqRegionAdd) (*RegionInfo, error) {
+func (mine *SceneInfo) CreateRegion(ctx context.Context, info *pb.ReqRegionAdd) (*RegionInfo, error) {
+	local, geo, err := parseLocation(info.Location)
+	if err != nil {
+		return nil, err
+	}
 	db := new(nosql.Region)
 	db.UID = primitive.NewObjectID()
-	db.ID = nosql.GetRegionNextID()
+	db.ID, err = store.GetRegionNextID()
+	if err != nil {
+		return nil, err
+	}
 	db.CreatedTime = time.Now()
 	db.UpdatedTime = time.Now()
 	db.Operator = info.Operator
 	db.Creator = info.Operator
 	db.Name = info.Name
 	db.Remark = info.Remark
-	db.Location = info.Location
+	db.Location = local
+	db.Geo = geo
 	db.Scene = info.Scene
 	db.Parent = info.Parent
 	db.Master = ""
@@ -610,27 +914,128 @@ func (mine *SceneInfo) CreateRegion(info *pb.ReqRegionAdd) (*RegionInfo, error)
 	}
 
 	db.Members = make([]string, 0, 1)
-	err := nosql.CreateRegion(db)
+	if len(db.Parent) > 0 {
+		parent := mine.findRegion(db.Parent)
+		if parent == nil {
+			return nil, errors.New("the parent region not found")
+		}
+		if parent.Depth()+1 > MaxRegionDepth {
+			return nil, errors.New("the region tree is too deep")
+		}
+	}
+	mine.initRegions()
+	err = store.CreateRegion(ctx, db)
 	if err == nil {
 		tmp := new(RegionInfo)
 		tmp.initInfo(db)
+		mine.lock.Lock()
+		mine.regions = append(mine.regions, tmp)
+		mine.lock.Unlock()
+		cacheCtx.indexRegions(tmp)
 		return tmp, nil
 	}
 	return nil, err
 }
 
-func (mine *SceneInfo) HadRegion(uid string) bool {
-	info, _ := mine.GetRegion(uid)
-	if info != nil {
-		return true
+func (mine *SceneInfo) initRegions() {
+	mine.touch()
+	mine.lock.RLock()
+	had := mine.regions != nil && fresh(mine.regionsAt)
+	mine.lock.RUnlock()
+	countHit(had)
+	if had {
+		return
 	}
-	return false
+	list, err := store.GetRegionsByScene(mine.UID)
+	mine.lock.Lock()
+	if mine.regions != nil && fresh(mine.regionsAt) {
+		mine.lock.Unlock()
+		return
+	}
+	countExpire(mine.regions != nil)
+	if err == nil {
+		for _, region := range mine.regions {
+			cacheCtx.unindexRegion(region.UID)
+		}
+		mine.regions = make([]*RegionInfo, 0, len(list))
+		for i := 0; i < len(list); i += 1 {
+			tmp := new(RegionInfo)
+			tmp.initInfo(list[i])
+			mine.regions = append(mine.regions, tmp)
+		}
+		mine.regionsAt = time.Now()
+	} else if mine.regions == nil {
+		mine.regions = make([]*RegionInfo, 0, 1)
+	}
+	cacheCtx.indexRegions(mine.regions...)
+	mine.lock.Unlock()
+	cacheCtx.checkResident(mine)
+}
+
+// regionList 返回区域列表的副本
+func (mine *SceneInfo) regionList() []*RegionInfo {
+	mine.initRegions()
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	list := make([]*RegionInfo, len(mine.regions))
+	copy(list, mine.regions)
+	return list
+}
+
+func (mine *SceneInfo) findRegion(uid string) *RegionInfo {
+	for _, item := range mine.regionList() {
+		if item.UID == uid {
+			return item
+		}
+	}
+	return nil
+}
+
+// syncRegion 回收站恢复或者其他实例修改后同步到缓存，删除的移除，没有加载时等待initRegions
+func (mine *SceneInfo) syncRegion(db *nosql.Region) {
+	uid := db.UID.Hex()
+	if !db.DeleteTime.IsZero() {
+		mine.dropRegion(uid)
+		return
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if mine.regions == nil {
+		return
+	}
+	//已有的区域在原对象上修改，不替换指针
+	for i := 0; i < len(mine.regions); i++ {
+		if mine.regions[i].UID == uid {
+			mine.regions[i].syncInfo(db)
+			return
+		}
+	}
+	tmp := new(RegionInfo)
+	tmp.initInfo(db)
+	cacheCtx.indexRegions(tmp)
+	mine.regions = append(mine.regions, tmp)
+}
+
+// dropRegion 只从缓存中移除
+func (mine *SceneInfo) dropRegion(uid string) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	for i := 0; i < len(mine.regions); i++ {
+		if mine.regions[i].UID == uid {
+			mine.regions = append(mine.regions[:i:i], mine.regions[i+1:]...)
+			break
+		}
+	}
+	cacheCtx.unindexRegion(uid)
+}
+
+func (mine *SceneInfo) HadRegion(uid string) bool {
+	return mine.findRegion(uid) != nil
 }
 
 func (mine *SceneInfo) HadRegionByName(name string) bool {
-	arr := cacheCtx.GetRegionsByScene(mine.UID)
-	for _, group := range arr {
-		if group.Name == name {
+	for _, item := range mine.regionList() {
+		if item.filterValue("name") == name {
 			return true
 		}
 	}
@@ -638,40 +1043,45 @@ func (mine *SceneInfo) HadRegionByName(name string) bool {
 }
 
 func (mine *SceneInfo) GetRegion(uid string) (*RegionInfo, error) {
-	return cacheCtx.GetRegion(uid)
+	info := mine.findRegion(uid)
+	if info == nil {
+		return nil, errors.New("not found the region of " + uid)
+	}
+	return info, nil
 }
 
-func (mine *SceneInfo) RemoveRegion(uid, operator string) error {
-	info, er := mine.GetRegion(uid)
-	if er != nil {
-		return er
-	}
+func (mine *SceneInfo) RemoveRegion(ctx context.Context, uid, operator string) error {
+	info := mine.findRegion(uid)
 	if info == nil {
 		return nil
 	}
-	return info.Remove(operator)
+	return info.Remove(ctx, operator)
 }
 
-func (mine *SceneInfo) GetRegions(number, page uint32) (uint32, uint32, []*RegionInfo) {
-	array := cacheCtx.GetRegionsByScene(mine.UID)
-	if number < 1 {
-		number = 10
-	}
-	if len(array) < 1 {
-		return 0, 0, make([]*RegionInfo, 0, 1)
-	}
-	total, maxPage, list := checkPage(page, number, array)
-	return total, maxPage, list
+func (mine *SceneInfo) GetRegions(pager *Pager) (uint32, uint32, []*RegionInfo) {
+	return PageList(pager, mine.regionList())
+}
+
+func (mine *SceneInfo) QueryRegions(query *FilterQuery, pager *Pager) (uint32, uint32, []*RegionInfo, error) {
+	return QueryList(query, pager, mine.regionList())
+}
+
+func (mine *SceneInfo) GeoRegions(query *GeoQuery, pager *Pager) (uint32, uint32, []*RegionInfo, error) {
+	return geoPage(query, pager, mine.geoRegions(query))
 }
 
 //endregion
 
 //region Room Fun
-func (mine *SceneInfo) CreateRoom(info *pb.ReqRoomAdd) (*RoomInfo, error) {
+func (mine *SceneInfo) CreateRoom(ctx context.Context, info *pb.ReqRoomAdd) (*RoomInfo, error) {
 	mine.initRooms()
 	db := new(nosql.Room)
 	db.UID = primitive.NewObjectID()
-	db.ID = nosql.GetRoomNextID()
+	id, err := store.GetRoomNextID()
+	if err != nil {
+		return nil, err
+	}
+	db.ID = id
 	db.CreatedTime = time.Now()
 	db.UpdatedTime = time.Now()
 	db.Operator = info.Operator
@@ -681,30 +1091,64 @@ func (mine *SceneInfo) CreateRoom(info *pb.ReqRoomAdd) (*RoomInfo, error) {
 	db.Scene = info.Owner
 	db.Quotes = make([]string, 0, 1)
 	//db.Displays = make([]proxy.DisplayInfo, 0, 1)
-	err := nosql.CreateRoom(db)
+	err = store.CreateRoom(ctx, db)
 	if err == nil {
 		tmp := new(RoomInfo)
 		tmp.initInfo(db)
+		mine.lock.Lock()
 		mine.rooms = append(mine.rooms, tmp)
+		cacheCtx.indexRooms(tmp)
+		mine.lock.Unlock()
 		return tmp, nil
 	}
 	return nil, err
 }
 
-func (mine *SceneInfo) HadRoom(uid string) bool {
-	mine.initRooms()
-	for _, item := range mine.rooms {
-		if item.UID == uid {
-			return true
+// syncRoom 回收站恢复或者其他实例修改后同步到缓存以及索引，没有加载时等待initRooms
+func (mine *SceneInfo) syncRoom(db *nosql.Room) {
+	uid := db.UID.Hex()
+	if !db.DeleteTime.IsZero() {
+		mine.dropRoom(uid)
+		return
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if mine.rooms == nil {
+		return
+	}
+	//已有的房间在原对象上修改，不替换指针
+	for i := 0; i < len(mine.rooms); i++ {
+		if mine.rooms[i].UID == uid {
+			mine.rooms[i].syncInfo(db)
+			return
 		}
 	}
-	return false
+	tmp := new(RoomInfo)
+	tmp.initInfo(db)
+	cacheCtx.indexRooms(tmp)
+	mine.rooms = append(mine.rooms, tmp)
+}
+
+// dropRoom 只从缓存以及索引中移除
+func (mine *SceneInfo) dropRoom(uid string) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	for i := 0; i < len(mine.rooms); i++ {
+		if mine.rooms[i].UID == uid {
+			mine.rooms = append(mine.rooms[:i:i], mine.rooms[i+1:]...)
+			break
+		}
+	}
+	cacheCtx.unindexRoom(uid)
+}
+
+func (mine *SceneInfo) HadRoom(uid string) bool {
+	return mine.GetRoom(uid) != nil
 }
 
 func (mine *SceneInfo) HadRoomByName(name string) bool {
-	mine.initRooms()
-	for _, item := range mine.rooms {
-		if item.Name == name {
+	for _, item := range mine.roomList() {
+		if item.name() == name {
 			return true
 		}
 	}
@@ -712,24 +1156,22 @@ func (mine *SceneInfo) HadRoomByName(name string) bool {
 }
 
 func (mine *SceneInfo) GetRooms() []*RoomInfo {
-	mine.initRooms()
-	return mine.rooms
+	return mine.roomList()
 }
 
 func (mine *SceneInfo) GetRoom(uid string) *RoomInfo {
 	mine.initRooms()
-	for _, item := range mine.rooms {
-		if item.UID == uid {
-			return item
-		}
+	info := cacheCtx.lookupRoom(uid)
+	if info != nil && info.Scene == mine.UID {
+		return info
 	}
 	return nil
 }
 
 func (mine *SceneInfo) GetRoomsByType(tp uint8) []*RoomInfo {
-	mine.initRooms()
-	list := make([]*RoomInfo, 0, len(mine.rooms))
-	for _, item := range mine.rooms {
+	rooms := mine.roomList()
+	list := make([]*RoomInfo, 0, len(rooms))
+	for _, item := range rooms {
 		if item.HadDeviceByType(tp) {
 			list = append(list, item)
 		}
@@ -738,9 +1180,9 @@ func (mine *SceneInfo) GetRoomsByType(tp uint8) []*RoomInfo {
 }
 
 func (mine *SceneInfo) GetRoomsByQuote(quote string) []*RoomInfo {
-	mine.initRooms()
-	list := make([]*RoomInfo, 0, len(mine.rooms))
-	for _, item := range mine.rooms {
+	rooms := mine.roomList()
+	list := make([]*RoomInfo, 0, len(rooms))
+	for _, item := range rooms {
 		if item.HadQuote(quote) {
 			list = append(list, item)
 		}
@@ -749,9 +1191,9 @@ func (mine *SceneInfo) GetRoomsByQuote(quote string) []*RoomInfo {
 }
 
 func (mine *SceneInfo) GetRoomsByDevice(device string) []*RoomInfo {
-	mine.initRooms()
-	list := make([]*RoomInfo, 0, len(mine.rooms))
-	for _, item := range mine.rooms {
+	rooms := mine.roomList()
+	list := make([]*RoomInfo, 0, len(rooms))
+	for _, item := range rooms {
 		if item.HadDevice(device) {
 			list = append(list, item)
 		}
@@ -771,8 +1213,7 @@ func (mine *SceneInfo) GetRoomsByDevice(device string) []*RoomInfo {
 //}
 
 func (mine *SceneInfo) GetAreaBySN(sn string) *AreaInfo {
-	mine.initRooms()
-	for _, item := range mine.rooms {
+	for _, item := range mine.roomList() {
 		tmp := item.GetAreaBySN(sn)
 		if tmp != nil {
 			return tmp
@@ -782,8 +1223,7 @@ func (mine *SceneInfo) GetAreaBySN(sn string) *AreaInfo {
 }
 
 func (mine *SceneInfo) GetArea(uid string) *AreaInfo {
-	mine.initRooms()
-	for _, item := range mine.rooms {
+	for _, item := range mine.roomList() {
 		tmp := item.GetAreaBy(uid)
 		if tmp != nil {
 			return tmp
@@ -793,7 +1233,7 @@ func (mine *SceneInfo) GetArea(uid string) *AreaInfo {
 }
 
 func (mine *SceneInfo) GetDevices(arr []string) ([]*AreaInfo, error) {
-	all, err := nosql.GetAreasByOwner(mine.UID)
+	all, err := store.GetAreasByOwner(mine.UID)
 	if err != nil {
 		return nil, err
 	}
@@ -833,34 +1273,61 @@ func (mine *SceneInfo) GetDevicesByRoom(room string) ([]*AreaInfo, error) {
 	return list, nil
 }
 
-func (mine *SceneInfo) RemoveRoom(uid, operator string) error {
+func (mine *SceneInfo) RemoveRoom(ctx context.Context, uid, operator string) error {
 	if !mine.HadRoom(uid) {
 		return nil
 	}
-	err := nosql.RemoveRoom(uid, operator)
+	err := store.RemoveRoom(ctx, uid, operator)
 	if err == nil {
-		for i := 0; i < len(mine.rooms); i++ {
-			if mine.rooms[i].UID == uid {
-				if i == len(mine.rooms)-1 {
-					mine.rooms = append(mine.rooms[:i])
-				} else {
-					mine.rooms = append(mine.rooms[:i], mine.rooms[i+1:]...)
-				}
-				break
-			}
-		}
+		mine.dropRoom(uid)
 	}
 	return err
 }
 
-func (mine *SceneInfo) ClearQuotes(operator string, list []string) {
-	mine.initRooms()
-	for _, room := range mine.rooms {
-		if room.HadQuotes(list) {
-			_ = room.UpdateQuotes(operator, make([]string, 0, 1))
-			break
+func (mine *SceneInfo) ClearQuotes(ctx context.Context, operator string, list []string) error {
+	return mine.UpdateRoomQuotes(ctx, nil, operator, list)
+}
+
+// UpdateRoomQuotes 从其他房间中移除相同的引用，然后设置到指定的房间，room为nil时只移除，数组只提交变化的元素
+func (mine *SceneInfo) UpdateRoomQuotes(ctx context.Context, room *RoomInfo, operator string, list []string) error {
+	if list == nil {
+		list = make([]string, 0, 1)
+	}
+	rooms := make([]*RoomInfo, 0, 2)
+	ops := make([]*nosql.WriteOp, 0, 2)
+	for _, item := range mine.roomList() {
+		if item != room && item.HadQuotes(list) {
+			rooms = append(rooms, item)
+			ops = append(ops, nosql.RoomQuotesPullOp(item.UID, operator, list))
 		}
 	}
+	if room != nil {
+		removes, adds := tool.DiffItems(room.quotes(), list)
+		if len(removes) > 0 {
+			ops = append(ops, nosql.RoomQuotesPullOp(room.UID, operator, removes))
+		}
+		if len(adds) > 0 {
+			ops = append(ops, nosql.RoomQuotesAddOp(room.UID, operator, adds))
+		}
+	}
+	err := store.RunTransaction(ctx, ops)
+	if err != nil {
+		return err
+	}
+	for _, item := range rooms {
+		//不在list中的就是保留的引用
+		rest, _ := tool.DiffItems(item.quotes(), list)
+		item.update(operator, func() {
+			item.Quotes = rest
+		})
+	}
+	if room != nil {
+		list = append(make([]string, 0, len(list)), list...)
+		room.update(operator, func() {
+			room.Quotes = list
+		})
+	}
+	return nil
 }
 
 //endregion
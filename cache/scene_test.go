@@ -0,0 +1,239 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
+)
+
+// 使用go test -race检查场景字段的并发读写
+func TestSceneConcurrentUpdate(t *testing.T) {
+	ctx := context.Background()
+	initMemory(t)
+	scene := createScene(t, "museum", "")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i += 1 {
+		wg.Add(2)
+		go func(num int) {
+			defer wg.Done()
+			for j := 0; j < 20; j += 1 {
+				_ = scene.UpdateBase(ctx, fmt.Sprintf("museum-%d-%d", num, j), "remark", "tester")
+				_ = scene.UpdateMaster(ctx, fmt.Sprintf("master-%d-%d", num, j), "tester")
+				_ = scene.UpdateCover(ctx, fmt.Sprintf("cover-%d", j), "tester")
+				_ = scene.UpdateType(ctx, "tester", uint8(j%5))
+				_ = scene.UpdateLocation(ctx, fmt.Sprintf("120.%d,30.%d", num, j), "tester")
+			}
+		}(i)
+		go func(num int) {
+			defer wg.Done()
+			for j := 0; j < 20; j += 1 {
+				_, _ = scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: fmt.Sprintf("room-%d-%d", num, j), Operator: "tester"})
+				_ = scene.Clone()
+				_ = scene.HadMember("master-1-1")
+				_ = scene.filterValue("master")
+				_ = cacheCtx.GetScenesByType(1)
+				_, _ = GeoSearch("scene", "", &GeoQuery{Mode: GeoModeBox, Box: []float64{100, 20, 130, 40}})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	//最后一次修改的管理员在索引中
+	info := scene.Clone()
+	if !IsMasterUsed(info.Master) {
+		t.Fatalf("the master %s not in the index", info.Master)
+	}
+	if len(scene.GetRooms()) != 80 {
+		t.Fatalf("the rooms should be 80 but %d", len(scene.GetRooms()))
+	}
+}
+
+func TestRegionConcurrentMove(t *testing.T) {
+	ctx := context.Background()
+	initMemory(t)
+	scene := createScene(t, "museum", "")
+	list := make([]*RegionInfo, 0, 4)
+	for i := 0; i < 4; i += 1 {
+		region, err := scene.CreateRegion(ctx, &pb.ReqRegionAdd{Scene: scene.UID, Name: fmt.Sprintf("region-%d", i), Operator: "tester"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, region)
+	}
+	var wg sync.WaitGroup
+	for i := 1; i < len(list); i += 1 {
+		wg.Add(2)
+		go func(region *RegionInfo) {
+			defer wg.Done()
+			for j := 0; j < 20; j += 1 {
+				parent := list[0].UID
+				if j%2 == 1 {
+					parent = ""
+				}
+				_ = region.UpdateParent(ctx, parent, "tester")
+				_ = region.UpdateBase(ctx, fmt.Sprintf("%s-%d", region.UID, j), "", "tester")
+				_ = region.AppendMember(ctx, fmt.Sprintf("member-%d", j))
+			}
+		}(list[i])
+		go func(region *RegionInfo) {
+			defer wg.Done()
+			for j := 0; j < 20; j += 1 {
+				_ = list[0].Children()
+				_ = region.Ancestors()
+				_ = scene.GetRegionTree()
+				_ = region.Clone()
+				_ = scene.HadRegionByName("region-0")
+			}
+		}(list[i])
+	}
+	wg.Wait()
+	for _, region := range list[1:] {
+		if len(region.AllMembers()) != 20 {
+			t.Fatalf("the members of %s should be 20 but %d", region.UID, len(region.AllMembers()))
+		}
+	}
+}
+
+// 房间、小组以及区域的修改和快照、列表的读取同时进行
+func TestRoomGroupConcurrentUpdate(t *testing.T) {
+	ctx := context.Background()
+	initMemory(t)
+	scene := createScene(t, "museum", "")
+	room, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "room", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := scene.CreateGroup(ctx, &pb.ReqGroupAdd{Scene: scene.UID, Name: "group", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	area, err := cacheCtx.CreateArea(ctx, "area", "", scene.UID, room.UID, "tester", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i += 1 {
+		wg.Add(2)
+		go func(num int) {
+			defer wg.Done()
+			for j := 0; j < 20; j += 1 {
+				_ = room.UpdateBase(ctx, fmt.Sprintf("room-%d-%d", num, j), "remark", "tester")
+				_ = room.UpdateQuotes(ctx, "tester", []string{fmt.Sprintf("quote-%d", j%3)})
+				_ = group.UpdateBase(ctx, fmt.Sprintf("group-%d-%d", num, j), "", "tester")
+				_ = group.UpdateContact(ctx, fmt.Sprintf("phone-%d", j), "tester")
+				_ = group.AppendMember(ctx, fmt.Sprintf("member-%d-%d", num, j))
+				_ = area.UpdateBase(ctx, fmt.Sprintf("area-%d-%d", num, j), "", "tester")
+				_ = area.UpdateModule(ctx, fmt.Sprintf("key-%d", j%3), "value", "tester")
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j += 1 {
+				_, _ = collectCacheSnapshot()
+				_ = cacheCtx.GetRoomsByQuote("quote-1")
+				_ = cacheCtx.GetGroupByContact("phone-1")
+				_ = cacheCtx.GetGroupByMember("member-1-1")
+				_ = scene.HadRoomByName("room")
+				_ = scene.HadGroupByName("group")
+				_ = room.Clone()
+				_ = group.Clone()
+				_ = area.Clone()
+				_ = room.filterValue("quotes")
+				_ = area.filterValue("remark")
+			}
+		}()
+	}
+	wg.Wait()
+	if len(group.AllMembers()) != 80 {
+		t.Fatalf("the members of group should be 80 but %d", len(group.AllMembers()))
+	}
+	if len(area.Clone().Modules) != 3 {
+		t.Fatalf("the modules of area should be 3 but %d", len(area.Clone().Modules))
+	}
+}
+
+// 其他实例的修改同步到原有的对象上，索引随之更新
+func TestSyncInPlace(t *testing.T) {
+	ctx := context.Background()
+	storage := initMemory(t)
+	scene := createScene(t, "museum", "master-a")
+	room, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "room", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	region, err := scene.CreateRegion(ctx, &pb.ReqRegionAdd{Scene: scene.UID, Name: "region", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.UpdateSceneBase(ctx, scene.UID, "museum-2", "", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.UpdateSceneMaster(ctx, scene.UID, "master-b", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.UpdateRoomBase(ctx, room.UID, "room-2", "", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.UpdateRegionBase(ctx, region.UID, "region-2", "", "other"); err != nil {
+		t.Fatal(err)
+	}
+	cacheCtx.syncScene(scene.UID)
+	db, _ := storage.GetRoom(room.UID)
+	scene.syncRoom(db)
+	tmp, _ := storage.GetRegion(region.UID)
+	scene.syncRegion(tmp)
+
+	if cacheCtx.GetScene(scene.UID) != scene || scene.Clone().Name != "museum-2" || scene.Clone().Operator != "other" {
+		t.Fatalf("the scene should be synced in place but %s", scene.Clone().Name)
+	}
+	if IsMasterUsed("master-a") || !IsMasterUsed("master-b") {
+		t.Fatal("the master index should be moved to master-b")
+	}
+	if cacheCtx.GetRoom(room.UID) != room || room.Clone().Name != "room-2" {
+		t.Fatalf("the room should be synced in place but %s", room.Clone().Name)
+	}
+	if info, _ := cacheCtx.GetRegion(region.UID); info != region || region.Clone().Name != "region-2" {
+		t.Fatalf("the region should be synced in place but %s", region.Clone().Name)
+	}
+	//旧指针上的修改继续生效
+	if err = scene.UpdateBase(ctx, "museum-3", "", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if cacheCtx.GetScene(scene.UID).Clone().Name != "museum-3" {
+		t.Fatal("the update on the held scene should be visible")
+	}
+}
+
+func TestRegionsByParent(t *testing.T) {
+	ctx := context.Background()
+	storage := initMemory(t)
+	scene := createScene(t, "museum", "")
+	parent, err := scene.CreateRegion(ctx, &pb.ReqRegionAdd{Scene: scene.UID, Name: "parent", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := scene.CreateRegion(ctx, &pb.ReqRegionAdd{Scene: scene.UID, Name: "child", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = child.UpdateParent(ctx, parent.UID, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if list := cacheCtx.GetRegionsByParent(parent.UID); len(list) != 1 || list[0] != child {
+		t.Fatalf("the children of cached region is error: %d", len(list))
+	}
+	//上级已经删除时从存储中查询下级
+	if err = storage.RemoveRegion(ctx, parent.UID, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err = InitDataBy(storage); err != nil {
+		t.Fatal(err)
+	}
+	list := cacheCtx.GetRegionsByParent(parent.UID)
+	if len(list) != 1 || list[0].UID != child.UID {
+		t.Fatalf("the children of removed region is error: %d", len(list))
+	}
+}
@@ -0,0 +1,541 @@
+package cache
+
+import (
+	"errors"
+	"omo.msa.organization/config"
+	"omo.msa.organization/proxy/nosql"
+	"omo.msa.organization/tool"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+/**
+全文搜索，第一次搜索时从数据库加载场景、小组、房间、区域、展区以及终端，
+按照单字以及相邻两个字建立倒排索引，包含汉字的字段同时索引拼音首字母，
+写操作以及变化通知只标记对象，下次搜索前重新读取标记的对象
+*/
+
+const defaultSearchLimit = 20
+
+// searchTypes 搜索的对象类型
+var searchTypes = map[string]string{
+	"scene":  nosql.TableScene,
+	"group":  nosql.TableGroup,
+	"room":   nosql.TableRoom,
+	"region": nosql.TableRegion,
+	"area":   nosql.TableArea,
+	"device": nosql.TableDevice,
+}
+
+// SearchHit 搜索结果，highlights为匹配的字段，匹配的部分使用<em></em>标记
+type SearchHit struct {
+	Type       string            `json:"type"`
+	UID        string            `json:"uid"`
+	Scene      string            `json:"scene"`
+	Name       string            `json:"name"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+	created    time.Time
+}
+
+type SearchOptions struct {
+	Scene string   //为空时搜索全部场景
+	Types []string //为空时搜索全部类型
+	Limit int
+}
+
+type searchField struct {
+	name   string
+	text   string
+	norm   []rune
+	pinyin []rune //拼音首字母，和norm一一对应，不包含汉字时为空
+	weight float64
+}
+
+type searchDoc struct {
+	kind    string
+	uid     string
+	scene   string
+	name    string
+	created time.Time
+	fields  []*searchField
+}
+
+type searchIndex struct {
+	lock     sync.RWMutex
+	loaded   bool
+	docs     map[string]*searchDoc          //type:uid -> doc
+	postings map[string]map[string]struct{} //token -> type:uid
+	dirty    map[string]string              //type:uid -> type
+}
+
+func newSearchIndex() *searchIndex {
+	tmp := new(searchIndex)
+	tmp.docs = make(map[string]*searchDoc, 500)
+	tmp.postings = make(map[string]map[string]struct{}, 5000)
+	tmp.dirty = make(map[string]string, 10)
+	return tmp
+}
+
+func searchKey(kind, uid string) string {
+	return kind + ":" + uid
+}
+
+// searchKind 表名对应的类型，不搜索的表返回空
+func searchKind(table string) string {
+	for kind, name := range searchTypes {
+		if name == table {
+			return kind
+		}
+	}
+	return ""
+}
+
+func newSearchField(name, text string, weight float64) *searchField {
+	text = strings.TrimSpace(text)
+	if len(text) < 1 {
+		return nil
+	}
+	tmp := &searchField{name: name, text: text, weight: weight}
+	tmp.norm = []rune(strings.ToLower(text))
+	if len(tmp.norm) != len([]rune(text)) {
+		tmp.norm = []rune(text)
+		for i, r := range tmp.norm {
+			tmp.norm[i] = unicode.ToLower(r)
+		}
+	}
+	if tool.HasHan(text) {
+		tmp.pinyin = []rune(tool.PinyinInitials(text))
+	}
+	return tmp
+}
+
+func newSearchDoc(kind, uid, scene, name string, created time.Time, fields ...*searchField) *searchDoc {
+	tmp := &searchDoc{kind: kind, uid: uid, scene: scene, name: name, created: created}
+	tmp.fields = make([]*searchField, 0, len(fields))
+	for _, field := range fields {
+		if field != nil {
+			tmp.fields = append(tmp.fields, field)
+		}
+	}
+	return tmp
+}
+
+func addressText(address nosql.AddressInfo) string {
+	return strings.Join([]string{address.Country, address.Province, address.City, address.Zone}, " ")
+}
+
+//region Document
+func sceneSearchDoc(db *nosql.Scene) *searchDoc {
+	uid := db.UID.Hex()
+	return newSearchDoc("scene", uid, uid, db.Name, db.CreatedTime,
+		newSearchField("name", db.Name, 3),
+		newSearchField("short", db.Short, 3),
+		newSearchField("remark", db.Remark, 1),
+		newSearchField("address", addressText(db.Address), 1))
+}
+
+func groupSearchDoc(db *nosql.Group) *searchDoc {
+	return newSearchDoc("group", db.UID.Hex(), db.Scene, db.Name, db.CreatedTime,
+		newSearchField("name", db.Name, 3),
+		newSearchField("remark", db.Remark, 1),
+		newSearchField("address", addressText(db.Address), 1))
+}
+
+func roomSearchDoc(db *nosql.Room) *searchDoc {
+	return newSearchDoc("room", db.UID.Hex(), db.Scene, db.Name, db.CreatedTime,
+		newSearchField("name", db.Name, 3),
+		newSearchField("remark", db.Remark, 1))
+}
+
+func regionSearchDoc(db *nosql.Region) *searchDoc {
+	return newSearchDoc("region", db.UID.Hex(), db.Scene, db.Name, db.CreatedTime,
+		newSearchField("name", db.Name, 3),
+		newSearchField("remark", db.Remark, 1),
+		newSearchField("address", addressText(db.Address), 1))
+}
+
+// areaSearchDoc sn为绑定的终端
+func areaSearchDoc(db *nosql.Area, sn string) *searchDoc {
+	return newSearchDoc("area", db.UID.Hex(), db.Scene, db.Name, db.CreatedTime,
+		newSearchField("name", db.Name, 3),
+		newSearchField("sn", sn, 3),
+		newSearchField("remark", db.Remark, 1))
+}
+
+func deviceSearchDoc(db *nosql.Invite) *searchDoc {
+	return newSearchDoc("device", db.UID.Hex(), db.Scene, db.Name, db.CreatedTime,
+		newSearchField("name", db.Name, 3),
+		newSearchField("sn", db.SN, 3),
+		newSearchField("remark", db.Remark, 1))
+}
+
+// fetch 从数据库读取对象，不存在或者已经删除时返回nil
+func fetchSearchDoc(kind, uid string) *searchDoc {
+	switch kind {
+	case "scene":
+		if db, err := store.GetScene(uid); err == nil && db.DeleteTime.IsZero() {
+			return sceneSearchDoc(db)
+		}
+	case "group":
+		if db, err := store.GetGroup(uid); err == nil && db.DeleteTime.IsZero() {
+			return groupSearchDoc(db)
+		}
+	case "room":
+		if db, err := store.GetRoom(uid); err == nil && db.DeleteTime.IsZero() {
+			return roomSearchDoc(db)
+		}
+	case "region":
+		if db, err := store.GetRegion(uid); err == nil && db.DeleteTime.IsZero() {
+			return regionSearchDoc(db)
+		}
+	case "area":
+		if db, err := store.GetArea(uid); err == nil && db.DeleteTime.IsZero() {
+			sn := ""
+			if len(db.Device) > 0 {
+				if device, er := store.GetDevice(db.Device); er == nil {
+					sn = device.SN
+				}
+			}
+			return areaSearchDoc(db, sn)
+		}
+	case "device":
+		if db, err := store.GetDevice(uid); err == nil && db.DeleteTime.IsZero() {
+			return deviceSearchDoc(db)
+		}
+	}
+	return nil
+}
+
+//endregion
+
+//region Index
+// load 加载期间持有写锁，和终端注册表相同
+func (mine *searchIndex) load() error {
+	mine.lock.RLock()
+	loaded := mine.loaded
+	mine.lock.RUnlock()
+	if loaded {
+		return nil
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if mine.loaded {
+		return nil
+	}
+	devices, err := store.GetAllDevices()
+	if err != nil {
+		return err
+	}
+	sns := make(map[string]string, len(devices))
+	for _, db := range devices {
+		if db.DeleteTime.IsZero() {
+			sns[db.UID.Hex()] = db.SN
+			mine.putLocked(deviceSearchDoc(db))
+		}
+	}
+	scenes, err := store.GetAllScenes()
+	if err != nil {
+		return err
+	}
+	for _, scene := range scenes {
+		if !scene.DeleteTime.IsZero() {
+			continue
+		}
+		uid := scene.UID.Hex()
+		mine.putLocked(sceneSearchDoc(scene))
+		groups, er := store.GetGroupsByScene(uid)
+		if er != nil {
+			return er
+		}
+		for _, db := range groups {
+			mine.putLocked(groupSearchDoc(db))
+		}
+		rooms, er := store.GetRoomsByScene(uid)
+		if er != nil {
+			return er
+		}
+		for _, db := range rooms {
+			mine.putLocked(roomSearchDoc(db))
+		}
+		regions, er := store.GetRegionsByScene(uid)
+		if er != nil {
+			return er
+		}
+		for _, db := range regions {
+			mine.putLocked(regionSearchDoc(db))
+		}
+		areas, er := store.GetAreasByOwner(uid)
+		if er != nil {
+			return er
+		}
+		for _, db := range areas {
+			mine.putLocked(areaSearchDoc(db, sns[db.Device]))
+		}
+	}
+	mine.dirty = make(map[string]string, 10)
+	mine.loaded = true
+	return nil
+}
+
+// mark 写操作之后标记对象，没有加载时忽略
+func (mine *searchIndex) mark(table, uid string) {
+	kind := searchKind(table)
+	if len(kind) < 1 || len(uid) < 1 {
+		return
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if mine.loaded {
+		mine.dirty[searchKey(kind, uid)] = kind
+	}
+}
+
+// refresh 重新读取标记的对象
+func (mine *searchIndex) refresh() {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	for key, kind := range mine.dirty {
+		mine.dropLocked(key)
+		doc := fetchSearchDoc(kind, strings.TrimPrefix(key, kind+":"))
+		if doc != nil {
+			mine.putLocked(doc)
+		}
+	}
+	mine.dirty = make(map[string]string, 10)
+}
+
+func (mine *searchIndex) putLocked(doc *searchDoc) {
+	key := searchKey(doc.kind, doc.uid)
+	mine.dropLocked(key)
+	mine.docs[key] = doc
+	for _, token := range doc.tokens() {
+		if mine.postings[token] == nil {
+			mine.postings[token] = make(map[string]struct{}, 5)
+		}
+		mine.postings[token][key] = struct{}{}
+	}
+}
+
+func (mine *searchIndex) dropLocked(key string) {
+	doc, ok := mine.docs[key]
+	if !ok {
+		return
+	}
+	for _, token := range doc.tokens() {
+		if arr, ok := mine.postings[token]; ok {
+			delete(arr, key)
+			if len(arr) < 1 {
+				delete(mine.postings, token)
+			}
+		}
+	}
+	delete(mine.docs, key)
+}
+
+// tokens 全部字段的单字以及相邻两个字
+func (mine *searchDoc) tokens() []string {
+	all := make(map[string]struct{}, 20)
+	for _, field := range mine.fields {
+		for _, token := range searchGrams(field.norm, true) {
+			all[token] = struct{}{}
+		}
+		for _, token := range searchGrams(field.pinyin, true) {
+			all[token] = struct{}{}
+		}
+	}
+	list := make([]string, 0, len(all))
+	for token := range all {
+		list = append(list, token)
+	}
+	return list
+}
+
+// searchGrams 查询只需要相邻两个字，只有一个字时使用单字
+func searchGrams(runes []rune, single bool) []string {
+	list := make([]string, 0, len(runes)*2)
+	for i := range runes {
+		if unicode.IsSpace(runes[i]) {
+			continue
+		}
+		if single || len(runes) == 1 {
+			list = append(list, string(runes[i]))
+		}
+		if i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			list = append(list, string(runes[i:i+2]))
+		}
+	}
+	return list
+}
+
+//endregion
+
+//region Search
+// Search 关键字匹配名称、简称、SN、备注以及地址，拼音首字母可以匹配汉字，
+// 完全相同的排在最前，然后是前缀匹配，名称的权重高于备注以及地址
+func Search(keyword string, opts SearchOptions) ([]*SearchHit, error) {
+	query := []rune(strings.ToLower(strings.TrimSpace(keyword)))
+	if len(query) < 1 {
+		return nil, errors.New("the keyword is empty")
+	}
+	kinds := make(map[string]bool, len(opts.Types))
+	for _, kind := range opts.Types {
+		if _, ok := searchTypes[kind]; !ok {
+			return nil, errors.New("the search type not defined of " + kind)
+		}
+		kinds[kind] = true
+	}
+	index := cacheCtx.searches()
+	err := index.load()
+	if err != nil {
+		return nil, err
+	}
+	index.refresh()
+
+	index.lock.RLock()
+	list := make([]*SearchHit, 0, 20)
+	for _, key := range index.candidates(query) {
+		doc := index.docs[key]
+		if len(kinds) > 0 && !kinds[doc.kind] {
+			continue
+		}
+		if len(opts.Scene) > 0 && doc.scene != opts.Scene {
+			continue
+		}
+		if hit := doc.match(query); hit != nil {
+			list = append(list, hit)
+		}
+	}
+	index.lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		if len(list[i].Name) != len(list[j].Name) {
+			return len(list[i].Name) < len(list[j].Name)
+		}
+		if !list[i].created.Equal(list[j].created) {
+			return list[i].created.Before(list[j].created)
+		}
+		return list[i].UID < list[j].UID
+	})
+	limit := opts.Limit
+	if limit < 1 {
+		limit = defaultSearchLimit
+	}
+	if max := config.Schema.Database.Page; max > 0 && limit > max {
+		limit = max
+	}
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// candidates 包含全部查询词的对象，还需要检查是否连续
+func (mine *searchIndex) candidates(query []rune) []string {
+	var result map[string]struct{}
+	for _, token := range searchGrams(query, false) {
+		arr := mine.postings[token]
+		if len(arr) < 1 {
+			return nil
+		}
+		if result == nil || len(arr) < len(result) {
+			next := make(map[string]struct{}, len(arr))
+			for key := range arr {
+				if result == nil {
+					next[key] = struct{}{}
+				} else if _, ok := result[key]; ok {
+					next[key] = struct{}{}
+				}
+			}
+			result = next
+		} else {
+			for key := range result {
+				if _, ok := arr[key]; !ok {
+					delete(result, key)
+				}
+			}
+		}
+	}
+	list := make([]string, 0, len(result))
+	for key := range result {
+		list = append(list, key)
+	}
+	return list
+}
+
+// match 每个字段取原文以及拼音中得分高的匹配，对象的得分为最高的字段加上其他字段的一小部分
+func (mine *searchDoc) match(query []rune) *SearchHit {
+	var best float64
+	var other float64
+	highlights := make(map[string]string, 2)
+	for _, field := range mine.fields {
+		score, positions := matchRunes(field.norm, query)
+		if pyScore, pyPositions := matchRunes(field.pinyin, query); pyScore*0.8 > score {
+			score, positions = pyScore*0.8, pyPositions
+		}
+		if score <= 0 {
+			continue
+		}
+		score = score * field.weight
+		if score > best {
+			other += best
+			best = score
+		} else {
+			other += score
+		}
+		highlights[field.name] = highlightRunes([]rune(field.text), positions, len(query))
+	}
+	if best <= 0 {
+		return nil
+	}
+	return &SearchHit{Type: mine.kind, UID: mine.uid, Scene: mine.scene, Name: mine.name,
+		Score: best + other*0.1, Highlights: highlights, created: mine.created}
+}
+
+// matchRunes 完全相同4分，前缀2分，包含1分，返回不重叠的匹配位置
+func matchRunes(text, query []rune) (float64, []int) {
+	if len(text) < len(query) || len(query) < 1 {
+		return 0, nil
+	}
+	positions := make([]int, 0, 1)
+	for i := 0; i+len(query) <= len(text); {
+		if string(text[i:i+len(query)]) == string(query) {
+			positions = append(positions, i)
+			i += len(query)
+		} else {
+			i += 1
+		}
+	}
+	if len(positions) < 1 {
+		return 0, nil
+	}
+	if len(text) == len(query) {
+		return 4, positions
+	}
+	if positions[0] == 0 {
+		return 2, positions
+	}
+	return 1, positions
+}
+
+func highlightRunes(text []rune, positions []int, length int) string {
+	var builder strings.Builder
+	last := 0
+	for _, pos := range positions {
+		builder.WriteString(string(text[last:pos]))
+		builder.WriteString("<em>")
+		builder.WriteString(string(text[pos : pos+length]))
+		builder.WriteString("</em>")
+		last = pos + length
+	}
+	builder.WriteString(string(text[last:]))
+	return builder.String()
+}
+
+//endregion
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
+)
+
+// searchUIDs 搜索结果的uid，按照得分排序
+func searchUIDs(t *testing.T, keyword string, opts SearchOptions) []string {
+	t.Helper()
+	list, err := Search(keyword, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr := make([]string, 0, len(list))
+	for _, hit := range list {
+		arr = append(arr, hit.UID)
+	}
+	return arr
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	initMemory(t)
+	scene := createScene(t, "北京博物馆", "")
+	hall, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "博物馆大厅", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "library", Remark: "博物馆", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//得分为匹配程度乘以字段的权重：名称前缀6分，备注完全相同4分，名称包含3分
+	list, err := Search("博物馆", SearchOptions{})
+	if err != nil || len(list) != 3 {
+		t.Fatalf("the search result is error: %v, %d", err, len(list))
+	}
+	if list[0].UID != hall.UID || list[1].UID != room.UID || list[2].UID != scene.UID {
+		t.Fatalf("the search order is error: %s, %s, %s", list[0].Name, list[1].Name, list[2].Name)
+	}
+	if list[0].Highlights["name"] != "<em>博物馆</em>大厅" || list[1].Highlights["remark"] != "<em>博物馆</em>" {
+		t.Fatalf("the highlights is error: %v, %v", list[0].Highlights, list[1].Highlights)
+	}
+	//拼音首字母匹配汉字
+	if arr := searchUIDs(t, "BJBWG", SearchOptions{}); len(arr) != 1 || arr[0] != scene.UID {
+		t.Fatalf("the pinyin search is error: %v", arr)
+	}
+	if arr := searchUIDs(t, "博物馆", SearchOptions{Types: []string{"room"}, Limit: 1}); len(arr) != 1 || arr[0] != hall.UID {
+		t.Fatalf("the search by type is error: %v", arr)
+	}
+	if _, err = Search("博物馆", SearchOptions{Types: []string{"user"}}); err == nil {
+		t.Fatal("the undefined type should be rejected")
+	}
+	if _, err = Search(" ", SearchOptions{}); err == nil {
+		t.Fatal("the empty keyword should be rejected")
+	}
+	//改名以及删除后旧的名称不再命中
+	if err = hall.UpdateBase(ctx, "展厅", "", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err = scene.RemoveRoom(ctx, room.UID, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if arr := searchUIDs(t, "博物馆", SearchOptions{}); len(arr) != 1 || arr[0] != scene.UID {
+		t.Fatalf("the renamed and removed room should not be found: %v", arr)
+	}
+	if arr := searchUIDs(t, "zt", SearchOptions{Scene: scene.UID}); len(arr) != 1 || arr[0] != hall.UID {
+		t.Fatalf("the new name should be found: %v", arr)
+	}
+	if arr := searchUIDs(t, "bwg", SearchOptions{}); len(arr) != 1 {
+		t.Fatalf("the old pinyin should not be found: %v", arr)
+	}
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"omo.msa.organization/config"
+	"omo.msa.organization/proxy/nosql"
+)
+
+func snapshotRoot() string {
+	if len(config.Schema.Database.Backup) > 0 {
+		return config.Schema.Database.Backup
+	}
+	return "db/"
+}
+
+// snapshotStore mongo以及内存存储支持快照
+func snapshotStore() (nosql.SnapshotStore, error) {
+	tmp := store
+	if audit, ok := tmp.(*auditStore); ok {
+		tmp = audit.Storage
+	}
+	if source, ok := tmp.(nosql.SnapshotStore); ok {
+		return source, nil
+	}
+	return nil, errors.New("the snapshot not supported by the storage")
+}
+
+// BackupStorage 备份所有的表到快照目录
+func BackupStorage() (*nosql.SnapshotManifest, error) {
+	source, err := snapshotStore()
+	if err != nil {
+		return nil, err
+	}
+	return nosql.BackupDatabase(source, snapshotRoot())
+}
+
+// RecoveryStorage 恢复快照，tables为空时恢复全部，完成后重新加载缓存
+func RecoveryStorage(name string, tables []string) (*nosql.SnapshotManifest, error) {
+	target, err := snapshotStore()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := nosql.RecoveryDatabase(target, snapshotRoot(), name, tables)
+	if err != nil {
+		return nil, err
+	}
+	dropCacheSnapshot()
+	return manifest, InitDataBy(store)
+}
+
+// ImportStorage 批量导入数据，有成功的数据时重新加载缓存
+func ImportStorage(ctx context.Context, table, operator string, reader io.Reader) (*nosql.ImportReport, error) {
+	report, err := nosql.ImportDatabase(ctx, store, table, operator, reader)
+	if err != nil {
+		return nil, err
+	}
+	if report.Success > 0 {
+		dropCacheSnapshot()
+		err = InitDataBy(store)
+	}
+	return report, err
+}
+
+// IndexStorage 返回索引和声明的差异，apply为true时进行同步
+func IndexStorage(apply bool) (*nosql.IndexReport, error) {
+	if !isMongoStore() {
+		return nil, errors.New("the index only supported by mongodb")
+	}
+	return nosql.CheckIndexes(apply)
+}
+
+// MigrateStorage 迁移到指定的版本，target小于0时为最新版本，实际执行后重新加载缓存
+func MigrateStorage(target int, dry bool) ([]*nosql.MigrationResult, error) {
+	if !isMongoStore() {
+		return nil, errors.New("the migration only supported by mongodb")
+	}
+	list, err := nosql.Migrate(target, dry)
+	if err != nil {
+		return list, err
+	}
+	if !dry && len(list) > 0 {
+		dropCacheSnapshot()
+		err = InitDataBy(store)
+	}
+	return list, err
+}
@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/config"
+	"omo.msa.organization/proxy/nosql"
+)
+
+func TestImportResetVersion(t *testing.T) {
+	ctx := context.Background()
+	storage := initMemory(t)
+	data := `[{"name":"museum","version":9},{"name":"school","version":3}]`
+	report, err := ImportStorage(ctx, nosql.TableScene, "tester", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Success != 2 || len(report.Errors) > 0 {
+		t.Fatalf("the import report is error: %+v", report)
+	}
+	for _, uid := range report.List {
+		num, err := storage.GetVersion(nosql.TableScene, uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if num != 0 {
+			t.Fatalf("the version of %s should be reset but %d", uid, num)
+		}
+	}
+}
+
+// snapshotDocs 每个文档的bson编码，用于比较恢复前后的数据
+func snapshotDocs(t *testing.T, storage nosql.Storage) []string {
+	t.Helper()
+	scenes, err := storage.GetAllScenes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := make([]string, 0, len(scenes)*2)
+	for _, scene := range scenes {
+		rooms, er := storage.GetRoomsByScene(scene.UID.Hex())
+		if er != nil {
+			t.Fatal(er)
+		}
+		for _, item := range append([]interface{}{scene}, toInterfaces(rooms)...) {
+			bytes, er := bson.Marshal(item)
+			if er != nil {
+				t.Fatal(er)
+			}
+			list = append(list, string(bytes))
+		}
+	}
+	return list
+}
+
+func toInterfaces[T any](list []*T) []interface{} {
+	arr := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		arr = append(arr, item)
+	}
+	return arr
+}
+
+func useBackupRoot(t *testing.T) string {
+	root := t.TempDir()
+	backup := config.Schema.Database.Backup
+	config.Schema.Database.Backup = root
+	t.Cleanup(func() {
+		config.Schema.Database.Backup = backup
+	})
+	return root
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	useBackupRoot(t)
+	storage := initMemory(t)
+	scene := createScene(t, "museum", "")
+	if _, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "hall", Operator: "tester"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := scene.UpdateBase(ctx, "museum-2", "remark", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	before := snapshotDocs(t, storage)
+	count, _ := storage.GetSequenceCount(nosql.TableScene)
+	manifest, err := BackupStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = scene.UpdateBase(ctx, "changed", "", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	other := createScene(t, "gallery", "")
+	if _, err = RecoveryStorage(manifest.Name, nil); err != nil {
+		t.Fatal(err)
+	}
+	after := snapshotDocs(t, storage)
+	if !reflect.DeepEqual(before, after) {
+		t.Fatal("the documents should be same as the snapshot")
+	}
+	if num, _ := storage.GetSequenceCount(nosql.TableScene); num != count {
+		t.Fatalf("the sequence should be %d but %d", count, num)
+	}
+	if info := cacheCtx.GetScene(scene.UID); info == nil || info.Name != "museum-2" || cacheCtx.GetScene(other.UID) != nil {
+		t.Fatal("the cache should be reloaded from the snapshot")
+	}
+}
+
+func TestSnapshotRecoveryFailed(t *testing.T) {
+	ctx := context.Background()
+	root := useBackupRoot(t)
+	storage := initMemory(t)
+	scene := createScene(t, "museum", "")
+	room, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "hall", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := BackupStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = scene.UpdateBase(ctx, "changed", "", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	//房间的文件校验通过但是不能解码，场景在房间之前恢复，也不能被替换
+	line := `{"_id":{"$oid":"` + room.UID + `"},"version":"bad"}` + "\n"
+	path := filepath.Join(root, manifest.Name)
+	if err = os.WriteFile(filepath.Join(path, nosql.TableRoom+".ndjson"), []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(line))
+	for i := range manifest.Tables {
+		if manifest.Tables[i].Name == nosql.TableRoom {
+			manifest.Tables[i].Checksum = hex.EncodeToString(sum[:])
+			manifest.Tables[i].Count = 1
+		}
+	}
+	data, _ := json.Marshal(manifest)
+	if err = os.WriteFile(filepath.Join(path, nosql.SnapshotManifestFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = RecoveryStorage(manifest.Name, nil); err == nil {
+		t.Fatal("the recovery should fail")
+	}
+	db, err := storage.GetScene(scene.UID)
+	if err != nil || db.Name != "changed" {
+		t.Fatal("the scenes should not be replaced by the failed recovery")
+	}
+	if _, err = storage.GetRoom(room.UID); err != nil {
+		t.Fatal("the rooms should not be replaced by the failed recovery")
+	}
+}
+
+func TestImportAreaDevice(t *testing.T) {
+	ctx := context.Background()
+	storage := initMemory(t)
+	scene := createScene(t, "museum", "")
+	room, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "hall", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound := &nosql.Invite{UID: primitive.NewObjectID(), SN: "sn-1", Scene: scene.UID}
+	free := &nosql.Invite{UID: primitive.NewObjectID(), SN: "sn-2", Scene: scene.UID}
+	for _, item := range []*nosql.Invite{bound, free} {
+		if err = storage.CreateDevice(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	area := &nosql.Area{UID: primitive.NewObjectID(), Name: "first", Scene: scene.UID, Parent: room.UID, Device: bound.UID.Hex()}
+	if err = storage.CreateArea(ctx, area); err != nil {
+		t.Fatal(err)
+	}
+	row := `{"name":"%s","scene":"` + scene.UID + `","parent":"` + room.UID + `","device":"%s"}`
+	data := "[" + fmt.Sprintf(row, "second", bound.UID.Hex()) + "," + fmt.Sprintf(row, "third", free.UID.Hex()) + "," +
+		fmt.Sprintf(row, "fourth", free.UID.Hex()) + "]"
+	report, err := ImportStorage(ctx, nosql.TableArea, "tester", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Success != 1 || len(report.Errors) != 2 || report.Errors[0].Row != 0 || report.Errors[1].Row != 2 {
+		t.Fatalf("the rows binding the bound device should be rejected: %+v", report)
+	}
+	db, err := storage.GetAreaByDevice(free.UID.Hex())
+	if err != nil || db.Name != "third" {
+		t.Fatalf("the free device should be bound to the third area but %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+package cache
+
+import (
+	"errors"
+	"omo.msa.organization/proxy/nosql"
+)
+
+/**
+乐观锁，客户端提交读取时的版本，版本作为写入的条件，一致时才允许修改
+*/
+
+// GetVersion 对象当前的版本
+func GetVersion(table, uid string) (uint32, error) {
+	if len(uid) < 1 {
+		return 0, errors.New("the uid is empty")
+	}
+	if !nosql.IsVersionTable(table) {
+		return 0, errors.New("the table not support version of " + table)
+	}
+	return store.GetVersion(table, uid)
+}
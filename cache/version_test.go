@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
+	"omo.msa.organization/proxy/nosql"
+)
+
+func TestVersionExpect(t *testing.T) {
+	storage := initMemory(t)
+	scene := createScene(t, "museum", "")
+	current, err := storage.GetVersion(nosql.TableScene, scene.UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, exp := nosql.WithExpect(context.Background(), nosql.TableScene, scene.UID, current)
+	if err = scene.UpdateBase(ctx, "museum-2", "", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err = scene.UpdateCover(ctx, "cover", "tester"); err != nil {
+		t.Fatalf("the second write of the same request should pass: %s", err.Error())
+	}
+	if exp.Version() != current+2 {
+		t.Fatalf("the expect version should be %d but %d", current+2, exp.Version())
+	}
+	stale, _ := nosql.WithExpect(context.Background(), nosql.TableScene, scene.UID, current)
+	err = scene.UpdateBase(stale, "museum-3", "", "tester")
+	if _, ok := err.(*nosql.VersionConflict); !ok {
+		t.Fatalf("the stale version should conflict but %v", err)
+	}
+	if scene.Name != "museum-2" {
+		t.Fatalf("the cache should not change by the conflict but %s", scene.Name)
+	}
+	num, _ := storage.GetVersion(nosql.TableScene, scene.UID)
+	if num != current+2 {
+		t.Fatalf("the conflict should not bump the version but %d", num)
+	}
+}
+
+func TestRoomQuotesElements(t *testing.T) {
+	ctx := context.Background()
+	storage := initMemory(t)
+	scene := createScene(t, "museum", "")
+	first, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "first", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := scene.CreateRoom(ctx, &pb.ReqRoomAdd{Owner: scene.UID, Name: "second", Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = scene.UpdateRoomQuotes(ctx, first, "tester", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	//另外一个请求在数据库中追加的引用不会被覆盖
+	if err = storage.AppendRoomQuotes(ctx, first.UID, "other", []string{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = scene.UpdateRoomQuotes(ctx, second, "tester", []string{"b", "d"}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := storage.GetRoom(first.UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Quotes) != 2 || db.Quotes[0] != "a" || db.Quotes[1] != "c" {
+		t.Fatalf("the quotes of first room is error: %v", db.Quotes)
+	}
+	db, err = storage.GetRoom(second.UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Quotes) != 2 || db.Quotes[0] != "b" || db.Quotes[1] != "d" {
+		t.Fatalf("the quotes of second room is error: %v", db.Quotes)
+	}
+}
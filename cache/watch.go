@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"github.com/micro/go-micro/v2/logger"
+	"omo.msa.organization/config"
+	"omo.msa.organization/proxy/nosql"
+	"os"
+)
+
+/**
+多个实例之间的缓存同步，收到变化后重新读取文档，
+只处理缓存中的场景、小组、房间、区域树以及终端注册表，展区只需要移除设备索引
+*/
+
+// WatchChanges 只支持mongo，实例名称优先使用配置，其次是MSA_INSTANCE，都为空时使用主机名，
+// 容器的主机名每次启动都不同，多实例部署时建议配置固定的名称
+func WatchChanges() {
+	if !isMongoStore() {
+		return
+	}
+	instance := watchInstance()
+	if len(instance) < 1 {
+		logger.Warn("the watch instance is empty")
+		return
+	}
+	tables := []string{nosql.TableScene, nosql.TableGroup, nosql.TableRoom, nosql.TableRegion, nosql.TableArea, nosql.TableDevice}
+	nosql.WatchTables(instance, tables, cacheCtx.applyChange, nil)
+	logger.Infof("watch the changes of %v by instance %s", tables, instance)
+}
+
+func watchInstance() string {
+	if len(config.Schema.Database.Instance) > 0 {
+		return config.Schema.Database.Instance
+	}
+	if instance := os.Getenv("MSA_INSTANCE"); len(instance) > 0 {
+		return instance
+	}
+	instance, _ := os.Hostname()
+	return instance
+}
+
+func (mine *cacheContext) applyChange(event *nosql.ChangeEvent) {
+	if event.Operation == nosql.ChangeReload {
+		logger.Warnf("the resume of %s is lost and reload the cache", event.Table)
+		mine.reloadTable(event.Table)
+		return
+	}
+	mine.searches().mark(event.Table, event.UID)
+	switch event.Table {
+	case nosql.TableScene:
+		mine.syncScene(event.UID)
+	case nosql.TableGroup:
+		db, err := store.GetGroup(event.UID)
+		if err != nil {
+			for _, scene := range mine.allScenes() {
+				scene.dropGroup(event.UID)
+			}
+		} else if scene := mine.lookupScene(db.Scene); scene != nil {
+			scene.syncGroup(db)
+		}
+	case nosql.TableRoom:
+		db, err := store.GetRoom(event.UID)
+		if err != nil {
+			if room := mine.lookupRoom(event.UID); room != nil {
+				if scene := mine.lookupScene(room.Scene); scene != nil {
+					scene.dropRoom(event.UID)
+				}
+			}
+			mine.unindexRoom(event.UID)
+		} else if scene := mine.lookupScene(db.Scene); scene != nil {
+			scene.syncRoom(db)
+		}
+	case nosql.TableRegion:
+		db, err := store.GetRegion(event.UID)
+		if err != nil {
+			if region := mine.lookupRegion(event.UID); region != nil {
+				if scene := mine.lookupScene(region.Scene); scene != nil {
+					scene.dropRegion(event.UID)
+				}
+			}
+			mine.unindexRegion(event.UID)
+		} else if scene := mine.lookupScene(db.Scene); scene != nil {
+			if old := mine.lookupRegion(event.UID); old != nil && old.Scene != db.Scene {
+				if from := mine.lookupScene(old.Scene); from != nil {
+					from.dropRegion(event.UID)
+				}
+			}
+			scene.syncRegion(db)
+		}
+	case nosql.TableArea:
+		mine.unindexArea(event.UID)
+	case nosql.TableDevice:
+		mine.syncDevice(event.UID)
+	}
+}
+
+// syncScene 替换为新的对象，已经加载的小组以及房间继续使用
+func (mine *cacheContext) syncScene(uid string) {
+	old := mine.lookupScene(uid)
+	db, err := store.GetScene(uid)
+	if err != nil || !db.DeleteTime.IsZero() {
+		if old != nil {
+			mine.removeScene(old)
+		}
+		return
+	}
+	if old == nil {
+		info := new(SceneInfo)
+		info.initInfo(db)
+		mine.addScene(info)
+		return
+	}
+	//持有旧指针的调用者继续使用同一个对象以及锁
+	old.syncInfo(db)
+}
+
+// reloadTable 丢失的变化无法补齐，重新加载
+func (mine *cacheContext) reloadTable(table string) {
+	mine.lock.Lock()
+	mine.search = newSearchIndex()
+	mine.lock.Unlock()
+	switch table {
+	case nosql.TableScene:
+		_ = InitDataBy(store)
+	case nosql.TableGroup:
+		for _, scene := range mine.allScenes() {
+			scene.lock.Lock()
+			scene.groups = nil
+			scene.lock.Unlock()
+		}
+	case nosql.TableRoom:
+		for _, scene := range mine.allScenes() {
+			scene.lock.Lock()
+			for _, room := range scene.rooms {
+				mine.unindexRoom(room.UID)
+			}
+			scene.rooms = nil
+			scene.lock.Unlock()
+		}
+	case nosql.TableRegion:
+		for _, scene := range mine.allScenes() {
+			scene.lock.Lock()
+			for _, region := range scene.regions {
+				mine.unindexRegion(region.UID)
+			}
+			scene.regions = nil
+			scene.lock.Unlock()
+		}
+	case nosql.TableArea:
+		mine.lock.Lock()
+		mine.devices = make(map[string]*areaIndex, 100)
+		mine.areas = make(map[string]string, 100)
+		mine.lock.Unlock()
+	case nosql.TableDevice:
+		mine.lock.Lock()
+		mine.registry = newDeviceRegistry()
+		mine.lock.Unlock()
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"omo.msa.organization/cache"
+	"omo.msa.organization/config"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/**
+维护命令，在启动服务之前执行，执行完成后退出
+	backup                      备份数据库
+	recovery <name> [tables]    恢复快照，tables以逗号分隔
+	import <table> <file> [operator]  批量导入json数组文件
+	purge [days]                清理回收站中超过保留天数的对象
+	indexes [apply]             输出索引差异，apply时同步索引
+	migrate [version] [dry]     迁移到指定版本，默认最新，小于当前版本时回滚
+	restore <table> <uid> [operator]  恢复回收站中的对象
+	revert <revision> [operator]      恢复对象到历史版本
+*/
+
+func runCommand(args []string) (bool, error) {
+	if len(args) < 1 {
+		return false, nil
+	}
+	ctx := cache.WithPath(context.Background(), "cli."+args[0])
+	switch args[0] {
+	case "backup":
+		manifest, err := cache.BackupStorage()
+		if err != nil {
+			return true, err
+		}
+		for _, table := range manifest.Tables {
+			fmt.Printf("%s\t%d\t%s\n", table.Name, table.Count, table.Checksum)
+		}
+		fmt.Println("backup the snapshot success: " + manifest.Name)
+		return true, nil
+	case "recovery":
+		if len(args) < 2 {
+			return true, fmt.Errorf("usage: recovery <name> [tables]")
+		}
+		var tables []string
+		if len(args) > 2 && len(args[2]) > 0 {
+			tables = strings.Split(args[2], ",")
+		}
+		manifest, err := cache.RecoveryStorage(args[1], tables)
+		if err != nil {
+			return true, err
+		}
+		fmt.Println("recovery the snapshot success: " + manifest.Name)
+		return true, nil
+	case "import":
+		if len(args) < 3 {
+			return true, fmt.Errorf("usage: import <table> <file> [operator]")
+		}
+		f, err := os.Open(args[2])
+		if err != nil {
+			return true, err
+		}
+		defer f.Close()
+		operator := ""
+		if len(args) > 3 {
+			operator = args[3]
+		}
+		report, err := cache.ImportStorage(ctx, args[1], operator, f)
+		if err != nil {
+			return true, err
+		}
+		bytes, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(bytes))
+		return true, nil
+	case "indexes":
+		report, err := cache.IndexStorage(len(args) > 1 && args[1] == "apply")
+		if err != nil {
+			return true, err
+		}
+		for _, drift := range report.Drifts {
+			fmt.Printf("%s\t%s\t%s\t%s\n", drift.Table, drift.Name, drift.State, drift.Error)
+		}
+		fmt.Printf("the index version: %d, applied: %d\n", report.Version, report.Applied)
+		return true, nil
+	case "migrate":
+		target := -1
+		dry := false
+		for _, arg := range args[1:] {
+			if arg == "dry" {
+				dry = true
+				continue
+			}
+			num, err := strconv.Atoi(arg)
+			if err != nil {
+				return true, err
+			}
+			target = num
+		}
+		list, err := cache.MigrateStorage(target, dry)
+		for _, item := range list {
+			fmt.Printf("%d\t%s\t%s\t%d\n", item.Version, item.Name, item.Direction, item.Affected)
+		}
+		if err != nil {
+			return true, err
+		}
+		fmt.Printf("migrate success: %d\n", len(list))
+		return true, nil
+	case "restore":
+		if len(args) < 3 {
+			return true, fmt.Errorf("usage: restore <table> <uid> [operator]")
+		}
+		operator := ""
+		if len(args) > 3 {
+			operator = args[3]
+		}
+		err := cache.Context().Restore(ctx, args[1], args[2], operator)
+		if err != nil {
+			return true, err
+		}
+		fmt.Println("restore success: " + args[2])
+		return true, nil
+	case "revert":
+		if len(args) < 2 {
+			return true, fmt.Errorf("usage: revert <revision> [operator]")
+		}
+		operator := ""
+		if len(args) > 2 {
+			operator = args[2]
+		}
+		err := cache.Context().RevertRevision(ctx, args[1], operator)
+		if err != nil {
+			return true, err
+		}
+		fmt.Println("revert success: " + args[1])
+		return true, nil
+	case "purge":
+		days := config.Schema.Database.Retention
+		if len(args) > 1 {
+			num, err := strconv.Atoi(args[1])
+			if err != nil {
+				return true, err
+			}
+			days = num
+		}
+		list, err := cache.PurgeRecycles(ctx, days)
+		if err != nil {
+			return true, err
+		}
+		for _, item := range list {
+			fmt.Printf("%s\t%s\t%s\n", item.Table, item.UID, item.Name)
+		}
+		fmt.Printf("purge the recycles success: %d\n", len(list))
+		return true, nil
+	}
+	return false, nil
+}
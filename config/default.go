@@ -4,7 +4,9 @@ const defaultJson string = `{
 	"service": {
 		"address": ":7174",
 		"ttl": 15,
-		"interval": 10
+		"interval": 10,
+		"token": "",
+		"strict": false
 	},
 	"logger": {
 		"level": "info",
@@ -17,7 +19,34 @@ const defaultJson string = `{
 		"port": "27017",
 		"user": "root",
 		"password": "pass2019",
-		"type": "mongodb"
+		"uri": "",
+		"replica": "",
+		"authSource": "",
+		"tls": {
+			"enable": false,
+			"ca": "",
+			"cert": "",
+			"key": "",
+			"insecure": false
+		},
+		"pool": {
+			"max": 200,
+			"min": 0,
+			"idle": 5,
+			"threshold": 3000,
+			"timeout": 10
+		},
+		"type": "mongodb",
+		"backup": "db/",
+		"retention": 30,
+		"ping": 5,
+		"retry": 0,
+		"cache": "db/cache.snap",
+		"interval": 600,
+		"instance": "",
+		"ttl": 600,
+		"capacity": 0,
+		"page": 100
 	}
 }
 `
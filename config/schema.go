@@ -4,6 +4,8 @@ type ServiceConfig struct {
 	TTL      int64  `json:"ttl"`
 	Interval int64  `json:"interval"`
 	Address  string `json:"address"`
+	Token    string `json:"token"` //管理命令的令牌，为空时修改数据的管理命令只能使用命令行
+	Strict   bool   `json:"strict"` //为true时修改已有对象的请求必须带有Version
 }
 
 type LoggerConfig struct {
@@ -12,13 +14,44 @@ type LoggerConfig struct {
 	Std bool `json:"std"`
 }
 
+type DBTLSConfig struct {
+	Enable   bool   `json:"enable"`
+	CA       string `json:"ca"`       //CA证书文件，为空时使用系统证书
+	Cert     string `json:"cert"`     //客户端证书文件
+	Key      string `json:"key"`      //客户端私钥文件
+	Insecure bool   `json:"insecure"` //不校验服务端证书
+}
+
+type DBPoolConfig struct {
+	Max       uint64 `json:"max"`       //最大连接数
+	Min       uint64 `json:"min"`       //最小连接数
+	Idle      int    `json:"idle"`      //连接空闲的最大秒数
+	Threshold int    `json:"threshold"` //延迟窗口的毫秒数
+	Timeout   int    `json:"timeout"`   //连接超时的秒数
+}
+
 type DBConfig struct {
 	Type     string	`json:"type"`
 	User     string	`json:"user"`
-	Password string	`json:"password"`
-	IP      string	`json:"ip"`
+	Password string	`json:"password"` //建议使用环境变量MSA_DB_PASSWORD或者MSA_DB_PASSWORD_FILE
+	IP      string	`json:"ip"` //多个地址使用逗号分隔
 	Port     string	`json:"port"`
 	Name     string	`json:"name"`
+	URI      string	`json:"uri"` //完整的mongo连接地址，设置后忽略ip以及port
+	Replica  string	`json:"replica"` //副本集名称
+	AuthSource string	`json:"authSource"` //认证数据库
+	TLS      DBTLSConfig	`json:"tls"`
+	Pool     DBPoolConfig	`json:"pool"`
+	Backup   string	`json:"backup"` //快照保存的目录
+	Retention int	`json:"retention"` //回收站保留的天数，0表示不清理
+	Ping     int	`json:"ping"` //检查数据库连接的间隔秒数
+	Retry    int	`json:"retry"` //启动时连接数据库的重试次数，0表示一直重试
+	Cache    string	`json:"cache"` //缓存快照文件，为空时每次启动完整加载
+	Interval int	`json:"interval"` //写缓存快照的间隔秒数
+	Instance string	`json:"instance"` //缓存同步的实例名称，用于保存恢复位置，多个实例不能相同，为空时使用MSA_INSTANCE或者主机名
+	TTL      int	`json:"ttl"` //场景子集合的有效秒数，0表示一直有效
+	Capacity int	`json:"capacity"` //加载了子集合的场景数量上限，只释放子集合，场景一直保留，0表示不限制
+	Page     int	`json:"page"` //列表每页的最大数量，0表示不限制
 }
 
 type SchemaConfig struct {
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+/**
+数据库的账号、密码、连接地址以及管理命令的令牌优先从环境变量读取，
+NAME_FILE指定保存的文件，例如docker secret；配置中的值也可以写成env:NAME或者file:/path
+*/
+
+const (
+	EnvDBUser     = "MSA_DB_USER"
+	EnvDBPassword = "MSA_DB_PASSWORD"
+	EnvDBURI      = "MSA_DB_URI"
+	EnvAdminToken = "MSA_ADMIN_TOKEN"
+
+	secretMask = "xxxxxx"
+)
+
+func loadSecrets(conf *DBConfig) error {
+	var err error
+	conf.User, err = secretValue(EnvDBUser, conf.User)
+	if err != nil {
+		return err
+	}
+	conf.Password, err = secretValue(EnvDBPassword, conf.Password)
+	if err != nil {
+		return err
+	}
+	conf.URI, err = secretValue(EnvDBURI, conf.URI)
+	return err
+}
+
+// secretValue 环境变量 > 环境变量指定的文件 > 配置中的引用 > 配置中的值
+func secretValue(env, value string) (string, error) {
+	if tmp := os.Getenv(env); len(tmp) > 0 {
+		return tmp, nil
+	}
+	if path := os.Getenv(env + "_FILE"); len(path) > 0 {
+		return readSecret(path)
+	}
+	if strings.HasPrefix(value, "env:") {
+		name := strings.TrimPrefix(value, "env:")
+		tmp := os.Getenv(name)
+		if len(tmp) < 1 {
+			return "", errors.New("the secret env is empty of " + name)
+		}
+		return tmp, nil
+	}
+	if strings.HasPrefix(value, "file:") {
+		return readSecret(strings.TrimPrefix(value, "file:"))
+	}
+	return value, nil
+}
+
+func readSecret(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// maskSecrets 输出日志时隐藏密码以及连接地址中的密码
+func maskSecrets(conf DBConfig) DBConfig {
+	if len(conf.Password) > 0 {
+		conf.Password = secretMask
+	}
+	if len(conf.URI) > 0 {
+		uri, err := url.Parse(conf.URI)
+		if err != nil {
+			conf.URI = secretMask
+		} else if uri.User != nil {
+			if _, ok := uri.User.Password(); ok {
+				uri.User = url.UserPassword(uri.User.Username(), secretMask)
+			}
+			conf.URI = uri.String()
+		}
+	}
+	return conf
+}
@@ -190,7 +190,20 @@ func Setup() {
 	// initialize logger
 	initLogger(mode)
 
-	ycd, err := json.Marshal(&Schema)
+	err = loadSecrets(&Schema.Database)
+	if err != nil {
+		panic(err)
+	}
+	Schema.Service.Token, err = secretValue(EnvAdminToken, Schema.Service.Token)
+	if err != nil {
+		panic(err)
+	}
+	masked := Schema
+	masked.Database = maskSecrets(Schema.Database)
+	if len(masked.Service.Token) > 0 {
+		masked.Service.Token = secretMask
+	}
+	ycd, err := json.Marshal(&masked)
 	if nil != err {
 		logger.Error(err)
 	} else {
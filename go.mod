@@ -5,7 +5,9 @@ go 1.18
 replace google.golang.org/grpc => github.com/grpc/grpc-go v1.26.0
 
 require (
+	github.com/go-sql-driver/mysql v1.6.0
 	github.com/labstack/gommon v0.3.0
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/micro/go-micro/v2 v2.9.1
 	github.com/micro/go-plugins/config/source/consul/v2 v2.9.1
 	github.com/micro/go-plugins/logger/logrus/v2 v2.9.1
@@ -17,6 +19,8 @@ require (
 	github.com/xtech-cloud/omo-msp-organization v1.9.3
 	github.com/xtech-cloud/omo-msp-status v1.0.1
 	go.mongodb.org/mongo-driver v1.4.6
+	golang.org/x/text v0.3.3
+	google.golang.org/grpc v1.27.0
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 )
 
@@ -87,10 +91,8 @@ require (
 	golang.org/x/net v0.0.0-20200520182314-0ba52f642ac2 // indirect
 	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e // indirect
 	golang.org/x/sys v0.0.0-20200523222454-059865788121 // indirect
-	golang.org/x/text v0.3.3 // indirect
 	golang.org/x/tools v0.0.0-20191216173652-a0e659d51361 // indirect
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
-	google.golang.org/grpc v1.27.0 // indirect
 	google.golang.org/protobuf v1.23.1-0.20200526195155-81db48ad09cc // indirect
 	gopkg.in/fsnotify.v1 v1.4.7 // indirect
 	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
@@ -0,0 +1,326 @@
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/micro/go-micro/v2/metadata"
+	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
+	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
+	"omo.msa.organization/cache"
+	"omo.msa.organization/config"
+	"omo.msa.organization/proxy/nosql"
+	"omo.msa.organization/tool"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+管理命令，注册为单独的AdminService，复用MaintainService.UpdateByFilter的请求以及回复，
+key为命令，会修改或者删除数据的命令需要metadata中的Token和配置的service.token一致，
+没有配置token时这些命令只能通过命令行执行
+*/
+
+type AdminService struct{}
+
+// destructiveKeys 需要授权的管理命令
+var destructiveKeys = []string{"recovery", "import", "indexes", "migrate", "revert", "restore", "purge"}
+
+// checkAdmin 只读的命令以及indexes、migrate的预览不需要授权
+func checkAdmin(ctx context.Context, in *pb.ReqUpdateFilter) (string, pbstatus.ResultStatus) {
+	if !tool.HasItem(destructiveKeys, in.Key) {
+		return "", pbstatus.ResultStatus_Success
+	}
+	if (in.Key == "indexes" && in.Value != "apply") || (in.Key == "migrate" && tool.HasItem(in.Values, "dry")) {
+		return "", pbstatus.ResultStatus_Success
+	}
+	if len(config.Schema.Service.Token) < 1 {
+		return "the admin command only support the cli of " + in.Key, pbstatus.ResultStatus_Prohibition
+	}
+	token, ok := metadata.Get(ctx, "Token")
+	if !ok || len(token) < 1 {
+		return "the admin token is empty", pbstatus.ResultStatus_TokenEmpty
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(config.Schema.Service.Token)) != 1 {
+		return "the admin token is unusable", pbstatus.ResultStatus_TokenUnusable
+	}
+	return "", pbstatus.ResultStatus_Success
+}
+
+func (mine *AdminService) UpdateByFilter(ctx context.Context, in *pb.ReqUpdateFilter, out *pb.ReplyInfo) error {
+	path := "admin.updateByFilter"
+	inLog(path, in)
+	if msg, code := checkAdmin(ctx, in); code != pbstatus.ResultStatus_Success {
+		out.Status = outError(path, msg, code)
+		return nil
+	}
+	if in.Key == "backup" {
+		manifest, err := cache.BackupStorage()
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
+			return nil
+		}
+		out.Uid = manifest.Name
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "recovery" {
+		if len(in.Value) < 1 {
+			out.Status = outError(path, "the snapshot name is empty", pbstatus.ResultStatus_Empty)
+			return nil
+		}
+		manifest, err := cache.RecoveryStorage(in.Value, in.Values)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
+			return nil
+		}
+		out.Uid = manifest.Name
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "import" {
+		//value为表名，values为json数组或者每一行一个json对象，有错误的行以json返回在error中
+		data := strings.Join(in.Values, ",")
+		if len(in.Values) > 1 {
+			data = "[" + data + "]"
+		}
+		report, err := cache.ImportStorage(ctx, in.Value, in.Operator, strings.NewReader(data))
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		out.Uid = fmt.Sprintf("%d/%d", report.Success, report.Total)
+		if len(report.Errors) > 0 {
+			bytes, _ := json.Marshal(report.Errors)
+			out.Status = outError(path, string(bytes), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "indexes" {
+		//value为apply时同步索引，uid返回差异报告的json
+		report, err := cache.IndexStorage(in.Value == "apply")
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
+			return nil
+		}
+		bytes, _ := json.Marshal(report)
+		out.Uid = string(bytes)
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "migrate" {
+		//value为目标版本，为空时迁移到最新，values包含dry时只统计，uid返回结果的json
+		target := -1
+		if len(in.Value) > 0 {
+			num, er := strconv.Atoi(in.Value)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			target = num
+		}
+		list, err := cache.MigrateStorage(target, tool.HasItem(in.Values, "dry"))
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
+			return nil
+		}
+		bytes, _ := json.Marshal(list)
+		out.Uid = string(bytes)
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "version" {
+		//value为表名，uid为对象，uid返回当前版本
+		num, err := cache.GetVersion(in.Value, in.Uid)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		out.Uid = strconv.FormatUint(uint64(num), 10)
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "audits" {
+		//scene为场景，value为表名，values为target、operator、from、to、limit的key=value，uid返回审计记录的json
+		filter, err := parseAuditFilter(in.Scene, in.Value, in.Values)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		list, err := cache.GetAudits(filter)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
+			return nil
+		}
+		bytes, _ := json.Marshal(list)
+		out.Uid = string(bytes)
+		out.Status = outLog(path, fmt.Sprintf("the length = %d", len(list)))
+		return nil
+	} else if in.Key == "revisions" {
+		//value为表名，uid为对象，values可以包含limit=n，uid返回历史版本的json
+		filter, err := parseAuditFilter("", in.Value, in.Values)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		list, err := cache.Context().GetRevisions(in.Value, in.Uid, filter.Limit)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
+			return nil
+		}
+		bytes, _ := json.Marshal(list)
+		out.Uid = string(bytes)
+		out.Status = outLog(path, fmt.Sprintf("the length = %d", len(list)))
+		return nil
+	} else if in.Key == "revision" {
+		//value为表名，uid为对象，values的第一个为unix秒，uid返回这个时间的版本的json
+		if len(in.Values) < 1 {
+			out.Status = outError(path, "the revision time is empty", pbstatus.ResultStatus_Empty)
+			return nil
+		}
+		stamp, err := strconv.ParseInt(in.Values[0], 10, 64)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		info, err := cache.Context().GetRevisionAt(in.Value, in.Uid, time.Unix(stamp, 0))
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		bytes, _ := json.Marshal(info)
+		out.Uid = string(bytes)
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "compare" {
+		//value为旧的版本，uid为新的版本，为空时和当前的对象比较，uid返回字段差异的json
+		list, err := cache.Context().DiffRevisions(in.Value, in.Uid)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		bytes, _ := json.Marshal(list)
+		out.Uid = string(bytes)
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "revert" {
+		//uid为历史版本，恢复对象的配置字段，metadata中的Version为对象的版本
+		info, err := cache.Context().GetRevision(in.Uid)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		tmp, status := expectVersion(ctx, path, info.Table, info.Target)
+		if status != nil {
+			out.Status = status
+			return nil
+		}
+		err = cache.Context().RevertRevision(tmp, in.Uid, in.Operator)
+		if _, ok := err.(*nosql.VersionConflict); ok {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_NotMatch)
+			return nil
+		} else if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
+			return nil
+		}
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "health" {
+		//value为check时立即检查一次，uid返回连接状态的json
+		info := cache.GetHealth()
+		if in.Value == "check" {
+			info = cache.CheckHealth()
+		}
+		bytes, _ := json.Marshal(info)
+		out.Uid = string(bytes)
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "cache" {
+		//uid返回缓存数量以及命中率的json
+		bytes, _ := json.Marshal(cache.GetCacheStats())
+		out.Uid = string(bytes)
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "search" {
+		//scene为场景，为空时搜索全部场景，value为关键字，values为类型(scene,group,room,region,area,device)，uid返回结果的json
+		hits, err := cache.Search(in.Value, cache.SearchOptions{Scene: in.Scene, Types: in.Values})
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_Empty)
+			return nil
+		}
+		bytes, _ := json.Marshal(hits)
+		out.Uid = string(bytes)
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "geo" {
+		//value为位置条件的json，mode为near、box、polygon或者cluster，values为类型(scene,region)，
+		//区域需要指定scene，uid返回结果的json，附近查询带有距离，聚合返回每个网格的数量
+		query, err := cache.ParseGeoQuery("", in.Value)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		kind := ""
+		if len(in.Values) > 0 {
+			kind = in.Values[0]
+		}
+		result, err := cache.GeoSearch(kind, in.Scene, query)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		bytes, _ := json.Marshal(result)
+		out.Uid = string(bytes)
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "invalidate" {
+		//value为场景，为空时释放全部场景的子集合
+		err := cache.Invalidate(in.Value)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "recycles" {
+		//scene为场景，uid返回回收站列表的json
+		list, err := cache.Context().GetRecycles(in.Scene)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
+			return nil
+		}
+		bytes, _ := json.Marshal(list)
+		out.Uid = string(bytes)
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "restore" {
+		//value为表名，uid为删除的对象
+		err := cache.Context().Restore(ctx, in.Value, in.Uid, in.Operator)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		out.Uid = in.Uid
+		out.Status = outLog(path, out)
+		return nil
+	} else if in.Key == "purge" {
+		//value为保留天数，为空时使用配置
+		days := config.Schema.Database.Retention
+		if len(in.Value) > 0 {
+			num, er := strconv.Atoi(in.Value)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			days = num
+		}
+		list, err := cache.PurgeRecycles(ctx, days)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
+			return nil
+		}
+		out.Uid = strconv.Itoa(len(list))
+		out.Status = outLog(path, out)
+		return nil
+	}
+	out.Status = outError(path, "the admin key not support of "+in.Key, pbstatus.ResultStatus_FormatError)
+	return nil
+}
@@ -7,12 +7,14 @@ import (
 	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
 	"omo.msa.organization/cache"
+	"omo.msa.organization/proxy/nosql"
 	"strings"
 )
 
 type AreaService struct{}
 
-func switchArea(info *cache.AreaInfo, dev bool) *pb.AreaInfo {
+func switchArea(area *cache.AreaInfo, dev bool) *pb.AreaInfo {
+	info := area.Clone()
 	tmp := new(pb.AreaInfo)
 	tmp.Uid = info.UID
 	tmp.Id = info.ID
@@ -60,7 +62,7 @@ func (mine *AreaService) AddOne(ctx context.Context, in *pb.ReqAreaAdd, out *pb.
 		return nil
 	}
 
-	info, err := cache.Context().CreateArea(in.Name, in.Remark, in.Owner, in.Parent, in.Operator, in.Assets)
+	info, err := cache.Context().CreateArea(ctx, in.Name, in.Remark, in.Owner, in.Parent, in.Operator, in.Assets)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -111,7 +113,7 @@ func (mine *AreaService) RemoveOne(ctx context.Context, in *pb.RequestInfo, out
 		out.Status = outError(path, "the area not found ", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	err := info.Remove(in.Operator)
+	err := info.Remove(ctx, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -124,7 +126,20 @@ func (mine *AreaService) RemoveOne(ctx context.Context, in *pb.RequestInfo, out
 func (mine *AreaService) Search(ctx context.Context, in *pb.RequestInfo, out *pb.ReplyAreaList) error {
 	path := "area.search"
 	inLog(path, in)
-
+	//parent为场景，为空时搜索全部场景，uid为关键字，flag为返回的最大数量
+	hits, err := cache.Search(in.Uid, cache.SearchOptions{Scene: in.Parent, Types: []string{"area"}, Limit: int(in.Flag)})
+	if err != nil {
+		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_Empty)
+		return nil
+	}
+	out.List = make([]*pb.AreaInfo, 0, len(hits))
+	for _, hit := range hits {
+		info, er := cache.Context().GetArea(hit.UID)
+		if er == nil {
+			out.List = append(out.List, switchArea(info, false))
+		}
+	}
+	out.Total = uint32(len(out.List))
 	out.Status = outLog(path, fmt.Sprintf("the length = %d", len(out.List)))
 	return nil
 }
@@ -132,10 +147,23 @@ func (mine *AreaService) Search(ctx context.Context, in *pb.RequestInfo, out *pb
 func (mine *AreaService) GetListByFilter(ctx context.Context, in *pb.RequestFilter, out *pb.ReplyAreaList) error {
 	path := "area.getListByFilter"
 	inLog(path, in)
+	pager, er := readPager(ctx, in.Page, in.Number)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
+	query, er := readQuery(in.Key, in.Value, nosql.TableArea)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
 	var list []*cache.AreaInfo
 	var err error
 	if in.Key == "" {
 		list, _ = cache.Context().GetAreasByScene(in.Scene)
+	} else if query != nil {
+		//scene为场景，value为组合条件的json
+		list, err = cache.Context().GetAreasByScene(in.Scene)
 	} else if in.Key == "template" {
 		list = cache.Context().GetAreasByTemplate(in.Scene, in.Value)
 	} else if in.Key == "array" {
@@ -159,6 +187,23 @@ func (mine *AreaService) GetListByFilter(ctx context.Context, in *pb.RequestFilt
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
 	}
+	//原来的过滤方式一直返回全部
+	var limit *cache.Pager
+	if query != nil {
+		limit = optionalPager(pager, in.Number)
+	}
+	total, pages, list, er := cache.QueryList(query, limit, list)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
+	out.Total = total
+	if limit != nil {
+		out.Pages = pages
+		out.Page = limit.Page
+		out.Number = limit.Number
+		writePager(ctx, limit)
+	}
 	out.List = make([]*pb.AreaInfo, 0, len(list))
 	for _, value := range list {
 		out.List = append(out.List, switchArea(value, in.Flag > 0))
@@ -181,7 +226,7 @@ func (mine *AreaService) UpdateBase(ctx context.Context, in *pb.ReqAreaBase, out
 		return nil
 	}
 	var err error
-	err = info.UpdateBase(in.Name, in.Remark, "")
+	err = info.UpdateBase(ctx, in.Name, in.Remark, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -205,11 +250,11 @@ func (mine *AreaService) UpdateByFilter(ctx context.Context, in *pb.ReqUpdateFil
 	}
 	var err error
 	if in.Key == "question" {
-		err = info.UpdateQuestion(in.Value, in.Operator)
+		err = info.UpdateQuestion(ctx, in.Value, in.Operator)
 	} else if in.Key == "sn" {
-		err = info.UpdateDevice2(in.Value, in.Operator)
+		err = info.UpdateDevice2(ctx, in.Value, in.Operator)
 	} else if in.Key == "template" {
-		err = info.UpdateTemplate(in.Value, in.Operator)
+		err = info.UpdateTemplate(ctx, in.Value, in.Operator)
 	} else if in.Key == "device" {
 		arr := strings.Split(in.Value, ";")
 		if len(arr) != 2 {
@@ -217,25 +262,25 @@ func (mine *AreaService) UpdateByFilter(ctx context.Context, in *pb.ReqUpdateFil
 		} else {
 			tp := parseInt(arr[0])
 			sn := arr[1]
-			err = info.UpdateDevice(sn, in.Operator, uint32(tp))
+			err = info.UpdateDevice(ctx, sn, in.Operator, uint32(tp))
 		}
 	} else if in.Key == "type" {
 		tp := parseInt(in.Value)
-		err = info.UpdateType(uint32(tp), in.Operator)
+		err = info.UpdateType(ctx, uint32(tp), in.Operator)
 	} else if in.Key == "limit" {
 		num := parseInt(in.Value)
-		err = info.UpdateLimitCount(in.Operator, uint32(num))
+		err = info.UpdateLimitCount(ctx, in.Operator, uint32(num))
 	} else if in.Key == "catalog" {
-		err = info.UpdateCatalog(in.Value, in.Operator)
+		err = info.UpdateCatalog(ctx, in.Value, in.Operator)
 	} else if in.Key == "assets" {
-		err = info.UpdateAssets(in.Operator, in.Values)
+		err = info.UpdateAssets(ctx, in.Operator, in.Values)
 	} else if in.Key == "module" {
 		if len(in.Values) < 2 {
 			err = errors.New("the values length error when update module")
 		} else {
 			key := in.Values[0]
 			val := in.Values[1]
-			err = info.UpdateModule(key, val, in.Operator)
+			err = info.UpdateModule(ctx, key, val, in.Operator)
 		}
 	} else if in.Key == "source" {
 		if len(in.Values) < 2 {
@@ -243,7 +288,7 @@ func (mine *AreaService) UpdateByFilter(ctx context.Context, in *pb.ReqUpdateFil
 		} else {
 			key := in.Values[0]
 			val := in.Values[1]
-			err = info.UpdateCustomSource(key, val, in.Operator)
+			err = info.UpdateCustomSource(ctx, key, val, in.Operator)
 		}
 	} else {
 		err = errors.New("the field not defined")
@@ -0,0 +1,56 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"github.com/micro/go-micro/v2/server"
+	"omo.msa.organization/cache"
+	"omo.msa.organization/proxy/nosql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+审计记录的调用路径，通过context传递到存储接口
+*/
+
+// AuditWrapper 注册到服务的handler wrapper
+func AuditWrapper(fn server.HandlerFunc) server.HandlerFunc {
+	return func(ctx context.Context, req server.Request, rsp interface{}) error {
+		return fn(cache.WithPath(ctx, req.Endpoint()), req, rsp)
+	}
+}
+
+// parseAuditFilter values的格式为key=value，时间为unix秒
+func parseAuditFilter(scene, table string, values []string) (*nosql.AuditFilter, error) {
+	filter := &nosql.AuditFilter{Scene: scene, Table: table}
+	for _, item := range values {
+		i := strings.Index(item, "=")
+		if i < 1 {
+			return nil, errors.New("the audit filter format is error of " + item)
+		}
+		key, value := item[:i], item[i+1:]
+		switch key {
+		case "target":
+			filter.Target = value
+		case "operator":
+			filter.Operator = value
+		case "from", "to", "limit":
+			num, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, errors.New("the audit filter format is error of " + item)
+			}
+			if key == "from" {
+				filter.From = time.Unix(num, 0)
+			} else if key == "to" {
+				filter.To = time.Unix(num, 0)
+			} else {
+				filter.Limit = num
+			}
+		default:
+			return nil, errors.New("the audit filter not support of " + key)
+		}
+	}
+	return filter, nil
+}
@@ -7,11 +7,13 @@ import (
 	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
 	"omo.msa.organization/cache"
+	"omo.msa.organization/proxy/nosql"
 )
 
 type DeviceService struct{}
 
-func switchDevice(info *cache.DeviceInfo) *pb.DeviceInfo {
+func switchDevice(device *cache.DeviceInfo) *pb.DeviceInfo {
+	info := device.Clone()
 	tmp := new(pb.DeviceInfo)
 	tmp.Uid = info.UID
 	tmp.Id = info.ID
@@ -52,7 +54,7 @@ func (mine *DeviceService) AddOne(ctx context.Context, in *pb.ReqDeviceAdd, out
 		return nil
 	}
 
-	info, err := cache.Context().CreateDevice(in.Owner, in.Name, in.Sn, in.Remark, in.Operator, uint8(in.Type))
+	info, err := cache.Context().CreateDevice(ctx, in.Owner, in.Name, in.Sn, in.Remark, in.Operator, uint8(in.Type))
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -113,7 +115,7 @@ func (mine *DeviceService) RemoveOne(ctx context.Context, in *pb.RequestInfo, ou
 		out.Status = outError(path, "the device not found ", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	err := info.Remove(in.Operator)
+	err := info.Remove(ctx, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -134,19 +136,33 @@ func (mine *DeviceService) Search(ctx context.Context, in *pb.RequestInfo, out *
 func (mine *DeviceService) GetListByFilter(ctx context.Context, in *pb.RequestFilter, out *pb.ReplyDeviceList) error {
 	path := "device.getListByFilter"
 	inLog(path, in)
+	pager, er := readPager(ctx, in.Page, in.Number)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
+	query, er := readQuery(in.Key, in.Value, nosql.TableDevice)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
 	var list []*cache.DeviceInfo
 	var err error
 	if in.Scene == "" {
-		if in.Key == "status" {
+		if query != nil {
+			list, err = cache.Context().GetAllDevices()
+		} else if in.Key == "status" {
 			st := parseInt(in.Value)
 			list, err = cache.Context().GetDevicesByStatus(int32(st))
 		} else if in.Key == "array" {
 			list, err = cache.Context().GetDevicesByArray(in.List)
+		} else if in.Key == "quote" {
+			list, err = cache.Context().GetDevicesByQuote(in.Value)
 		} else {
 			err = errors.New("the key not defined")
 		}
 	} else {
-		if in.Key == "" {
+		if in.Key == "" || query != nil {
 			list, err = cache.Context().GetDevicesByScene(in.Scene)
 		} else if in.Key == "area" {
 			list, err = cache.Context().GetUsableDevicesByScene(in.Scene)
@@ -159,6 +175,19 @@ func (mine *DeviceService) GetListByFilter(ctx context.Context, in *pb.RequestFi
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
 	}
+	limit := optionalPager(pager, in.Number)
+	total, pages, list, er := cache.QueryList(query, limit, list)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
+	out.Total = total
+	if limit != nil {
+		out.Pages = pages
+		out.Page = limit.Page
+		out.Number = limit.Number
+		writePager(ctx, limit)
+	}
 	out.List = make([]*pb.DeviceInfo, 0, len(list))
 	for _, value := range list {
 		out.List = append(out.List, switchDevice(value))
@@ -181,7 +210,7 @@ func (mine *DeviceService) UpdateBase(ctx context.Context, in *pb.ReqDeviceBase,
 		return nil
 	}
 	var err error
-	err = info.UpdateBase(in.Name, in.Remark, in.Operator)
+	err = info.UpdateBase(ctx, in.Name, in.Remark, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -205,23 +234,23 @@ func (mine *DeviceService) UpdateByFilter(ctx context.Context, in *pb.ReqUpdateF
 	}
 	var err error
 	if in.Key == "certificate" {
-		err = info.UpdateCertificate(in.Value, in.Operator)
+		err = info.UpdateCertificate(ctx, in.Value, in.Operator)
 	} else if in.Key == "scene" {
-		err = info.UpdateScene(in.Value, in.Operator)
+		err = info.UpdateScene(ctx, in.Value, in.Operator)
 	} else if in.Key == "aspect" {
-		err = info.UpdateAspect(in.Value, in.Operator)
+		err = info.UpdateAspect(ctx, in.Value, in.Operator)
 	} else if in.Key == "type" {
 		tp := parseInt(in.Value)
-		err = info.UpdateType(in.Operator, uint8(tp))
+		err = info.UpdateType(ctx, in.Operator, uint8(tp))
 	} else if in.Key == "status" {
 		st := parseInt(in.Value)
-		err = info.UpdateStatus(in.Operator, uint8(st))
+		err = info.UpdateStatus(ctx, in.Operator, uint8(st))
 	} else if in.Key == "auto" {
 		if len(in.Values) == 2 {
-			err = info.UpdateAuto(in.Operator, in.Values[0], in.Values[1])
+			err = info.UpdateAuto(ctx, in.Operator, in.Values[0], in.Values[1])
 		}
 	} else if in.Key == "meta" {
-		err = info.UpdateMeta(in.Operator, in.Value)
+		err = info.UpdateMeta(ctx, in.Operator, in.Value)
 	} else {
 		err = errors.New("the field not defined")
 	}
@@ -249,7 +278,7 @@ func (mine *DeviceService) Bind(ctx context.Context, in *pb.ReqDeviceBind, out *
 	//	out.Status = outError(path, "the device had bind ", pbstatus.ResultStatus_Prohibition)
 	//	return nil
 	//}
-	err := info.Bind(in.Quote, in.Os, in.Operator, in.Activated, uint64(in.Expiry))
+	err := info.Bind(ctx, in.Quote, in.Os, in.Operator, in.Activated, uint64(in.Expiry))
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
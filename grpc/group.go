@@ -6,11 +6,13 @@ import (
 	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
 	"omo.msa.organization/cache"
+	"omo.msa.organization/proxy/nosql"
 )
 
 type GroupService struct{}
 
-func switchGroup(info *cache.GroupInfo) *pb.GroupInfo {
+func switchGroup(group *cache.GroupInfo) *pb.GroupInfo {
+	info := group.Clone()
 	tmp := new(pb.GroupInfo)
 	tmp.Uid = info.UID
 	tmp.Id = info.ID
@@ -42,6 +44,10 @@ func (mine *GroupService) AddOne(ctx context.Context, in *pb.ReqGroupAdd, out *p
 		out.Status = outError(path, "the name is empty ", pbstatus.ResultStatus_Empty)
 		return nil
 	}
+	if _, er := nosql.ParseGeoPoint(in.Location); er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
 	scene := cache.Context().GetScene(in.Scene)
 	if scene == nil {
 		out.Status = outError(path, "not found the scene ", pbstatus.ResultStatus_NotExisted)
@@ -53,7 +59,7 @@ func (mine *GroupService) AddOne(ctx context.Context, in *pb.ReqGroupAdd, out *p
 		return nil
 	}
 
-	group, err := scene.CreateGroup(in)
+	group, err := scene.CreateGroup(ctx, in)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -142,7 +148,7 @@ func (mine *GroupService) RemoveOne(ctx context.Context, in *pb.RequestInfo, out
 		out.Status = outError(path, "the uid is empty ", pbstatus.ResultStatus_Empty)
 		return nil
 	}
-	err := cache.Context().RemoveGroup(in.Uid, in.Operator)
+	err := cache.Context().RemoveGroup(ctx, in.Uid, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -160,12 +166,18 @@ func (mine *GroupService) GetList(ctx context.Context, in *pb.RequestPage, out *
 		out.Status = outError(path, "not found the scene ", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	total, max, list := scene.GetGroups(in.Number, in.Page)
+	pager, er := readPager(ctx, in.Page, in.Number)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
+	total, max, list := scene.GetGroups(pager)
 	out.List = make([]*pb.GroupInfo, 0, len(list))
 	for _, value := range list {
 		out.List = append(out.List, switchGroup(value))
 	}
-	out.PageNow = in.Page
+	writePager(ctx, pager)
+	out.PageNow = pager.Page
 	out.Total = total
 	out.PageMax = max
 	out.Status = outLog(path, fmt.Sprintf("the length = %d", len(out.List)))
@@ -186,7 +198,7 @@ func (mine *GroupService) UpdateBase(ctx context.Context, in *pb.ReqGroupUpdate,
 	}
 	var err error
 	if len(in.Cover) > 0 {
-		err = info.UpdateCover(in.Cover, in.Operator)
+		err = info.UpdateCover(ctx, in.Cover, in.Operator)
 	}
 
 	if len(in.Name) > 0 || len(in.Remark) > 0 {
@@ -199,7 +211,7 @@ func (mine *GroupService) UpdateBase(ctx context.Context, in *pb.ReqGroupUpdate,
 			out.Status = outError(path, "the department name repeated ", pbstatus.ResultStatus_Repeated)
 			return nil
 		}
-		err = info.UpdateBase(in.Name, in.Remark, in.Operator)
+		err = info.UpdateBase(ctx, in.Name, in.Remark, in.Operator)
 	}
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
@@ -224,13 +236,17 @@ func (mine *GroupService) UpdateAddress(ctx context.Context, in *pb.RequestAddre
 	}
 	var err error
 	if in.Location != info.Location {
-		err = info.UpdateLocation(in.Location, in.Operator)
+		if _, er := nosql.ParseGeoPoint(in.Location); er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		err = info.UpdateLocation(ctx, in.Location, in.Operator)
 		if err != nil {
 			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 			return nil
 		}
 	}
-	err = info.UpdateAddress(in.Country, in.Province, in.City, in.Zone, in.Operator)
+	err = info.UpdateAddress(ctx, in.Country, in.Province, in.City, in.Zone, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -252,7 +268,11 @@ func (mine *GroupService) UpdateLocation(ctx context.Context, in *pb.RequestFlag
 		out.Status = outError(path, "the Group not found ", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	err := info.UpdateLocation(in.Flag, in.Operator)
+	if _, er := nosql.ParseGeoPoint(in.Flag); er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
+	err := info.UpdateLocation(ctx, in.Flag, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -274,7 +294,7 @@ func (mine *GroupService) UpdateContact(ctx context.Context, in *pb.RequestFlag,
 		out.Status = outError(path, "the Group not found ", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	err := info.UpdateContact(in.Flag, in.Operator)
+	err := info.UpdateContact(ctx, in.Flag, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -296,7 +316,7 @@ func (mine *GroupService) UpdateMaster(ctx context.Context, in *pb.RequestFlag,
 		out.Status = outError(path, "the group not found ", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	err := info.UpdateMaster(in.Flag, in.Operator)
+	err := info.UpdateMaster(ctx, in.Flag, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -317,7 +337,7 @@ func (mine *GroupService) UpdateAssistant(ctx context.Context, in *pb.RequestFla
 		out.Status = outError(path, "the group not found ", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	err := info.UpdateMaster(in.Flag, in.Operator)
+	err := info.UpdateMaster(ctx, in.Flag, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -356,7 +376,7 @@ func (mine *GroupService) AppendMember(ctx context.Context, in *pb.RequestInfo,
 		return nil
 	}
 
-	err := info.AppendMember(in.Uid)
+	err := info.AppendMember(ctx, in.Uid)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -380,7 +400,7 @@ func (mine *GroupService) SubtractMember(ctx context.Context, in *pb.RequestInfo
 		return nil
 	}
 
-	err := info.SubtractMember(in.Uid)
+	err := info.SubtractMember(ctx, in.Uid)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -0,0 +1,196 @@
+package grpc
+
+import (
+	"context"
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
+	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
+	"google.golang.org/grpc"
+	gmd "google.golang.org/grpc/metadata"
+	"omo.msa.organization/cache"
+	"omo.msa.organization/config"
+	"omo.msa.organization/proxy/nosql"
+	"omo.msa.organization/tool"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/**
+数据库不可用时的只读模式，查询继续使用缓存，写操作直接返回DBException；
+写操作的metadata中带有Version时作为写入的条件，版本过期返回NotMatch，成功时header中返回新的版本
+*/
+
+// versionTables 服务对应的表
+var versionTables = map[string]string{
+	"SceneService":    nosql.TableScene,
+	"GroupService":    nosql.TableGroup,
+	"RoomService":     nosql.TableRoom,
+	"RegionService":   nosql.TableRegion,
+	"AreaService":     nosql.TableArea,
+	"DeviceService":   nosql.TableDevice,
+	"MaintainService": nosql.TableMaintain,
+}
+
+// GuardWrapper 注册到服务的handler wrapper
+func GuardWrapper(fn server.HandlerFunc) server.HandlerFunc {
+	return func(ctx context.Context, req server.Request, rsp interface{}) error {
+		if cache.IsReadOnly() && !isReadRequest(req.Endpoint(), req.Body()) {
+			status := outError(req.Endpoint(), cache.ErrReadOnly.Error(), pbstatus.ResultStatus_DBException)
+			if setStatus(rsp, status) {
+				return nil
+			}
+		}
+		target, status := versionTarget(ctx, req)
+		if status != nil && setStatus(rsp, status) {
+			return nil
+		}
+		var exp *nosql.Expect
+		if target != nil && target.checked {
+			ctx, exp = nosql.WithExpect(ctx, target.table, target.uid, target.version)
+		}
+		err := fn(ctx, req, rsp)
+		if err == nil && target != nil {
+			replyVersion(ctx, req.Endpoint(), target, exp, rsp)
+		}
+		return err
+	}
+}
+
+// readKeys 只读的管理命令
+var readKeys = []string{"health", "cache", "version", "audits", "revisions", "revision", "compare", "search", "geo"}
+
+// isReadRequest 方法名以Get开头以及查询状态的管理命令
+func isReadRequest(endpoint string, body interface{}) bool {
+	method := endpoint
+	if i := strings.LastIndex(endpoint, "."); i > -1 {
+		method = endpoint[i+1:]
+	}
+	if strings.HasPrefix(method, "Get") || method == "Search" || method == "IsMasterUsed" {
+		return true
+	}
+	if in, ok := body.(*pb.ReqUpdateFilter); ok && strings.HasPrefix(endpoint, "AdminService.") {
+		return tool.HasItem(readKeys, in.Key)
+	}
+	return false
+}
+
+type versionInfo struct {
+	table   string
+	uid     string
+	version uint32
+	checked bool
+}
+
+// versionTarget 修改已有对象的请求，没有Version时只返回新的版本，strict时必须带有Version
+func versionTarget(ctx context.Context, req server.Request) (*versionInfo, *pb.ReplyStatus) {
+	if isReadRequest(req.Endpoint(), req.Body()) {
+		return nil, nil
+	}
+	arr := strings.Split(req.Endpoint(), ".")
+	table, ok := versionTables[arr[0]]
+	if !ok {
+		return nil, nil
+	}
+	uid := getUid(req.Body())
+	if len(uid) < 1 {
+		return nil, nil
+	}
+	version, checked, status := readVersion(ctx, req.Endpoint())
+	if status != nil {
+		return nil, status
+	}
+	return &versionInfo{table: table, uid: uid, version: version, checked: checked}, nil
+}
+
+// readVersion metadata中的Version，没有时返回false
+func readVersion(ctx context.Context, path string) (uint32, bool, *pb.ReplyStatus) {
+	value, ok := metadata.Get(ctx, "Version")
+	if !ok || len(value) < 1 {
+		if config.Schema.Service.Strict {
+			return 0, false, outError(path, "the version is empty", pbstatus.ResultStatus_Empty)
+		}
+		return 0, false, nil
+	}
+	version, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, false, outError(path, "the version format is error", pbstatus.ResultStatus_FormatError)
+	}
+	return uint32(version), true, nil
+}
+
+// expectVersion 请求的对象不是uid时使用，例如恢复历史版本
+func expectVersion(ctx context.Context, path, table, uid string) (context.Context, *pb.ReplyStatus) {
+	version, checked, status := readVersion(ctx, path)
+	if status != nil || !checked {
+		return ctx, status
+	}
+	ctx, _ = nosql.WithExpect(ctx, table, uid, version)
+	return ctx, nil
+}
+
+// replyVersion 写入时版本冲突改为NotMatch，成功时header中返回对象当前的版本
+func replyVersion(ctx context.Context, path string, target *versionInfo, exp *nosql.Expect, rsp interface{}) {
+	if exp != nil {
+		if conflict := exp.Conflict(); conflict != nil {
+			setStatus(rsp, outError(path, conflict.Error(), pbstatus.ResultStatus_NotMatch))
+			_ = grpc.SetHeader(ctx, gmd.Pairs("version", strconv.FormatUint(uint64(conflict.Current), 10)))
+			return
+		}
+	}
+	if status := getStatus(rsp); status == nil || status.Code != 0 {
+		return
+	}
+	var version uint32
+	if exp != nil && exp.Version() != target.version {
+		version = exp.Version()
+	} else {
+		num, err := cache.GetVersion(target.table, target.uid)
+		if err != nil {
+			return
+		}
+		version = num
+	}
+	_ = grpc.SetHeader(ctx, gmd.Pairs("version", strconv.FormatUint(uint64(version), 10)))
+}
+
+// getUid 请求中的Uid字段
+func getUid(body interface{}) string {
+	value := reflect.ValueOf(body)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+	field := value.Elem().FieldByName("Uid")
+	if !field.IsValid() || field.Kind() != reflect.String {
+		return ""
+	}
+	return field.String()
+}
+
+// setStatus 所有的回复都有Status字段
+func setStatus(rsp interface{}, status *pb.ReplyStatus) bool {
+	value := reflect.ValueOf(rsp)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	field := value.Elem().FieldByName("Status")
+	if !field.IsValid() || !field.CanSet() || field.Type() != reflect.TypeOf(status) {
+		return false
+	}
+	field.Set(reflect.ValueOf(status))
+	return true
+}
+
+func getStatus(rsp interface{}) *pb.ReplyStatus {
+	value := reflect.ValueOf(rsp)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	field := value.Elem().FieldByName("Status")
+	if !field.IsValid() {
+		return nil
+	}
+	status, _ := field.Interface().(*pb.ReplyStatus)
+	return status
+}
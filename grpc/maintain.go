@@ -6,6 +6,7 @@ import (
 	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
 	"omo.msa.organization/cache"
+	"omo.msa.organization/proxy/nosql"
 )
 
 type MaintainService struct{}
@@ -43,7 +44,7 @@ func (mine *MaintainService) AddOne(ctx context.Context, in *pb.ReqMaintainAdd,
 		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	info, err := cache.Context().CreateMaintain(in, area.Device)
+	info, err := cache.Context().CreateMaintain(ctx, in, area.Device)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -86,12 +87,41 @@ func (mine *MaintainService) RemoveOne(ctx context.Context, in *pb.RequestInfo,
 func (mine *MaintainService) GetByFilter(ctx context.Context, in *pb.RequestFilter, out *pb.ReplyMaintainList) error {
 	path := "maintain.getByFilter"
 	inLog(path, in)
+	pager, er := readPager(ctx, in.Page, in.Number)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
+	query, er := readQuery(in.Key, in.Value, nosql.TableMaintain)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
 	var array []*cache.MaintainInfo
-	if in.Key == "" {
+	if query != nil {
+		array, er = cache.Context().QueryMaintains(in.Scene, query)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_DBException)
+			return nil
+		}
+	} else if in.Key == "" {
 		array, _ = cache.Context().GetMaintainByScene(in.Scene)
 	} else if in.Key == "area" {
 		array, _ = cache.Context().GetMaintainByArea(in.Scene, in.Value)
 	}
+	limit := optionalPager(pager, in.Number)
+	total, pages, array, er := cache.QueryList(query, limit, array)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
+	out.Total = total
+	if limit != nil {
+		out.Pages = pages
+		out.Page = limit.Page
+		out.Number = limit.Number
+		writePager(ctx, limit)
+	}
 	out.List = make([]*pb.MaintainInfo, 0, len(array))
 	for _, info := range array {
 		item := switchMaintain(info)
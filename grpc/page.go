@@ -0,0 +1,52 @@
+package grpc
+
+import (
+	"context"
+	"github.com/micro/go-micro/v2/metadata"
+	"google.golang.org/grpc"
+	gmd "google.golang.org/grpc/metadata"
+	"omo.msa.organization/cache"
+	"strconv"
+)
+
+/**
+列表分页，请求的metadata中带有Cursor时使用游标分页，Cursor为空或者first时从第一页开始，
+下一页的游标通过响应头cursor返回，为空表示没有下一页；没有Cursor时按照页码分页；
+key为query时使用组合条件过滤以及排序，指定排序字段时只能使用页码分页；
+回复中没有Total以及Pages字段的列表通过响应头total以及pages返回
+*/
+
+func readPager(ctx context.Context, page, number uint32) (*cache.Pager, error) {
+	token, ok := metadata.Get(ctx, "Cursor")
+	if !ok {
+		return cache.NewPager(page, number), nil
+	}
+	return cache.NewCursorPager(token, number)
+}
+
+// optionalPager 原来返回全部的列表只在指定数量或者使用游标时分页，不分页时返回nil
+func optionalPager(pager *cache.Pager, number uint32) *cache.Pager {
+	if number > 0 || pager.Cursored() {
+		return pager
+	}
+	return nil
+}
+
+func writePager(ctx context.Context, pager *cache.Pager) {
+	if pager != nil {
+		_ = grpc.SetHeader(ctx, gmd.Pairs("cursor", pager.Next))
+	}
+}
+
+func writeTotal(ctx context.Context, total, pages uint32) {
+	_ = grpc.SetHeader(ctx, gmd.Pairs("total", strconv.FormatUint(uint64(total), 10),
+		"pages", strconv.FormatUint(uint64(pages), 10)))
+}
+
+// readQuery key为query时value为组合条件的json，其他key使用原来的过滤方式，返回nil
+func readQuery(key, value, table string) (*cache.FilterQuery, error) {
+	if key != "query" {
+		return nil, nil
+	}
+	return cache.ParseFilter(table, value)
+}
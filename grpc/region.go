@@ -6,11 +6,13 @@ import (
 	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
 	"omo.msa.organization/cache"
+	"omo.msa.organization/proxy/nosql"
 )
 
 type RegionService struct {}
 
-func switchRegion(info *cache.RegionInfo) *pb.RegionInfo {
+func switchRegion(region *cache.RegionInfo) *pb.RegionInfo {
+	info := region.Clone()
 	tmp := new(pb.RegionInfo)
 	tmp.Uid = info.UID
 	tmp.Id = info.ID
@@ -41,6 +43,10 @@ func (mine *RegionService)AddOne(ctx context.Context, in *pb.ReqRegionAdd, out *
 		out.Status = outError(path,"the name is empty ", pbstatus.ResultStatus_Empty)
 		return nil
 	}
+	if _, er := nosql.ParseGeoPoint(in.Location); er != nil {
+		out.Status = outError(path,er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
 	scene := cache.Context().GetScene(in.Scene)
 	if scene == nil {
 		out.Status = outError(path,"not found the scene ", pbstatus.ResultStatus_NotExisted)
@@ -52,7 +58,7 @@ func (mine *RegionService)AddOne(ctx context.Context, in *pb.ReqRegionAdd, out *
 		return nil
 	}
 
-	region, err := scene.CreateRegion(in)
+	region, err := scene.CreateRegion(ctx, in)
 	if err != nil {
 		out.Status = outError(path,err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -115,7 +121,7 @@ func (mine *RegionService)RemoveOne(ctx context.Context, in *pb.RequestInfo, out
 		out.Status = outError(path,er.Error(), pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	err := info.Remove(in.Operator)
+	err := info.Remove(ctx, in.Operator)
 	if err != nil {
 		out.Status = outError(path,err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -133,18 +139,68 @@ func (mine *RegionService)GetList(ctx context.Context, in *pb.RequestFilter, out
 		out.Status = outError(path,"not found the scene ", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
+	pager,er := readPager(ctx, in.Page, in.Number)
+	if er != nil {
+		out.Status = outError(path,er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
 	var total uint32
 	var max uint32
 	var list []*cache.RegionInfo
 	if in.Key == "" {
-		total,max,list = scene.GetRegions(in.Number, in.Page)
-		out.List = make([]*pb.RegionInfo, 0, len(list))
-		for _, value := range list {
-			out.List = append(out.List, switchRegion(value))
+		total,max,list = scene.GetRegions(pager)
+		writePager(ctx, pager)
+	}else if in.Key == "query" {
+		//value为组合条件的json
+		query,er := cache.ParseFilter(nosql.TableRegion, in.Value)
+		if er == nil {
+			total,max,list,er = scene.QueryRegions(query, pager)
+		}
+		if er != nil {
+			out.Status = outError(path,er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		writePager(ctx, pager)
+	}else if in.Key == cache.GeoModeNear || in.Key == cache.GeoModeBox || in.Key == cache.GeoModePolygon {
+		//value为位置条件的json，附近查询按照距离排序，只能使用页码分页
+		query,er := cache.ParseGeoQuery(in.Key, in.Value)
+		if er == nil {
+			total,max,list,er = scene.GeoRegions(query, pager)
+		}
+		if er != nil {
+			out.Status = outError(path,er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		writePager(ctx, pager)
+	}else if in.Key == "tree" {
+		//先序遍历整个区域树，上级在下级的前面
+		list = make([]*cache.RegionInfo, 0, 20)
+		for _, node := range scene.GetRegionTree() {
+			list = append(list, node.Flatten()...)
 		}
+		total = uint32(len(list))
+	}else if in.Key == "ancestors" || in.Key == "descendants" || in.Key == "children" {
+		//value为区域uid
+		info,er := scene.GetRegion(in.Value)
+		if er != nil {
+			out.Status = outError(path,er.Error(), pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		if in.Key == "ancestors" {
+			list = info.Ancestors()
+		}else if in.Key == "descendants" {
+			list = info.Descendants()
+		}else{
+			list = info.Children()
+		}
+		total = uint32(len(list))
+	}
+	out.List = make([]*pb.RegionInfo, 0, len(list))
+	for _, value := range list {
+		out.List = append(out.List, switchRegion(value))
 	}
 
-	out.PageNow = in.Page
+	out.PageNow = pager.Page
 	out.Total = total
 	out.PageMax = max
 	out.Status = outLog(path, fmt.Sprintf("the length = %d", len(out.List)))
@@ -171,11 +227,11 @@ func (mine *RegionService) UpdateBase (ctx context.Context, in *pb.ReqRegionUpda
 			out.Status = outError(path,"not found the scene ", pbstatus.ResultStatus_NotExisted)
 			return nil
 		}
-		if in.Name != info.Name && scene.HadRegionByName(in.Name) {
+		if in.Name != info.Clone().Name && scene.HadRegionByName(in.Name) {
 			out.Status = outError(path,"the department name repeated ", pbstatus.ResultStatus_Repeated)
 			return nil
 		}
-		err = info.UpdateBase(in.Name, in.Remark, in.Operator)
+		err = info.UpdateBase(ctx, in.Name, in.Remark, in.Operator)
 	}
 	if err != nil {
 		out.Status = outError(path,err.Error(), pbstatus.ResultStatus_DBException)
@@ -193,12 +249,19 @@ func (mine *RegionService) UpdateByFilter(ctx context.Context, in *pb.ReqUpdateF
 		out.Status = outError(path,"the uid is empty ", pbstatus.ResultStatus_Empty)
 		return nil
 	}
-	_,er := cache.Context().GetRegion(in.Uid)
+	info,er := cache.Context().GetRegion(in.Uid)
 	if er != nil {
 		out.Status = outError(path,er.Error(), pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
 	var err error
+	if in.Key == "parent" {
+		//value为新的上级，为空时移动到根节点
+		err = info.UpdateParent(ctx, in.Value, in.Operator)
+	}else{
+		out.Status = outError(path,"the key not defined", pbstatus.ResultStatus_Empty)
+		return nil
+	}
 	if err != nil {
 		out.Status = outError(path,err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -221,14 +284,18 @@ func (mine *RegionService) UpdateAddress (ctx context.Context, in *pb.RequestAdd
 		return nil
 	}
 	var err error
-	if in.Location != info.Location {
-		err = info.UpdateLocation(in.Location, in.Operator)
+	if in.Location != info.Clone().Location {
+		if _, er := nosql.ParseGeoPoint(in.Location); er != nil {
+			out.Status = outError(path,er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		err = info.UpdateLocation(ctx, in.Location, in.Operator)
 		if err != nil {
 			out.Status = outError(path,err.Error(), pbstatus.ResultStatus_DBException)
 			return nil
 		}
 	}
-	err = info.UpdateAddress(in.Country, in.Province, in.City, in.Zone, in.Operator)
+	err = info.UpdateAddress(ctx, in.Country, in.Province, in.City, in.Zone, in.Operator)
 	if err != nil {
 		out.Status = outError(path,err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -251,13 +318,13 @@ func (mine *RegionService) AppendMember (ctx context.Context, in *pb.RequestInfo
 		return nil
 	}
 
-	err := info.AppendMember(in.Uid)
+	err := info.AppendMember(ctx, in.Uid)
 	if err != nil {
 		out.Status = outError(path,err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
 	}
 	out.Uid = in.Uid
-	out.List = info.Members
+	out.List = info.AllMembers()
 	out.Status = outLog(path, out)
 	return nil
 }
@@ -275,13 +342,13 @@ func (mine *RegionService) SubtractMember (ctx context.Context, in *pb.RequestIn
 		return nil
 	}
 
-	err := info.SubtractMember(in.Uid)
+	err := info.SubtractMember(ctx, in.Uid)
 	if err != nil {
 		out.Status = outError(path,err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
 	}
 	out.Uid = in.Uid
-	out.List = info.Members
+	out.List = info.AllMembers()
 	out.Status = outLog(path, out)
 	return nil
 }
@@ -7,12 +7,14 @@ import (
 	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
 	"omo.msa.organization/cache"
+	"omo.msa.organization/proxy/nosql"
 	"strconv"
 )
 
 type RoomService struct{}
 
-func switchRoom(info *cache.RoomInfo) *pb.RoomInfo {
+func switchRoom(room *cache.RoomInfo) *pb.RoomInfo {
+	info := room.Clone()
 	tmp := new(pb.RoomInfo)
 	tmp.Uid = info.UID
 	tmp.Id = info.ID
@@ -49,7 +51,7 @@ func (mine *RoomService) AddOne(ctx context.Context, in *pb.ReqRoomAdd, out *pb.
 		return nil
 	}
 
-	Room, err := scene.CreateRoom(in)
+	Room, err := scene.CreateRoom(ctx, in)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -106,7 +108,7 @@ func (mine *RoomService) RemoveOne(ctx context.Context, in *pb.RequestInfo, out
 		out.Status = outError(path, "the uid is empty ", pbstatus.ResultStatus_Empty)
 		return nil
 	}
-	err := cache.Context().RemoveRoom(in.Uid, in.Operator)
+	err := cache.Context().RemoveRoom(ctx, in.Uid, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -119,9 +121,22 @@ func (mine *RoomService) RemoveOne(ctx context.Context, in *pb.RequestInfo, out
 func (mine *RoomService) GetList(ctx context.Context, in *pb.RequestFilter, out *pb.ReplyRoomList) error {
 	path := "room.getList"
 	inLog(path, in)
+	pager, er := readPager(ctx, in.Page, in.Number)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
+	query, er := readQuery(in.Key, in.Value, nosql.TableRoom)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
 	var list []*cache.RoomInfo
 	if in.Scene == "" {
-		if in.Key == "device" {
+		if query != nil {
+			out.Status = outError(path, "the scene is empty ", pbstatus.ResultStatus_Empty)
+			return nil
+		} else if in.Key == "device" {
 			list = cache.Context().GetRoomsByDevice(in.Value)
 		} else if in.Key == "quote" {
 			list = cache.Context().GetRoomsByQuote(in.Value)
@@ -141,7 +156,7 @@ func (mine *RoomService) GetList(ctx context.Context, in *pb.RequestFilter, out
 			out.Status = outError(path, "not found the scene ", pbstatus.ResultStatus_NotExisted)
 			return nil
 		}
-		if in.Key == "" {
+		if in.Key == "" || query != nil {
 			list = scene.GetRooms()
 		} else if in.Key == "product" {
 			tp, er := strconv.ParseUint(in.Value, 10, 32)
@@ -166,6 +181,14 @@ func (mine *RoomService) GetList(ctx context.Context, in *pb.RequestFilter, out
 		}
 	}
 
+	limit := optionalPager(pager, in.Number)
+	total, pages, list, er := cache.QueryList(query, limit, list)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
+	writePager(ctx, limit)
+	writeTotal(ctx, total, pages)
 	out.List = make([]*pb.RoomInfo, 0, len(list))
 	for _, value := range list {
 		out.List = append(out.List, switchRoom(value))
@@ -198,7 +221,7 @@ func (mine *RoomService) UpdateBase(ctx context.Context, in *pb.ReqRoomUpdate, o
 			out.Status = outError(path, "the room name repeated ", pbstatus.ResultStatus_Repeated)
 			return nil
 		}
-		err = info.UpdateBase(in.Name, in.Remark, in.Operator)
+		err = info.UpdateBase(ctx, in.Name, in.Remark, in.Operator)
 	}
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
@@ -226,8 +249,7 @@ func (mine *RoomService) UpdateQuotes(ctx context.Context, in *pb.ReqRoomQuotes,
 		out.Status = outError(path, "the room not found ", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	scene.ClearQuotes(in.Operator, in.List)
-	err := info.UpdateQuotes(in.Operator, in.List)
+	err := scene.UpdateRoomQuotes(ctx, info, in.Operator, in.List)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -255,7 +277,7 @@ func (mine *RoomService) UpdateDisplays(ctx context.Context, in *pb.ReqRoomDispl
 			out.Status = outError(path, "the room not found ", pbstatus.ResultStatus_NotExisted)
 			return nil
 		}
-		err := info.UpdateDisplays(room.Area, in.Operator, room.List)
+		err := info.UpdateDisplays(ctx, room.Area, in.Operator, room.List)
 		if err != nil {
 			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 			return nil
@@ -284,7 +306,7 @@ func (mine *RoomService) UpdateByFilter(ctx context.Context, in *pb.ReqUpdateFil
 		if device == nil {
 			err = errors.New("not found the device that sn = " + in.Uid)
 		} else {
-			err = device.UpdateQuestion(in.Value, in.Operator)
+			err = device.UpdateQuestion(ctx, in.Value, in.Operator)
 		}
 	} else {
 		err = errors.New("not defined the key")
@@ -323,7 +345,7 @@ func (mine *RoomService) AppendDevice(ctx context.Context, in *pb.ReqRoomDevice,
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
 	}
-	err = info.AppendDevice(in.Area, dev.UID, in.Remark, in.Operator, in.Type)
+	err = info.AppendDevice(ctx, in.Area, dev.UID, in.Remark, in.Operator, in.Type)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -355,7 +377,7 @@ func (mine *RoomService) SubtractDevice(ctx context.Context, in *pb.ReqRoomDevic
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
 	}
-	err = area.UpdateDevice("", in.Operator, 0)
+	err = area.UpdateDevice(ctx, "", in.Operator, 0)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -2,17 +2,20 @@ package grpc
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	pb "github.com/xtech-cloud/omo-msp-organization/proto/organization"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
 	"omo.msa.organization/cache"
+	"omo.msa.organization/proxy/nosql"
 	"strconv"
 )
 
 type SceneService struct{}
 
-func switchScene(info *cache.SceneInfo) *pb.SceneInfo {
+func switchScene(scene *cache.SceneInfo) *pb.SceneInfo {
+	info := scene.Clone()
 	tmp := new(pb.SceneInfo)
 	tmp.Uid = info.UID
 	tmp.Id = info.ID
@@ -50,6 +53,10 @@ func (mine *SceneService) AddOne(ctx context.Context, in *pb.ReqSceneAdd, out *p
 		out.Status = outError(path, "the name is empty ", pbstatus.ResultStatus_Empty)
 		return nil
 	}
+	if _, er := nosql.ParseGeoPoint(in.Location); er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
 	info := new(cache.SceneInfo)
 	info.Name = in.Name
 	info.Remark = in.Remark
@@ -60,7 +67,7 @@ func (mine *SceneService) AddOne(ctx context.Context, in *pb.ReqSceneAdd, out *p
 	info.Entity = in.Entity
 	info.Creator = in.Operator
 	info.ShortName = ""
-	err := cache.Context().CreateScene(info)
+	err := cache.Context().CreateScene(ctx, info)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -111,7 +118,14 @@ func (mine *SceneService) RemoveOne(ctx context.Context, in *pb.RequestInfo, out
 		out.Status = outError(path, "the uid is empty ", pbstatus.ResultStatus_Empty)
 		return nil
 	}
-	err := cache.RemoveScene(in.Uid, in.Operator)
+	//flag为删除模式，0只删除场景，1严格，2级联，3解绑设备；预览依赖使用GetStatistic的depends
+	mode := cache.SceneRemoveMode(in.Flag)
+	depends, err := cache.RemoveSceneBy(ctx, in.Uid, in.Operator, mode)
+	if errors.Is(err, cache.ErrSceneDepends) {
+		bytes, _ := json.Marshal(depends)
+		out.Status = outError(path, string(bytes), pbstatus.ResultStatus_Prohibition)
+		return nil
+	}
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -137,20 +151,26 @@ func (mine *SceneService) IsMasterUsed(ctx context.Context, in *pb.RequestInfo,
 func (mine *SceneService) GetList(ctx context.Context, in *pb.RequestPage, out *pb.ReplySceneList) error {
 	path := "scene.getList"
 	inLog(path, in)
+	pager, er := readPager(ctx, in.Page, in.Number)
+	if er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
 	var total uint32 = 0
 	var max uint32 = 0
 	var list []*cache.SceneInfo
 	if len(in.Parent) < 1 {
-		total, max, list = cache.Context().GetScenes(in.Page, in.Number)
+		total, max, list = cache.Context().GetScenes(pager)
 	} else {
-		total, max, list = cache.Context().GetScenesByParent(in.Parent, in.Page, in.Number)
+		total, max, list = cache.Context().GetScenesByParent(in.Parent, pager)
 	}
 
 	out.List = make([]*pb.SceneInfo, 0, len(list))
 	for _, value := range list {
 		out.List = append(out.List, switchScene(value))
 	}
-	out.PageNow = in.Page
+	writePager(ctx, pager)
+	out.PageNow = pager.Page
 	out.Total = total
 	out.PageMax = max
 	out.Status = outLog(path, fmt.Sprintf("the length = %d", len(out.List)))
@@ -163,7 +183,42 @@ func (mine *SceneService) GetByFilter(ctx context.Context, in *pb.RequestFilter,
 	var total uint32 = 0
 	var max uint32 = 0
 	var list []*cache.SceneInfo
-	if in.Key == "shortname" {
+	pageNow := in.Page
+	if in.Key == "query" {
+		//value为组合条件的json
+		pager, er := readPager(ctx, in.Page, in.Number)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		query, er := cache.ParseFilter(nosql.TableScene, in.Value)
+		if er == nil {
+			total, max, list, er = cache.Context().QueryScenes(query, pager)
+		}
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		writePager(ctx, pager)
+		pageNow = pager.Page
+	} else if in.Key == cache.GeoModeNear || in.Key == cache.GeoModeBox || in.Key == cache.GeoModePolygon {
+		//value为位置条件的json，附近查询按照距离排序，只能使用页码分页
+		pager, er := readPager(ctx, in.Page, in.Number)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		query, er := cache.ParseGeoQuery(in.Key, in.Value)
+		if er == nil {
+			total, max, list, er = cache.Context().GeoScenes(query, pager)
+		}
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		writePager(ctx, pager)
+		pageNow = pager.Page
+	} else if in.Key == "shortname" {
 		list = make([]*cache.SceneInfo, 0, 1)
 	} else if in.Key == "type" {
 		tp, er := strconv.ParseUint(in.Scene, 10, 32)
@@ -173,7 +228,7 @@ func (mine *SceneService) GetByFilter(ctx context.Context, in *pb.RequestFilter,
 		}
 		list = cache.Context().GetScenesByType(uint8(tp))
 	} else if in.Key == "parent" {
-		total, max, list = cache.Context().GetScenesByParent(in.Value, in.Page, in.Number)
+		total, max, list = cache.Context().GetScenesByParent(in.Value, cache.NewPager(in.Page, in.Number))
 	} else if in.Key == "array" {
 		list = cache.Context().GetScenesByArray(in.List)
 	} else if in.Key == "sn" {
@@ -192,7 +247,7 @@ func (mine *SceneService) GetByFilter(ctx context.Context, in *pb.RequestFilter,
 	for _, value := range list {
 		out.List = append(out.List, switchScene(value))
 	}
-	out.PageNow = in.Page
+	out.PageNow = pageNow
 	out.Total = total
 	out.PageMax = max
 	out.Status = outLog(path, fmt.Sprintf("the length = %d", len(out.List)))
@@ -202,6 +257,18 @@ func (mine *SceneService) GetByFilter(ctx context.Context, in *pb.RequestFilter,
 func (mine *SceneService) GetStatistic(ctx context.Context, in *pb.RequestFilter, out *pb.ReplyStatistic) error {
 	path := "scene.getStatistic"
 	inLog(path, in)
+	if in.Key == "depends" {
+		//value为场景，删除前预览依赖对象，count为数量，owner返回依赖报告的json
+		depends, err := cache.GetSceneDepends(in.Value)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		bytes, _ := json.Marshal(depends)
+		out.Key = in.Key
+		out.Owner = string(bytes)
+		out.Count = uint32(depends.Total())
+	}
 
 	out.Status = outLog(path, out)
 	return nil
@@ -221,16 +288,16 @@ func (mine *SceneService) UpdateBase(ctx context.Context, in *pb.ReqSceneUpdate,
 	}
 	var err error
 	if len(in.Cover) > 0 {
-		err = info.UpdateCover(in.Cover, in.Operator)
+		err = info.UpdateCover(ctx, in.Cover, in.Operator)
 	}
 	if len(in.Master) > 0 {
-		err = info.UpdateMaster(in.Master, in.Operator)
+		err = info.UpdateMaster(ctx, in.Master, in.Operator)
 	}
 	if len(in.Name) > 0 || len(in.Remark) > 0 {
-		err = info.UpdateBase(in.Name, in.Remark, in.Operator)
+		err = info.UpdateBase(ctx, in.Name, in.Remark, in.Operator)
 	}
 	if in.Type > 0 {
-		err = info.UpdateType(in.Operator, uint8(in.Type))
+		err = info.UpdateType(ctx, in.Operator, uint8(in.Type))
 	}
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
@@ -253,7 +320,7 @@ func (mine *SceneService) UpdateAddress(ctx context.Context, in *pb.RequestAddre
 		out.Status = outError(path, "the scene not found ", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	err := info.UpdateAddress(in.Country, in.Province, in.City, in.Zone, in.Operator)
+	err := info.UpdateAddress(ctx, in.Country, in.Province, in.City, in.Zone, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -276,7 +343,11 @@ func (mine *SceneService) UpdateLocation(ctx context.Context, in *pb.RequestFlag
 		out.Status = outError(path, "the scene not found ", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	err := info.UpdateLocation(in.Flag, in.Operator)
+	if _, er := nosql.ParseGeoPoint(in.Flag); er != nil {
+		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+		return nil
+	}
+	err := info.UpdateLocation(ctx, in.Flag, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -299,7 +370,7 @@ func (mine *SceneService) UpdateStatus(ctx context.Context, in *pb.ReqSceneStatu
 		return nil
 	}
 
-	err := info.UpdateStatus(cache.SceneStatus(in.Status), in.Operator)
+	err := info.UpdateStatus(ctx, cache.SceneStatus(in.Status), in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -325,7 +396,7 @@ func (mine *SceneService) UpdateSupporter(ctx context.Context, in *pb.RequestFla
 		return nil
 	}
 
-	err := info.UpdateSupporter(in.Flag, in.Operator)
+	err := info.UpdateSupporter(ctx, in.Flag, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -400,7 +471,7 @@ func (mine *SceneService) UpdateShortName(ctx context.Context, in *pb.RequestFla
 		return nil
 	}
 
-	err := info.UpdateShortName(in.Flag, in.Operator)
+	err := info.UpdateShortName(ctx, in.Flag, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -422,7 +493,7 @@ func (mine *SceneService) AppendMember(ctx context.Context, in *pb.RequestInfo,
 		return nil
 	}
 
-	err := info.AppendMember(in.Uid)
+	err := info.AppendMember(ctx, in.Uid)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -446,7 +517,7 @@ func (mine *SceneService) SubtractMember(ctx context.Context, in *pb.RequestInfo
 		return nil
 	}
 
-	err := info.SubtractMember(in.Uid)
+	err := info.SubtractMember(ctx, in.Uid)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -544,7 +615,7 @@ func (mine *SceneService) UpdateParents(ctx context.Context, in *pb.RequestList,
 		return nil
 	}
 
-	err := info.UpdateParents(in.Operator, in.List)
+	err := info.UpdateParents(ctx, in.Operator, in.List)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -569,12 +640,12 @@ func (mine *SceneService) UpdateByFilter(ctx context.Context, in *pb.ReqUpdateFi
 	}
 	var err error
 	if in.Key == "questions" {
-		err = scene.UpdateQuestions(in.Operator, in.Values)
+		err = scene.UpdateQuestions(ctx, in.Operator, in.Values)
 	} else if in.Key == "limit" {
 		var limit int64
 		limit, err = strconv.ParseInt(in.Value, 10, 32)
 		if err == nil {
-			err = scene.UpdateLimit(in.Operator, int(limit))
+			err = scene.UpdateLimit(ctx, in.Operator, int(limit))
 		}
 	} else {
 		err = errors.New("not defined the key")
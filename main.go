@@ -25,10 +25,21 @@ var (
 
 func main() {
 	config.Setup()
-	err := cache.InitData()
+	err := cache.InitDataRetry(config.Schema.Database.Retry)
 	if err != nil {
-		panic(err)
+		logger.Fatal(err)
+	}
+	done, err := runCommand(os.Args[1:])
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if done {
+		return
 	}
+	cache.CheckRecycles()
+	cache.Supervise()
+	cache.WatchChanges()
+	cache.KeepCacheSnapshot()
 	// New Service
 	service := micro.NewService(
 		micro.Name("omo.msa.organization"),
@@ -36,6 +47,7 @@ func main() {
 		micro.RegisterTTL(time.Second*time.Duration(config.Schema.Service.TTL)),
 		micro.RegisterInterval(time.Second*time.Duration(config.Schema.Service.Interval)),
 		micro.Address(config.Schema.Service.Address),
+		micro.WrapHandler(grpc.AuditWrapper, grpc.GuardWrapper),
 	)
 	// Initialise service
 	service.Init()
@@ -47,6 +59,7 @@ func main() {
 	_ = proto.RegisterRegionServiceHandler(service.Server(), new(grpc.RegionService))
 	_ = proto.RegisterDeviceServiceHandler(service.Server(), new(grpc.DeviceService))
 	_ = proto.RegisterMaintainServiceHandler(service.Server(), new(grpc.MaintainService))
+	_ = service.Server().Handle(service.Server().NewHandler(new(grpc.AdminService)))
 
 	app, _ := filepath.Abs(os.Args[0])
 
@@ -0,0 +1,173 @@
+package memory
+
+import (
+	"context"
+	"omo.msa.organization/proxy"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+func (mine *Storage) CreateArea(ctx context.Context, info *nosql.Area) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.areas.insert(info.UID.Hex(), info)
+}
+
+func (mine *Storage) GetAreaNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableArea)
+}
+
+func (mine *Storage) GetArea(uid string) (*nosql.Area, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.areas.get(uid)
+}
+
+func (mine *Storage) GetAreaByDevice(uid string) (*nosql.Area, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.areas.first(func(db *nosql.Area) bool {
+		return db.Device == uid && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetAreasByOwner(owner string) ([]*nosql.Area, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.areas.filter(func(db *nosql.Area) bool {
+		return db.Scene == owner && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetAreasByTemplate(owner, template string) ([]*nosql.Area, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.areas.filter(func(db *nosql.Area) bool {
+		return db.Scene == owner && db.Template == template && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetAreasByParent(parent string) ([]*nosql.Area, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.areas.filter(func(db *nosql.Area) bool {
+		return db.Parent == parent && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetAreasBy(owner, parent string) ([]*nosql.Area, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.areas.filter(func(db *nosql.Area) bool {
+		return db.Scene == owner && db.Parent == parent && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetAllAreas() ([]*nosql.Area, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.areas.filter(func(db *nosql.Area) bool {
+		return !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) updateArea(ctx context.Context, uid, operator string, fun func(db *nosql.Area)) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.areas.update(ctx, uid, func(db *nosql.Area) {
+		fun(db)
+		db.Operator = operator
+		db.UpdatedTime = time.Now()
+	})
+}
+
+func (mine *Storage) UpdateAreaBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Name = name
+		db.Remark = remark
+	})
+}
+
+func (mine *Storage) UpdateAreaAssets(ctx context.Context, uid, operator string, assets []string) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Assets = append([]string{}, assets...)
+	})
+}
+
+func (mine *Storage) UpdateAreaTemplate(ctx context.Context, uid, template, operator string) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Template = template
+	})
+}
+
+func (mine *Storage) UpdateAreaDevice(ctx context.Context, uid, device, operator string, tp uint32) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Device = device
+		db.Type = tp
+	})
+}
+
+func (mine *Storage) UpdateAreaCatalog(ctx context.Context, uid, catalog, operator string) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Catalog = catalog
+	})
+}
+
+func (mine *Storage) UpdateAreaDevice2(ctx context.Context, uid, device, operator string) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Device = device
+	})
+}
+
+func (mine *Storage) UpdateAreaType(ctx context.Context, uid, operator string, tp uint32) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Type = tp
+	})
+}
+
+func (mine *Storage) UpdateAreaQuestion(ctx context.Context, uid, question, operator string) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Question = question
+	})
+}
+
+func (mine *Storage) UpdateAreaLimit(ctx context.Context, uid, operator string, num uint32) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Limit = num
+	})
+}
+
+func (mine *Storage) UpdateAreaDisplays(ctx context.Context, uid, operator string, displays []string) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Displays = append([]string{}, displays...)
+	})
+}
+
+func (mine *Storage) SetAreaModule(ctx context.Context, uid, operator, key, value string) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Modules = setPair(db.Modules, key, value)
+	})
+}
+
+func (mine *Storage) SetAreaSource(ctx context.Context, uid, operator, key, value string) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.Sources = setPair(db.Sources, key, value)
+	})
+}
+
+func (mine *Storage) RemoveArea(ctx context.Context, uid, operator string) error {
+	return mine.updateArea(ctx, uid, operator, func(db *nosql.Area) {
+		db.DeleteTime = time.Now()
+	})
+}
+
+// setPair 修改key对应的值，不存在时追加
+func setPair(list []*proxy.PairInfo, key, value string) []*proxy.PairInfo {
+	for _, item := range list {
+		if item.Key == key {
+			item.Value = value
+			return list
+		}
+	}
+	return append(list, &proxy.PairInfo{Key: key, Value: value})
+}
@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"errors"
+	"omo.msa.organization/proxy/nosql"
+)
+
+func (mine *Storage) CreateAudit(info *nosql.Audit) error {
+	if info == nil {
+		return errors.New("the audit is nil")
+	}
+	tmp, err := clone(info)
+	if err != nil {
+		return err
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	mine.audits = append(mine.audits, tmp)
+	return nil
+}
+
+// GetAudits 按照时间倒序
+func (mine *Storage) GetAudits(filter *nosql.AuditFilter) ([]*nosql.Audit, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	list := make([]*nosql.Audit, 0, 20)
+	for i := len(mine.audits) - 1; i >= 0; i-- {
+		if !filter.Match(mine.audits[i]) {
+			continue
+		}
+		tmp, err := clone(mine.audits[i])
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, tmp)
+		if filter.Limit > 0 && int64(len(list)) >= filter.Limit {
+			break
+		}
+	}
+	return list, nil
+}
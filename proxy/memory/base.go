@@ -0,0 +1,306 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"omo.msa.organization/proxy/nosql"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/**
+内存存储，不依赖数据库，主要用于单元测试以及本地演示
+*/
+
+var ErrNotFound = errors.New("not found the document")
+
+var _ nosql.Storage = (*Storage)(nil)
+
+type table[T any] struct {
+	name  string
+	keys  []string
+	items map[string]*T
+}
+
+type Storage struct {
+	lock      sync.RWMutex
+	scenes    *table[nosql.Scene]
+	groups    *table[nosql.Group]
+	rooms     *table[nosql.Room]
+	regions   *table[nosql.Region]
+	areas     *table[nosql.Area]
+	devices   *table[nosql.Invite]
+	maintains *table[nosql.Maintain]
+	sequences map[string]uint64
+	audits    []*nosql.Audit
+	revisions []*nosql.Revision
+}
+
+func NewStorage() *Storage {
+	tmp := new(Storage)
+	tmp.scenes = newTable[nosql.Scene](nosql.TableScene)
+	tmp.groups = newTable[nosql.Group](nosql.TableGroup)
+	tmp.rooms = newTable[nosql.Room](nosql.TableRoom)
+	tmp.regions = newTable[nosql.Region](nosql.TableRegion)
+	tmp.areas = newTable[nosql.Area](nosql.TableArea)
+	tmp.devices = newTable[nosql.Invite](nosql.TableDevice)
+	tmp.maintains = newTable[nosql.Maintain](nosql.TableMaintain)
+	tmp.sequences = make(map[string]uint64, 10)
+	tmp.audits = make([]*nosql.Audit, 0, 100)
+	tmp.revisions = make([]*nosql.Revision, 0, 100)
+	return tmp
+}
+
+// Ping 内存存储一直可用
+func (mine *Storage) Ping() error {
+	return nil
+}
+
+func newTable[T any](name string) *table[T] {
+	return &table[T]{name: name, keys: make([]string, 0, 50), items: make(map[string]*T, 50)}
+}
+
+func (mine *table[T]) insert(uid string, info *T) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	if _, ok := mine.items[uid]; ok {
+		return errors.New("the document had existed of " + uid)
+	}
+	tmp, err := clone(info)
+	if err != nil {
+		return err
+	}
+	mine.keys = append(mine.keys, uid)
+	mine.items[uid] = tmp
+	return nil
+}
+
+func (mine *table[T]) get(uid string) (*T, error) {
+	info, ok := mine.items[uid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(info)
+}
+
+func (mine *table[T]) first(fun func(*T) bool) (*T, error) {
+	for _, key := range mine.keys {
+		if fun(mine.items[key]) {
+			return clone(mine.items[key])
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (mine *table[T]) filter(fun func(*T) bool) ([]*T, error) {
+	list := make([]*T, 0, 20)
+	for _, key := range mine.keys {
+		if fun(mine.items[key]) {
+			tmp, err := clone(mine.items[key])
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, tmp)
+		}
+	}
+	return list, nil
+}
+
+func (mine *table[T]) count() int64 {
+	return int64(len(mine.keys))
+}
+
+// update 请求期望这个文档的版本时先比较，和mongo的条件更新一致
+func (mine *table[T]) update(ctx context.Context, uid string, fun func(*T)) error {
+	info, ok := mine.items[uid]
+	if !ok {
+		return ErrNotFound
+	}
+	exp := nosql.ExpectOf(ctx, mine.name, uid)
+	if exp != nil {
+		current, _ := mine.version(uid)
+		if err := exp.Check(current); err != nil {
+			return err
+		}
+	}
+	fun(info)
+	bumpVersion(info)
+	if exp != nil {
+		exp.Advance()
+	}
+	mine.after(ctx, uid, info)
+	return nil
+}
+
+// after 请求写入后的文档时在同一个锁中复制
+func (mine *table[T]) after(ctx context.Context, uid string, info *T) {
+	afters := nosql.AftersOf(ctx)
+	if afters == nil {
+		return
+	}
+	tmp, err := clone(info)
+	if err == nil {
+		afters.Set(mine.name, uid, tmp)
+	}
+}
+
+// versionField 模型中的Version字段，没有时返回无效值
+func versionField(info interface{}) reflect.Value {
+	value := reflect.ValueOf(info)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	return value.Elem().FieldByName("Version")
+}
+
+// bumpVersion 和mongo的$inc一致，每次修改加1
+func bumpVersion(info interface{}) {
+	field := versionField(info)
+	if field.IsValid() && field.Kind() == reflect.Uint32 {
+		field.SetUint(field.Uint() + 1)
+	}
+}
+
+func (mine *table[T]) delete(uid string) error {
+	if _, ok := mine.items[uid]; !ok {
+		return ErrNotFound
+	}
+	delete(mine.items, uid)
+	for i, key := range mine.keys {
+		if key == uid {
+			mine.keys = append(mine.keys[:i], mine.keys[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// updateAll 批量修改，不存在的文档直接忽略
+func updateAll[T any](t *table[T], list []string, fun func(*T)) {
+	for _, uid := range list {
+		_ = t.update(context.Background(), uid, fun)
+	}
+}
+
+// clone 通过bson编解码复制一份，和从数据库读取的效果一致，避免共享切片
+func clone[T any](info *T) (*T, error) {
+	bytes, err := bson.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	tmp := new(T)
+	err = bson.Unmarshal(bytes, tmp)
+	if err != nil {
+		return nil, err
+	}
+	return tmp, nil
+}
+
+func removeItem(array []string, item string) []string {
+	list := make([]string, 0, len(array))
+	for _, s := range array {
+		if s != item {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// appendItems 和$addToSet一致，已经存在的元素不重复添加
+func appendItems(array []string, items []string) []string {
+	list := append(make([]string, 0, len(array)+len(items)), array...)
+	for _, item := range items {
+		had := false
+		for _, s := range list {
+			if s == item {
+				had = true
+				break
+			}
+		}
+		if !had {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// removeItems 和$pull一致
+func removeItems(array []string, items []string) []string {
+	list := make([]string, 0, len(array))
+	for _, s := range array {
+		had := false
+		for _, item := range items {
+			if s == item {
+				had = true
+				break
+			}
+		}
+		if !had {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func (mine *Storage) GetSequenceNext(name string) (uint64, error) {
+	return mine.GetSequenceBlock(name, 1)
+}
+
+func (mine *Storage) GetSequenceBlock(name string, num uint64) (uint64, error) {
+	if num < 1 {
+		return 0, errors.New("the sequence number is zero")
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	mine.sequences[name] += num
+	return mine.sequences[name] - num + 1, nil
+}
+
+func (mine *Storage) RepairSequences() ([]*nosql.SequenceRepair, error) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	ids := map[string]uint64{
+		nosql.TableScene:    maxID(mine.scenes, func(t *nosql.Scene) uint64 { return t.ID }),
+		nosql.TableGroup:    maxID(mine.groups, func(t *nosql.Group) uint64 { return t.ID }),
+		nosql.TableRoom:     maxID(mine.rooms, func(t *nosql.Room) uint64 { return t.ID }),
+		nosql.TableRegion:   maxID(mine.regions, func(t *nosql.Region) uint64 { return t.ID }),
+		nosql.TableArea:     maxID(mine.areas, func(t *nosql.Area) uint64 { return t.ID }),
+		nosql.TableDevice:   maxID(mine.devices, func(t *nosql.Invite) uint64 { return t.ID }),
+		nosql.TableMaintain: maxID(mine.maintains, func(t *nosql.Maintain) uint64 { return t.ID }),
+	}
+	list := make([]*nosql.SequenceRepair, 0, 2)
+	for _, name := range nosql.SequenceTables() {
+		if mine.sequences[name] < ids[name] {
+			list = append(list, &nosql.SequenceRepair{Name: name, Count: mine.sequences[name], Max: ids[name]})
+			mine.sequences[name] = ids[name]
+		}
+	}
+	return list, nil
+}
+
+func maxID[T any](t *table[T], fun func(*T) uint64) uint64 {
+	var num uint64
+	for _, info := range t.items {
+		if id := fun(info); id > num {
+			num = id
+		}
+	}
+	return num
+}
+
+func (mine *Storage) GetSequenceCount(name string) (uint64, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	num, ok := mine.sequences[name]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return num, nil
+}
+
+func isDeleted(t time.Time) bool {
+	return !t.IsZero()
+}
@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+type stampDoc struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	UpdatedTime time.Time          `bson:"updatedAt"`
+	DeleteTime  time.Time          `bson:"deleteAt"`
+}
+
+func (mine *Storage) GetChangedSince(table string, stamp time.Time) ([]string, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	switch table {
+	case nosql.TableScene:
+		return changedSince(mine.scenes, stamp)
+	case nosql.TableGroup:
+		return changedSince(mine.groups, stamp)
+	case nosql.TableRoom:
+		return changedSince(mine.rooms, stamp)
+	case nosql.TableRegion:
+		return changedSince(mine.regions, stamp)
+	case nosql.TableArea:
+		return changedSince(mine.areas, stamp)
+	case nosql.TableDevice:
+		return changedSince(mine.devices, stamp)
+	case nosql.TableMaintain:
+		return changedSince(mine.maintains, stamp)
+	}
+	return nil, errors.New("the table not support of " + table)
+}
+
+func changedSince[T any](t *table[T], stamp time.Time) ([]string, error) {
+	list := make([]string, 0, 10)
+	for _, key := range t.keys {
+		bytes, err := bson.Marshal(t.items[key])
+		if err != nil {
+			return nil, err
+		}
+		doc := new(stampDoc)
+		err = bson.Unmarshal(bytes, doc)
+		if err != nil {
+			return nil, err
+		}
+		if doc.UpdatedTime.After(stamp) || doc.DeleteTime.After(stamp) {
+			list = append(list, key)
+		}
+	}
+	return list, nil
+}
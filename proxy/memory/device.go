@@ -0,0 +1,159 @@
+package memory
+
+import (
+	"context"
+	"omo.msa.organization/proxy"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+func (mine *Storage) CreateDevice(ctx context.Context, info *nosql.Invite) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.devices.insert(info.UID.Hex(), info)
+}
+
+func (mine *Storage) GetDeviceNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableDevice)
+}
+
+func (mine *Storage) GetDeviceCount() int64 {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.devices.count()
+}
+
+func (mine *Storage) GetDeviceBySN(sn string) (*nosql.Invite, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.devices.first(func(db *nosql.Invite) bool {
+		return db.SN == sn
+	})
+}
+
+func (mine *Storage) GetDevice(uid string) (*nosql.Invite, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.devices.get(uid)
+}
+
+func (mine *Storage) GetDeviceByID(id uint64) (*nosql.Invite, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.devices.first(func(db *nosql.Invite) bool {
+		return db.ID == id
+	})
+}
+
+func (mine *Storage) RemoveDevice(ctx context.Context, uid, operator string) error {
+	return mine.updateDevice(ctx, uid, operator, func(db *nosql.Invite) {
+		db.DeleteTime = time.Now()
+	})
+}
+
+func (mine *Storage) GetAllDevices() ([]*nosql.Invite, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.devices.filter(func(db *nosql.Invite) bool {
+		return !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetAllDevicesExcept(st uint8) ([]*nosql.Invite, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.devices.filter(func(db *nosql.Invite) bool {
+		return db.Status != st && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetDevicesByScene(scene string) ([]*nosql.Invite, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.devices.filter(func(db *nosql.Invite) bool {
+		return db.Scene == scene && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetDevicesByStatus(st uint8) ([]*nosql.Invite, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.devices.filter(func(db *nosql.Invite) bool {
+		return db.Status == st && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) updateDevice(ctx context.Context, uid, operator string, fun func(db *nosql.Invite)) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.devices.update(ctx, uid, func(db *nosql.Invite) {
+		fun(db)
+		db.Operator = operator
+		db.UpdatedTime = time.Now()
+	})
+}
+
+func (mine *Storage) UpdateDeviceBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateDevice(ctx, uid, operator, func(db *nosql.Invite) {
+		db.Name = name
+		db.Remark = remark
+	})
+}
+
+func (mine *Storage) UpdateDeviceTime(ctx context.Context, uid, operator string, act, expiry uint64) error {
+	return mine.updateDevice(ctx, uid, operator, func(db *nosql.Invite) {
+		db.ActiveTime = int64(act)
+		db.ExpiryTime = uint32(expiry)
+	})
+}
+
+func (mine *Storage) UpdateDeviceCertificate(ctx context.Context, uid, data, operator string) error {
+	return mine.updateDevice(ctx, uid, operator, func(db *nosql.Invite) {
+		db.Certificate = data
+	})
+}
+
+func (mine *Storage) UpdateDeviceScene(ctx context.Context, uid, data, operator string) error {
+	return mine.updateDevice(ctx, uid, operator, func(db *nosql.Invite) {
+		db.Scene = data
+	})
+}
+
+func (mine *Storage) UpdateDeviceAspect(ctx context.Context, uid, data, operator string) error {
+	return mine.updateDevice(ctx, uid, operator, func(db *nosql.Invite) {
+		db.Aspect = data
+	})
+}
+
+func (mine *Storage) BindDevice(ctx context.Context, uid, quote, os, operator string, act, expiry uint64) error {
+	return mine.updateDevice(ctx, uid, operator, func(db *nosql.Invite) {
+		db.Quote = quote
+		db.OS = os
+		db.ActiveTime = int64(act)
+		db.ExpiryTime = uint32(expiry)
+	})
+}
+
+func (mine *Storage) UpdateDeviceStatus(ctx context.Context, uid, operator string, st uint8) error {
+	return mine.updateDevice(ctx, uid, operator, func(db *nosql.Invite) {
+		db.Status = st
+	})
+}
+
+func (mine *Storage) UpdateDeviceMeta(ctx context.Context, uid, meta, operator string) error {
+	return mine.updateDevice(ctx, uid, operator, func(db *nosql.Invite) {
+		db.Meta = meta
+	})
+}
+
+func (mine *Storage) UpdateDeviceAuto(ctx context.Context, uid, operator string, auto proxy.AutoInfo) error {
+	return mine.updateDevice(ctx, uid, operator, func(db *nosql.Invite) {
+		db.Auto = auto
+	})
+}
+
+func (mine *Storage) UpdateDeviceType(ctx context.Context, uid, operator string, tp uint8) error {
+	return mine.updateDevice(ctx, uid, operator, func(db *nosql.Invite) {
+		db.Type = tp
+	})
+}
@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+func (mine *Storage) CreateGroup(ctx context.Context, info *nosql.Group) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.groups.insert(info.UID.Hex(), info)
+}
+
+func (mine *Storage) GetGroupNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableGroup)
+}
+
+func (mine *Storage) GetGroupCount() int64 {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.groups.count()
+}
+
+func (mine *Storage) GetGroup(uid string) (*nosql.Group, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.groups.get(uid)
+}
+
+func (mine *Storage) GetGroupByID(id uint64) (*nosql.Group, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.groups.first(func(db *nosql.Group) bool {
+		return db.ID == id
+	})
+}
+
+func (mine *Storage) RemoveGroup(ctx context.Context, uid, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, func(db *nosql.Group) {
+		db.DeleteTime = time.Now()
+	})
+}
+
+func (mine *Storage) GetAllGroups() ([]*nosql.Group, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.groups.filter(func(db *nosql.Group) bool {
+		return !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetGroupsByScene(scene string) ([]*nosql.Group, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.groups.filter(func(db *nosql.Group) bool {
+		return db.Scene == scene && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) updateGroup(ctx context.Context, uid, operator string, fun func(db *nosql.Group)) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.groups.update(ctx, uid, func(db *nosql.Group) {
+		fun(db)
+		db.Operator = operator
+		db.UpdatedTime = time.Now()
+	})
+}
+
+func (mine *Storage) UpdateGroupBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, func(db *nosql.Group) {
+		db.Name = name
+		db.Remark = remark
+	})
+}
+
+func (mine *Storage) UpdateGroupCover(ctx context.Context, uid, cover, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, func(db *nosql.Group) {
+		db.Cover = cover
+	})
+}
+
+func (mine *Storage) UpdateGroupMembers(ctx context.Context, uid, operator string, members []string) error {
+	return mine.updateGroup(ctx, uid, operator, func(db *nosql.Group) {
+		db.Members = append([]string{}, members...)
+	})
+}
+
+func (mine *Storage) UpdateGroupAddress(ctx context.Context, uid, operator string, address nosql.AddressInfo) error {
+	return mine.updateGroup(ctx, uid, operator, func(db *nosql.Group) {
+		db.Address = address
+	})
+}
+
+func (mine *Storage) UpdateGroupLocation(ctx context.Context, uid, location, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, func(db *nosql.Group) {
+		db.Location = location
+		db.Geo, _ = nosql.ParseGeoPoint(location)
+	})
+}
+
+func (mine *Storage) UpdateGroupContact(ctx context.Context, uid, phone, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, func(db *nosql.Group) {
+		db.Contact = phone
+	})
+}
+
+func (mine *Storage) UpdateGroupMaster(ctx context.Context, uid, member, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, func(db *nosql.Group) {
+		db.Master = member
+	})
+}
+
+func (mine *Storage) UpdateGroupAssistant(ctx context.Context, uid, member, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, func(db *nosql.Group) {
+		db.Assistant = member
+	})
+}
+
+func (mine *Storage) AppendGroupMember(ctx context.Context, uid, member string) error {
+	if len(member) < 1 {
+		return errors.New("the member uid is empty")
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.groups.update(ctx, uid, func(db *nosql.Group) {
+		db.Members = append(db.Members, member)
+		db.UpdatedTime = time.Now()
+	})
+}
+
+func (mine *Storage) SubtractGroupMember(ctx context.Context, uid string, member string) error {
+	if len(member) < 1 {
+		return errors.New("the member uid is empty")
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.groups.update(ctx, uid, func(db *nosql.Group) {
+		db.Members = removeItem(db.Members, member)
+		db.UpdatedTime = time.Now()
+	})
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+func (mine *Storage) CreateMaintain(ctx context.Context, info *nosql.Maintain) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.maintains.insert(info.UID.Hex(), info)
+}
+
+func (mine *Storage) GetMaintainNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableMaintain)
+}
+
+func (mine *Storage) RemoveMaintain(ctx context.Context, uid, operator string) error {
+	if len(uid) < 2 {
+		return errors.New("db Maintain uid is empty ")
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.maintains.update(ctx, uid, func(db *nosql.Maintain) {
+		db.Operator = operator
+		db.DeleteTime = time.Now()
+	})
+}
+
+func (mine *Storage) GetMaintain(uid string) (*nosql.Maintain, error) {
+	if len(uid) < 2 {
+		return nil, errors.New("db Maintain uid is empty of GetMaintain")
+	}
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.maintains.get(uid)
+}
+
+func (mine *Storage) GetMaintainsByOwner(owner string) ([]*nosql.Maintain, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.maintains.filter(func(db *nosql.Maintain) bool {
+		return db.Scene == owner
+	})
+}
+
+func (mine *Storage) GetMaintainsByArea(scene, area string) ([]*nosql.Maintain, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.maintains.filter(func(db *nosql.Maintain) bool {
+		return db.Scene == scene && db.Area == area
+	})
+}
+
+func (mine *Storage) GetMaintainsByFilter(scene string, filter bson.M, sorts bson.D) ([]*nosql.Maintain, error) {
+	list, err := mine.GetMaintainsByOwner(scene)
+	if err != nil {
+		return nil, err
+	}
+	return nosql.FilterModels(list, filter, sorts)
+}
+
+func (mine *Storage) GetMaintainCount() int64 {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.maintains.count()
+}
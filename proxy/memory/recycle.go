@@ -0,0 +1,165 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+type recycleDoc struct {
+	UID               primitive.ObjectID `bson:"_id"`
+	nosql.RecycleInfo `bson:",inline"`
+}
+
+type recycler interface {
+	recycles(name string, fun func(*nosql.RecycleInfo) bool) ([]*nosql.RecycleInfo, error)
+	restore(ctx context.Context, uid, operator string) error
+	purge(uid string) error
+}
+
+// recycleTable 回收站对表的包装，restore负责清除删除时间
+type recycleTable[T any] struct {
+	*table[T]
+	restoreFun func(*T, string)
+}
+
+func (mine *recycleTable[T]) recycles(name string, fun func(*nosql.RecycleInfo) bool) ([]*nosql.RecycleInfo, error) {
+	list := make([]*nosql.RecycleInfo, 0, 10)
+	for _, key := range mine.keys {
+		bytes, err := bson.Marshal(mine.items[key])
+		if err != nil {
+			return nil, err
+		}
+		doc := new(recycleDoc)
+		err = bson.Unmarshal(bytes, doc)
+		if err != nil {
+			return nil, err
+		}
+		if !isDeleted(doc.Deleted) {
+			continue
+		}
+		doc.Table = name
+		doc.RecycleInfo.UID = doc.UID.Hex()
+		if name == nosql.TableScene {
+			doc.Scene = doc.RecycleInfo.UID
+		}
+		if fun(&doc.RecycleInfo) {
+			list = append(list, &doc.RecycleInfo)
+		}
+	}
+	return list, nil
+}
+
+func (mine *recycleTable[T]) restore(ctx context.Context, uid, operator string) error {
+	return mine.update(ctx, uid, func(db *T) {
+		mine.restoreFun(db, operator)
+	})
+}
+
+func (mine *recycleTable[T]) purge(uid string) error {
+	return mine.delete(uid)
+}
+
+func (mine *Storage) recycler(name string) (recycler, error) {
+	switch name {
+	case nosql.TableScene:
+		return &recycleTable[nosql.Scene]{mine.scenes, func(db *nosql.Scene, operator string) {
+			db.DeleteTime = time.Time{}
+			db.Operator = operator
+			db.UpdatedTime = time.Now()
+		}}, nil
+	case nosql.TableGroup:
+		return &recycleTable[nosql.Group]{mine.groups, func(db *nosql.Group, operator string) {
+			db.DeleteTime = time.Time{}
+			db.Operator = operator
+			db.UpdatedTime = time.Now()
+		}}, nil
+	case nosql.TableRoom:
+		return &recycleTable[nosql.Room]{mine.rooms, func(db *nosql.Room, operator string) {
+			db.DeleteTime = time.Time{}
+			db.Operator = operator
+			db.UpdatedTime = time.Now()
+		}}, nil
+	case nosql.TableRegion:
+		return &recycleTable[nosql.Region]{mine.regions, func(db *nosql.Region, operator string) {
+			db.DeleteTime = time.Time{}
+			db.Operator = operator
+			db.UpdatedTime = time.Now()
+		}}, nil
+	case nosql.TableArea:
+		return &recycleTable[nosql.Area]{mine.areas, func(db *nosql.Area, operator string) {
+			db.DeleteTime = time.Time{}
+			db.Operator = operator
+			db.UpdatedTime = time.Now()
+		}}, nil
+	case nosql.TableDevice:
+		return &recycleTable[nosql.Invite]{mine.devices, func(db *nosql.Invite, operator string) {
+			db.DeleteTime = time.Time{}
+			db.Operator = operator
+			db.UpdatedTime = time.Now()
+		}}, nil
+	case nosql.TableMaintain:
+		return &recycleTable[nosql.Maintain]{mine.maintains, func(db *nosql.Maintain, operator string) {
+			db.DeleteTime = time.Time{}
+			db.Operator = operator
+			db.UpdatedTime = time.Now()
+		}}, nil
+	}
+	return nil, errors.New("the table not support recycle of " + name)
+}
+
+func (mine *Storage) GetRecycles(scene string) ([]*nosql.RecycleInfo, error) {
+	if len(scene) < 1 {
+		return nil, errors.New("the scene uid is empty")
+	}
+	return mine.findRecycles(func(info *nosql.RecycleInfo) bool {
+		return info.Scene == scene
+	})
+}
+
+func (mine *Storage) GetRecyclesBefore(stamp time.Time) ([]*nosql.RecycleInfo, error) {
+	return mine.findRecycles(func(info *nosql.RecycleInfo) bool {
+		return info.Deleted.Before(stamp)
+	})
+}
+
+func (mine *Storage) findRecycles(fun func(*nosql.RecycleInfo) bool) ([]*nosql.RecycleInfo, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	list := make([]*nosql.RecycleInfo, 0, 20)
+	for _, name := range nosql.RecycleTables() {
+		t, err := mine.recycler(name)
+		if err != nil {
+			return nil, err
+		}
+		arr, err := t.recycles(name, fun)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, arr...)
+	}
+	return list, nil
+}
+
+func (mine *Storage) RestoreRecycle(ctx context.Context, table, uid, operator string) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	t, err := mine.recycler(table)
+	if err != nil {
+		return err
+	}
+	return t.restore(ctx, uid, operator)
+}
+
+func (mine *Storage) PurgeRecycle(ctx context.Context, table, uid string) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	t, err := mine.recycler(table)
+	if err != nil {
+		return err
+	}
+	return t.purge(uid)
+}
@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+func (mine *Storage) CreateRegion(ctx context.Context, info *nosql.Region) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.regions.insert(info.UID.Hex(), info)
+}
+
+func (mine *Storage) GetRegionNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableRegion)
+}
+
+func (mine *Storage) GetRegionCount() int64 {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.regions.count()
+}
+
+func (mine *Storage) GetRegion(uid string) (*nosql.Region, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.regions.get(uid)
+}
+
+func (mine *Storage) GetRegionByID(id uint64) (*nosql.Region, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.regions.first(func(db *nosql.Region) bool {
+		return db.ID == id
+	})
+}
+
+func (mine *Storage) RemoveRegion(ctx context.Context, uid, operator string) error {
+	return mine.updateRegion(ctx, uid, operator, func(db *nosql.Region) {
+		db.DeleteTime = time.Now()
+	})
+}
+
+func (mine *Storage) GetAllRegions() ([]*nosql.Region, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.regions.filter(func(db *nosql.Region) bool {
+		return !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetRegionsByScene(scene string) ([]*nosql.Region, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.regions.filter(func(db *nosql.Region) bool {
+		return db.Scene == scene && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetRegionsByParent(parent string) ([]*nosql.Region, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.regions.filter(func(db *nosql.Region) bool {
+		return db.Parent == parent && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) updateRegion(ctx context.Context, uid, operator string, fun func(db *nosql.Region)) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.regions.update(ctx, uid, func(db *nosql.Region) {
+		fun(db)
+		db.Operator = operator
+		db.UpdatedTime = time.Now()
+	})
+}
+
+func (mine *Storage) UpdateRegionBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateRegion(ctx, uid, operator, func(db *nosql.Region) {
+		db.Name = name
+		db.Remark = remark
+	})
+}
+
+func (mine *Storage) UpdateRegionMaster(ctx context.Context, uid, master, operator string) error {
+	return mine.updateRegion(ctx, uid, operator, func(db *nosql.Region) {
+		db.Master = master
+	})
+}
+
+func (mine *Storage) UpdateRegionEntity(ctx context.Context, uid, entity, operator string) error {
+	return mine.updateRegion(ctx, uid, operator, func(db *nosql.Region) {
+		db.Entity = entity
+	})
+}
+
+func (mine *Storage) UpdateRegionParent(ctx context.Context, uid, parent, operator string) error {
+	return mine.updateRegion(ctx, uid, operator, func(db *nosql.Region) {
+		db.Parent = parent
+	})
+}
+
+func (mine *Storage) UpdateRegionAddress(ctx context.Context, uid, operator string, address nosql.AddressInfo) error {
+	return mine.updateRegion(ctx, uid, operator, func(db *nosql.Region) {
+		db.Address = address
+	})
+}
+
+func (mine *Storage) UpdateRegionLocation(ctx context.Context, uid, location, operator string) error {
+	return mine.updateRegion(ctx, uid, operator, func(db *nosql.Region) {
+		db.Location = location
+		db.Geo, _ = nosql.ParseGeoPoint(location)
+	})
+}
+
+func (mine *Storage) AppendRegionMember(ctx context.Context, uid string, member string) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.regions.update(ctx, uid, func(db *nosql.Region) {
+		db.Members = append(db.Members, member)
+		db.UpdatedTime = time.Now()
+	})
+}
+
+func (mine *Storage) SubtractRegionMember(ctx context.Context, uid, member string) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.regions.update(ctx, uid, func(db *nosql.Region) {
+		db.Members = removeItem(db.Members, member)
+		db.UpdatedTime = time.Now()
+	})
+}
@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"errors"
+	"omo.msa.organization/proxy/nosql"
+)
+
+func (mine *Storage) CreateRevision(info *nosql.Revision) error {
+	if info == nil {
+		return errors.New("the revision is nil")
+	}
+	tmp, err := clone(info)
+	if err != nil {
+		return err
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	mine.revisions = append(mine.revisions, tmp)
+	return nil
+}
+
+func (mine *Storage) GetRevision(uid string) (*nosql.Revision, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	for _, item := range mine.revisions {
+		if item.UID.Hex() == uid {
+			return clone(item)
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetRevisions 按照时间倒序
+func (mine *Storage) GetRevisions(filter *nosql.RevisionFilter) ([]*nosql.Revision, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	list := make([]*nosql.Revision, 0, 20)
+	for i := len(mine.revisions) - 1; i >= 0; i-- {
+		if !filter.Match(mine.revisions[i]) {
+			continue
+		}
+		tmp, err := clone(mine.revisions[i])
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, tmp)
+		if filter.Limit > 0 && int64(len(list)) >= filter.Limit {
+			break
+		}
+	}
+	return list, nil
+}
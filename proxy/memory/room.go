@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"omo.msa.organization/proxy"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+func (mine *Storage) CreateRoom(ctx context.Context, info *nosql.Room) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.rooms.insert(info.UID.Hex(), info)
+}
+
+func (mine *Storage) GetRoomNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableRoom)
+}
+
+func (mine *Storage) GetRoomCount() int64 {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.rooms.count()
+}
+
+func (mine *Storage) GetRoom(uid string) (*nosql.Room, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.rooms.get(uid)
+}
+
+func (mine *Storage) GetRoomByID(id uint64) (*nosql.Room, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.rooms.first(func(db *nosql.Room) bool {
+		return db.ID == id
+	})
+}
+
+func (mine *Storage) RemoveRoom(ctx context.Context, uid, operator string) error {
+	return mine.updateRoom(ctx, uid, operator, func(db *nosql.Room) {
+		db.DeleteTime = time.Now()
+	})
+}
+
+func (mine *Storage) GetAllRooms() ([]*nosql.Room, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.rooms.filter(func(db *nosql.Room) bool {
+		return !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) GetRoomsByScene(scene string) ([]*nosql.Room, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.rooms.filter(func(db *nosql.Room) bool {
+		return db.Scene == scene && !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) updateRoom(ctx context.Context, uid, operator string, fun func(db *nosql.Room)) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.rooms.update(ctx, uid, func(db *nosql.Room) {
+		fun(db)
+		db.Operator = operator
+		db.UpdatedTime = time.Now()
+	})
+}
+
+func (mine *Storage) UpdateRoomBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateRoom(ctx, uid, operator, func(db *nosql.Room) {
+		db.Name = name
+		db.Remark = remark
+	})
+}
+
+func (mine *Storage) UpdateRoomDisplays(ctx context.Context, uid, operator string, list []*proxy.DisplayInfo) error {
+	// Room模型中已经没有displays字段，和mongo实现一样只更新操作者
+	return mine.updateRoom(ctx, uid, operator, func(db *nosql.Room) {})
+}
+
+func (mine *Storage) AppendRoomQuotes(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.updateRoom(ctx, uid, operator, func(db *nosql.Room) {
+		db.Quotes = appendItems(db.Quotes, arr)
+	})
+}
+
+func (mine *Storage) SubtractRoomQuotes(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.updateRoom(ctx, uid, operator, func(db *nosql.Room) {
+		db.Quotes = removeItems(db.Quotes, arr)
+	})
+}
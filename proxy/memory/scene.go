@@ -0,0 +1,202 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+func (mine *Storage) CreateScene(ctx context.Context, info *nosql.Scene) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.scenes.insert(info.UID.Hex(), info)
+}
+
+func (mine *Storage) GetSceneNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableScene)
+}
+
+func (mine *Storage) GetScene(uid string) (*nosql.Scene, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.scenes.get(uid)
+}
+
+func (mine *Storage) GetSceneByMaster(user string) (*nosql.Scene, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.scenes.first(func(db *nosql.Scene) bool {
+		return db.Master == user
+	})
+}
+
+func (mine *Storage) GetAllScenes() ([]*nosql.Scene, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.scenes.filter(func(db *nosql.Scene) bool {
+		return !isDeleted(db.DeleteTime)
+	})
+}
+
+func (mine *Storage) updateScene(ctx context.Context, uid, operator string, fun func(db *nosql.Scene)) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.scenes.update(ctx, uid, func(db *nosql.Scene) {
+		fun(db)
+		db.Operator = operator
+		db.UpdatedTime = time.Now()
+	})
+}
+
+func (mine *Storage) UpdateSceneBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Name = name
+		db.Remark = remark
+	})
+}
+
+func (mine *Storage) UpdateSceneMaster(ctx context.Context, uid, master, operator string) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Master = master
+	})
+}
+
+func (mine *Storage) UpdateSceneCover(ctx context.Context, uid, icon, operator string) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Cover = icon
+	})
+}
+
+func (mine *Storage) UpdateSceneType(ctx context.Context, uid, operator string, tp uint8) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Type = tp
+	})
+}
+
+func (mine *Storage) UpdateSceneLocal(ctx context.Context, uid, local, operator string) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Location = local
+		db.Geo, _ = nosql.ParseGeoPoint(local)
+	})
+}
+
+func (mine *Storage) UpdateSceneAddress(ctx context.Context, uid, operator string, address nosql.AddressInfo) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Address = address
+	})
+}
+
+func (mine *Storage) UpdateSceneStatus(ctx context.Context, uid string, status uint8, operator string) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Status = status
+	})
+}
+
+func (mine *Storage) AppendSceneQuestions(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Questions = appendItems(db.Questions, arr)
+	})
+}
+
+func (mine *Storage) SubtractSceneQuestions(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Questions = removeItems(db.Questions, arr)
+	})
+}
+
+func (mine *Storage) UpdateSceneLimit(ctx context.Context, uid, operator string, limit uint16) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Limit = limit
+	})
+}
+
+func (mine *Storage) UpdateSceneShort(ctx context.Context, uid, operator, name string) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Short = name
+	})
+}
+
+func (mine *Storage) UpdateSceneSupporter(ctx context.Context, uid, supporter, operator string) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Supporter = supporter
+	})
+}
+
+func (mine *Storage) UpdateSceneParents(ctx context.Context, uid, operator string, list []string) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.Parents = append([]string{}, list...)
+	})
+}
+
+func (mine *Storage) RemoveScene(ctx context.Context, uid, operator string) error {
+	return mine.updateScene(ctx, uid, operator, func(db *nosql.Scene) {
+		db.DeleteTime = time.Now()
+	})
+}
+
+func (mine *Storage) RemoveSceneCascade(ctx context.Context, depends *nosql.SceneDepends, detach bool, operator string, stamp time.Time) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if _, ok := mine.scenes.items[depends.Scene]; !ok {
+		return ErrNotFound
+	}
+	updateAll(mine.groups, depends.Groups, func(db *nosql.Group) {
+		db.Operator = operator
+		db.DeleteTime = stamp
+	})
+	updateAll(mine.rooms, depends.Rooms, func(db *nosql.Room) {
+		db.Operator = operator
+		db.DeleteTime = stamp
+	})
+	updateAll(mine.regions, depends.Regions, func(db *nosql.Region) {
+		db.Operator = operator
+		db.DeleteTime = stamp
+	})
+	updateAll(mine.areas, depends.Areas, func(db *nosql.Area) {
+		db.Operator = operator
+		db.DeleteTime = stamp
+	})
+	updateAll(mine.maintains, depends.Maintains, func(db *nosql.Maintain) {
+		db.Operator = operator
+		db.DeleteTime = stamp
+	})
+	updateAll(mine.devices, depends.Devices, func(db *nosql.Invite) {
+		db.Operator = operator
+		if detach {
+			db.Scene = ""
+			db.Status = nosql.DeviceDetached
+			db.UpdatedTime = stamp
+		} else {
+			db.DeleteTime = stamp
+		}
+	})
+	return mine.scenes.update(ctx, depends.Scene, func(db *nosql.Scene) {
+		db.Operator = operator
+		db.DeleteTime = stamp
+	})
+}
+
+func (mine *Storage) AppendSceneMember(ctx context.Context, uid string, member string) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.scenes.update(ctx, uid, func(db *nosql.Scene) {
+		db.Members = append(db.Members, member)
+		db.UpdatedTime = time.Now()
+	})
+}
+
+func (mine *Storage) SubtractSceneMember(ctx context.Context, uid, member string) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.scenes.update(ctx, uid, func(db *nosql.Scene) {
+		db.Members = removeItem(db.Members, member)
+		db.UpdatedTime = time.Now()
+	})
+}
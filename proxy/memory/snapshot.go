@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy/nosql"
+	"sort"
+)
+
+/**
+快照的读写，文档使用bson编码，和mongo导出的格式一致，
+内存存储没有版本、迁移以及地址表，这些表导出为空
+*/
+
+var _ nosql.SnapshotStore = (*Storage)(nil)
+
+func (mine *Storage) DatabaseName() string {
+	return "memory"
+}
+
+func (mine *Storage) DumpTable(table string, fun func(doc bson.Raw) error) error {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	switch table {
+	case nosql.TableSequence:
+		names := make([]string, 0, len(mine.sequences))
+		for name := range mine.sequences {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			bytes, err := bson.Marshal(&nosql.Sequence{UID: primitive.NewObjectID(), Name: name, Count: mine.sequences[name]})
+			if err != nil {
+				return err
+			}
+			if err = fun(bytes); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nosql.TableScene:
+		return dumpItems(mine.scenes, fun)
+	case nosql.TableGroup:
+		return dumpItems(mine.groups, fun)
+	case nosql.TableRoom:
+		return dumpItems(mine.rooms, fun)
+	case nosql.TableRegion:
+		return dumpItems(mine.regions, fun)
+	case nosql.TableArea:
+		return dumpItems(mine.areas, fun)
+	case nosql.TableDevice:
+		return dumpItems(mine.devices, fun)
+	case nosql.TableMaintain:
+		return dumpItems(mine.maintains, fun)
+	}
+	return nil
+}
+
+func dumpItems[T any](t *table[T], fun func(doc bson.Raw) error) error {
+	for _, key := range t.keys {
+		bytes, err := bson.Marshal(t.items[key])
+		if err != nil {
+			return err
+		}
+		if err = fun(bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceTables 所有的表都解码成功后在同一个锁中替换
+func (mine *Storage) ReplaceTables(tables []string, docs [][]interface{}) error {
+	if len(tables) != len(docs) {
+		return errors.New("the tables not match the documents")
+	}
+	commits := make([]func(), 0, len(tables))
+	for i, name := range tables {
+		commit, err := mine.stageTable(name, docs[i])
+		if err != nil {
+			return errors.New("stage table " + name + " failed: " + err.Error())
+		}
+		commits = append(commits, commit)
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	for _, commit := range commits {
+		commit()
+	}
+	return nil
+}
+
+func (mine *Storage) stageTable(name string, docs []interface{}) (func(), error) {
+	switch name {
+	case nosql.TableSequence:
+		list := make(map[string]uint64, len(docs))
+		for _, doc := range docs {
+			info, err := decodeDoc[nosql.Sequence](doc)
+			if err != nil {
+				return nil, err
+			}
+			list[info.Name] = info.Count
+		}
+		return func() {
+			mine.sequences = list
+		}, nil
+	case nosql.TableScene:
+		return stageItems(&mine.scenes, name, docs)
+	case nosql.TableGroup:
+		return stageItems(&mine.groups, name, docs)
+	case nosql.TableRoom:
+		return stageItems(&mine.rooms, name, docs)
+	case nosql.TableRegion:
+		return stageItems(&mine.regions, name, docs)
+	case nosql.TableArea:
+		return stageItems(&mine.areas, name, docs)
+	case nosql.TableDevice:
+		return stageItems(&mine.devices, name, docs)
+	case nosql.TableMaintain:
+		return stageItems(&mine.maintains, name, docs)
+	}
+	if len(docs) > 0 {
+		return nil, errors.New("the table not support of " + name)
+	}
+	return func() {}, nil
+}
+
+func stageItems[T any](target **table[T], name string, docs []interface{}) (func(), error) {
+	tmp := newTable[T](name)
+	for _, doc := range docs {
+		info, err := decodeDoc[T](doc)
+		if err != nil {
+			return nil, err
+		}
+		err = tmp.insert(nosql.ModelUID(info), info)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return func() {
+		*target = tmp
+	}, nil
+}
+
+func decodeDoc[T any](doc interface{}) (*T, error) {
+	bytes, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	info := new(T)
+	err = bson.Unmarshal(bytes, info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,174 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"omo.msa.organization/proxy/nosql"
+)
+
+type writer interface {
+	prepare(ctx context.Context, op *nosql.WriteOp) (func(), error)
+	version(uid string) (uint32, error)
+}
+
+// prepare 通过bson编解码设置字段，字段名和数据库一致，返回的函数用于提交
+func (mine *table[T]) prepare(ctx context.Context, op *nosql.WriteOp) (func(), error) {
+	uid := op.UID
+	info, ok := mine.items[uid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	exp := nosql.ExpectOf(ctx, mine.name, uid)
+	if exp != nil {
+		current, _ := mine.version(uid)
+		if err := exp.Check(current); err != nil {
+			return nil, err
+		}
+	}
+	bytes, err := bson.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	err = bson.Unmarshal(bytes, &doc)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range op.Fields {
+		doc[key] = value
+	}
+	for key, items := range op.Pulls {
+		doc[key] = removeItems(toStrings(doc[key]), items)
+	}
+	for key, items := range op.Adds {
+		doc[key] = appendItems(toStrings(doc[key]), items)
+	}
+	bytes, err = bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	tmp := new(T)
+	err = bson.Unmarshal(bytes, tmp)
+	if err != nil {
+		return nil, err
+	}
+	bumpVersion(tmp)
+	return func() {
+		*info = *tmp
+		if exp != nil {
+			exp.Advance()
+		}
+		mine.after(ctx, uid, info)
+	}, nil
+}
+
+func (mine *table[T]) version(uid string) (uint32, error) {
+	info, ok := mine.items[uid]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	field := versionField(info)
+	if !field.IsValid() {
+		return 0, nil
+	}
+	return uint32(field.Uint()), nil
+}
+
+func (mine *Storage) GetVersion(table, uid string) (uint32, error) {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	t := mine.writer(table)
+	if t == nil {
+		return 0, errors.New("the table not support of " + table)
+	}
+	return t.version(uid)
+}
+
+func (mine *Storage) writer(name string) writer {
+	switch name {
+	case nosql.TableScene:
+		return mine.scenes
+	case nosql.TableGroup:
+		return mine.groups
+	case nosql.TableRoom:
+		return mine.rooms
+	case nosql.TableRegion:
+		return mine.regions
+	case nosql.TableArea:
+		return mine.areas
+	case nosql.TableDevice:
+		return mine.devices
+	case nosql.TableMaintain:
+		return mine.maintains
+	}
+	return nil
+}
+
+func (mine *Storage) RunTransaction(ctx context.Context, ops []*nosql.WriteOp) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	//全部准备成功后再提交，保证要么全部写入要么全部不写
+	commits := make([]func(), 0, len(ops))
+	for _, op := range mergeOps(ops) {
+		t := mine.writer(op.Table)
+		if t == nil {
+			return errors.New("the table not support of " + op.Table)
+		}
+		commit, err := t.prepare(ctx, op)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, commit)
+	}
+	for _, commit := range commits {
+		commit()
+	}
+	return nil
+}
+
+// mergeOps 同一个文档的多个写操作按照顺序合并
+func mergeOps(ops []*nosql.WriteOp) []*nosql.WriteOp {
+	list := make([]*nosql.WriteOp, 0, len(ops))
+	docs := make(map[string]*nosql.WriteOp, len(ops))
+	for _, op := range ops {
+		key := op.Table + "/" + op.UID
+		tmp, ok := docs[key]
+		if !ok {
+			tmp = &nosql.WriteOp{Table: op.Table, UID: op.UID, Fields: bson.M{}}
+			docs[key] = tmp
+			list = append(list, tmp)
+		}
+		for field, value := range op.Fields {
+			tmp.Fields[field] = value
+		}
+		tmp.Pulls = mergeItems(tmp.Pulls, op.Pulls)
+		tmp.Adds = mergeItems(tmp.Adds, op.Adds)
+	}
+	return list
+}
+
+func mergeItems(to, from map[string][]string) map[string][]string {
+	if len(from) < 1 {
+		return to
+	}
+	if to == nil {
+		to = make(map[string][]string, len(from))
+	}
+	for key, items := range from {
+		to[key] = append(to[key], items...)
+	}
+	return to
+}
+
+// toStrings bson解码后的数组为bson.A
+func toStrings(value interface{}) []string {
+	arr, _ := value.(bson.A)
+	list := make([]string, 0, len(arr))
+	for _, item := range arr {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
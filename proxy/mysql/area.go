@@ -0,0 +1,174 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+var areaColumns = getTable(nosql.TableArea).columnNames()
+
+func scanArea(row scanner) (*nosql.Area, error) {
+	info := new(nosql.Area)
+	var uid, displays, assets, modules, sources string
+	var created, updated, deleted int64
+	err := row.Scan(&uid, &info.ID, &created, &updated, &deleted, &info.Creator, &info.Operator, &info.Name,
+		&info.Type, &info.Remark, &info.Scene, &info.Parent, &info.Template, &info.Width, &info.Height,
+		&info.Limit, &info.Device, &info.Question, &info.Catalog, &displays, &assets, &modules, &sources, &info.Version)
+	if err != nil {
+		return nil, err
+	}
+	info.UID, _ = primitive.ObjectIDFromHex(uid)
+	info.CreatedTime = fromStamp(created)
+	info.UpdatedTime = fromStamp(updated)
+	info.DeleteTime = fromStamp(deleted)
+	decodeJson(displays, &info.Displays)
+	decodeJson(assets, &info.Assets)
+	decodeJson(modules, &info.Modules)
+	decodeJson(sources, &info.Sources)
+	return info, nil
+}
+
+func (mine *Storage) CreateArea(ctx context.Context, info *nosql.Area) error {
+	return insertOne(mine.db, nosql.TableArea, fields{
+		"uid": info.UID.Hex(), "version": info.Version, "id": info.ID, "createdAt": toStamp(info.CreatedTime), "updatedAt": toStamp(info.UpdatedTime),
+		"deleteAt": toStamp(info.DeleteTime), "creator": info.Creator, "operator": info.Operator, "name": info.Name,
+		"type": info.Type, "remark": info.Remark, "scene": info.Scene, "parent": info.Parent, "template": info.Template,
+		"width": info.Width, "height": info.Height, "limit": info.Limit, "device": info.Device,
+		"question": info.Question, "catalog": info.Catalog, "displays": encodeJson(info.Displays),
+		"assets": encodeJson(info.Assets), "modules": encodeJson(info.Modules), "sources": encodeJson(info.Sources),
+	})
+}
+
+func (mine *Storage) GetAreaNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableArea)
+}
+
+func (mine *Storage) GetArea(uid string) (*nosql.Area, error) {
+	return findOne(mine, nosql.TableArea, areaColumns, scanArea, "`uid` = ?", uid)
+}
+
+func (mine *Storage) GetAreaByDevice(uid string) (*nosql.Area, error) {
+	return findOne(mine, nosql.TableArea, areaColumns, scanArea, "`device` = ? AND `deleteAt` = 0", uid)
+}
+
+func (mine *Storage) GetAreasByOwner(owner string) ([]*nosql.Area, error) {
+	return findMany(mine, nosql.TableArea, areaColumns, scanArea, "`scene` = ? AND `deleteAt` = 0", owner)
+}
+
+func (mine *Storage) GetAreasByTemplate(owner, template string) ([]*nosql.Area, error) {
+	return findMany(mine, nosql.TableArea, areaColumns, scanArea, "`scene` = ? AND `template` = ? AND `deleteAt` = 0", owner, template)
+}
+
+func (mine *Storage) GetAreasByParent(parent string) ([]*nosql.Area, error) {
+	return findMany(mine, nosql.TableArea, areaColumns, scanArea, "`parent` = ? AND `deleteAt` = 0", parent)
+}
+
+func (mine *Storage) GetAreasBy(owner, parent string) ([]*nosql.Area, error) {
+	return findMany(mine, nosql.TableArea, areaColumns, scanArea, "`scene` = ? AND `parent` = ? AND `deleteAt` = 0", owner, parent)
+}
+
+func (mine *Storage) GetAllAreas() ([]*nosql.Area, error) {
+	return findMany(mine, nosql.TableArea, areaColumns, scanArea, "`deleteAt` = 0")
+}
+
+func (mine *Storage) updateArea(ctx context.Context, uid, operator string, values fields) error {
+	values["operator"] = operator
+	values["updatedAt"] = toStamp(time.Now())
+	_, err := updateOne(ctx, mine.db, nosql.TableArea, uid, values)
+	return err
+}
+
+func (mine *Storage) UpdateAreaBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateArea(ctx, uid, operator, fields{"name": name, "remark": remark})
+}
+
+func (mine *Storage) UpdateAreaAssets(ctx context.Context, uid, operator string, assets []string) error {
+	return mine.updateArea(ctx, uid, operator, fields{"assets": encodeJson(assets)})
+}
+
+func (mine *Storage) UpdateAreaTemplate(ctx context.Context, uid, template, operator string) error {
+	return mine.updateArea(ctx, uid, operator, fields{"template": template})
+}
+
+func (mine *Storage) UpdateAreaDevice(ctx context.Context, uid, device, operator string, tp uint32) error {
+	return mine.updateArea(ctx, uid, operator, fields{"device": device, "type": tp})
+}
+
+func (mine *Storage) UpdateAreaCatalog(ctx context.Context, uid, catalog, operator string) error {
+	return mine.updateArea(ctx, uid, operator, fields{"catalog": catalog})
+}
+
+func (mine *Storage) UpdateAreaDevice2(ctx context.Context, uid, device, operator string) error {
+	return mine.updateArea(ctx, uid, operator, fields{"device": device})
+}
+
+func (mine *Storage) UpdateAreaType(ctx context.Context, uid, operator string, tp uint32) error {
+	return mine.updateArea(ctx, uid, operator, fields{"type": tp})
+}
+
+func (mine *Storage) UpdateAreaQuestion(ctx context.Context, uid, question, operator string) error {
+	return mine.updateArea(ctx, uid, operator, fields{"question": question})
+}
+
+func (mine *Storage) UpdateAreaLimit(ctx context.Context, uid, operator string, num uint32) error {
+	return mine.updateArea(ctx, uid, operator, fields{"limit": num})
+}
+
+func (mine *Storage) UpdateAreaDisplays(ctx context.Context, uid, operator string, displays []string) error {
+	return mine.updateArea(ctx, uid, operator, fields{"displays": encodeJson(displays)})
+}
+
+func (mine *Storage) SetAreaModule(ctx context.Context, uid, operator, key, value string) error {
+	return mine.setAreaPair(ctx, uid, "modules", operator, key, value)
+}
+
+func (mine *Storage) SetAreaSource(ctx context.Context, uid, operator, key, value string) error {
+	return mine.setAreaPair(ctx, uid, "sources", operator, key, value)
+}
+
+// setAreaPair 在事务中读取并且锁定记录，修改key对应的值，不存在时追加
+func (mine *Storage) setAreaPair(ctx context.Context, uid, column, operator, key, value string) error {
+	tx, err := mine.db.Begin()
+	if err != nil {
+		return err
+	}
+	ctx, exps := nosql.WithExpectTx(ctx)
+	var data string
+	err = tx.QueryRow("SELECT "+quote(column)+" FROM "+quote(nosql.TableArea)+" WHERE `uid` = ?"+mine.lockRow(), uid).Scan(&data)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	list := make([]*proxy.PairInfo, 0, 5)
+	decodeJson(data, &list)
+	ok := false
+	for _, item := range list {
+		if item.Key == key {
+			item.Value = value
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		list = append(list, &proxy.PairInfo{Key: key, Value: value})
+	}
+	values := fields{column: encodeJson(list), "operator": operator, "updatedAt": toStamp(time.Now())}
+	_, err = updateOne(ctx, tx, nosql.TableArea, uid, values)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return commit(tx, exps)
+}
+
+func (mine *Storage) RemoveArea(ctx context.Context, uid, operator string) error {
+	return removeOne(ctx, mine.db, nosql.TableArea, uid, operator)
+}
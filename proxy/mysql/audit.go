@@ -0,0 +1,81 @@
+package mysql
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy/nosql"
+	"strconv"
+	"strings"
+)
+
+var auditColumns = getTable(nosql.TableAudit).columnNames()
+
+func scanAudit(row scanner) (*nosql.Audit, error) {
+	info := new(nosql.Audit)
+	var uid, changes string
+	var created int64
+	err := row.Scan(&uid, &created, &info.Table, &info.Target, &info.Scene, &info.Action, &info.Operator,
+		&info.Path, &changes)
+	if err != nil {
+		return nil, err
+	}
+	info.UID, _ = primitive.ObjectIDFromHex(uid)
+	info.CreatedTime = fromStamp(created)
+	info.Changes = make([]*nosql.AuditChange, 0, 5)
+	decodeJson(changes, &info.Changes)
+	return info, nil
+}
+
+func (mine *Storage) CreateAudit(info *nosql.Audit) error {
+	if info == nil {
+		return errors.New("the audit is nil")
+	}
+	return insertOne(mine.db, nosql.TableAudit, fields{
+		"uid": info.UID.Hex(), "createdAt": toStamp(info.CreatedTime), "table": info.Table, "target": info.Target,
+		"scene": info.Scene, "action": info.Action, "operator": info.Operator, "path": info.Path,
+		"changes": encodeJson(info.Changes),
+	})
+}
+
+// GetAudits 按照时间倒序
+func (mine *Storage) GetAudits(filter *nosql.AuditFilter) ([]*nosql.Audit, error) {
+	wheres := make([]string, 0, 6)
+	args := make([]interface{}, 0, 6)
+	pairs := [][2]string{{"scene", filter.Scene}, {"table", filter.Table}, {"target", filter.Target}, {"operator", filter.Operator}}
+	for _, pair := range pairs {
+		if len(pair[1]) > 0 {
+			wheres = append(wheres, quote(pair[0])+" = ?")
+			args = append(args, pair[1])
+		}
+	}
+	if !filter.From.IsZero() {
+		wheres = append(wheres, "`createdAt` >= ?")
+		args = append(args, toStamp(filter.From))
+	}
+	if !filter.To.IsZero() {
+		wheres = append(wheres, "`createdAt` < ?")
+		args = append(args, toStamp(filter.To))
+	}
+	query := "SELECT " + selectColumns(auditColumns) + " FROM " + quote(nosql.TableAudit)
+	if len(wheres) > 0 {
+		query += " WHERE " + strings.Join(wheres, " AND ")
+	}
+	query += " ORDER BY `createdAt` DESC, `uid` DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + strconv.FormatInt(filter.Limit, 10)
+	}
+	rows, err := mine.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make([]*nosql.Audit, 0, 20)
+	for rows.Next() {
+		info, er := scanAudit(rows)
+		if er != nil {
+			return nil, er
+		}
+		list = append(list, info)
+	}
+	return list, rows.Err()
+}
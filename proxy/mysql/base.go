@@ -0,0 +1,463 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/micro/go-micro/v2/logger"
+	"omo.msa.organization/proxy/nosql"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+关系型数据库存储，支持mysql以及嵌入式的sqlite
+数组以及结构体字段使用json文本保存，时间使用毫秒时间戳保存
+*/
+
+const (
+	KindMysql  = "mysql"
+	KindSqlite = "sqlite"
+)
+
+var ErrNotFound = errors.New("not found the record")
+
+type fields map[string]interface{}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type Storage struct {
+	kind string
+	db   *sql.DB
+}
+
+var _ nosql.Storage = (*Storage)(nil)
+
+// Open 连接数据库并且创建缺失的表，sqlite时name为数据库文件路径
+func Open(kind, user, password, ip, port, name string) (*Storage, error) {
+	var driver, uri string
+	if kind == KindMysql {
+		driver = "mysql"
+		uri = user + ":" + password + "@tcp(" + ip + ":" + port + ")/" + name + "?charset=utf8mb4"
+	} else if kind == KindSqlite {
+		driver = "sqlite3"
+		uri = "file:" + name + "?_busy_timeout=5000&_journal_mode=WAL"
+	} else {
+		return nil, errors.New("the database type not supported of " + kind)
+	}
+	db, err := sql.Open(driver, uri)
+	if err != nil {
+		return nil, err
+	}
+	if kind == KindSqlite {
+		//sqlite只允许一个写连接
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxIdleConns(10)
+		db.SetMaxOpenConns(100)
+		db.SetConnMaxIdleTime(5 * time.Minute)
+	}
+	err = db.Ping()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	tmp := &Storage{kind: kind, db: db}
+	err = tmp.createTables()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	logger.Infof("connect %s database success of %s", kind, name)
+	return tmp, nil
+}
+
+func (mine *Storage) Close() error {
+	return mine.db.Close()
+}
+
+func (mine *Storage) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return mine.db.PingContext(ctx)
+}
+
+// createTables 先追加缺少的列再创建索引，sqlite的索引可能建立在新增的列上
+func (mine *Storage) createTables() error {
+	for _, table := range tables {
+		queries := table.schema(mine.kind)
+		_, err := mine.db.Exec(queries[0])
+		if err != nil {
+			return errors.New("create table " + table.name + " failed: " + err.Error())
+		}
+		err = mine.addColumns(table)
+		if err != nil {
+			return errors.New("alter table " + table.name + " failed: " + err.Error())
+		}
+		for _, query := range queries[1:] {
+			_, err = mine.db.Exec(query)
+			if err != nil {
+				return errors.New("create index of " + table.name + " failed: " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// addColumns 已经存在的表追加新声明的列
+func (mine *Storage) addColumns(table *tableDefine) error {
+	rows, err := mine.db.Query("SELECT * FROM " + quote(table.name) + " LIMIT 0")
+	if err != nil {
+		return err
+	}
+	names, err := rows.Columns()
+	_ = rows.Close()
+	if err != nil {
+		return err
+	}
+	existed := make(map[string]bool, len(names))
+	for _, name := range names {
+		existed[name] = true
+	}
+	for _, item := range table.columns {
+		if existed[item.name] {
+			continue
+		}
+		query := "ALTER TABLE " + quote(table.name) + " ADD COLUMN " + quote(item.name) + " " + columnType(mine.kind, item.kind) + columnDefault(item.kind)
+		_, err = mine.db.Exec(query)
+		if err != nil {
+			return err
+		}
+		if item.kind == kindText {
+			//mysql的text不能有默认值，已有的记录补为空字符串
+			_, err = mine.db.Exec("UPDATE " + quote(table.name) + " SET " + quote(item.name) + " = ''")
+			if err != nil {
+				return err
+			}
+		}
+		logger.Infof("add the column %s to table %s", item.name, table.name)
+	}
+	return nil
+}
+
+func quote(name string) string {
+	return "`" + name + "`"
+}
+
+func insertOne(db execer, table string, values fields) error {
+	keys := sortKeys(values)
+	names := make([]string, 0, len(keys))
+	marks := make([]string, 0, len(keys))
+	args := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, quote(key))
+		marks = append(marks, "?")
+		args = append(args, values[key])
+	}
+	query := "INSERT INTO " + quote(table) + " (" + strings.Join(names, ",") + ") VALUES (" + strings.Join(marks, ",") + ")"
+	_, err := db.Exec(query, args...)
+	return err
+}
+
+func updateOne(ctx context.Context, db execer, table string, uid string, values fields) (int64, error) {
+	if len(uid) < 1 {
+		return 0, errors.New("the uid is empty")
+	}
+	if pool, ok := db.(*sql.DB); ok && nosql.AftersOf(ctx) != nil {
+		//需要写入后的文档时，写入和读取在同一个事务中
+		tx, err := pool.Begin()
+		if err != nil {
+			return 0, err
+		}
+		ctx, exps := nosql.WithExpectTx(ctx)
+		num, err := updateOne(ctx, tx, table, uid, values)
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		return num, commit(tx, exps)
+	}
+	keys := sortKeys(values)
+	sets := make([]string, 0, len(keys))
+	args := make([]interface{}, 0, len(keys)+1)
+	for _, key := range keys {
+		sets = append(sets, quote(key)+" = ?")
+		args = append(args, values[key])
+	}
+	if define := getTable(table); define != nil && define.hasColumn("version") {
+		sets = append(sets, "`version` = `version` + 1")
+	}
+	args = append(args, uid)
+	where := " WHERE `uid` = ?"
+	exp := nosql.ExpectOf(ctx, table, uid)
+	if exp != nil {
+		where += " AND `version` = ?"
+		args = append(args, nosql.ExpectNext(ctx, exp))
+	}
+	query := "UPDATE " + quote(table) + " SET " + strings.Join(sets, ",") + where
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	num, err := result.RowsAffected()
+	if err != nil {
+		return num, err
+	}
+	if exp == nil {
+		return num, readAfter(ctx, db, table, uid)
+	}
+	if num > 0 {
+		nosql.ExpectMatched(ctx, exp)
+		return num, readAfter(ctx, db, table, uid)
+	}
+	//版本每次加1，没有修改的行只可能是版本不一致或者记录不存在
+	var current uint32
+	err = db.QueryRow("SELECT `version` FROM "+quote(table)+" WHERE `uid` = ?", uid).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, exp.Fail(current)
+}
+
+// readAfter 请求写入后的文档时，使用写入的事务读取，记录不存在时不返回
+func readAfter(ctx context.Context, db execer, table, uid string) error {
+	afters := nosql.AftersOf(ctx)
+	if afters == nil {
+		return nil
+	}
+	var info interface{}
+	var err error
+	switch table {
+	case nosql.TableScene:
+		info, err = scanOne(db, table, sceneColumns, scanScene, uid)
+	case nosql.TableGroup:
+		info, err = scanOne(db, table, groupColumns, scanGroup, uid)
+	case nosql.TableRoom:
+		info, err = scanOne(db, table, roomColumns, scanRoom, uid)
+	case nosql.TableRegion:
+		info, err = scanOne(db, table, regionColumns, scanRegion, uid)
+	case nosql.TableArea:
+		info, err = scanOne(db, table, areaColumns, scanArea, uid)
+	case nosql.TableDevice:
+		info, err = scanOne(db, table, deviceColumns, scanDevice, uid)
+	case nosql.TableMaintain:
+		info, err = scanOne(db, table, maintainColumns, scanMaintain, uid)
+	default:
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	afters.Set(table, uid, info)
+	return nil
+}
+
+func scanOne[T any](db execer, table string, columns []string, scan func(scanner) (*T, error), uid string) (*T, error) {
+	return scan(db.QueryRow("SELECT "+selectColumns(columns)+" FROM "+quote(table)+" WHERE `uid` = ?", uid))
+}
+
+func removeOne(ctx context.Context, db execer, table, uid, operator string) error {
+	_, err := updateOne(ctx, db, table, uid, fields{"operator": operator, "deleteAt": toStamp(time.Now())})
+	return err
+}
+
+func (mine *Storage) getCount(table string) int64 {
+	var num int64
+	err := mine.db.QueryRow("SELECT COUNT(*) FROM " + quote(table)).Scan(&num)
+	if err != nil {
+		return 0
+	}
+	return num
+}
+
+func sortKeys(values fields) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func findOne[T any](mine *Storage, table string, columns []string, scan func(scanner) (*T, error), where string, args ...interface{}) (*T, error) {
+	query := "SELECT " + selectColumns(columns) + " FROM " + quote(table) + " WHERE " + where + " LIMIT 1"
+	row := mine.db.QueryRow(query, args...)
+	info, err := scan(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return info, err
+}
+
+func findMany[T any](mine *Storage, table string, columns []string, scan func(scanner) (*T, error), where string, args ...interface{}) ([]*T, error) {
+	query := "SELECT " + selectColumns(columns) + " FROM " + quote(table) + " WHERE " + where + " ORDER BY `createdAt`, `uid`"
+	rows, err := mine.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items = make([]*T, 0, 20)
+	for rows.Next() {
+		info, er := scan(rows)
+		if er != nil {
+			return nil, er
+		}
+		items = append(items, info)
+	}
+	return items, rows.Err()
+}
+
+func selectColumns(columns []string) string {
+	arr := make([]string, 0, len(columns))
+	for _, column := range columns {
+		arr = append(arr, quote(column))
+	}
+	return strings.Join(arr, ",")
+}
+
+// updateJson 在事务中读取json字段，修改后写回，用于数组元素的追加或者移除，values为同时修改的其他字段
+func (mine *Storage) updateJson(ctx context.Context, table, uid, column string, values fields, fun func(arr []string) []string) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	tx, err := mine.db.Begin()
+	if err != nil {
+		return err
+	}
+	ctx, exps := nosql.WithExpectTx(ctx)
+	var data string
+	err = tx.QueryRow("SELECT "+quote(column)+" FROM "+quote(table)+" WHERE `uid` = ?"+mine.lockRow(), uid).Scan(&data)
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	arr := make([]string, 0, 5)
+	decodeJson(data, &arr)
+	if values == nil {
+		values = fields{}
+	}
+	values[column] = encodeJson(fun(arr))
+	values["updatedAt"] = toStamp(time.Now())
+	_, err = updateOne(ctx, tx, table, uid, values)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return commit(tx, exps)
+}
+
+// lockRow mysql在事务中读取后修改需要锁定记录，sqlite只有一个写连接
+func (mine *Storage) lockRow() string {
+	if mine.kind == KindMysql {
+		return " FOR UPDATE"
+	}
+	return ""
+}
+
+func (mine *Storage) GetVersion(table, uid string) (uint32, error) {
+	define := getTable(table)
+	if define == nil || !define.hasColumn("version") {
+		return 0, errors.New("the table not support version of " + table)
+	}
+	var num uint32
+	err := mine.db.QueryRow("SELECT `version` FROM "+quote(table)+" WHERE `uid` = ?", uid).Scan(&num)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return num, err
+}
+
+func toStamp(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromStamp(num int64) time.Time {
+	if num == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(num)
+}
+
+func encodeJson(data interface{}) string {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+	return string(bytes)
+}
+
+func decodeJson(data string, value interface{}) {
+	if len(data) < 1 || data == "null" {
+		return
+	}
+	_ = json.Unmarshal([]byte(data), value)
+}
+
+func removeItem(array []string, item string) []string {
+	list := make([]string, 0, len(array))
+	for _, s := range array {
+		if s != item {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// appendItems 和$addToSet一致，已经存在的元素不重复添加
+func appendItems(array []string, items []string) []string {
+	list := append(make([]string, 0, len(array)+len(items)), array...)
+	for _, item := range items {
+		had := false
+		for _, s := range list {
+			if s == item {
+				had = true
+				break
+			}
+		}
+		if !had {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// removeItems 和$pull一致
+func removeItems(array []string, items []string) []string {
+	list := make([]string, 0, len(array))
+	for _, s := range array {
+		had := false
+		for _, item := range items {
+			if s == item {
+				had = true
+				break
+			}
+		}
+		if !had {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,280 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy"
+	"omo.msa.organization/proxy/nosql"
+)
+
+func openSqlite(t *testing.T, path string) *Storage {
+	storage, err := Open(KindSqlite, "", "", "", "", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = storage.Close()
+	})
+	return storage
+}
+
+func TestOpenAddColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "organization.db")
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//旧版本的表只有基础字段
+	_, err = db.Exec("CREATE TABLE `scenes` (`uid` VARCHAR(64) NOT NULL PRIMARY KEY, `id` BIGINT, `createdAt` BIGINT," +
+		" `updatedAt` BIGINT, `deleteAt` BIGINT, `creator` VARCHAR(64), `operator` VARCHAR(64), `name` VARCHAR(255))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid := primitive.NewObjectID().Hex()
+	_, err = db.Exec("INSERT INTO `scenes` VALUES (?, 1, 0, 0, 0, 'tester', 'tester', 'museum')", uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+	storage := openSqlite(t, path)
+	info, err := storage.GetScene(uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "museum" || info.Version != 0 || len(info.Master) > 0 || info.Members != nil {
+		t.Fatalf("the old scene is error: %s, %d, %s, %v", info.Name, info.Version, info.Master, info.Members)
+	}
+	_ = storage.Close()
+	//再次打开时不会重复追加
+	storage = openSqlite(t, path)
+	if _, err = storage.GetScene(uid); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJsonColumns(t *testing.T) {
+	ctx := context.Background()
+	storage := openSqlite(t, filepath.Join(t.TempDir(), "organization.db"))
+	geo, _ := nosql.NewGeoPoint(116.4, 39.9)
+	scene := &nosql.Scene{UID: primitive.NewObjectID(), ID: 1, CreatedTime: time.Now(), Name: "museum",
+		Members: []string{"a", "b"}, Questions: []string{}, Geo: geo,
+		Address: nosql.AddressInfo{Country: "china", City: "beijing"}}
+	if err := storage.CreateScene(ctx, scene); err != nil {
+		t.Fatal(err)
+	}
+	info, err := storage.GetScene(scene.UID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Members) != 2 || info.Members[1] != "b" || info.Questions == nil || len(info.Questions) > 0 || info.Parents != nil {
+		t.Fatalf("the array columns is error: %v, %v, %v", info.Members, info.Questions, info.Parents)
+	}
+	if info.Address.City != "beijing" || info.Geo == nil || info.Geo.Lng() != 116.4 || info.Geo.Lat() != 39.9 {
+		t.Fatalf("the struct columns is error: %v, %v", info.Address, info.Geo)
+	}
+	area := &nosql.Area{UID: primitive.NewObjectID(), ID: 1, CreatedTime: time.Now(), Name: "hall", Scene: scene.UID.Hex(),
+		Modules: []*proxy.PairInfo{{Key: "a", Value: "1"}}}
+	if err = storage.CreateArea(ctx, area); err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.SetAreaModule(ctx, area.UID.Hex(), "tester", "a", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.SetAreaModule(ctx, area.UID.Hex(), "tester", "b", "3"); err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := storage.GetArea(area.UID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmp.Modules) != 2 || tmp.Modules[0].Value != "2" || tmp.Modules[1].Key != "b" || tmp.Version != 2 {
+		t.Fatalf("the pair columns is error: %v, %d", tmp.Modules, tmp.Version)
+	}
+}
+
+func TestTimeColumns(t *testing.T) {
+	storage := openSqlite(t, filepath.Join(t.TempDir(), "organization.db"))
+	created := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.Local)
+	scene := &nosql.Scene{UID: primitive.NewObjectID(), ID: 1, CreatedTime: created, Name: "museum"}
+	if err := storage.CreateScene(context.Background(), scene); err != nil {
+		t.Fatal(err)
+	}
+	var stamp, deleted int64
+	err := storage.db.QueryRow("SELECT `createdAt`, `deleteAt` FROM `scenes` WHERE `uid` = ?", scene.UID.Hex()).Scan(&stamp, &deleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stamp != created.UnixMilli() || deleted != 0 {
+		t.Fatalf("the time should be saved as milliseconds but %d, %d", stamp, deleted)
+	}
+	info, err := storage.GetScene(scene.UID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.CreatedTime.Equal(created.Truncate(time.Millisecond)) || !info.DeleteTime.IsZero() {
+		t.Fatalf("the time is error: %v, %v", info.CreatedTime, info.DeleteTime)
+	}
+}
+
+func TestUpdateVersion(t *testing.T) {
+	storage := openSqlite(t, filepath.Join(t.TempDir(), "organization.db"))
+	scene := &nosql.Scene{UID: primitive.NewObjectID(), ID: 1, CreatedTime: time.Now(), Name: "museum"}
+	if err := storage.CreateScene(context.Background(), scene); err != nil {
+		t.Fatal(err)
+	}
+	uid := scene.UID.Hex()
+	ctx, exp := nosql.WithExpect(context.Background(), nosql.TableScene, uid, 0)
+	if _, err := updateOne(ctx, storage.db, nosql.TableScene, uid, fields{"name": "museum-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if exp.Version() != 1 {
+		t.Fatalf("the expect version should be 1 but %d", exp.Version())
+	}
+	stale, _ := nosql.WithExpect(context.Background(), nosql.TableScene, uid, 0)
+	num, err := updateOne(stale, storage.db, nosql.TableScene, uid, fields{"name": "museum-3"})
+	conflict, ok := err.(*nosql.VersionConflict)
+	if !ok || num != 0 || conflict.Expect != 0 || conflict.Current != 1 {
+		t.Fatalf("the stale version should conflict but %v", err)
+	}
+	missing, _ := nosql.WithExpect(context.Background(), nosql.TableScene, "none", 0)
+	if _, err = updateOne(missing, storage.db, nosql.TableScene, "none", fields{"name": "none"}); err != ErrNotFound {
+		t.Fatalf("the missing record should not found but %v", err)
+	}
+	info, _ := storage.GetScene(uid)
+	if info.Name != "museum-2" || info.Version != 1 {
+		t.Fatalf("the scene is error: %s, %d", info.Name, info.Version)
+	}
+}
+
+func TestSequenceBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "organization.db")
+	first := openSqlite(t, path)
+	id, err := first.GetSequenceBlock(nosql.TableScene, 5)
+	if err != nil || id != 1 {
+		t.Fatalf("the first block should start from 1 but %d, %v", id, err)
+	}
+	id, err = first.GetSequenceNext(nosql.TableScene)
+	if err != nil || id != 6 {
+		t.Fatalf("the next id should be 6 but %d, %v", id, err)
+	}
+	//重复插入计数时可以识别为唯一索引冲突
+	err = insertOne(first.db, nosql.TableSequence, fields{"uid": primitive.NewObjectID().Hex(), "name": nosql.TableScene, "count": 1})
+	if err == nil || !isDuplicate(err) {
+		t.Fatalf("the duplicate sequence should be detected but %v", err)
+	}
+	//两个连接同时分配新的计数，ID不能重复
+	second := openSqlite(t, path)
+	ids := make(map[uint64]bool, 40)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		for _, storage := range []*Storage{first, second} {
+			wg.Add(1)
+			go func(storage *Storage) {
+				defer wg.Done()
+				num, er := storage.GetSequenceNext(nosql.TableGroup)
+				if er != nil {
+					t.Error(er)
+					return
+				}
+				lock.Lock()
+				ids[num] = true
+				lock.Unlock()
+			}(storage)
+		}
+	}
+	wg.Wait()
+	count, _ := first.GetSequenceCount(nosql.TableGroup)
+	if len(ids) != 40 || count != 40 {
+		t.Fatalf("the ids should be unique but %d, %d", len(ids), count)
+	}
+}
+
+func TestTransactionExpect(t *testing.T) {
+	storage := openSqlite(t, filepath.Join(t.TempDir(), "organization.db"))
+	scene := &nosql.Scene{UID: primitive.NewObjectID(), ID: 1, CreatedTime: time.Now(), Name: "museum"}
+	if err := storage.CreateScene(context.Background(), scene); err != nil {
+		t.Fatal(err)
+	}
+	uid := scene.UID.Hex()
+	ctx, exp := nosql.WithExpect(context.Background(), nosql.TableScene, uid, 0)
+	//第二个操作失败时事务回滚，期望的版本不变
+	ops := []*nosql.WriteOp{nosql.RestoreOp(nosql.TableScene, uid, "tester"),
+		nosql.RestoreOp(nosql.TableScene, primitive.NewObjectID().Hex(), "tester")}
+	if err := storage.RunTransaction(ctx, ops); err == nil {
+		t.Fatal("the transaction should be failed")
+	}
+	if current, _ := storage.GetVersion(nosql.TableScene, uid); exp.Version() != 0 || current != 0 {
+		t.Fatalf("the version should not advance after rollback but %d, %d", exp.Version(), current)
+	}
+	//同一个文档的多次写入依次检查，提交后再修改期望的版本
+	ops = []*nosql.WriteOp{nosql.RestoreOp(nosql.TableScene, uid, "tester"),
+		nosql.RemoveOp(nosql.TableScene, uid, "tester", time.Now())}
+	if err := storage.RunTransaction(ctx, ops); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := storage.GetVersion(nosql.TableScene, uid); exp.Version() != 2 || current != 2 {
+		t.Fatalf("the version should be 2 but %d, %d", exp.Version(), current)
+	}
+}
+
+func TestUpdateAfter(t *testing.T) {
+	storage := openSqlite(t, filepath.Join(t.TempDir(), "organization.db"))
+	scene := &nosql.Scene{UID: primitive.NewObjectID(), ID: 1, CreatedTime: time.Now(), Name: "museum"}
+	if err := storage.CreateScene(context.Background(), scene); err != nil {
+		t.Fatal(err)
+	}
+	uid := scene.UID.Hex()
+	ctx, afters := nosql.WithAfters(context.Background())
+	if err := storage.UpdateSceneBase(ctx, uid, "museum-2", "remark", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.AppendSceneQuestions(ctx, uid, "tester", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	info, ok := afters.Get(nosql.TableScene, uid).(*nosql.Scene)
+	if !ok || info.Name != "museum-2" || info.Version != 2 || len(info.Questions) != 1 {
+		t.Fatalf("the scene after written is error: %v", afters.Get(nosql.TableScene, uid))
+	}
+	//不存在的记录没有返回
+	if err := storage.UpdateSceneBase(ctx, "none", "none", "", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if afters.Get(nosql.TableScene, "none") != nil {
+		t.Fatal("the missing scene should not be returned")
+	}
+}
+
+func TestMaintainFilter(t *testing.T) {
+	ctx := context.Background()
+	storage := openSqlite(t, filepath.Join(t.TempDir(), "organization.db"))
+	stamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, scene := range []string{"scene", "scene", "scene", "other"} {
+		info := &nosql.Maintain{UID: primitive.NewObjectID(), ID: uint64(i + 1), CreatedTime: stamp.Add(time.Duration(i) * time.Second),
+			Scene: scene, Type: uint8(i), Name: "maintain", Maintainers: []string{"bob"}}
+		if i == 1 {
+			info.Maintainers = []string{"carl"}
+		}
+		if err := storage.CreateMaintain(ctx, info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter := bson.M{"$or": []bson.M{{"maintainers": "bob"}, {"type": bson.M{"$gte": float64(2)}}}}
+	list, err := storage.GetMaintainsByFilter("scene", filter, bson.D{{Key: "type", Value: -1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Type != 2 || list[1].Type != 0 {
+		t.Fatalf("the maintains by filter is error: %d", len(list))
+	}
+	if _, err = storage.GetMaintainsByFilter("scene", bson.M{"type": bson.M{"$where": 1}}, nil); err == nil {
+		t.Fatal("the unsupported op should fail")
+	}
+}
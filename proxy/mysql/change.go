@@ -0,0 +1,28 @@
+package mysql
+
+import (
+	"errors"
+	"time"
+)
+
+func (mine *Storage) GetChangedSince(table string, stamp time.Time) ([]string, error) {
+	if getTable(table) == nil {
+		return nil, errors.New("the table not support of " + table)
+	}
+	rows, err := mine.db.Query("SELECT `uid` FROM "+quote(table)+" WHERE `updatedAt` > ? OR `deleteAt` > ?",
+		toStamp(stamp), toStamp(stamp))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make([]string, 0, 10)
+	for rows.Next() {
+		var uid string
+		err = rows.Scan(&uid)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, uid)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,126 @@
+package mysql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+var deviceColumns = getTable(nosql.TableDevice).columnNames()
+
+func scanDevice(row scanner) (*nosql.Invite, error) {
+	info := new(nosql.Invite)
+	var uid, auto string
+	var created, updated, deleted int64
+	err := row.Scan(&uid, &info.ID, &created, &updated, &deleted, &info.Creator, &info.Operator, &info.Name,
+		&info.Scene, &info.Type, &info.Status, &info.Remark, &info.SN, &info.OS, &info.Aspect, &info.ExpiryTime,
+		&info.ActiveTime, &info.Quote, &info.Certificate, &info.Meta, &auto, &info.Version)
+	if err != nil {
+		return nil, err
+	}
+	info.UID, _ = primitive.ObjectIDFromHex(uid)
+	info.CreatedTime = fromStamp(created)
+	info.UpdatedTime = fromStamp(updated)
+	info.DeleteTime = fromStamp(deleted)
+	decodeJson(auto, &info.Auto)
+	return info, nil
+}
+
+func (mine *Storage) CreateDevice(ctx context.Context, info *nosql.Invite) error {
+	return insertOne(mine.db, nosql.TableDevice, fields{
+		"uid": info.UID.Hex(), "version": info.Version, "id": info.ID, "createdAt": toStamp(info.CreatedTime), "updatedAt": toStamp(info.UpdatedTime),
+		"deleteAt": toStamp(info.DeleteTime), "creator": info.Creator, "operator": info.Operator, "name": info.Name,
+		"scene": info.Scene, "type": info.Type, "status": info.Status, "remark": info.Remark, "sn": info.SN,
+		"os": info.OS, "aspect": info.Aspect, "expiry": info.ExpiryTime, "activated": info.ActiveTime,
+		"quote": info.Quote, "certificate": info.Certificate, "meta": info.Meta, "auto": encodeJson(info.Auto),
+	})
+}
+
+func (mine *Storage) GetDeviceNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableDevice)
+}
+
+func (mine *Storage) GetDeviceCount() int64 {
+	return mine.getCount(nosql.TableDevice)
+}
+
+func (mine *Storage) GetDeviceBySN(sn string) (*nosql.Invite, error) {
+	return findOne(mine, nosql.TableDevice, deviceColumns, scanDevice, "`sn` = ?", sn)
+}
+
+func (mine *Storage) GetDevice(uid string) (*nosql.Invite, error) {
+	return findOne(mine, nosql.TableDevice, deviceColumns, scanDevice, "`uid` = ?", uid)
+}
+
+func (mine *Storage) GetDeviceByID(id uint64) (*nosql.Invite, error) {
+	return findOne(mine, nosql.TableDevice, deviceColumns, scanDevice, "`id` = ?", id)
+}
+
+func (mine *Storage) RemoveDevice(ctx context.Context, uid, operator string) error {
+	return removeOne(ctx, mine.db, nosql.TableDevice, uid, operator)
+}
+
+func (mine *Storage) GetAllDevices() ([]*nosql.Invite, error) {
+	return findMany(mine, nosql.TableDevice, deviceColumns, scanDevice, "`deleteAt` = 0")
+}
+
+func (mine *Storage) GetAllDevicesExcept(st uint8) ([]*nosql.Invite, error) {
+	return findMany(mine, nosql.TableDevice, deviceColumns, scanDevice, "`status` <> ? AND `deleteAt` = 0", st)
+}
+
+func (mine *Storage) GetDevicesByScene(scene string) ([]*nosql.Invite, error) {
+	return findMany(mine, nosql.TableDevice, deviceColumns, scanDevice, "`scene` = ? AND `deleteAt` = 0", scene)
+}
+
+func (mine *Storage) GetDevicesByStatus(st uint8) ([]*nosql.Invite, error) {
+	return findMany(mine, nosql.TableDevice, deviceColumns, scanDevice, "`status` = ? AND `deleteAt` = 0", st)
+}
+
+func (mine *Storage) updateDevice(ctx context.Context, uid, operator string, values fields) error {
+	values["operator"] = operator
+	values["updatedAt"] = toStamp(time.Now())
+	_, err := updateOne(ctx, mine.db, nosql.TableDevice, uid, values)
+	return err
+}
+
+func (mine *Storage) UpdateDeviceBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateDevice(ctx, uid, operator, fields{"name": name, "remark": remark})
+}
+
+func (mine *Storage) UpdateDeviceTime(ctx context.Context, uid, operator string, act, expiry uint64) error {
+	return mine.updateDevice(ctx, uid, operator, fields{"activated": act, "expiry": expiry})
+}
+
+func (mine *Storage) UpdateDeviceCertificate(ctx context.Context, uid, data, operator string) error {
+	return mine.updateDevice(ctx, uid, operator, fields{"certificate": data})
+}
+
+func (mine *Storage) UpdateDeviceScene(ctx context.Context, uid, data, operator string) error {
+	return mine.updateDevice(ctx, uid, operator, fields{"scene": data})
+}
+
+func (mine *Storage) UpdateDeviceAspect(ctx context.Context, uid, data, operator string) error {
+	return mine.updateDevice(ctx, uid, operator, fields{"aspect": data})
+}
+
+func (mine *Storage) BindDevice(ctx context.Context, uid, quote, os, operator string, act, expiry uint64) error {
+	return mine.updateDevice(ctx, uid, operator, fields{"quote": quote, "os": os, "activated": act, "expiry": expiry})
+}
+
+func (mine *Storage) UpdateDeviceStatus(ctx context.Context, uid, operator string, st uint8) error {
+	return mine.updateDevice(ctx, uid, operator, fields{"status": st})
+}
+
+func (mine *Storage) UpdateDeviceMeta(ctx context.Context, uid, meta, operator string) error {
+	return mine.updateDevice(ctx, uid, operator, fields{"meta": meta})
+}
+
+func (mine *Storage) UpdateDeviceAuto(ctx context.Context, uid, operator string, auto proxy.AutoInfo) error {
+	return mine.updateDevice(ctx, uid, operator, fields{"auto": encodeJson(auto)})
+}
+
+func (mine *Storage) UpdateDeviceType(ctx context.Context, uid, operator string, tp uint8) error {
+	return mine.updateDevice(ctx, uid, operator, fields{"type": tp})
+}
@@ -0,0 +1,120 @@
+package mysql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+var groupColumns = getTable(nosql.TableGroup).columnNames()
+
+func scanGroup(row scanner) (*nosql.Group, error) {
+	info := new(nosql.Group)
+	var uid, address, members, geo string
+	var created, updated, deleted int64
+	err := row.Scan(&uid, &info.ID, &created, &updated, &deleted, &info.Creator, &info.Operator, &info.Name,
+		&info.Scene, &info.Remark, &info.Contact, &info.Cover, &info.Master, &info.Assistant, &address,
+		&info.Location, &members, &geo, &info.Version)
+	if err != nil {
+		return nil, err
+	}
+	info.UID, _ = primitive.ObjectIDFromHex(uid)
+	info.CreatedTime = fromStamp(created)
+	info.UpdatedTime = fromStamp(updated)
+	info.DeleteTime = fromStamp(deleted)
+	decodeJson(address, &info.Address)
+	decodeJson(members, &info.Members)
+	decodeJson(geo, &info.Geo)
+	return info, nil
+}
+
+func (mine *Storage) CreateGroup(ctx context.Context, info *nosql.Group) error {
+	return insertOne(mine.db, nosql.TableGroup, fields{
+		"uid": info.UID.Hex(), "version": info.Version, "id": info.ID, "createdAt": toStamp(info.CreatedTime), "updatedAt": toStamp(info.UpdatedTime),
+		"deleteAt": toStamp(info.DeleteTime), "creator": info.Creator, "operator": info.Operator, "name": info.Name,
+		"scene": info.Scene, "remark": info.Remark, "contact": info.Contact, "cover": info.Cover, "master": info.Master,
+		"assistant": info.Assistant, "address": encodeJson(info.Address), "location": info.Location,
+		"members": encodeJson(info.Members), "geo": encodeJson(info.Geo),
+	})
+}
+
+func (mine *Storage) GetGroupNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableGroup)
+}
+
+func (mine *Storage) GetGroupCount() int64 {
+	return mine.getCount(nosql.TableGroup)
+}
+
+func (mine *Storage) GetGroup(uid string) (*nosql.Group, error) {
+	return findOne(mine, nosql.TableGroup, groupColumns, scanGroup, "`uid` = ?", uid)
+}
+
+func (mine *Storage) GetGroupByID(id uint64) (*nosql.Group, error) {
+	return findOne(mine, nosql.TableGroup, groupColumns, scanGroup, "`id` = ?", id)
+}
+
+func (mine *Storage) RemoveGroup(ctx context.Context, uid, operator string) error {
+	return removeOne(ctx, mine.db, nosql.TableGroup, uid, operator)
+}
+
+func (mine *Storage) GetAllGroups() ([]*nosql.Group, error) {
+	return findMany(mine, nosql.TableGroup, groupColumns, scanGroup, "`deleteAt` = 0")
+}
+
+func (mine *Storage) GetGroupsByScene(scene string) ([]*nosql.Group, error) {
+	return findMany(mine, nosql.TableGroup, groupColumns, scanGroup, "`scene` = ? AND `deleteAt` = 0", scene)
+}
+
+func (mine *Storage) updateGroup(ctx context.Context, uid, operator string, values fields) error {
+	values["operator"] = operator
+	values["updatedAt"] = toStamp(time.Now())
+	_, err := updateOne(ctx, mine.db, nosql.TableGroup, uid, values)
+	return err
+}
+
+func (mine *Storage) UpdateGroupBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, fields{"name": name, "remark": remark})
+}
+
+func (mine *Storage) UpdateGroupCover(ctx context.Context, uid, cover, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, fields{"cover": cover})
+}
+
+func (mine *Storage) UpdateGroupMembers(ctx context.Context, uid, operator string, members []string) error {
+	return mine.updateGroup(ctx, uid, operator, fields{"members": encodeJson(members)})
+}
+
+func (mine *Storage) UpdateGroupAddress(ctx context.Context, uid, operator string, address nosql.AddressInfo) error {
+	return mine.updateGroup(ctx, uid, operator, fields{"address": encodeJson(address)})
+}
+
+func (mine *Storage) UpdateGroupLocation(ctx context.Context, uid, location, operator string) error {
+	geo, _ := nosql.ParseGeoPoint(location)
+	return mine.updateGroup(ctx, uid, operator, fields{"location": location, "geo": encodeJson(geo)})
+}
+
+func (mine *Storage) UpdateGroupContact(ctx context.Context, uid, phone, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, fields{"contact": phone})
+}
+
+func (mine *Storage) UpdateGroupMaster(ctx context.Context, uid, member, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, fields{"master": member})
+}
+
+func (mine *Storage) UpdateGroupAssistant(ctx context.Context, uid, member, operator string) error {
+	return mine.updateGroup(ctx, uid, operator, fields{"assistant": member})
+}
+
+func (mine *Storage) AppendGroupMember(ctx context.Context, uid, member string) error {
+	return mine.updateJson(ctx, nosql.TableGroup, uid, "members", nil, func(arr []string) []string {
+		return append(arr, member)
+	})
+}
+
+func (mine *Storage) SubtractGroupMember(ctx context.Context, uid string, member string) error {
+	return mine.updateJson(ctx, nosql.TableGroup, uid, "members", nil, func(arr []string) []string {
+		return removeItem(arr, member)
+	})
+}
@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy/nosql"
+)
+
+var maintainColumns = getTable(nosql.TableMaintain).columnNames()
+
+func scanMaintain(row scanner) (*nosql.Maintain, error) {
+	info := new(nosql.Maintain)
+	var uid, maintainers, contents string
+	var created, updated, deleted int64
+	err := row.Scan(&uid, &info.ID, &created, &updated, &deleted, &info.Creator, &info.Operator, &info.Name,
+		&info.Type, &info.Remark, &info.Scene, &info.Area, &info.Date, &info.Device, &info.Submitter,
+		&info.Contacts, &maintainers, &contents, &info.Version)
+	if err != nil {
+		return nil, err
+	}
+	info.UID, _ = primitive.ObjectIDFromHex(uid)
+	info.CreatedTime = fromStamp(created)
+	info.UpdatedTime = fromStamp(updated)
+	info.DeleteTime = fromStamp(deleted)
+	decodeJson(maintainers, &info.Maintainers)
+	decodeJson(contents, &info.Contents)
+	return info, nil
+}
+
+func (mine *Storage) CreateMaintain(ctx context.Context, info *nosql.Maintain) error {
+	return insertOne(mine.db, nosql.TableMaintain, fields{
+		"uid": info.UID.Hex(), "version": info.Version, "id": info.ID, "createdAt": toStamp(info.CreatedTime), "updatedAt": toStamp(info.UpdatedTime),
+		"deleteAt": toStamp(info.DeleteTime), "creator": info.Creator, "operator": info.Operator, "name": info.Name,
+		"type": info.Type, "remark": info.Remark, "scene": info.Scene, "area": info.Area, "date": info.Date,
+		"device": info.Device, "submitter": info.Submitter, "contacts": info.Contacts,
+		"maintainers": encodeJson(info.Maintainers), "contents": encodeJson(info.Contents),
+	})
+}
+
+func (mine *Storage) GetMaintainNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableMaintain)
+}
+
+func (mine *Storage) RemoveMaintain(ctx context.Context, uid, operator string) error {
+	if len(uid) < 2 {
+		return errors.New("db Maintain uid is empty ")
+	}
+	return removeOne(ctx, mine.db, nosql.TableMaintain, uid, operator)
+}
+
+func (mine *Storage) GetMaintain(uid string) (*nosql.Maintain, error) {
+	if len(uid) < 2 {
+		return nil, errors.New("db Maintain uid is empty of GetMaintain")
+	}
+	return findOne(mine, nosql.TableMaintain, maintainColumns, scanMaintain, "`uid` = ?", uid)
+}
+
+func (mine *Storage) GetMaintainsByOwner(owner string) ([]*nosql.Maintain, error) {
+	return findMany(mine, nosql.TableMaintain, maintainColumns, scanMaintain, "`scene` = ?", owner)
+}
+
+func (mine *Storage) GetMaintainsByArea(scene, area string) ([]*nosql.Maintain, error) {
+	return findMany(mine, nosql.TableMaintain, maintainColumns, scanMaintain, "`scene` = ? AND `area` = ?", scene, area)
+}
+
+func (mine *Storage) GetMaintainsByFilter(scene string, filter bson.M, sorts bson.D) ([]*nosql.Maintain, error) {
+	list, err := mine.GetMaintainsByOwner(scene)
+	if err != nil {
+		return nil, err
+	}
+	return nosql.FilterModels(list, filter, sorts)
+}
+
+func (mine *Storage) GetMaintainCount() int64 {
+	return mine.getCount(nosql.TableMaintain)
+}
@@ -0,0 +1,83 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+func (mine *Storage) GetRecycles(scene string) ([]*nosql.RecycleInfo, error) {
+	if len(scene) < 1 {
+		return nil, errors.New("the scene uid is empty")
+	}
+	list := make([]*nosql.RecycleInfo, 0, 20)
+	for _, table := range nosql.RecycleTables() {
+		where := "`scene` = ?"
+		if table == nosql.TableScene {
+			where = "`uid` = ?"
+		}
+		arr, err := mine.findRecycles(table, where, scene)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, arr...)
+	}
+	return list, nil
+}
+
+func (mine *Storage) GetRecyclesBefore(stamp time.Time) ([]*nosql.RecycleInfo, error) {
+	list := make([]*nosql.RecycleInfo, 0, 20)
+	for _, table := range nosql.RecycleTables() {
+		arr, err := mine.findRecycles(table, "`deleteAt` < ?", toStamp(stamp))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, arr...)
+	}
+	return list, nil
+}
+
+func (mine *Storage) RestoreRecycle(ctx context.Context, table, uid, operator string) error {
+	if !nosql.IsRecycleTable(table) {
+		return errors.New("the table not support recycle of " + table)
+	}
+	num, err := updateOne(ctx, mine.db, table, uid, fields{"deleteAt": 0, "operator": operator, "updatedAt": toStamp(time.Now())})
+	if err == nil && num < 1 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (mine *Storage) PurgeRecycle(ctx context.Context, table, uid string) error {
+	if !nosql.IsRecycleTable(table) {
+		return errors.New("the table not support recycle of " + table)
+	}
+	_, err := mine.db.Exec("DELETE FROM "+quote(table)+" WHERE `uid` = ?", uid)
+	return err
+}
+
+func (mine *Storage) findRecycles(table, where string, args ...interface{}) ([]*nosql.RecycleInfo, error) {
+	scene := "`scene`"
+	if table == nosql.TableScene {
+		scene = "`uid`"
+	}
+	rows, err := mine.db.Query("SELECT `uid`, `name`, "+scene+", `operator`, `deleteAt` FROM "+quote(table)+
+		" WHERE `deleteAt` > 0 AND "+where+" ORDER BY `deleteAt`", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make([]*nosql.RecycleInfo, 0, 10)
+	for rows.Next() {
+		info := &nosql.RecycleInfo{Table: table}
+		var deleted int64
+		err = rows.Scan(&info.UID, &info.Name, &info.Scene, &info.Operator, &deleted)
+		if err != nil {
+			return nil, err
+		}
+		info.Deleted = fromStamp(deleted)
+		list = append(list, info)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,116 @@
+package mysql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+var regionColumns = getTable(nosql.TableRegion).columnNames()
+
+func scanRegion(row scanner) (*nosql.Region, error) {
+	info := new(nosql.Region)
+	var uid, address, members, geo string
+	var created, updated, deleted int64
+	err := row.Scan(&uid, &info.ID, &created, &updated, &deleted, &info.Creator, &info.Operator, &info.Name,
+		&info.Scene, &info.Entity, &info.Remark, &info.Code, &info.Parent, &info.Master, &info.Location,
+		&address, &members, &geo, &info.Version)
+	if err != nil {
+		return nil, err
+	}
+	info.UID, _ = primitive.ObjectIDFromHex(uid)
+	info.CreatedTime = fromStamp(created)
+	info.UpdatedTime = fromStamp(updated)
+	info.DeleteTime = fromStamp(deleted)
+	decodeJson(address, &info.Address)
+	decodeJson(members, &info.Members)
+	decodeJson(geo, &info.Geo)
+	return info, nil
+}
+
+func (mine *Storage) CreateRegion(ctx context.Context, info *nosql.Region) error {
+	return insertOne(mine.db, nosql.TableRegion, fields{
+		"uid": info.UID.Hex(), "version": info.Version, "id": info.ID, "createdAt": toStamp(info.CreatedTime), "updatedAt": toStamp(info.UpdatedTime),
+		"deleteAt": toStamp(info.DeleteTime), "creator": info.Creator, "operator": info.Operator, "name": info.Name,
+		"scene": info.Scene, "entity": info.Entity, "remark": info.Remark, "code": info.Code, "parent": info.Parent,
+		"master": info.Master, "location": info.Location, "address": encodeJson(info.Address),
+		"members": encodeJson(info.Members), "geo": encodeJson(info.Geo),
+	})
+}
+
+func (mine *Storage) GetRegionNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableRegion)
+}
+
+func (mine *Storage) GetRegionCount() int64 {
+	return mine.getCount(nosql.TableRegion)
+}
+
+func (mine *Storage) GetRegion(uid string) (*nosql.Region, error) {
+	return findOne(mine, nosql.TableRegion, regionColumns, scanRegion, "`uid` = ?", uid)
+}
+
+func (mine *Storage) GetRegionByID(id uint64) (*nosql.Region, error) {
+	return findOne(mine, nosql.TableRegion, regionColumns, scanRegion, "`id` = ?", id)
+}
+
+func (mine *Storage) RemoveRegion(ctx context.Context, uid, operator string) error {
+	return removeOne(ctx, mine.db, nosql.TableRegion, uid, operator)
+}
+
+func (mine *Storage) GetAllRegions() ([]*nosql.Region, error) {
+	return findMany(mine, nosql.TableRegion, regionColumns, scanRegion, "`deleteAt` = 0")
+}
+
+func (mine *Storage) GetRegionsByScene(scene string) ([]*nosql.Region, error) {
+	return findMany(mine, nosql.TableRegion, regionColumns, scanRegion, "`scene` = ? AND `deleteAt` = 0", scene)
+}
+
+func (mine *Storage) GetRegionsByParent(parent string) ([]*nosql.Region, error) {
+	return findMany(mine, nosql.TableRegion, regionColumns, scanRegion, "`parent` = ? AND `deleteAt` = 0", parent)
+}
+
+func (mine *Storage) updateRegion(ctx context.Context, uid, operator string, values fields) error {
+	values["operator"] = operator
+	values["updatedAt"] = toStamp(time.Now())
+	_, err := updateOne(ctx, mine.db, nosql.TableRegion, uid, values)
+	return err
+}
+
+func (mine *Storage) UpdateRegionBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateRegion(ctx, uid, operator, fields{"name": name, "remark": remark})
+}
+
+func (mine *Storage) UpdateRegionMaster(ctx context.Context, uid, master, operator string) error {
+	return mine.updateRegion(ctx, uid, operator, fields{"master": master})
+}
+
+func (mine *Storage) UpdateRegionEntity(ctx context.Context, uid, entity, operator string) error {
+	return mine.updateRegion(ctx, uid, operator, fields{"entity": entity})
+}
+
+func (mine *Storage) UpdateRegionParent(ctx context.Context, uid, parent, operator string) error {
+	return mine.updateRegion(ctx, uid, operator, fields{"parent": parent})
+}
+
+func (mine *Storage) UpdateRegionAddress(ctx context.Context, uid, operator string, address nosql.AddressInfo) error {
+	return mine.updateRegion(ctx, uid, operator, fields{"address": encodeJson(address)})
+}
+
+func (mine *Storage) UpdateRegionLocation(ctx context.Context, uid, location, operator string) error {
+	geo, _ := nosql.ParseGeoPoint(location)
+	return mine.updateRegion(ctx, uid, operator, fields{"location": location, "geo": encodeJson(geo)})
+}
+
+func (mine *Storage) AppendRegionMember(ctx context.Context, uid string, member string) error {
+	return mine.updateJson(ctx, nosql.TableRegion, uid, "members", nil, func(arr []string) []string {
+		return append(arr, member)
+	})
+}
+
+func (mine *Storage) SubtractRegionMember(ctx context.Context, uid, member string) error {
+	return mine.updateJson(ctx, nosql.TableRegion, uid, "members", nil, func(arr []string) []string {
+		return removeItem(arr, member)
+	})
+}
@@ -0,0 +1,67 @@
+package mysql
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy/nosql"
+	"strconv"
+)
+
+var revisionColumns = getTable(nosql.TableRevision).columnNames()
+
+func scanRevision(row scanner) (*nosql.Revision, error) {
+	info := new(nosql.Revision)
+	var uid string
+	var created int64
+	err := row.Scan(&uid, &created, &info.Table, &info.Target, &info.Scene, &info.Version, &info.Action,
+		&info.Operator, &info.Path, &info.Data)
+	if err != nil {
+		return nil, err
+	}
+	info.UID, _ = primitive.ObjectIDFromHex(uid)
+	info.CreatedTime = fromStamp(created)
+	return info, nil
+}
+
+func (mine *Storage) CreateRevision(info *nosql.Revision) error {
+	if info == nil {
+		return errors.New("the revision is nil")
+	}
+	return insertOne(mine.db, nosql.TableRevision, fields{
+		"uid": info.UID.Hex(), "createdAt": toStamp(info.CreatedTime), "table": info.Table, "target": info.Target,
+		"scene": info.Scene, "version": info.Version, "action": info.Action, "operator": info.Operator,
+		"path": info.Path, "data": info.Data,
+	})
+}
+
+func (mine *Storage) GetRevision(uid string) (*nosql.Revision, error) {
+	return findOne(mine, nosql.TableRevision, revisionColumns, scanRevision, "`uid` = ?", uid)
+}
+
+// GetRevisions 按照时间倒序
+func (mine *Storage) GetRevisions(filter *nosql.RevisionFilter) ([]*nosql.Revision, error) {
+	query := "SELECT " + selectColumns(revisionColumns) + " FROM " + quote(nosql.TableRevision) + " WHERE `table` = ? AND `target` = ?"
+	args := []interface{}{filter.Table, filter.Target}
+	if !filter.Before.IsZero() {
+		query += " AND `createdAt` <= ?"
+		args = append(args, toStamp(filter.Before))
+	}
+	query += " ORDER BY `createdAt` DESC, `uid` DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + strconv.FormatInt(filter.Limit, 10)
+	}
+	rows, err := mine.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make([]*nosql.Revision, 0, 20)
+	for rows.Next() {
+		info, er := scanRevision(rows)
+		if er != nil {
+			return nil, er
+		}
+		list = append(list, info)
+	}
+	return list, rows.Err()
+}
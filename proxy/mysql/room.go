@@ -0,0 +1,92 @@
+package mysql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+var roomColumns = []string{"uid", "id", "createdAt", "updatedAt", "deleteAt", "creator", "operator", "name",
+	"scene", "remark", "quotes", "version"}
+
+func scanRoom(row scanner) (*nosql.Room, error) {
+	info := new(nosql.Room)
+	var uid, quotes string
+	var created, updated, deleted int64
+	err := row.Scan(&uid, &info.ID, &created, &updated, &deleted, &info.Creator, &info.Operator, &info.Name,
+		&info.Scene, &info.Remark, &quotes, &info.Version)
+	if err != nil {
+		return nil, err
+	}
+	info.UID, _ = primitive.ObjectIDFromHex(uid)
+	info.CreatedTime = fromStamp(created)
+	info.UpdatedTime = fromStamp(updated)
+	info.DeleteTime = fromStamp(deleted)
+	decodeJson(quotes, &info.Quotes)
+	return info, nil
+}
+
+func (mine *Storage) CreateRoom(ctx context.Context, info *nosql.Room) error {
+	return insertOne(mine.db, nosql.TableRoom, fields{
+		"uid": info.UID.Hex(), "version": info.Version, "id": info.ID, "createdAt": toStamp(info.CreatedTime), "updatedAt": toStamp(info.UpdatedTime),
+		"deleteAt": toStamp(info.DeleteTime), "creator": info.Creator, "operator": info.Operator, "name": info.Name,
+		"scene": info.Scene, "remark": info.Remark, "quotes": encodeJson(info.Quotes), "displays": "[]",
+	})
+}
+
+func (mine *Storage) GetRoomNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableRoom)
+}
+
+func (mine *Storage) GetRoomCount() int64 {
+	return mine.getCount(nosql.TableRoom)
+}
+
+func (mine *Storage) GetRoom(uid string) (*nosql.Room, error) {
+	return findOne(mine, nosql.TableRoom, roomColumns, scanRoom, "`uid` = ?", uid)
+}
+
+func (mine *Storage) GetRoomByID(id uint64) (*nosql.Room, error) {
+	return findOne(mine, nosql.TableRoom, roomColumns, scanRoom, "`id` = ?", id)
+}
+
+func (mine *Storage) RemoveRoom(ctx context.Context, uid, operator string) error {
+	return removeOne(ctx, mine.db, nosql.TableRoom, uid, operator)
+}
+
+func (mine *Storage) GetAllRooms() ([]*nosql.Room, error) {
+	return findMany(mine, nosql.TableRoom, roomColumns, scanRoom, "`deleteAt` = 0")
+}
+
+func (mine *Storage) GetRoomsByScene(scene string) ([]*nosql.Room, error) {
+	return findMany(mine, nosql.TableRoom, roomColumns, scanRoom, "`scene` = ? AND `deleteAt` = 0", scene)
+}
+
+func (mine *Storage) updateRoom(ctx context.Context, uid, operator string, values fields) error {
+	values["operator"] = operator
+	values["updatedAt"] = toStamp(time.Now())
+	_, err := updateOne(ctx, mine.db, nosql.TableRoom, uid, values)
+	return err
+}
+
+func (mine *Storage) UpdateRoomBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateRoom(ctx, uid, operator, fields{"name": name, "remark": remark})
+}
+
+func (mine *Storage) UpdateRoomDisplays(ctx context.Context, uid, operator string, list []*proxy.DisplayInfo) error {
+	return mine.updateRoom(ctx, uid, operator, fields{"displays": encodeJson(list)})
+}
+
+func (mine *Storage) AppendRoomQuotes(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.updateJson(ctx, nosql.TableRoom, uid, "quotes", fields{"operator": operator}, func(list []string) []string {
+		return appendItems(list, arr)
+	})
+}
+
+func (mine *Storage) SubtractRoomQuotes(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.updateJson(ctx, nosql.TableRoom, uid, "quotes", fields{"operator": operator}, func(list []string) []string {
+		return removeItems(list, arr)
+	})
+}
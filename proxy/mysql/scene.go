@@ -0,0 +1,178 @@
+package mysql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+var sceneColumns = getTable(nosql.TableScene).columnNames()
+
+func scanScene(row scanner) (*nosql.Scene, error) {
+	info := new(nosql.Scene)
+	var uid, address, members, parents, questions, geo string
+	var created, updated, deleted int64
+	err := row.Scan(&uid, &info.ID, &created, &updated, &deleted, &info.Creator, &info.Operator, &info.Name,
+		&info.Type, &info.Status, &info.Limit, &info.Short, &info.Cover, &info.Master, &info.Remark, &info.Entity,
+		&info.Location, &info.Supporter, &address, &members, &parents, &questions, &geo, &info.Version)
+	if err != nil {
+		return nil, err
+	}
+	info.UID, _ = primitive.ObjectIDFromHex(uid)
+	info.CreatedTime = fromStamp(created)
+	info.UpdatedTime = fromStamp(updated)
+	info.DeleteTime = fromStamp(deleted)
+	decodeJson(address, &info.Address)
+	decodeJson(members, &info.Members)
+	decodeJson(parents, &info.Parents)
+	decodeJson(questions, &info.Questions)
+	decodeJson(geo, &info.Geo)
+	return info, nil
+}
+
+func (mine *Storage) CreateScene(ctx context.Context, info *nosql.Scene) error {
+	return insertOne(mine.db, nosql.TableScene, fields{
+		"uid": info.UID.Hex(), "version": info.Version, "id": info.ID, "createdAt": toStamp(info.CreatedTime), "updatedAt": toStamp(info.UpdatedTime),
+		"deleteAt": toStamp(info.DeleteTime), "creator": info.Creator, "operator": info.Operator, "name": info.Name,
+		"type": info.Type, "status": info.Status, "limit": info.Limit, "short": info.Short, "cover": info.Cover,
+		"master": info.Master, "remark": info.Remark, "entity": info.Entity, "location": info.Location,
+		"supporter": info.Supporter, "address": encodeJson(info.Address), "members": encodeJson(info.Members),
+		"parents": encodeJson(info.Parents), "questions": encodeJson(info.Questions), "geo": encodeJson(info.Geo),
+	})
+}
+
+func (mine *Storage) GetSceneNextID() (uint64, error) {
+	return mine.GetSequenceNext(nosql.TableScene)
+}
+
+func (mine *Storage) GetScene(uid string) (*nosql.Scene, error) {
+	return findOne(mine, nosql.TableScene, sceneColumns, scanScene, "`uid` = ?", uid)
+}
+
+func (mine *Storage) GetSceneByMaster(user string) (*nosql.Scene, error) {
+	return findOne(mine, nosql.TableScene, sceneColumns, scanScene, "`master` = ?", user)
+}
+
+func (mine *Storage) GetAllScenes() ([]*nosql.Scene, error) {
+	return findMany(mine, nosql.TableScene, sceneColumns, scanScene, "`deleteAt` = 0")
+}
+
+func (mine *Storage) updateScene(ctx context.Context, uid, operator string, values fields) error {
+	values["operator"] = operator
+	values["updatedAt"] = toStamp(time.Now())
+	_, err := updateOne(ctx, mine.db, nosql.TableScene, uid, values)
+	return err
+}
+
+func (mine *Storage) UpdateSceneBase(ctx context.Context, uid, name, remark, operator string) error {
+	return mine.updateScene(ctx, uid, operator, fields{"name": name, "remark": remark})
+}
+
+func (mine *Storage) UpdateSceneMaster(ctx context.Context, uid, master, operator string) error {
+	return mine.updateScene(ctx, uid, operator, fields{"master": master})
+}
+
+func (mine *Storage) UpdateSceneCover(ctx context.Context, uid, icon, operator string) error {
+	return mine.updateScene(ctx, uid, operator, fields{"cover": icon})
+}
+
+func (mine *Storage) UpdateSceneType(ctx context.Context, uid, operator string, tp uint8) error {
+	return mine.updateScene(ctx, uid, operator, fields{"type": tp})
+}
+
+func (mine *Storage) UpdateSceneLocal(ctx context.Context, uid, local, operator string) error {
+	geo, _ := nosql.ParseGeoPoint(local)
+	return mine.updateScene(ctx, uid, operator, fields{"location": local, "geo": encodeJson(geo)})
+}
+
+func (mine *Storage) UpdateSceneAddress(ctx context.Context, uid, operator string, address nosql.AddressInfo) error {
+	return mine.updateScene(ctx, uid, operator, fields{"address": encodeJson(address)})
+}
+
+func (mine *Storage) UpdateSceneStatus(ctx context.Context, uid string, status uint8, operator string) error {
+	return mine.updateScene(ctx, uid, operator, fields{"status": status})
+}
+
+func (mine *Storage) AppendSceneQuestions(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.updateJson(ctx, nosql.TableScene, uid, "questions", fields{"operator": operator}, func(list []string) []string {
+		return appendItems(list, arr)
+	})
+}
+
+func (mine *Storage) SubtractSceneQuestions(ctx context.Context, uid, operator string, arr []string) error {
+	return mine.updateJson(ctx, nosql.TableScene, uid, "questions", fields{"operator": operator}, func(list []string) []string {
+		return removeItems(list, arr)
+	})
+}
+
+func (mine *Storage) UpdateSceneLimit(ctx context.Context, uid, operator string, limit uint16) error {
+	return mine.updateScene(ctx, uid, operator, fields{"limit": limit})
+}
+
+func (mine *Storage) UpdateSceneShort(ctx context.Context, uid, operator, name string) error {
+	return mine.updateScene(ctx, uid, operator, fields{"short": name})
+}
+
+func (mine *Storage) UpdateSceneSupporter(ctx context.Context, uid, supporter, operator string) error {
+	return mine.updateScene(ctx, uid, operator, fields{"supporter": supporter})
+}
+
+func (mine *Storage) UpdateSceneParents(ctx context.Context, uid, operator string, list []string) error {
+	return mine.updateScene(ctx, uid, operator, fields{"parents": encodeJson(list)})
+}
+
+func (mine *Storage) RemoveScene(ctx context.Context, uid, operator string) error {
+	return removeOne(ctx, mine.db, nosql.TableScene, uid, operator)
+}
+
+func (mine *Storage) RemoveSceneCascade(ctx context.Context, depends *nosql.SceneDepends, detach bool, operator string, stamp time.Time) error {
+	tx, err := mine.db.Begin()
+	if err != nil {
+		return err
+	}
+	ctx, exps := nosql.WithExpectTx(ctx)
+	removes := map[string][]string{
+		nosql.TableGroup:    depends.Groups,
+		nosql.TableRoom:     depends.Rooms,
+		nosql.TableRegion:   depends.Regions,
+		nosql.TableArea:     depends.Areas,
+		nosql.TableMaintain: depends.Maintains,
+		nosql.TableScene:    {depends.Scene},
+	}
+	values := fields{"operator": operator, "deleteAt": toStamp(stamp)}
+	if detach {
+		for _, uid := range depends.Devices {
+			_, err = updateOne(ctx, tx, nosql.TableDevice, uid, fields{"scene": "", "status": nosql.DeviceDetached,
+				"operator": operator, "updatedAt": toStamp(stamp)})
+			if err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+		}
+	} else {
+		removes[nosql.TableDevice] = depends.Devices
+	}
+	for table, list := range removes {
+		for _, uid := range list {
+			_, err = updateOne(ctx, tx, table, uid, values)
+			if err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+		}
+	}
+	return commit(tx, exps)
+}
+
+func (mine *Storage) AppendSceneMember(ctx context.Context, uid string, member string) error {
+	return mine.updateJson(ctx, nosql.TableScene, uid, "members", nil, func(arr []string) []string {
+		return append(arr, member)
+	})
+}
+
+func (mine *Storage) SubtractSceneMember(ctx context.Context, uid, member string) error {
+	return mine.updateJson(ctx, nosql.TableScene, uid, "members", nil, func(arr []string) []string {
+		return removeItem(arr, member)
+	})
+}
@@ -0,0 +1,107 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+func (mine *Storage) GetSequenceNext(name string) (uint64, error) {
+	return mine.GetSequenceBlock(name, 1)
+}
+
+// GetSequenceBlock 在事务中递增计数，不存在时插入新的计数，返回预留的第一个ID
+func (mine *Storage) GetSequenceBlock(name string, num uint64) (uint64, error) {
+	if len(name) < 1 {
+		return 0, errors.New("the sequence name is empty")
+	}
+	if num < 1 {
+		return 0, errors.New("the sequence number is zero")
+	}
+	id, err := mine.sequenceBlock(name, num)
+	if err != nil && isDuplicate(err) {
+		//并发插入同一个计数时唯一索引冲突，此时记录已经存在，再执行一次即可
+		id, err = mine.sequenceBlock(name, num)
+	}
+	return id, err
+}
+
+func (mine *Storage) sequenceBlock(name string, num uint64) (uint64, error) {
+	tx, err := mine.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	now := toStamp(time.Now())
+	result, err := tx.Exec("UPDATE `"+nosql.TableSequence+"` SET `count` = `count` + ?, `updatedAt` = ? WHERE `name` = ?", num, now, name)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	rows, _ := result.RowsAffected()
+	if rows < 1 {
+		err = insertOne(tx, nosql.TableSequence, fields{"uid": primitive.NewObjectID().Hex(), "name": name,
+			"createdAt": now, "updatedAt": now, "deleteAt": 0, "count": num})
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+	var count uint64
+	err = tx.QueryRow("SELECT `count` FROM `"+nosql.TableSequence+"` WHERE `name` = ?", name).Scan(&count)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	return count - num + 1, tx.Commit()
+}
+
+// isDuplicate 唯一索引冲突，mysql并发插入时也可能因为间隙锁返回死锁，同样可以重试
+func isDuplicate(err error) bool {
+	var my *driver.MySQLError
+	if errors.As(err, &my) {
+		return my.Number == 1062 || my.Number == 1213
+	}
+	var lite sqlite3.Error
+	if errors.As(err, &lite) {
+		return lite.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	return false
+}
+
+func (mine *Storage) GetSequenceCount(name string) (uint64, error) {
+	var count uint64
+	err := mine.db.QueryRow("SELECT `count` FROM `"+nosql.TableSequence+"` WHERE `name` = ?", name).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return count, err
+}
+
+func (mine *Storage) RepairSequences() ([]*nosql.SequenceRepair, error) {
+	list := make([]*nosql.SequenceRepair, 0, 2)
+	for _, name := range nosql.SequenceTables() {
+		var top sql.NullInt64
+		err := mine.db.QueryRow("SELECT MAX(`id`) FROM " + quote(name)).Scan(&top)
+		if err != nil {
+			return list, err
+		}
+		count, err := mine.GetSequenceCount(name)
+		if err != nil {
+			return list, err
+		}
+		if !top.Valid || count >= uint64(top.Int64) {
+			continue
+		}
+		//计数不存在时先创建，然后补齐差值
+		_, err = mine.GetSequenceBlock(name, uint64(top.Int64)-count)
+		if err != nil {
+			return list, err
+		}
+		list = append(list, &nosql.SequenceRepair{Name: name, Count: count, Max: uint64(top.Int64)})
+	}
+	return list, nil
+}
@@ -0,0 +1,189 @@
+package mysql
+
+import (
+	"omo.msa.organization/proxy/nosql"
+	"strings"
+)
+
+const (
+	kindKey    = "key"
+	kindString = "string"
+	kindText   = "text"
+	kindInt    = "int"
+)
+
+type column struct {
+	name string
+	kind string
+}
+
+type tableDefine struct {
+	name    string
+	columns []column
+	indexes []string
+	uniques []string
+}
+
+var baseColumns = []column{
+	{"uid", kindKey},
+	{"id", kindInt},
+	{"createdAt", kindInt},
+	{"updatedAt", kindInt},
+	{"deleteAt", kindInt},
+	{"creator", kindKey},
+	{"operator", kindKey},
+	{"name", kindString},
+}
+
+var tables = []*tableDefine{
+	{name: nosql.TableSequence, columns: []column{
+		{"uid", kindKey}, {"name", kindKey}, {"createdAt", kindInt}, {"updatedAt", kindInt},
+		{"deleteAt", kindInt}, {"count", kindInt},
+	}, uniques: []string{"name"}},
+	{name: nosql.TableAudit, columns: []column{
+		{"uid", kindKey}, {"createdAt", kindInt}, {"table", kindKey}, {"target", kindKey}, {"scene", kindKey},
+		{"action", kindKey}, {"operator", kindKey}, {"path", kindString}, {"changes", kindText},
+	}, indexes: []string{"scene", "target", "operator", "createdAt"}},
+	{name: nosql.TableRevision, columns: []column{
+		{"uid", kindKey}, {"createdAt", kindInt}, {"table", kindKey}, {"target", kindKey}, {"scene", kindKey},
+		{"version", kindInt}, {"action", kindKey}, {"operator", kindKey}, {"path", kindString}, {"data", kindText},
+	}, indexes: []string{"target"}},
+	{name: nosql.TableScene, columns: withBase(
+		column{"type", kindInt}, column{"status", kindInt}, column{"limit", kindInt},
+		column{"short", kindString}, column{"cover", kindString}, column{"master", kindKey},
+		column{"remark", kindText}, column{"entity", kindKey}, column{"location", kindString},
+		column{"supporter", kindKey}, column{"address", kindText}, column{"members", kindText},
+		column{"parents", kindText}, column{"questions", kindText}, column{"geo", kindText},
+	), indexes: []string{"master"}},
+	{name: nosql.TableGroup, columns: withBase(
+		column{"scene", kindKey}, column{"remark", kindText}, column{"contact", kindString},
+		column{"cover", kindString}, column{"master", kindKey}, column{"assistant", kindKey},
+		column{"address", kindText}, column{"location", kindString}, column{"members", kindText},
+		column{"geo", kindText},
+	), indexes: []string{"scene"}},
+	{name: nosql.TableRoom, columns: withBase(
+		column{"scene", kindKey}, column{"remark", kindText}, column{"quotes", kindText},
+		column{"displays", kindText},
+	), indexes: []string{"scene"}},
+	{name: nosql.TableRegion, columns: withBase(
+		column{"scene", kindKey}, column{"entity", kindKey}, column{"remark", kindText},
+		column{"code", kindString}, column{"parent", kindKey}, column{"master", kindKey},
+		column{"location", kindString}, column{"address", kindText}, column{"members", kindText},
+		column{"geo", kindText},
+	), indexes: []string{"scene", "parent"}},
+	{name: nosql.TableArea, columns: withBase(
+		column{"type", kindInt}, column{"remark", kindText}, column{"scene", kindKey},
+		column{"parent", kindKey}, column{"template", kindKey}, column{"width", kindInt},
+		column{"height", kindInt}, column{"limit", kindInt}, column{"device", kindKey},
+		column{"question", kindKey}, column{"catalog", kindKey}, column{"displays", kindText},
+		column{"assets", kindText}, column{"modules", kindText}, column{"sources", kindText},
+	), indexes: []string{"scene", "parent", "device"}},
+	{name: nosql.TableDevice, columns: withBase(
+		column{"scene", kindKey}, column{"type", kindInt}, column{"status", kindInt},
+		column{"remark", kindText}, column{"sn", kindString}, column{"os", kindString},
+		column{"aspect", kindString}, column{"expiry", kindInt}, column{"activated", kindInt},
+		column{"quote", kindKey}, column{"certificate", kindText}, column{"meta", kindText},
+		column{"auto", kindText},
+	), indexes: []string{"scene", "sn", "status"}},
+	{name: nosql.TableMaintain, columns: withBase(
+		column{"type", kindInt}, column{"remark", kindText}, column{"scene", kindKey},
+		column{"area", kindKey}, column{"date", kindString}, column{"device", kindKey},
+		column{"submitter", kindKey}, column{"contacts", kindString}, column{"maintainers", kindText},
+		column{"contents", kindText},
+	), indexes: []string{"scene", "area"}},
+}
+
+// withBase 版本字段在最后，已经存在的表追加这一列时顺序一致
+func withBase(list ...column) []column {
+	arr := make([]column, 0, len(baseColumns)+len(list)+1)
+	arr = append(arr, baseColumns...)
+	arr = append(arr, list...)
+	return append(arr, column{"version", kindInt})
+}
+
+func (mine *tableDefine) hasColumn(name string) bool {
+	for _, item := range mine.columns {
+		if item.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (mine *tableDefine) columnNames() []string {
+	arr := make([]string, 0, len(mine.columns))
+	for _, item := range mine.columns {
+		arr = append(arr, item.name)
+	}
+	return arr
+}
+
+// schema 生成建表语句，mysql的索引在建表语句中声明，sqlite需要单独创建
+func (mine *tableDefine) schema(kind string) []string {
+	list := make([]string, 0, len(mine.columns)+len(mine.indexes))
+	for _, item := range mine.columns {
+		line := quote(item.name) + " " + columnType(kind, item.kind)
+		if item.name == "uid" {
+			line += " NOT NULL PRIMARY KEY"
+		}
+		list = append(list, line)
+	}
+	if kind == KindMysql {
+		for _, index := range mine.uniques {
+			list = append(list, "UNIQUE INDEX "+quote("uni_"+index)+" ("+quote(index)+")")
+		}
+		for _, index := range mine.indexes {
+			list = append(list, "INDEX "+quote("idx_"+index)+" ("+quote(index)+")")
+		}
+	}
+	query := "CREATE TABLE IF NOT EXISTS " + quote(mine.name) + " (" + strings.Join(list, ", ") + ")"
+	if kind == KindMysql {
+		query += " DEFAULT CHARSET=utf8mb4"
+	}
+	arr := []string{query}
+	if kind == KindSqlite {
+		for _, index := range mine.uniques {
+			arr = append(arr, "CREATE UNIQUE INDEX IF NOT EXISTS "+quote("uni_"+mine.name+"_"+index)+" ON "+quote(mine.name)+" ("+quote(index)+")")
+		}
+		for _, index := range mine.indexes {
+			arr = append(arr, "CREATE INDEX IF NOT EXISTS "+quote("idx_"+mine.name+"_"+index)+" ON "+quote(mine.name)+" ("+quote(index)+")")
+		}
+	}
+	return arr
+}
+
+// columnDefault 新增的列需要默认值，否则读取旧的记录时为NULL
+func columnDefault(tp string) string {
+	switch tp {
+	case kindInt:
+		return " NOT NULL DEFAULT 0"
+	case kindKey, kindString:
+		return " NOT NULL DEFAULT ''"
+	}
+	return ""
+}
+
+func columnType(kind, tp string) string {
+	switch tp {
+	case kindKey:
+		return "VARCHAR(64)"
+	case kindString:
+		return "VARCHAR(255)"
+	case kindInt:
+		return "BIGINT"
+	default:
+		if kind == KindMysql {
+			return "MEDIUMTEXT"
+		}
+		return "TEXT"
+	}
+}
+
+func getTable(name string) *tableDefine {
+	for _, table := range tables {
+		if table.name == name {
+			return table
+		}
+	}
+	return nil
+}
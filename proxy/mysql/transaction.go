@@ -0,0 +1,80 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"omo.msa.organization/proxy/nosql"
+	"time"
+)
+
+func (mine *Storage) RunTransaction(ctx context.Context, ops []*nosql.WriteOp) error {
+	tx, err := mine.db.Begin()
+	if err != nil {
+		return err
+	}
+	ctx, exps := nosql.WithExpectTx(ctx)
+	for _, op := range ops {
+		err = mine.applyOp(ctx, tx, op)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return commit(tx, exps)
+}
+
+// commit 事务提交成功后才修改请求期望的版本
+func commit(tx *sql.Tx, exps *nosql.ExpectTx) error {
+	err := tx.Commit()
+	if err != nil {
+		return err
+	}
+	exps.Commit()
+	return nil
+}
+
+// applyOp 受影响的行数在值没有变化时为0，所以先确认记录存在
+func (mine *Storage) applyOp(ctx context.Context, tx *sql.Tx, op *nosql.WriteOp) error {
+	if getTable(op.Table) == nil {
+		return errors.New("the table not support of " + op.Table)
+	}
+	var num int
+	err := tx.QueryRow("SELECT COUNT(*) FROM "+quote(op.Table)+" WHERE `uid` = ?", op.UID).Scan(&num)
+	if err != nil {
+		return err
+	}
+	if num < 1 {
+		return ErrNotFound
+	}
+	values := make(fields, len(op.Fields))
+	for key, value := range op.Fields {
+		values[key] = toColumn(value)
+	}
+	for _, items := range []map[string][]string{op.Pulls, op.Adds} {
+		for key := range items {
+			var data string
+			err = tx.QueryRow("SELECT "+quote(key)+" FROM "+quote(op.Table)+" WHERE `uid` = ?"+mine.lockRow(), op.UID).Scan(&data)
+			if err != nil {
+				return err
+			}
+			arr := make([]string, 0, 5)
+			decodeJson(data, &arr)
+			arr = removeItems(arr, op.Pulls[key])
+			values[key] = encodeJson(appendItems(arr, op.Adds[key]))
+		}
+	}
+	_, err = updateOne(ctx, tx, op.Table, op.UID, values)
+	return err
+}
+
+// toColumn 时间保存为毫秒，数组以及结构体保存为json
+func toColumn(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		return toStamp(v)
+	case string, bool, int, int32, int64, uint, uint8, uint16, uint32, uint64, float64:
+		return v
+	}
+	return encodeJson(value)
+}
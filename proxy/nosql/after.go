@@ -0,0 +1,98 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+)
+
+/**
+写入后的文档，用于审计以及历史版本，需要和写入是同一次原子操作的结果，
+调用者通过context请求，mongo使用FindOneAndUpdate返回修改后的文档，其他存储在同一个锁或者事务中读取
+*/
+
+type afterKey struct{}
+
+// Afters 一次请求写入后的文档，同一个文档多次写入时保留最后一次
+type Afters struct {
+	lock sync.Mutex
+	docs map[string]interface{}
+}
+
+// WithAfters 之后使用返回的context写入时记录写入后的文档
+func WithAfters(ctx context.Context) (context.Context, *Afters) {
+	tmp := &Afters{docs: make(map[string]interface{}, 1)}
+	return context.WithValue(ctx, afterKey{}, tmp), tmp
+}
+
+// AftersOf 调用者没有请求时为nil
+func AftersOf(ctx context.Context) *Afters {
+	if ctx == nil {
+		return nil
+	}
+	tmp, _ := ctx.Value(afterKey{}).(*Afters)
+	return tmp
+}
+
+// Set 存储写入成功后调用，doc为模型的指针
+func (mine *Afters) Set(table, uid string, doc interface{}) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	mine.docs[table+"/"+uid] = doc
+}
+
+// Get 没有写入或者存储没有返回时为nil
+func (mine *Afters) Get(table, uid string) interface{} {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.docs[table+"/"+uid]
+}
+
+// NewModel 表对应的模型，不支持的表为nil
+func NewModel(table string) interface{} {
+	switch table {
+	case TableScene:
+		return new(Scene)
+	case TableGroup:
+		return new(Group)
+	case TableRoom:
+		return new(Room)
+	case TableRegion:
+		return new(Region)
+	case TableArea:
+		return new(Area)
+	case TableDevice:
+		return new(Invite)
+	case TableMaintain:
+		return new(Maintain)
+	}
+	return nil
+}
+
+// updateAfter 请求写入后的文档时使用FindOneAndUpdate，返回匹配的数量
+func updateAfter(ctx context.Context, c *mongo.Collection, table string, filter, update bson.M) (int64, error) {
+	afters := AftersOf(ctx)
+	model := NewModel(table)
+	if afters == nil || model == nil {
+		result, err := c.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return 0, err
+		}
+		return result.MatchedCount, nil
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := c.FindOneAndUpdate(ctx, filter, update, opts).Decode(model)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if uid, ok := filter["_id"].(primitive.ObjectID); ok {
+		afters.Set(table, uid.Hex(), model)
+	}
+	return 1, nil
+}
@@ -2,6 +2,7 @@ package nosql
 
 import (
 	"context"
+	"errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"omo.msa.organization/proxy"
@@ -14,6 +15,7 @@ type Area struct {
 	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
 	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Version     uint32             `json:"version" bson:"version"` //每次修改加1，用于乐观锁
 	Creator     string             `json:"creator" bson:"creator"`
 	Operator    string             `json:"operator" bson:"operator"`
 
@@ -35,17 +37,16 @@ type Area struct {
 	Sources  []*proxy.PairInfo `json:"sources" bson:"sources"`
 }
 
-func CreateArea(info *Area) error {
-	_, err := insertOne(TableArea, info)
+func CreateArea(ctx context.Context, info *Area) error {
+	_, err := insertOne(ctx, TableArea, info)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetAreaNextID() uint64 {
-	num, _ := getSequenceNext(TableArea)
-	return num
+func GetAreaNextID() (uint64, error) {
+	return getSequenceNext(TableArea)
 }
 
 func GetArea(uid string) (*Area, error) {
@@ -169,79 +170,123 @@ func GetAllAreas() ([]*Area, error) {
 	return items, nil
 }
 
-func UpdateAreaBase(uid, name, remark, operator string) error {
+func UpdateAreaBase(ctx context.Context, uid, name, remark, operator string) error {
 	msg := bson.M{"name": name, "remark": remark, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
+	_, err := updateOne(ctx, TableArea, uid, msg)
 	return err
 }
 
-func UpdateAreaAssets(uid, operator string, assets []string) error {
+func UpdateAreaAssets(ctx context.Context, uid, operator string, assets []string) error {
 	msg := bson.M{"assets": assets, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
+	_, err := updateOne(ctx, TableArea, uid, msg)
 	return err
 }
 
-func UpdateAreaTemplate(uid, template, operator string) error {
+func UpdateAreaTemplate(ctx context.Context, uid, template, operator string) error {
 	msg := bson.M{"template": template, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
+	_, err := updateOne(ctx, TableArea, uid, msg)
 	return err
 }
 
-func UpdateAreaDevice(uid, device, operator string, tp uint32) error {
+func UpdateAreaDevice(ctx context.Context, uid, device, operator string, tp uint32) error {
 	msg := bson.M{"device": device, "type": tp, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
+	_, err := updateOne(ctx, TableArea, uid, msg)
 	return err
 }
 
-func UpdateAreaCatalog(uid, catalog, operator string) error {
+func UpdateAreaCatalog(ctx context.Context, uid, catalog, operator string) error {
 	msg := bson.M{"catalog": catalog, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
+	_, err := updateOne(ctx, TableArea, uid, msg)
 	return err
 }
 
-func UpdateAreaDevice2(uid, device, operator string) error {
+func UpdateAreaDevice2(ctx context.Context, uid, device, operator string) error {
 	msg := bson.M{"device": device, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
+	_, err := updateOne(ctx, TableArea, uid, msg)
 	return err
 }
 
-func UpdateAreaType(uid, operator string, tp uint32) error {
+func UpdateAreaType(ctx context.Context, uid, operator string, tp uint32) error {
 	msg := bson.M{"type": tp, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
+	_, err := updateOne(ctx, TableArea, uid, msg)
 	return err
 }
 
-func UpdateAreaQuestion(uid, question, operator string) error {
+func UpdateAreaQuestion(ctx context.Context, uid, question, operator string) error {
 	msg := bson.M{"question": question, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
+	_, err := updateOne(ctx, TableArea, uid, msg)
 	return err
 }
 
-func UpdateAreaLimit(uid, operator string, num uint32) error {
+func UpdateAreaLimit(ctx context.Context, uid, operator string, num uint32) error {
 	msg := bson.M{"limit": num, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
+	_, err := updateOne(ctx, TableArea, uid, msg)
 	return err
 }
 
-func UpdateAreaDisplays(uid, operator string, displays []string) error {
+func UpdateAreaDisplays(ctx context.Context, uid, operator string, displays []string) error {
 	msg := bson.M{"displays": displays, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
+	_, err := updateOne(ctx, TableArea, uid, msg)
 	return err
 }
 
-func UpdateAreaModules(uid, operator string, list []*proxy.PairInfo) error {
-	msg := bson.M{"modules": list, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
-	return err
+// SetAreaModule 按照key修改或者追加一个模块，不影响其他模块
+func SetAreaModule(ctx context.Context, uid, operator, key, value string) error {
+	return setAreaPair(ctx, uid, "modules", operator, key, value)
 }
 
-func UpdateAreaSources(uid, operator string, list []*proxy.PairInfo) error {
-	msg := bson.M{"sources": list, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableArea, uid, msg)
-	return err
+func SetAreaSource(ctx context.Context, uid, operator, key, value string) error {
+	return setAreaPair(ctx, uid, "sources", operator, key, value)
+}
+
+// setAreaPair 先修改已经存在的元素，不存在时追加，并发追加同一个key时重试
+func setAreaPair(ctx context.Context, uid, field, operator, key, value string) error {
+	objID, err := primitive.ObjectIDFromHex(uid)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		set := bson.M{field + ".$.value": value, "operator": operator, "updatedAt": time.Now()}
+		filter := bson.M{"_id": objID, field + ".key": key}
+		exp := expectFilter(ctx, TableArea, uid, filter)
+		num, er := updateMatched(ctx, TableArea, filter, bson.M{"$set": set, "$inc": versionInc})
+		if er != nil {
+			return er
+		}
+		if num > 0 {
+			return expectResult(ctx, exp, TableArea, uid, num)
+		}
+		pair := &proxy.PairInfo{Key: key, Value: value}
+		set = bson.M{"operator": operator, "updatedAt": time.Now()}
+		update := bson.M{"$push": bson.M{field: pair}, "$set": set, "$inc": versionInc}
+		filter = bson.M{"_id": objID, field + ".key": bson.M{"$ne": key}}
+		exp = expectFilter(ctx, TableArea, uid, filter)
+		num, er = updateMatched(ctx, TableArea, filter, update)
+		if er != nil {
+			return er
+		}
+		if num > 0 {
+			return expectResult(ctx, exp, TableArea, uid, num)
+		}
+		if exp != nil {
+			current, er := GetVersion(TableArea, uid)
+			if er != nil {
+				return er
+			}
+			if current != exp.Version() {
+				return exp.Fail(current)
+			}
+			continue
+		}
+		had, _ := hadOne(TableArea, bson.M{"_id": objID})
+		if !had {
+			return errors.New("not found the area of " + uid)
+		}
+	}
+	return errors.New("update the " + field + " of area failed by concurrent")
 }
 
-func RemoveArea(uid, operator string) error {
-	_, err := removeOne(TableArea, uid, operator)
+func RemoveArea(ctx context.Context, uid, operator string) error {
+	_, err := removeOne(ctx, TableArea, uid, operator)
 	return err
 }
@@ -0,0 +1,124 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+/**
+审计记录，只追加不修改，记录每次增删改的操作者、调用路径以及字段的变化
+*/
+
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditRemove  = "remove"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// Audit 一个对象的一次修改
+type Audit struct {
+	UID         primitive.ObjectID `json:"uid" bson:"_id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	Table       string             `json:"table" bson:"table"`
+	Target      string             `json:"target" bson:"target"`
+	Scene       string             `json:"scene" bson:"scene"`
+	Action      string             `json:"action" bson:"action"`
+	Operator    string             `json:"operator" bson:"operator"`
+	Path        string             `json:"path" bson:"path"`
+	Changes     []*AuditChange     `json:"changes" bson:"changes"`
+}
+
+// AuditChange 字段修改前后的值，json格式
+type AuditChange struct {
+	Field  string `json:"field" bson:"field"`
+	Before string `json:"before" bson:"before"`
+	After  string `json:"after" bson:"after"`
+}
+
+// AuditFilter 查询条件，为空的条件不限制，按照时间倒序
+type AuditFilter struct {
+	Scene    string
+	Table    string
+	Target   string
+	Operator string
+	From     time.Time
+	To       time.Time
+	Limit    int64
+}
+
+// Match 内存存储使用的过滤
+func (mine *AuditFilter) Match(info *Audit) bool {
+	if len(mine.Scene) > 0 && info.Scene != mine.Scene {
+		return false
+	}
+	if len(mine.Table) > 0 && info.Table != mine.Table {
+		return false
+	}
+	if len(mine.Target) > 0 && info.Target != mine.Target {
+		return false
+	}
+	if len(mine.Operator) > 0 && info.Operator != mine.Operator {
+		return false
+	}
+	if !mine.From.IsZero() && info.CreatedTime.Before(mine.From) {
+		return false
+	}
+	if !mine.To.IsZero() && !info.CreatedTime.Before(mine.To) {
+		return false
+	}
+	return true
+}
+
+func CreateAudit(info *Audit) error {
+	_, err := insertOne(context.Background(), TableAudit, info)
+	return err
+}
+
+func GetAudits(filter *AuditFilter) ([]*Audit, error) {
+	query := bson.M{}
+	if len(filter.Scene) > 0 {
+		query["scene"] = filter.Scene
+	}
+	if len(filter.Table) > 0 {
+		query["table"] = filter.Table
+	}
+	if len(filter.Target) > 0 {
+		query["target"] = filter.Target
+	}
+	if len(filter.Operator) > 0 {
+		query["operator"] = filter.Operator
+	}
+	stamp := bson.M{}
+	if !filter.From.IsZero() {
+		stamp["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		stamp["$lt"] = filter.To
+	}
+	if len(stamp) > 0 {
+		query["createdAt"] = stamp
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+	cursor, err1 := findManyByOpts(TableAudit, query, opts)
+	if err1 != nil {
+		return nil, err1
+	}
+	var items = make([]*Audit, 0, 20)
+	for cursor.Next(context.Background()) {
+		var node = new(Audit)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,111 @@
+package nosql
+
+import (
+	"context"
+	"time"
+)
+
+/**
+场景的级联删除，先统计依赖对象，然后按照同一个操作者以及时间处理
+*/
+
+// DeviceDetached 解绑后设备的状态，和cache.DeviceIdle一致
+const DeviceDetached uint8 = 0
+
+// SceneDepends 场景下未删除的依赖对象
+type SceneDepends struct {
+	Scene     string   `json:"scene"`
+	Groups    []string `json:"groups"`
+	Rooms     []string `json:"rooms"`
+	Regions   []string `json:"regions"`
+	Areas     []string `json:"areas"`
+	Devices   []string `json:"devices"`
+	Maintains []string `json:"maintains"`
+}
+
+func (mine *SceneDepends) Total() int {
+	return len(mine.Groups) + len(mine.Rooms) + len(mine.Regions) + len(mine.Areas) + len(mine.Devices) + len(mine.Maintains)
+}
+
+// GetSceneDepends 通过存储接口统计依赖对象，所有的存储实现共用
+func GetSceneDepends(store Storage, scene string) (*SceneDepends, error) {
+	tmp := &SceneDepends{Scene: scene}
+	groups, err := store.GetGroupsByScene(scene)
+	if err != nil {
+		return nil, err
+	}
+	tmp.Groups = make([]string, 0, len(groups))
+	for _, item := range groups {
+		tmp.Groups = append(tmp.Groups, item.UID.Hex())
+	}
+	rooms, err := store.GetRoomsByScene(scene)
+	if err != nil {
+		return nil, err
+	}
+	tmp.Rooms = make([]string, 0, len(rooms))
+	for _, item := range rooms {
+		tmp.Rooms = append(tmp.Rooms, item.UID.Hex())
+	}
+	regions, err := store.GetRegionsByScene(scene)
+	if err != nil {
+		return nil, err
+	}
+	tmp.Regions = make([]string, 0, len(regions))
+	for _, item := range regions {
+		tmp.Regions = append(tmp.Regions, item.UID.Hex())
+	}
+	areas, err := store.GetAreasByOwner(scene)
+	if err != nil {
+		return nil, err
+	}
+	tmp.Areas = make([]string, 0, len(areas))
+	for _, item := range areas {
+		tmp.Areas = append(tmp.Areas, item.UID.Hex())
+	}
+	devices, err := store.GetDevicesByScene(scene)
+	if err != nil {
+		return nil, err
+	}
+	tmp.Devices = make([]string, 0, len(devices))
+	for _, item := range devices {
+		tmp.Devices = append(tmp.Devices, item.UID.Hex())
+	}
+	maintains, err := store.GetMaintainsByOwner(scene)
+	if err != nil {
+		return nil, err
+	}
+	tmp.Maintains = make([]string, 0, len(maintains))
+	for _, item := range maintains {
+		if item.DeleteTime.IsZero() {
+			tmp.Maintains = append(tmp.Maintains, item.UID.Hex())
+		}
+	}
+	return tmp, nil
+}
+
+// CascadeOps 级联删除的写操作，解绑的设备清空场景
+func CascadeOps(depends *SceneDepends, detach bool, operator string, stamp time.Time) []*WriteOp {
+	ops := make([]*WriteOp, 0, depends.Total()+1)
+	removes := [][]string{depends.Groups, depends.Rooms, depends.Regions, depends.Areas, depends.Maintains}
+	tables := []string{TableGroup, TableRoom, TableRegion, TableArea, TableMaintain}
+	for i, list := range removes {
+		for _, uid := range list {
+			ops = append(ops, RemoveOp(tables[i], uid, operator, stamp))
+		}
+	}
+	for _, uid := range depends.Devices {
+		if detach {
+			op := DeviceSceneOp(uid, "", operator, DeviceDetached)
+			op.Fields["updatedAt"] = stamp
+			ops = append(ops, op)
+		} else {
+			ops = append(ops, RemoveOp(TableDevice, uid, operator, stamp))
+		}
+	}
+	return append(ops, RemoveOp(TableScene, depends.Scene, operator, stamp))
+}
+
+// RemoveSceneCascade 所有的写操作在一个事务中执行
+func RemoveSceneCascade(ctx context.Context, depends *SceneDepends, detach bool, operator string, stamp time.Time) error {
+	return RunTransaction(ctx, CascadeOps(depends, detach, operator, stamp))
+}
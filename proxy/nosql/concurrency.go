@@ -0,0 +1,199 @@
+package nosql
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"sync"
+)
+
+/**
+乐观锁，每次修改文档时version加1，
+调用者提交读取时的版本，通过context带到写操作，版本作为更新的过滤条件，没有匹配时返回冲突
+*/
+
+var versionInc = bson.M{"version": 1}
+
+type expectKey struct{}
+
+type expectTxKey struct{}
+
+// VersionConflict 调用者的版本已经过期
+type VersionConflict struct {
+	Table   string
+	UID     string
+	Expect  uint32
+	Current uint32
+}
+
+func (mine *VersionConflict) Error() string {
+	return fmt.Sprintf("the version of %s is stale that expect = %d, current = %d", mine.UID, mine.Expect, mine.Current)
+}
+
+// Expect 一次请求对一个文档期望的版本，写入成功后加1，同一个请求内的多次写入依次检查
+type Expect struct {
+	Table    string
+	UID      string
+	lock     sync.Mutex
+	version  uint32
+	conflict *VersionConflict
+}
+
+// WithExpect 之后使用返回的context写入这个文档时检查版本
+func WithExpect(ctx context.Context, table, uid string, version uint32) (context.Context, *Expect) {
+	tmp := &Expect{Table: table, UID: uid, version: version}
+	return context.WithValue(ctx, expectKey{}, tmp), tmp
+}
+
+// ExpectOf 请求期望的是这个文档时返回，否则为nil
+func ExpectOf(ctx context.Context, table, uid string) *Expect {
+	if ctx == nil {
+		return nil
+	}
+	tmp, ok := ctx.Value(expectKey{}).(*Expect)
+	if !ok || tmp.Table != table || tmp.UID != uid {
+		return nil
+	}
+	return tmp
+}
+
+// Version 下一次写入期望的版本，写入成功后就是文档当前的版本
+func (mine *Expect) Version() uint32 {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.version
+}
+
+func (mine *Expect) Conflict() *VersionConflict {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	return mine.conflict
+}
+
+// Check 不支持条件更新的存储在同一个锁或者事务中写入前比较
+func (mine *Expect) Check(current uint32) error {
+	if current == mine.Version() {
+		return nil
+	}
+	return mine.Fail(current)
+}
+
+// Advance 条件写入成功
+func (mine *Expect) Advance() {
+	mine.advance(1)
+}
+
+func (mine *Expect) advance(num uint32) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	mine.version += num
+}
+
+// Fail 没有匹配到期望的版本，记录冲突用于返回NotMatch
+func (mine *Expect) Fail(current uint32) error {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	mine.conflict = &VersionConflict{Table: mine.Table, UID: mine.UID, Expect: mine.version, Current: current}
+	return mine.conflict
+}
+
+// ExpectTx 事务中条件写入成功的次数，提交后才修改期望的版本，中止或者重试时丢弃
+type ExpectTx struct {
+	lock   sync.Mutex
+	counts map[*Expect]uint32
+}
+
+// WithExpectTx 事务的每次尝试使用新的计数，提交成功后调用Commit
+func WithExpectTx(ctx context.Context) (context.Context, *ExpectTx) {
+	tmp := &ExpectTx{counts: make(map[*Expect]uint32, 1)}
+	return context.WithValue(ctx, expectTxKey{}, tmp), tmp
+}
+
+func (mine *ExpectTx) Commit() {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	for exp, num := range mine.counts {
+		exp.advance(num)
+	}
+	mine.counts = make(map[*Expect]uint32, 1)
+}
+
+// ExpectNext 下一次写入期望的版本，事务中包含已经写入但是没有提交的次数
+func ExpectNext(ctx context.Context, exp *Expect) uint32 {
+	version := exp.Version()
+	if tx, ok := ctx.Value(expectTxKey{}).(*ExpectTx); ok {
+		tx.lock.Lock()
+		version += tx.counts[exp]
+		tx.lock.Unlock()
+	}
+	return version
+}
+
+// ExpectMatched 条件写入成功，事务中等到提交后再修改期望的版本
+func ExpectMatched(ctx context.Context, exp *Expect) {
+	if tx, ok := ctx.Value(expectTxKey{}).(*ExpectTx); ok {
+		tx.lock.Lock()
+		tx.counts[exp] += 1
+		tx.lock.Unlock()
+		return
+	}
+	exp.Advance()
+}
+
+// IsVersionTable 支持版本的表
+func IsVersionTable(table string) bool {
+	switch table {
+	case TableScene, TableGroup, TableRoom, TableRegion, TableArea, TableDevice, TableMaintain:
+		return true
+	}
+	return false
+}
+
+type versionDoc struct {
+	Version uint32 `bson:"version"`
+}
+
+// GetVersion 没有version字段的旧文档为0
+func GetVersion(table, uid string) (uint32, error) {
+	result, err := findOneOfField(table, uid, bson.M{"version": 1})
+	if err != nil {
+		return 0, err
+	}
+	doc := new(versionDoc)
+	err = result.Decode(doc)
+	if err != nil {
+		return 0, err
+	}
+	return doc.Version, nil
+}
+
+// expectFilter 请求期望这个文档的版本时加入过滤条件，没有version字段的旧文档为0
+func expectFilter(ctx context.Context, table, uid string, filter bson.M) *Expect {
+	exp := ExpectOf(ctx, table, uid)
+	if exp == nil {
+		return nil
+	}
+	version := ExpectNext(ctx, exp)
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		filter["version"] = version
+	}
+	return exp
+}
+
+// expectResult 带有版本的更新没有匹配时区分冲突以及文档不存在
+func expectResult(ctx context.Context, exp *Expect, table, uid string, matched int64) error {
+	if exp == nil {
+		return nil
+	}
+	if matched > 0 {
+		ExpectMatched(ctx, exp)
+		return nil
+	}
+	current, err := GetVersion(table, uid)
+	if err != nil {
+		return err
+	}
+	return exp.Fail(current)
+}
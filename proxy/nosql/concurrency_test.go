@@ -0,0 +1,35 @@
+package nosql
+
+import (
+	"context"
+	"testing"
+)
+
+// 事务重试时回调再次执行，上一次尝试的写入不能修改期望的版本
+func TestExpectTxRetry(t *testing.T) {
+	ctx, exp := WithExpect(context.Background(), TableScene, "scene", 3)
+	first, _ := WithExpectTx(ctx)
+	if ExpectNext(first, exp) != 3 {
+		t.Fatalf("the next version should be 3 but %d", ExpectNext(first, exp))
+	}
+	ExpectMatched(first, exp)
+	if ExpectNext(first, exp) != 4 || exp.Version() != 3 {
+		t.Fatalf("the version should be 4 in the transaction but %d, %d", ExpectNext(first, exp), exp.Version())
+	}
+	//第一次尝试中止，重新计数
+	second, tx := WithExpectTx(ctx)
+	if ExpectNext(second, exp) != 3 {
+		t.Fatalf("the retry should expect 3 but %d", ExpectNext(second, exp))
+	}
+	ExpectMatched(second, exp)
+	ExpectMatched(second, exp)
+	tx.Commit()
+	if exp.Version() != 5 {
+		t.Fatalf("the version should be 5 after commit but %d", exp.Version())
+	}
+	//事务外直接修改
+	ExpectMatched(ctx, exp)
+	if exp.Version() != 6 {
+		t.Fatalf("the version should be 6 but %d", exp.Version())
+	}
+}
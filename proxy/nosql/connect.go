@@ -0,0 +1,155 @@
+package nosql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+/**
+mongo的连接参数，支持认证、副本集、多个地址、TLS以及连接池的设置
+*/
+
+const (
+	defaultPort      = "27017"
+	defaultMaxPool   = 200
+	defaultThreshold = 3 * time.Second
+	defaultIdleTime  = 5 * time.Second
+	defaultTimeout   = 10 * time.Second
+)
+
+// ConnectOptions URI不为空时忽略Hosts，其他设置覆盖URI中的同名参数
+type ConnectOptions struct {
+	URI        string
+	Hosts      []string //ip:port，没有端口时使用27017
+	User       string
+	Password   string
+	AuthSource string
+	Replica    string
+
+	TLS      bool
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	Insecure bool //不校验服务端证书，只用于测试环境
+
+	MaxPool   uint64
+	MinPool   uint64
+	IdleTime  time.Duration
+	Threshold time.Duration
+	Timeout   time.Duration
+}
+
+// ParseHosts 多个地址使用逗号分隔，没有端口的使用port
+func ParseHosts(ip, port string) []string {
+	if len(port) < 1 {
+		port = defaultPort
+	}
+	list := make([]string, 0, 3)
+	for _, item := range strings.Split(ip, ",") {
+		host := strings.TrimSpace(item)
+		if len(host) < 1 {
+			continue
+		}
+		if !strings.Contains(host, ":") {
+			host = host + ":" + port
+		}
+		list = append(list, host)
+	}
+	return list
+}
+
+func (mine *ConnectOptions) timeout() time.Duration {
+	if mine.Timeout > 0 {
+		return mine.Timeout
+	}
+	return defaultTimeout
+}
+
+// clientOptions 没有设置的参数使用原来的默认值
+func (mine *ConnectOptions) clientOptions() (*options.ClientOptions, error) {
+	opt := options.Client()
+	if len(mine.URI) > 0 {
+		opt.ApplyURI(mine.URI)
+	} else {
+		if len(mine.Hosts) < 1 {
+			return nil, errors.New("the database hosts is empty")
+		}
+		opt.SetHosts(mine.Hosts)
+	}
+	if len(mine.User) > 0 {
+		credential := options.Credential{Username: mine.User, Password: mine.Password, PasswordSet: true}
+		credential.AuthSource = mine.AuthSource
+		if opt.Auth != nil {
+			credential.AuthMechanism = opt.Auth.AuthMechanism
+			if len(credential.AuthSource) < 1 {
+				credential.AuthSource = opt.Auth.AuthSource
+			}
+		}
+		opt.SetAuth(credential)
+	}
+	if len(mine.Replica) > 0 {
+		opt.SetReplicaSet(mine.Replica)
+	}
+	if mine.TLS {
+		conf, err := mine.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opt.SetTLSConfig(conf)
+	}
+	if mine.MaxPool > 0 {
+		opt.SetMaxPoolSize(mine.MaxPool)
+	} else if opt.MaxPoolSize == nil {
+		opt.SetMaxPoolSize(defaultMaxPool) //使用最大的连接数
+	}
+	if mine.MinPool > 0 {
+		opt.SetMinPoolSize(mine.MinPool)
+	}
+	if mine.Threshold > 0 {
+		opt.SetLocalThreshold(mine.Threshold)
+	} else if opt.LocalThreshold == nil {
+		opt.SetLocalThreshold(defaultThreshold) //只使用与mongo操作耗时小于3秒的
+	}
+	if mine.IdleTime > 0 {
+		opt.SetMaxConnIdleTime(mine.IdleTime)
+	} else if opt.MaxConnIdleTime == nil {
+		opt.SetMaxConnIdleTime(defaultIdleTime) //指定连接可以保持空闲的最大时间
+	}
+	opt.SetConnectTimeout(mine.timeout())
+	opt.SetServerSelectionTimeout(mine.timeout())
+	opt.SetReadConcern(readconcern.Majority()) //指定查询应返回实例的最新数据确认为，已写入副本集中的大多数成员
+	return opt, opt.Validate()
+}
+
+// tlsConfig CA为空时使用系统证书，客户端证书和私钥需要同时设置
+func (mine *ConnectOptions) tlsConfig() (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: mine.Insecure}
+	if len(mine.CAFile) > 0 {
+		data, err := ioutil.ReadFile(mine.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("the ca file is invalid of " + mine.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+	if len(mine.CertFile) > 0 || len(mine.KeyFile) > 0 {
+		if len(mine.CertFile) < 1 || len(mine.KeyFile) < 1 {
+			return nil, errors.New("the tls cert and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(mine.CertFile, mine.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
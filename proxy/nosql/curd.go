@@ -12,7 +12,7 @@ import (
 
 const timeOut = 10 * time.Second
 
-func insertOne(collection string, info interface{}) (interface{}, error) {
+func insertOne(ctx context.Context, collection string, info interface{}) (interface{}, error) {
 	if len(collection) < 1 {
 		return "", errors.New("the collection is empty")
 	}
@@ -20,7 +20,7 @@ func insertOne(collection string, info interface{}) (interface{}, error) {
 	if c == nil {
 		return "", errors.New("can not found the collection of" + collection)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
 	defer cancel()
 	result, err := c.InsertOne(ctx, info)
 	if err != nil {
@@ -29,6 +29,32 @@ func insertOne(collection string, info interface{}) (interface{}, error) {
 	return result.InsertedID, nil
 }
 
+// insertMany 无序批量插入，返回失败的下标以及原因，其他的数据仍然会写入
+func insertMany(ctx context.Context, collection string, list []interface{}) (map[int]string, error) {
+	if len(collection) < 1 {
+		return nil, errors.New("the collection is empty")
+	}
+	c := noSql.Collection(collection)
+	if c == nil {
+		return nil, errors.New("can not found the collection of" + collection)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
+	defer cancel()
+	_, err := c.InsertMany(ctx, list, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return nil, nil
+	}
+	var bulk mongo.BulkWriteException
+	if errors.As(err, &bulk) && len(bulk.WriteErrors) > 0 {
+		failed := make(map[int]string, len(bulk.WriteErrors))
+		for _, item := range bulk.WriteErrors {
+			failed[item.Index] = item.Message
+		}
+		return failed, nil
+	}
+	return nil, err
+}
+
 func getCount(collection string) (int64, error) {
 	if len(collection) < 1 {
 		return 0, errors.New("the collection is empty")
@@ -85,7 +111,7 @@ func deleteOne(collection string, uid string) (int64, error) {
 	return result.DeletedCount, nil
 }
 
-func removeOne(collection string, uid, operator string) (int64, error) {
+func removeOne(ctx context.Context, collection string, uid, operator string) (int64, error) {
 	if len(collection) < 1 {
 		return 0, errors.New("the collection is empty")
 	}
@@ -97,15 +123,16 @@ func removeOne(collection string, uid, operator string) (int64, error) {
 	if c == nil {
 		return 0, errors.New("can not found the collection of" + collection)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
 	defer cancel()
 	filter := bson.M{"_id": objID}
-	node := bson.M{"$set": bson.M{"operator": operator, "deleteAt": time.Now()}}
-	result, err := c.UpdateOne(ctx, filter, node)
+	exp := expectFilter(ctx, collection, uid, filter)
+	node := bson.M{"$set": bson.M{"operator": operator, "deleteAt": time.Now()}, "$inc": versionInc}
+	matched, err := updateAfter(ctx, c, collection, filter, node)
 	if err != nil {
 		return 0, err
 	}
-	return result.ModifiedCount, nil
+	return matched, expectResult(ctx, exp, collection, uid, matched)
 }
 
 func hadOne(collection string, filter bson.M) (bool, error) {
@@ -125,7 +152,7 @@ func hadOne(collection string, filter bson.M) (bool, error) {
 	return true, nil
 }
 
-func updateOne(collection string, uid string, data bson.M) (int64, error) {
+func updateOne(ctx context.Context, collection string, uid string, data bson.M) (int64, error) {
 	if len(collection) < 1 {
 		return 0, errors.New("the collection is empty")
 	}
@@ -137,21 +164,22 @@ func updateOne(collection string, uid string, data bson.M) (int64, error) {
 	if c == nil {
 		return 0, errors.New("can not found the collection of" + collection)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
 	defer cancel()
 	filter := bson.M{"_id": objID}
-	node := bson.M{"$set": data}
-	result, err := c.UpdateOne(ctx, filter, node)
+	exp := expectFilter(ctx, collection, uid, filter)
+	node := bson.M{"$set": data, "$inc": versionInc}
+	matched, err := updateAfter(ctx, c, collection, filter, node)
 	if err != nil {
 		return 0, err
 	}
-	return result.ModifiedCount, nil
+	return matched, expectResult(ctx, exp, collection, uid, matched)
 }
 
 /**
-往数组里面追加一个元素
+往数组里面追加一个元素，已经存在时不重复添加
 */
-func appendElement(collection string, uid string, data bson.M) (int64, error) {
+func appendElement(ctx context.Context, collection string, uid string, data bson.M) (int64, error) {
 	if len(collection) < 1 {
 		return 0, errors.New("the collection is empty")
 	}
@@ -163,21 +191,22 @@ func appendElement(collection string, uid string, data bson.M) (int64, error) {
 	if c == nil {
 		return 0, errors.New("can not found the collection of" + collection)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
 	defer cancel()
 	filter := bson.M{"_id": objID}
-	node := bson.M{"$push": data, "$set": bson.M{"updatedAt": time.Now()}}
-	result, err := c.UpdateOne(ctx, filter, node)
+	exp := expectFilter(ctx, collection, uid, filter)
+	node := bson.M{"$addToSet": data, "$set": bson.M{"updatedAt": time.Now()}, "$inc": versionInc}
+	matched, err := updateAfter(ctx, c, collection, filter, node)
 	if err != nil {
 		return 0, err
 	}
-	return result.ModifiedCount, nil
+	return matched, expectResult(ctx, exp, collection, uid, matched)
 }
 
 /**
 从数组里面移除一个元素
 */
-func removeElement(collection string, uid string, data bson.M) (int64, error) {
+func removeElement(ctx context.Context, collection string, uid string, data bson.M) (int64, error) {
 	if len(collection) < 1 {
 		return 0, errors.New("the collection is empty")
 	}
@@ -189,18 +218,77 @@ func removeElement(collection string, uid string, data bson.M) (int64, error) {
 	if c == nil {
 		return 0, errors.New("can not found the collection of" + collection)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
 	defer cancel()
 	filter := bson.M{"_id": objID}
-	node := bson.M{"$pull": data, "$set": bson.M{"updatedAt": time.Now()}}
-	result, err := c.UpdateOne(ctx, filter, node)
+	exp := expectFilter(ctx, collection, uid, filter)
+	node := bson.M{"$pull": data, "$set": bson.M{"updatedAt": time.Now()}, "$inc": versionInc}
+	matched, err := updateAfter(ctx, c, collection, filter, node)
+	if err != nil {
+		return 0, err
+	}
+	return matched, expectResult(ctx, exp, collection, uid, matched)
+}
+
+/**
+数组元素的追加或者移除，同时记录操作者，mode为$addToSet或者$pull
+*/
+func updateElements(ctx context.Context, collection, uid, mode string, data bson.M, operator string) (int64, error) {
+	if len(collection) < 1 {
+		return 0, errors.New("the collection is empty")
+	}
+	objID, e := primitive.ObjectIDFromHex(uid)
+	if e != nil {
+		return 0, e
+	}
+	c := noSql.Collection(collection)
+	if c == nil {
+		return 0, errors.New("can not found the collection of" + collection)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
+	defer cancel()
+	filter := bson.M{"_id": objID}
+	exp := expectFilter(ctx, collection, uid, filter)
+	node := bson.M{mode: data, "$set": bson.M{"operator": operator, "updatedAt": time.Now()}, "$inc": versionInc}
+	matched, err := updateAfter(ctx, c, collection, filter, node)
+	if err != nil {
+		return 0, err
+	}
+	return matched, expectResult(ctx, exp, collection, uid, matched)
+}
+
+func updateOneBy(ctx context.Context, collection string, filter bson.M, update bson.M) (int64, error) {
+	if len(collection) < 1 {
+		return 0, errors.New("the collection is empty")
+	}
+	c := noSql.Collection(collection)
+	if c == nil {
+		return 0, errors.New("can not found the collection of" + collection)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
+	defer cancel()
+	result, err := c.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return 0, err
 	}
 	return result.ModifiedCount, nil
 }
 
-func updateOneBy(collection string, filter bson.M, update bson.M) (int64, error) {
+// updateMatched 返回匹配的数量，值没有变化时修改的数量为0
+func updateMatched(ctx context.Context, collection string, filter bson.M, update bson.M) (int64, error) {
+	if len(collection) < 1 {
+		return 0, errors.New("the collection is empty")
+	}
+	c := noSql.Collection(collection)
+	if c == nil {
+		return 0, errors.New("can not found the collection of" + collection)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeOut)
+	defer cancel()
+	return updateAfter(ctx, c, collection, filter, update)
+}
+
+func updateMany(collection string, filter bson.M, update bson.M) (int64, error) {
 	if len(collection) < 1 {
 		return 0, errors.New("the collection is empty")
 	}
@@ -210,7 +298,7 @@ func updateOneBy(collection string, filter bson.M, update bson.M) (int64, error)
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
 	defer cancel()
-	result, err := c.UpdateOne(ctx, filter, update)
+	result, err := c.UpdateMany(ctx, filter, update)
 	if err != nil {
 		return 0, err
 	}
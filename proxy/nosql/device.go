@@ -15,6 +15,7 @@ type Invite struct {
 	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
 	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Version     uint32             `json:"version" bson:"version"` //每次修改加1，用于乐观锁
 
 	Creator     string         `json:"creator" bson:"creator"`
 	Operator    string         `json:"operator" bson:"operator"`
@@ -33,17 +34,16 @@ type Invite struct {
 	Auto        proxy.AutoInfo `json:"auto" bson:"auto"`
 }
 
-func CreateDevice(info *Invite) error {
-	_, err := insertOne(TableDevice, info)
+func CreateDevice(ctx context.Context, info *Invite) error {
+	_, err := insertOne(ctx, TableDevice, info)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetDeviceNextID() uint64 {
-	num, _ := getSequenceNext(TableDevice)
-	return num
+func GetDeviceNextID() (uint64, error) {
+	return getSequenceNext(TableDevice)
 }
 
 func GetDeviceCount() int64 {
@@ -92,8 +92,8 @@ func GetDeviceByID(id uint64) (*Invite, error) {
 	return model, nil
 }
 
-func RemoveDevice(uid, operator string) error {
-	_, err := removeOne(TableDevice, uid, operator)
+func RemoveDevice(ctx context.Context, uid, operator string) error {
+	_, err := removeOne(ctx, TableDevice, uid, operator)
 	return err
 }
 
@@ -165,62 +165,62 @@ func GetDevicesByStatus(st uint8) ([]*Invite, error) {
 	return items, nil
 }
 
-func UpdateDeviceBase(uid, name, remark, operator string) error {
+func UpdateDeviceBase(ctx context.Context, uid, name, remark, operator string) error {
 	msg := bson.M{"name": name, "remark": remark, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableDevice, uid, msg)
+	_, err := updateOne(ctx, TableDevice, uid, msg)
 	return err
 }
 
-func UpdateDeviceTime(uid, operator string, act, expiry uint64) error {
+func UpdateDeviceTime(ctx context.Context, uid, operator string, act, expiry uint64) error {
 	msg := bson.M{"activated": act, "expiry": expiry, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableDevice, uid, msg)
+	_, err := updateOne(ctx, TableDevice, uid, msg)
 	return err
 }
 
-func UpdateDeviceCertificate(uid, data, operator string) error {
+func UpdateDeviceCertificate(ctx context.Context, uid, data, operator string) error {
 	msg := bson.M{"certificate": data, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableDevice, uid, msg)
+	_, err := updateOne(ctx, TableDevice, uid, msg)
 	return err
 }
 
-func UpdateDeviceScene(uid, data, operator string) error {
+func UpdateDeviceScene(ctx context.Context, uid, data, operator string) error {
 	msg := bson.M{"scene": data, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableDevice, uid, msg)
+	_, err := updateOne(ctx, TableDevice, uid, msg)
 	return err
 }
 
-func UpdateDeviceAspect(uid, data, operator string) error {
+func UpdateDeviceAspect(ctx context.Context, uid, data, operator string) error {
 	msg := bson.M{"aspect": data, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableDevice, uid, msg)
+	_, err := updateOne(ctx, TableDevice, uid, msg)
 	return err
 }
 
-func BindDevice(uid, quote, os, operator string, act, expiry uint64) error {
+func BindDevice(ctx context.Context, uid, quote, os, operator string, act, expiry uint64) error {
 	msg := bson.M{"quote": quote, "os": os, "activated": act, "expiry": expiry, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableDevice, uid, msg)
+	_, err := updateOne(ctx, TableDevice, uid, msg)
 	return err
 }
 
-func UpdateDeviceStatus(uid, operator string, st uint8) error {
+func UpdateDeviceStatus(ctx context.Context, uid, operator string, st uint8) error {
 	msg := bson.M{"status": st, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableDevice, uid, msg)
+	_, err := updateOne(ctx, TableDevice, uid, msg)
 	return err
 }
 
-func UpdateDeviceMeta(uid, meta, operator string) error {
+func UpdateDeviceMeta(ctx context.Context, uid, meta, operator string) error {
 	msg := bson.M{"meta": meta, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableDevice, uid, msg)
+	_, err := updateOne(ctx, TableDevice, uid, msg)
 	return err
 }
 
-func UpdateDeviceAuto(uid, operator string, auto proxy.AutoInfo) error {
+func UpdateDeviceAuto(ctx context.Context, uid, operator string, auto proxy.AutoInfo) error {
 	msg := bson.M{"auto": auto, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableDevice, uid, msg)
+	_, err := updateOne(ctx, TableDevice, uid, msg)
 	return err
 }
 
-func UpdateDeviceType(uid, operator string, tp uint8) error {
+func UpdateDeviceType(ctx context.Context, uid, operator string, tp uint8) error {
 	msg := bson.M{"type": tp, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableDevice, uid, msg)
+	_, err := updateOne(ctx, TableDevice, uid, msg)
 	return err
 }
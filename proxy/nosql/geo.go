@@ -0,0 +1,134 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+地理位置，location保留原来的字符串，同时保存为GeoJSON的点用于2dsphere索引，
+字符串支持"经度,纬度"以及GeoJSON两种格式，
+场景以及区域的附近查询通过索引筛选，分组没有位置查询所以不建索引
+*/
+
+const GeoTypePoint = "Point"
+
+// GeoPoint GeoJSON的点，坐标的顺序为经度、纬度
+type GeoPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+func NewGeoPoint(lng, lat float64) (*GeoPoint, error) {
+	if math.IsNaN(lng) || math.IsNaN(lat) || lng < -180 || lng > 180 || lat < -90 || lat > 90 {
+		return nil, errors.New("the location is out of range")
+	}
+	return &GeoPoint{Type: GeoTypePoint, Coordinates: []float64{lng, lat}}, nil
+}
+
+// ParseGeoPoint 字符串的顺序为"经度,纬度"，和GeoJSON一致，不会识别颠倒的顺序，
+// "39.9,116.4"只是因为纬度116.4超出范围才返回错误，两个值都在纬度范围内时按照经度、纬度接受；
+// "0,0"是合法的位置；位置为空或者只有空白时返回(nil, nil)
+func ParseGeoPoint(location string) (*GeoPoint, error) {
+	location = strings.TrimSpace(location)
+	if len(location) < 1 {
+		return nil, nil
+	}
+	if strings.HasPrefix(location, "{") {
+		tmp := new(GeoPoint)
+		if err := json.Unmarshal([]byte(location), tmp); err != nil || tmp.Type != GeoTypePoint || len(tmp.Coordinates) < 2 {
+			return nil, errors.New("the location format is error")
+		}
+		return NewGeoPoint(tmp.Coordinates[0], tmp.Coordinates[1])
+	}
+	arr := strings.Split(strings.ReplaceAll(location, "，", ","), ",")
+	if len(arr) != 2 {
+		return nil, errors.New("the location format is error")
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(arr[0]), 64)
+	if err != nil {
+		return nil, errors.New("the location format is error")
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(arr[1]), 64)
+	if err != nil {
+		return nil, errors.New("the location format is error")
+	}
+	return NewGeoPoint(lng, lat)
+}
+
+func (mine *GeoPoint) Lng() float64 {
+	return mine.Coordinates[0]
+}
+
+func (mine *GeoPoint) Lat() float64 {
+	return mine.Coordinates[1]
+}
+
+// String 统一保存为"经度,纬度"
+func (mine *GeoPoint) String() string {
+	return strconv.FormatFloat(mine.Lng(), 'f', -1, 64) + "," + strconv.FormatFloat(mine.Lat(), 'f', -1, 64)
+}
+
+// GetGeoWithin 使用2dsphere索引查询球面上中心一定弧度内未删除的对象，scene为空时不限制场景，只返回uid
+func GetGeoWithin(table, scene string, center *GeoPoint, radians float64) ([]string, error) {
+	filter := bson.M{"deleteAt": new(time.Time), "geo": bson.M{"$geoWithin": bson.M{
+		"$centerSphere": bson.A{center.Coordinates, radians}}}}
+	if len(scene) > 0 {
+		filter["scene"] = scene
+	}
+	cursor, err1 := findManyByOpts(table, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	var items = make([]string, 0, 20)
+	for cursor.Next(context.Background()) {
+		var node = struct {
+			UID primitive.ObjectID `bson:"_id"`
+		}{}
+		if err := cursor.Decode(&node); err != nil {
+			return nil, err
+		}
+		items = append(items, node.UID.Hex())
+	}
+	return items, nil
+}
+
+// backfillGeo 根据location生成geo，不能解析的位置保持不变，返回可以解析的数量
+func backfillGeo(table string, dry bool) (int64, error) {
+	cursor, err1 := findMany(table, bson.M{"location": bson.M{"$gt": ""}, "geo": nil}, 0)
+	if err1 != nil {
+		return 0, err1
+	}
+	defer cursor.Close(context.Background())
+	var num int64
+	for cursor.Next(context.Background()) {
+		var node = struct {
+			UID      primitive.ObjectID `bson:"_id"`
+			Location string             `bson:"location"`
+		}{}
+		if err := cursor.Decode(&node); err != nil {
+			return num, err
+		}
+		point, er := ParseGeoPoint(node.Location)
+		if er != nil || point == nil {
+			continue
+		}
+		if !dry {
+			_, er = updateOneBy(context.Background(), table, bson.M{"_id": node.UID}, bson.M{"$set": bson.M{"geo": point}})
+			if er != nil {
+				return num, er
+			}
+		}
+		num += 1
+	}
+	return num, nil
+}
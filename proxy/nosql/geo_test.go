@@ -0,0 +1,45 @@
+package nosql
+
+import "testing"
+
+func TestParseGeoPoint(t *testing.T) {
+	valid := map[string][2]float64{
+		"116.4,39.9":     {116.4, 39.9},
+		" 116.4 ， 39.9 ": {116.4, 39.9},
+		"0,0":            {0, 0},
+		"-180,-90":       {-180, -90},
+		`{"type":"Point","coordinates":[116.4,39.9]}`: {116.4, 39.9},
+		//颠倒的顺序都在纬度范围内时不能识别，按照经度、纬度接受
+		"39.9,40.1": {39.9, 40.1},
+	}
+	for location, target := range valid {
+		point, err := ParseGeoPoint(location)
+		if err != nil || point == nil || point.Lng() != target[0] || point.Lat() != target[1] {
+			t.Fatalf("the location %s should be %v but %v, %v", location, target, point, err)
+		}
+		if again, _ := ParseGeoPoint(point.String()); again.Lng() != target[0] || again.Lat() != target[1] {
+			t.Fatalf("the string of %s can not parse again: %s", location, point.String())
+		}
+	}
+	for _, location := range []string{"", "  "} {
+		if point, err := ParseGeoPoint(location); point != nil || err != nil {
+			t.Fatalf("the empty location should be nil but %v, %v", point, err)
+		}
+	}
+	malformed := []string{
+		"39.9,116.4", //纬度超出范围
+		"181,0",
+		"NaN,1",
+		"a,b",
+		"116.4",
+		"1,2,3",
+		`{"type":"LineString","coordinates":[116.4,39.9]}`,
+		`{"type":"Point","coordinates":[116.4]}`,
+		`{"type":"Point"`,
+	}
+	for _, location := range malformed {
+		if point, err := ParseGeoPoint(location); err == nil {
+			t.Fatalf("the location %s should be rejected but %v", location, point)
+		}
+	}
+}
@@ -16,6 +16,7 @@ type Group struct {
 	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
 	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Version     uint32             `json:"version" bson:"version"` //每次修改加1，用于乐观锁
 
 	Creator  string `json:"creator" bson:"creator"`
 	Operator string `json:"operator" bson:"operator"`
@@ -28,20 +29,20 @@ type Group struct {
 	Assistant string      `json:"assistant" bson:"assistant"`
 	Address   AddressInfo `json:"address" bson:"address"`
 	Location  string      `json:"location" bson:"location"`
+	Geo       *GeoPoint   `json:"geo,omitempty" bson:"geo,omitempty"`
 	Members   []string    `json:"members" bson:"members"`
 }
 
-func CreateGroup(info *Group) error {
-	_, err := insertOne(TableGroup, info)
+func CreateGroup(ctx context.Context, info *Group) error {
+	_, err := insertOne(ctx, TableGroup, info)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetGroupNextID() uint64 {
-	num, _ := getSequenceNext(TableGroup)
-	return num
+func GetGroupNextID() (uint64, error) {
+	return getSequenceNext(TableGroup)
 }
 
 func GetGroupCount() int64 {
@@ -76,8 +77,8 @@ func GetGroupByID(id uint64) (*Group, error) {
 	return model, nil
 }
 
-func RemoveGroup(uid,operator string) error {
-	_, err := removeOne(TableGroup, uid, operator)
+func RemoveGroup(ctx context.Context, uid,operator string) error {
+	_, err := removeOne(ctx, TableGroup, uid, operator)
 	return err
 }
 
@@ -115,68 +116,69 @@ func GetGroupsByScene(scene string) ([]*Group, error) {
 	return items, nil
 }
 
-func UpdateGroupBase(uid, name, remark, operator string) error {
+func UpdateGroupBase(ctx context.Context, uid, name, remark, operator string) error {
 	msg := bson.M{"name": name, "remark": remark, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableGroup, uid, msg)
+	_, err := updateOne(ctx, TableGroup, uid, msg)
 	return err
 }
 
-func UpdateGroupCover(uid, cover, operator string) error {
+func UpdateGroupCover(ctx context.Context, uid, cover, operator string) error {
 	msg := bson.M{"cover": cover,"operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableGroup, uid, msg)
+	_, err := updateOne(ctx, TableGroup, uid, msg)
 	return err
 }
 
-func UpdateGroupMembers(uid, operator string, members []string) error {
+func UpdateGroupMembers(ctx context.Context, uid, operator string, members []string) error {
 	msg := bson.M{"operator": operator, "members": members, "updatedAt": time.Now()}
-	_, err := updateOne(TableGroup, uid, msg)
+	_, err := updateOne(ctx, TableGroup, uid, msg)
 	return err
 }
 
-func UpdateGroupAddress(uid, operator string, address AddressInfo) error {
+func UpdateGroupAddress(ctx context.Context, uid, operator string, address AddressInfo) error {
 	msg := bson.M{"operator": operator, "address": address, "updatedAt": time.Now()}
-	_, err := updateOne(TableGroup, uid, msg)
+	_, err := updateOne(ctx, TableGroup, uid, msg)
 	return err
 }
 
-func UpdateGroupLocation(uid, location, operator string) error {
-	msg := bson.M{"location": location,"operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableGroup, uid, msg)
+func UpdateGroupLocation(ctx context.Context, uid, location, operator string) error {
+	geo, _ := ParseGeoPoint(location)
+	msg := bson.M{"location": location, "geo": geo, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(ctx, TableGroup, uid, msg)
 	return err
 }
 
-func UpdateGroupContact(uid, phone, operator string) error {
+func UpdateGroupContact(ctx context.Context, uid, phone, operator string) error {
 	msg := bson.M{"contact": phone,"operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableGroup, uid, msg)
+	_, err := updateOne(ctx, TableGroup, uid, msg)
 	return err
 }
 
-func UpdateGroupMaster(uid, member, operator string) error {
+func UpdateGroupMaster(ctx context.Context, uid, member, operator string) error {
 	msg := bson.M{"master": member,"operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableGroup, uid, msg)
+	_, err := updateOne(ctx, TableGroup, uid, msg)
 	return err
 }
 
-func UpdateGroupAssistant(uid, member, operator string) error {
+func UpdateGroupAssistant(ctx context.Context, uid, member, operator string) error {
 	msg := bson.M{"assistant": member,"operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableGroup, uid, msg)
+	_, err := updateOne(ctx, TableGroup, uid, msg)
 	return err
 }
 
-func AppendGroupMember(uid, member string) error {
+func AppendGroupMember(ctx context.Context, uid, member string) error {
 	if len(member) < 1 {
 		return errors.New("the member uid is empty")
 	}
 	msg := bson.M{"members": member}
-	_, err := appendElement(TableGroup, uid, msg)
+	_, err := appendElement(ctx, TableGroup, uid, msg)
 	return err
 }
 
-func SubtractGroupMember(uid string, member string) error {
+func SubtractGroupMember(ctx context.Context, uid string, member string) error {
 	if len(member) < 1 {
 		return errors.New("the member uid is empty")
 	}
 	msg := bson.M{"members": member}
-	_, err := removeElement(TableGroup, uid, msg)
+	_, err := removeElement(ctx, TableGroup, uid, msg)
 	return err
 }
@@ -0,0 +1,530 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/tidwall/gjson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"omo.msa.organization/proxy"
+	"time"
+)
+
+/**
+批量导入，每一行解析成对应的数据模型，校验必填字段以及引用关系后分配ID，分批写入，
+每一行的错误单独记录在报告中，不影响其他行
+*/
+
+const importBatch = 100
+
+var ErrBatchUnsupported = errors.New("the storage not support the batch insert")
+
+type ImportError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	Table   string        `json:"table"`
+	Total   int           `json:"total"`
+	Success int           `json:"success"`
+	List    []string      `json:"list"`
+	Errors  []ImportError `json:"errors"`
+}
+
+type importRow struct {
+	row   int
+	uid   string
+	model interface{}
+}
+
+type importContext struct {
+	store    Storage
+	operator string
+	scenes   map[string]bool
+	rooms    map[string]string
+	regions  map[string]string
+	areas    map[string]string
+	masters  map[string]bool
+	sns      map[string]bool
+	devices  map[string]bool //文件中已经绑定的设备
+}
+
+func ImportDatabase(ctx context.Context, store Storage, table, operator string, file io.Reader) (*ImportReport, error) {
+	body, err := io.ReadAll(file)
+	if err != nil {
+		return nil, errors.New("read the file failed")
+	}
+	if !gjson.ValidBytes(body) {
+		return nil, errors.New("the file is not valid json")
+	}
+	result := gjson.ParseBytes(body)
+	data := result.Array()
+
+	return analyticDataStructure(ctx, store, table, operator, data)
+}
+
+func analyticDataStructure(ctx context.Context, store Storage, table, operator string, data []gjson.Result) (*ImportReport, error) {
+	if store == nil {
+		return nil, errors.New("the storage is nil")
+	}
+	var check func(ctx *importContext, raw []byte) (importRow, error)
+	switch table {
+	case TableScene:
+		check = checkImportScene
+	case TableGroup:
+		check = checkImportGroup
+	case TableRoom:
+		check = checkImportRoom
+	case TableRegion:
+		check = checkImportRegion
+	case TableArea:
+		check = checkImportArea
+	case TableDevice:
+		check = checkImportDevice
+	case TableMaintain:
+		check = checkImportMaintain
+	default:
+		return nil, errors.New("the table not support import of " + table)
+	}
+	tmp := &importContext{store: store, operator: operator, scenes: make(map[string]bool), rooms: make(map[string]string),
+		regions: make(map[string]string), areas: make(map[string]string), masters: make(map[string]bool),
+		sns: make(map[string]bool), devices: make(map[string]bool)}
+	report := &ImportReport{Table: table, Total: len(data), List: make([]string, 0, len(data)), Errors: make([]ImportError, 0, 5)}
+	batch := make([]importRow, 0, importBatch)
+	for i, item := range data {
+		if !item.IsObject() {
+			report.appendError(i, "the row is not a json object")
+			continue
+		}
+		row, err := check(tmp, []byte(item.Raw))
+		if err != nil {
+			report.appendError(i, err.Error())
+			continue
+		}
+		row.row = i
+		batch = append(batch, row)
+		if len(batch) >= importBatch {
+			report.insertBatch(ctx, store, table, batch)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		report.insertBatch(ctx, store, table, batch)
+	}
+	return report, nil
+}
+
+func (mine *ImportReport) appendError(row int, msg string) {
+	mine.Errors = append(mine.Errors, ImportError{Row: row, Message: msg})
+}
+
+func (mine *ImportReport) insertBatch(ctx context.Context, store Storage, table string, batch []importRow) {
+	//整批一次性预留ID，避免每行都访问计数表
+	first, err := store.GetSequenceBlock(table, uint64(len(batch)))
+	if err != nil {
+		for _, item := range batch {
+			mine.appendError(item.row, "allocate the id failed: "+err.Error())
+		}
+		return
+	}
+	for i, item := range batch {
+		assignModel(item.model, first+uint64(i))
+	}
+	if batcher, ok := store.(BatchStore); ok {
+		list := make([]interface{}, 0, len(batch))
+		for _, item := range batch {
+			list = append(list, item.model)
+		}
+		failed, er := batcher.InsertMany(ctx, table, list)
+		if er != ErrBatchUnsupported {
+			for i, item := range batch {
+				if er != nil {
+					mine.appendError(item.row, er.Error())
+				} else if msg, ok := failed[i]; ok {
+					mine.appendError(item.row, msg)
+				} else {
+					mine.Success += 1
+					mine.List = append(mine.List, item.uid)
+				}
+			}
+			return
+		}
+	}
+	for _, item := range batch {
+		er := createModel(ctx, store, item.model)
+		if er != nil {
+			mine.appendError(item.row, er.Error())
+		} else {
+			mine.Success += 1
+			mine.List = append(mine.List, item.uid)
+		}
+	}
+}
+
+// assignModel 分配ID，文件中的version不保留，导入的对象从0开始
+func assignModel(model interface{}, id uint64) {
+	switch info := model.(type) {
+	case *Scene:
+		info.ID = id
+		info.Version = 0
+	case *Group:
+		info.ID = id
+		info.Version = 0
+	case *Room:
+		info.ID = id
+		info.Version = 0
+	case *Region:
+		info.ID = id
+		info.Version = 0
+	case *Area:
+		info.ID = id
+		info.Version = 0
+	case *Invite:
+		info.ID = id
+		info.Version = 0
+	case *Maintain:
+		info.ID = id
+		info.Version = 0
+	}
+}
+
+// ModelUID 导入的数据模型的uid
+func ModelUID(model interface{}) string {
+	switch info := model.(type) {
+	case *Scene:
+		return info.UID.Hex()
+	case *Group:
+		return info.UID.Hex()
+	case *Room:
+		return info.UID.Hex()
+	case *Region:
+		return info.UID.Hex()
+	case *Area:
+		return info.UID.Hex()
+	case *Invite:
+		return info.UID.Hex()
+	case *Maintain:
+		return info.UID.Hex()
+	}
+	return ""
+}
+
+func createModel(ctx context.Context, store Storage, model interface{}) error {
+	switch info := model.(type) {
+	case *Scene:
+		return store.CreateScene(ctx, info)
+	case *Group:
+		return store.CreateGroup(ctx, info)
+	case *Room:
+		return store.CreateRoom(ctx, info)
+	case *Region:
+		return store.CreateRegion(ctx, info)
+	case *Area:
+		return store.CreateArea(ctx, info)
+	case *Invite:
+		return store.CreateDevice(ctx, info)
+	case *Maintain:
+		return store.CreateMaintain(ctx, info)
+	}
+	return errors.New("the model not support")
+}
+
+//region Check
+func (mine *importContext) hadScene(uid string) bool {
+	if len(uid) < 1 {
+		return false
+	}
+	if ok, had := mine.scenes[uid]; had {
+		return ok
+	}
+	db, err := mine.store.GetScene(uid)
+	ok := err == nil && db.DeleteTime.IsZero()
+	mine.scenes[uid] = ok
+	return ok
+}
+
+// roomScene 返回房间所属的场景，不存在时返回空
+func (mine *importContext) roomScene(uid string) string {
+	if scene, had := mine.rooms[uid]; had {
+		return scene
+	}
+	db, err := mine.store.GetRoom(uid)
+	scene := ""
+	if err == nil && db.DeleteTime.IsZero() {
+		scene = db.Scene
+	}
+	mine.rooms[uid] = scene
+	return scene
+}
+
+func (mine *importContext) regionScene(uid string) string {
+	if scene, had := mine.regions[uid]; had {
+		return scene
+	}
+	db, err := mine.store.GetRegion(uid)
+	scene := ""
+	if err == nil && db.DeleteTime.IsZero() {
+		scene = db.Scene
+	}
+	mine.regions[uid] = scene
+	return scene
+}
+
+func (mine *importContext) areaScene(uid string) string {
+	if scene, had := mine.areas[uid]; had {
+		return scene
+	}
+	db, err := mine.store.GetArea(uid)
+	scene := ""
+	if err == nil && db.DeleteTime.IsZero() {
+		scene = db.Scene
+	}
+	mine.areas[uid] = scene
+	return scene
+}
+
+func (mine *importContext) checkScene(scene string) error {
+	if len(scene) < 1 {
+		return errors.New("the scene is empty")
+	}
+	if !mine.hadScene(scene) {
+		return errors.New("not found the scene of " + scene)
+	}
+	return nil
+}
+
+func decodeRow(raw []byte, model interface{}) error {
+	err := json.Unmarshal(raw, model)
+	if err != nil {
+		return errors.New("the format is error: " + err.Error())
+	}
+	return nil
+}
+
+func checkImportScene(ctx *importContext, raw []byte) (importRow, error) {
+	info := new(Scene)
+	if err := decodeRow(raw, info); err != nil {
+		return importRow{}, err
+	}
+	if len(info.Name) < 1 {
+		return importRow{}, errors.New("the name is empty")
+	}
+	if len(info.Master) > 0 {
+		if ctx.masters[info.Master] {
+			return importRow{}, errors.New("the master repeated in file of " + info.Master)
+		}
+		db, err := ctx.store.GetSceneByMaster(info.Master)
+		if err == nil && db.DeleteTime.IsZero() {
+			return importRow{}, errors.New("the master had used by other scene")
+		}
+		ctx.masters[info.Master] = true
+	}
+	geo, err := ParseGeoPoint(info.Location)
+	if err != nil {
+		return importRow{}, err
+	}
+	info.Geo = geo
+	info.UID = primitive.NewObjectID()
+	info.CreatedTime = time.Now()
+	info.UpdatedTime = time.Now()
+	info.DeleteTime = time.Time{}
+	info.Creator = ctx.operator
+	info.Operator = ctx.operator
+	if info.Members == nil {
+		info.Members = make([]string, 0, 1)
+	}
+	if info.Parents == nil {
+		info.Parents = make([]string, 0, 1)
+	}
+	if info.Questions == nil {
+		info.Questions = make([]string, 0, 1)
+	}
+	return importRow{uid: info.UID.Hex(), model: info}, nil
+}
+
+func checkImportGroup(ctx *importContext, raw []byte) (importRow, error) {
+	info := new(Group)
+	if err := decodeRow(raw, info); err != nil {
+		return importRow{}, err
+	}
+	if len(info.Name) < 1 {
+		return importRow{}, errors.New("the name is empty")
+	}
+	if err := ctx.checkScene(info.Scene); err != nil {
+		return importRow{}, err
+	}
+	geo, err := ParseGeoPoint(info.Location)
+	if err != nil {
+		return importRow{}, err
+	}
+	info.Geo = geo
+	info.UID = primitive.NewObjectID()
+	info.CreatedTime = time.Now()
+	info.UpdatedTime = time.Now()
+	info.DeleteTime = time.Time{}
+	info.Creator = ctx.operator
+	info.Operator = ctx.operator
+	if info.Members == nil {
+		info.Members = make([]string, 0, 1)
+	}
+	return importRow{uid: info.UID.Hex(), model: info}, nil
+}
+
+func checkImportRoom(ctx *importContext, raw []byte) (importRow, error) {
+	info := new(Room)
+	if err := decodeRow(raw, info); err != nil {
+		return importRow{}, err
+	}
+	if len(info.Name) < 1 {
+		return importRow{}, errors.New("the name is empty")
+	}
+	if err := ctx.checkScene(info.Scene); err != nil {
+		return importRow{}, err
+	}
+	info.UID = primitive.NewObjectID()
+	info.CreatedTime = time.Now()
+	info.UpdatedTime = time.Now()
+	info.DeleteTime = time.Time{}
+	info.Creator = ctx.operator
+	info.Operator = ctx.operator
+	if info.Quotes == nil {
+		info.Quotes = make([]string, 0, 1)
+	}
+	return importRow{uid: info.UID.Hex(), model: info}, nil
+}
+
+func checkImportRegion(ctx *importContext, raw []byte) (importRow, error) {
+	info := new(Region)
+	if err := decodeRow(raw, info); err != nil {
+		return importRow{}, err
+	}
+	if len(info.Name) < 1 {
+		return importRow{}, errors.New("the name is empty")
+	}
+	if err := ctx.checkScene(info.Scene); err != nil {
+		return importRow{}, err
+	}
+	if len(info.Parent) > 0 && ctx.regionScene(info.Parent) != info.Scene {
+		return importRow{}, errors.New("not found the parent region in scene of " + info.Parent)
+	}
+	geo, err := ParseGeoPoint(info.Location)
+	if err != nil {
+		return importRow{}, err
+	}
+	info.Geo = geo
+	info.UID = primitive.NewObjectID()
+	info.CreatedTime = time.Now()
+	info.UpdatedTime = time.Now()
+	info.DeleteTime = time.Time{}
+	info.Creator = ctx.operator
+	info.Operator = ctx.operator
+	if info.Members == nil {
+		info.Members = make([]string, 0, 1)
+	}
+	return importRow{uid: info.UID.Hex(), model: info}, nil
+}
+
+func checkImportArea(ctx *importContext, raw []byte) (importRow, error) {
+	info := new(Area)
+	if err := decodeRow(raw, info); err != nil {
+		return importRow{}, err
+	}
+	if len(info.Name) < 1 {
+		return importRow{}, errors.New("the name is empty")
+	}
+	if err := ctx.checkScene(info.Scene); err != nil {
+		return importRow{}, err
+	}
+	if len(info.Parent) < 1 {
+		return importRow{}, errors.New("the parent is empty")
+	}
+	if ctx.roomScene(info.Parent) != info.Scene {
+		return importRow{}, errors.New("not found the parent room in scene of " + info.Parent)
+	}
+	if len(info.Device) > 0 {
+		db, err := ctx.store.GetDevice(info.Device)
+		if err != nil || !db.DeleteTime.IsZero() {
+			return importRow{}, errors.New("not found the device of " + info.Device)
+		}
+		//一个设备只能绑定一个展区
+		if ctx.devices[info.Device] {
+			return importRow{}, errors.New("the device repeated in file of " + info.Device)
+		}
+		area, err := ctx.store.GetAreaByDevice(info.Device)
+		if err == nil && area.DeleteTime.IsZero() {
+			return importRow{}, errors.New("the device had bound to other area of " + area.UID.Hex())
+		}
+		ctx.devices[info.Device] = true
+	}
+	info.UID = primitive.NewObjectID()
+	info.CreatedTime = time.Now()
+	info.UpdatedTime = time.Now()
+	info.DeleteTime = time.Time{}
+	info.Creator = ctx.operator
+	info.Operator = ctx.operator
+	if info.Displays == nil {
+		info.Displays = make([]string, 0, 1)
+	}
+	if info.Assets == nil {
+		info.Assets = make([]string, 0, 1)
+	}
+	return importRow{uid: info.UID.Hex(), model: info}, nil
+}
+
+func checkImportDevice(ctx *importContext, raw []byte) (importRow, error) {
+	info := new(Invite)
+	if err := decodeRow(raw, info); err != nil {
+		return importRow{}, err
+	}
+	if len(info.SN) < 1 {
+		return importRow{}, errors.New("the sn is empty")
+	}
+	if ctx.sns[info.SN] {
+		return importRow{}, errors.New("the sn repeated in file of " + info.SN)
+	}
+	db, err := ctx.store.GetDeviceBySN(info.SN)
+	if err == nil && db.DeleteTime.IsZero() {
+		return importRow{}, errors.New("the sn had existed of " + info.SN)
+	}
+	if len(info.Scene) > 0 && !ctx.hadScene(info.Scene) {
+		return importRow{}, errors.New("not found the scene of " + info.Scene)
+	}
+	ctx.sns[info.SN] = true
+	info.UID = primitive.NewObjectID()
+	info.CreatedTime = time.Now()
+	info.UpdatedTime = time.Now()
+	info.DeleteTime = time.Time{}
+	info.Creator = ctx.operator
+	info.Operator = ctx.operator
+	return importRow{uid: info.UID.Hex(), model: info}, nil
+}
+
+func checkImportMaintain(ctx *importContext, raw []byte) (importRow, error) {
+	info := new(Maintain)
+	if err := decodeRow(raw, info); err != nil {
+		return importRow{}, err
+	}
+	if err := ctx.checkScene(info.Scene); err != nil {
+		return importRow{}, err
+	}
+	if len(info.Area) > 0 && ctx.areaScene(info.Area) != info.Scene {
+		return importRow{}, errors.New("not found the area in scene of " + info.Area)
+	}
+	info.UID = primitive.NewObjectID()
+	info.CreatedTime = time.Now()
+	info.UpdatedTime = time.Now()
+	info.DeleteTime = time.Time{}
+	info.Creator = ctx.operator
+	info.Operator = ctx.operator
+	if info.Maintainers == nil {
+		info.Maintainers = make([]string, 0, 1)
+	}
+	if info.Contents == nil {
+		info.Contents = make([]proxy.MaintainContent, 0, 1)
+	}
+	return importRow{uid: info.UID.Hex(), model: info}, nil
+}
+
+//endregion
@@ -0,0 +1,227 @@
+package nosql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+/**
+索引管理，启动时按照声明的索引集合进行同步，
+由本服务管理的索引以idx_或者uni_开头，其他名字的索引只报告不删除
+*/
+
+// IndexVersion 索引集合的版本，修改indexDefines后需要递增
+const IndexVersion = 7
+
+const (
+	IndexMissing = "missing" //缺少
+	IndexChanged = "changed" //定义不一致
+	IndexExtra   = "extra"   //多余
+)
+
+type indexDefine struct {
+	table   string
+	name    string
+	keys    bson.D
+	unique  bool
+	partial bson.M
+}
+
+// IndexDrift 实际索引和声明不一致的地方
+type IndexDrift struct {
+	Table string `json:"table"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+type IndexReport struct {
+	Version int           `json:"version"`
+	Applied int           `json:"applied"` //数据库中记录的版本
+	Drifts  []*IndexDrift `json:"drifts"`
+}
+
+type indexInfo struct {
+	Name    string `bson:"name"`
+	Key     bson.D `bson:"key"`
+	Unique  bool   `bson:"unique"`
+	Partial bson.M `bson:"partialFilterExpression"`
+}
+
+// indexDefines 声明的索引，未删除的设备sn以及场景管理员唯一，场景以及区域的位置使用2dsphere索引
+func indexDefines() []*indexDefine {
+	alive := bson.M{"deleteAt": bson.M{"$eq": time.Time{}}}
+	return []*indexDefine{
+		{table: TableSequence, name: "uni_name", keys: bson.D{{Key: "name", Value: 1}}, unique: true},
+		{table: TableMigration, name: "uni_version", keys: bson.D{{Key: "version", Value: 1}}, unique: true},
+		{table: TableResume, name: "uni_name", keys: bson.D{{Key: "name", Value: 1}}, unique: true},
+		{table: TableAudit, name: "idx_scene_created", keys: bson.D{{Key: "scene", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{table: TableAudit, name: "idx_target_created", keys: bson.D{{Key: "target", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{table: TableAudit, name: "idx_operator_created", keys: bson.D{{Key: "operator", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{table: TableRevision, name: "idx_target_created", keys: bson.D{{Key: "target", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{table: TableScene, name: "uni_master", keys: bson.D{{Key: "master", Value: 1}}, unique: true,
+			partial: bson.M{"master": bson.M{"$gt": ""}, "deleteAt": bson.M{"$eq": time.Time{}}}},
+		{table: TableScene, name: "idx_geo", keys: bson.D{{Key: "geo", Value: "2dsphere"}}},
+		{table: TableGroup, name: "idx_scene", keys: bson.D{{Key: "scene", Value: 1}}},
+		{table: TableRoom, name: "idx_scene", keys: bson.D{{Key: "scene", Value: 1}}},
+		{table: TableRegion, name: "idx_scene", keys: bson.D{{Key: "scene", Value: 1}}},
+		{table: TableRegion, name: "idx_parent", keys: bson.D{{Key: "parent", Value: 1}}},
+		{table: TableRegion, name: "idx_geo", keys: bson.D{{Key: "geo", Value: "2dsphere"}}},
+		{table: TableArea, name: "idx_scene", keys: bson.D{{Key: "scene", Value: 1}}},
+		{table: TableArea, name: "idx_parent", keys: bson.D{{Key: "parent", Value: 1}}},
+		{table: TableArea, name: "idx_device", keys: bson.D{{Key: "device", Value: 1}}},
+		{table: TableDevice, name: "uni_sn", keys: bson.D{{Key: "sn", Value: 1}}, unique: true, partial: alive},
+		{table: TableDevice, name: "idx_scene", keys: bson.D{{Key: "scene", Value: 1}}},
+		{table: TableDevice, name: "idx_status", keys: bson.D{{Key: "status", Value: 1}}},
+		{table: TableMaintain, name: "idx_scene_area", keys: bson.D{{Key: "scene", Value: 1}, {Key: "area", Value: 1}}},
+	}
+}
+
+func indexTables() []string {
+	return []string{TableSequence, TableMigration, TableResume, TableAudit, TableRevision, TableScene, TableGroup, TableRoom, TableRegion, TableArea, TableDevice, TableMaintain}
+}
+
+func isManagedIndex(name string) bool {
+	return strings.HasPrefix(name, "idx_") || strings.HasPrefix(name, "uni_")
+}
+
+// CheckIndexes 对比数据库中的索引和声明的索引，apply为true时创建缺少的，重建不一致的，删除多余的
+func CheckIndexes(apply bool) (*IndexReport, error) {
+	report := &IndexReport{Version: IndexVersion, Drifts: make([]*IndexDrift, 0, 5)}
+	report.Applied, _ = getVersion(versionIndexes)
+	defines := indexDefines()
+	for _, table := range indexTables() {
+		exists, err := listIndexes(table)
+		if err != nil {
+			return nil, err
+		}
+		for _, define := range defines {
+			if define.table != table {
+				continue
+			}
+			info, ok := exists[define.name]
+			delete(exists, define.name)
+			state := ""
+			if !ok {
+				state = IndexMissing
+			} else if !define.equal(info) {
+				state = IndexChanged
+			}
+			if len(state) < 1 {
+				continue
+			}
+			drift := &IndexDrift{Table: table, Name: define.name, State: state}
+			if apply {
+				var er error
+				if state == IndexChanged {
+					er = dropIndex(table, define.name)
+				}
+				if er == nil {
+					er = define.create()
+				}
+				if er != nil {
+					drift.Error = er.Error()
+				}
+			}
+			report.Drifts = append(report.Drifts, drift)
+		}
+		for name := range exists {
+			if name == "_id_" {
+				continue
+			}
+			drift := &IndexDrift{Table: table, Name: name, State: IndexExtra}
+			if apply && isManagedIndex(name) {
+				er := dropIndex(table, name)
+				if er != nil {
+					drift.Error = er.Error()
+				}
+			}
+			report.Drifts = append(report.Drifts, drift)
+		}
+	}
+	if apply {
+		failed := false
+		for _, drift := range report.Drifts {
+			if len(drift.Error) > 0 {
+				failed = true
+			}
+		}
+		if !failed && report.Applied != IndexVersion {
+			err := setVersion(versionIndexes, IndexVersion)
+			if err != nil {
+				return report, err
+			}
+			report.Applied = IndexVersion
+		}
+	}
+	return report, nil
+}
+
+// equal 比较字段以及唯一约束，部分索引只比较条件的字段
+func (mine *indexDefine) equal(info *indexInfo) bool {
+	if mine.unique != info.Unique || len(mine.keys) != len(info.Key) || len(mine.partial) != len(info.Partial) {
+		return false
+	}
+	for i, key := range mine.keys {
+		if info.Key[i].Key != key.Key || fmt.Sprint(info.Key[i].Value) != fmt.Sprint(key.Value) {
+			return false
+		}
+	}
+	for key := range mine.partial {
+		if _, ok := info.Partial[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (mine *indexDefine) create() error {
+	opts := options.Index().SetName(mine.name)
+	if mine.unique {
+		opts.SetUnique(true)
+	}
+	if mine.partial != nil {
+		opts.SetPartialFilterExpression(mine.partial)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	_, err := noSql.Collection(mine.table).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: mine.keys, Options: opts})
+	return err
+}
+
+func listIndexes(table string) (map[string]*indexInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	list := make(map[string]*indexInfo, 5)
+	cursor, err := noSql.Collection(table).Indexes().List(ctx)
+	if err != nil {
+		//集合还不存在
+		var cmd mongo.CommandError
+		if errors.As(err, &cmd) && cmd.Code == 26 {
+			return list, nil
+		}
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var node = new(indexInfo)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		}
+		list[node.Name] = node
+	}
+	return list, nil
+}
+
+func dropIndex(table, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	_, err := noSql.Collection(table).Indexes().DropOne(ctx, name)
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"omo.msa.organization/proxy"
 	"time"
 )
@@ -16,6 +17,7 @@ type Maintain struct {
 	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
 	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Version     uint32             `json:"version" bson:"version"` //每次修改加1，用于乐观锁
 	Creator     string             `json:"creator" bson:"creator"`
 	Operator    string             `json:"operator" bson:"operator"`
 
@@ -31,21 +33,20 @@ type Maintain struct {
 	Contents    []proxy.MaintainContent `json:"contents" bson:"contents"`       //内容，原因
 }
 
-func CreateMaintain(info *Maintain) error {
-	_, err := insertOne(TableMaintain, &info)
+func CreateMaintain(ctx context.Context, info *Maintain) error {
+	_, err := insertOne(ctx, TableMaintain, &info)
 	return err
 }
 
-func GetMaintainNextID() uint64 {
-	num, _ := getSequenceNext(TableMaintain)
-	return num
+func GetMaintainNextID() (uint64, error) {
+	return getSequenceNext(TableMaintain)
 }
 
-func RemoveMaintain(uid, operator string) error {
+func RemoveMaintain(ctx context.Context, uid, operator string) error {
 	if len(uid) < 2 {
 		return errors.New("db Maintain uid is empty ")
 	}
-	_, err := removeOne(TableMaintain, uid, operator)
+	_, err := removeOne(ctx, TableMaintain, uid, operator)
 	return err
 }
 
@@ -102,6 +103,24 @@ func GetMaintainsByArea(scene, area string) ([]*Maintain, error) {
 	return items, nil
 }
 
+// GetMaintainsByFilter 组合条件的查询，只有mongo支持
+func GetMaintainsByFilter(filter bson.M, sorts bson.D) ([]*Maintain, error) {
+	cursor, err1 := findManyByOpts(TableMaintain, filter, options.Find().SetSort(sorts))
+	if err1 != nil {
+		return nil, err1
+	}
+	var items = make([]*Maintain, 0, 20)
+	for cursor.Next(context.Background()) {
+		var node = new(Maintain)
+		if err := cursor.Decode(&node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
 func GetMaintainCount() int64 {
 	num, _ := getCount(TableMaintain)
 	return num
@@ -0,0 +1,353 @@
+package nosql
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+mongo查询条件在内存中的计算，用于不支持组合查询的存储，
+只支持组合过滤生成的操作：$and、$or、$nor、$ne、$gt、$gte、$lt、$lte、$in、$nin、$regex以及$size，
+数组字段的相等以及比较表示其中某个元素满足条件，和mongo一致
+*/
+
+// FilterModels 按照条件过滤后按照sorts排序，排序相同的保持原来的顺序
+func FilterModels[T any](list []*T, filter bson.M, sorts bson.D) ([]*T, error) {
+	type pair struct {
+		doc  bson.M
+		info *T
+	}
+	pairs := make([]pair, 0, len(list))
+	for _, info := range list {
+		doc, err := toBsonDoc(info)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := MatchBson(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			pairs = append(pairs, pair{doc: doc, info: info})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		for _, item := range sorts {
+			ret := compareSort(pairs[i].doc, pairs[j].doc, item.Key)
+			if ret == 0 {
+				continue
+			}
+			if order, _ := toNumber(item.Value); order < 0 {
+				return ret > 0
+			}
+			return ret < 0
+		}
+		return false
+	})
+	arr := make([]*T, 0, len(pairs))
+	for _, item := range pairs {
+		arr = append(arr, item.info)
+	}
+	return arr, nil
+}
+
+func toBsonDoc(info interface{}) (bson.M, error) {
+	bytes, err := bson.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	err = bson.Unmarshal(bytes, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// MatchBson 文档是否满足条件，不支持的操作返回错误
+func MatchBson(doc bson.M, filter bson.M) (bool, error) {
+	for key, cond := range filter {
+		var ok bool
+		var err error
+		switch key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogic(doc, key, cond)
+		default:
+			value, found := lookupBson(doc, key)
+			ok, err = matchField(value, found, cond)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogic(doc bson.M, key string, cond interface{}) (bool, error) {
+	subs, err := toFilters(cond)
+	if err != nil {
+		return false, err
+	}
+	for _, sub := range subs {
+		ok, er := MatchBson(doc, sub)
+		if er != nil {
+			return false, er
+		}
+		if key == "$and" && !ok {
+			return false, nil
+		}
+		if key != "$and" && ok {
+			return key == "$or", nil
+		}
+	}
+	return key != "$or", nil
+}
+
+func toFilters(cond interface{}) ([]bson.M, error) {
+	switch arr := cond.(type) {
+	case []bson.M:
+		return arr, nil
+	case bson.A:
+		list := make([]bson.M, 0, len(arr))
+		for _, item := range arr {
+			sub, ok := item.(bson.M)
+			if !ok {
+				return nil, errors.New("the filter condition need a document")
+			}
+			list = append(list, sub)
+		}
+		return list, nil
+	}
+	return nil, errors.New("the filter condition need an array")
+}
+
+// lookupBson 字段名可以使用.访问内嵌的文档
+func lookupBson(doc bson.M, key string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, name := range strings.Split(key, ".") {
+		switch tmp := value.(type) {
+		case bson.M:
+			item, ok := tmp[name]
+			if !ok {
+				return nil, false
+			}
+			value = item
+		case primitive.D:
+			item, ok := tmp.Map()[name]
+			if !ok {
+				return nil, false
+			}
+			value = item
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func matchField(value interface{}, found bool, cond interface{}) (bool, error) {
+	ops, ok := cond.(bson.M)
+	if !ok || !isOperators(ops) {
+		return equalBson(value, found, cond), nil
+	}
+	for op, arg := range ops {
+		var ok bool
+		switch op {
+		case "$ne":
+			ok = !equalBson(value, found, arg)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = anyItem(value, func(item interface{}) bool {
+				ret, same := compareBson(item, arg)
+				return same && compareOp(op, ret)
+			})
+		case "$in", "$nin":
+			list, er := toList(arg)
+			if er != nil {
+				return false, er
+			}
+			had := false
+			for _, item := range list {
+				if equalBson(value, found, item) {
+					had = true
+					break
+				}
+			}
+			ok = had == (op == "$in")
+		case "$regex":
+			options, _ := ops["$options"].(string)
+			pattern, _ := arg.(string)
+			if strings.Contains(options, "i") {
+				pattern = "(?i)" + pattern
+			}
+			reg, er := regexp.Compile(pattern)
+			if er != nil {
+				return false, er
+			}
+			ok = anyItem(value, func(item interface{}) bool {
+				str, is := item.(string)
+				return is && reg.MatchString(str)
+			})
+		case "$options":
+			ok = true
+		case "$size":
+			arr, is := value.(bson.A)
+			num, _ := toNumber(arg)
+			ok = is && float64(len(arr)) == num
+		default:
+			return false, errors.New("the filter op not support of " + op)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func isOperators(ops bson.M) bool {
+	for key := range ops {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return len(ops) > 0
+}
+
+func compareOp(op string, ret int) bool {
+	switch op {
+	case "$gt":
+		return ret > 0
+	case "$gte":
+		return ret >= 0
+	case "$lt":
+		return ret < 0
+	}
+	return ret <= 0
+}
+
+// equalBson nil匹配不存在或者为null的字段，数组包含某个元素时相等
+func equalBson(value interface{}, found bool, want interface{}) bool {
+	if want == nil {
+		return !found || value == nil
+	}
+	return anyItem(value, func(item interface{}) bool {
+		ret, same := compareBson(item, want)
+		return same && ret == 0
+	})
+}
+
+func anyItem(value interface{}, fun func(item interface{}) bool) bool {
+	if arr, ok := value.(bson.A); ok {
+		for _, item := range arr {
+			if fun(item) {
+				return true
+			}
+		}
+		return false
+	}
+	return fun(value)
+}
+
+func toList(arg interface{}) ([]interface{}, error) {
+	switch arr := arg.(type) {
+	case bson.A:
+		return arr, nil
+	case []interface{}:
+		return arr, nil
+	case []string:
+		list := make([]interface{}, 0, len(arr))
+		for _, item := range arr {
+			list = append(list, item)
+		}
+		return list, nil
+	}
+	return nil, errors.New("the filter value need an array")
+}
+
+// compareBson 数字、时间以及字符串之间的比较，类型不同时第二个返回值为false
+func compareBson(a, b interface{}) (int, bool) {
+	if x, ok := toNumber(a); ok {
+		y, is := toNumber(b)
+		return compareFloat(x, y), is
+	}
+	if x, ok := toMillis(a); ok {
+		y, is := toMillis(b)
+		return compareFloat(float64(x), float64(y)), is
+	}
+	x, ok := toText(a)
+	y, is := toText(b)
+	if !ok || !is {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+func compareFloat(x, y float64) int {
+	if x < y {
+		return -1
+	} else if x > y {
+		return 1
+	}
+	return 0
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch tmp := value.(type) {
+	case int:
+		return float64(tmp), true
+	case int32:
+		return float64(tmp), true
+	case int64:
+		return float64(tmp), true
+	case uint8:
+		return float64(tmp), true
+	case uint32:
+		return float64(tmp), true
+	case uint64:
+		return float64(tmp), true
+	case float64:
+		return tmp, true
+	}
+	return 0, false
+}
+
+// toMillis mongo的时间精确到毫秒
+func toMillis(value interface{}) (int64, bool) {
+	switch tmp := value.(type) {
+	case time.Time:
+		return int64(primitive.NewDateTimeFromTime(tmp)), true
+	case primitive.DateTime:
+		return int64(tmp), true
+	}
+	return 0, false
+}
+
+func toText(value interface{}) (string, bool) {
+	switch tmp := value.(type) {
+	case string:
+		return tmp, true
+	case primitive.ObjectID:
+		return tmp.Hex(), true
+	}
+	return "", false
+}
+
+// compareSort 不存在或者为null的字段在前面
+func compareSort(a, b bson.M, key string) int {
+	x, _ := lookupBson(a, key)
+	y, _ := lookupBson(b, key)
+	if x == nil || y == nil {
+		if x == nil && y == nil {
+			return 0
+		} else if x == nil {
+			return -1
+		}
+		return 1
+	}
+	ret, _ := compareBson(x, y)
+	return ret
+}
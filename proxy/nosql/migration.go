@@ -0,0 +1,240 @@
+package nosql
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"time"
+)
+
+/**
+数据结构迁移，已经执行的版本记录在migrations表中，
+新增迁移时追加到migrations()的末尾，版本号递增，不能修改已经发布的迁移
+*/
+
+const (
+	MigrateUp   = "up"
+	MigrateDown = "down"
+)
+
+type migration struct {
+	version int
+	name    string
+	up      func(dry bool) (int64, error)
+	down    func(dry bool) (int64, error)
+}
+
+// MigrationRecord 已经执行的迁移
+type MigrationRecord struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	Version     int                `json:"version" bson:"version"`
+	Name        string             `json:"name" bson:"name"`
+	AppliedTime time.Time          `json:"appliedAt" bson:"appliedAt"`
+}
+
+// MigrationResult 一次迁移的结果，dry为true时affected为将要修改的数量
+type MigrationResult struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Direction string `json:"direction"`
+	Affected  int64  `json:"affected"`
+	Dry       bool   `json:"dry"`
+}
+
+func migrations() []*migration {
+	return []*migration{
+		{version: 1, name: "backfill_scene_arrays",
+			up: func(dry bool) (int64, error) {
+				return backfillArrays(TableScene, []string{"members", "parents", "questions"}, dry)
+			}, down: skipMigration},
+		{version: 2, name: "backfill_child_arrays",
+			up: func(dry bool) (int64, error) {
+				num, err := backfillArrays(TableRoom, []string{"quotes"}, dry)
+				if err != nil {
+					return num, err
+				}
+				count, err := backfillArrays(TableGroup, []string{"members"}, dry)
+				num += count
+				if err != nil {
+					return num, err
+				}
+				count, err = backfillArrays(TableRegion, []string{"members"}, dry)
+				return num + count, err
+			}, down: skipMigration},
+		{version: 3, name: "backfill_area_arrays",
+			up: func(dry bool) (int64, error) {
+				return backfillArrays(TableArea, []string{"displays", "assets", "modules", "sources"}, dry)
+			}, down: skipMigration},
+		{version: 4, name: "archive_scene_legacy",
+			up: func(dry bool) (int64, error) {
+				return renameFields(TableScene, legacySceneFields(false), dry)
+			},
+			down: func(dry bool) (int64, error) {
+				num, err := renameFields(TableScene, legacySceneFields(true), dry)
+				if err != nil || dry {
+					return num, err
+				}
+				_, err = updateMany(TableScene, bson.M{"legacy": bson.M{}}, bson.M{"$unset": bson.M{"legacy": ""}})
+				return num, err
+			}},
+		{version: 5, name: "backfill_location_geo",
+			up: func(dry bool) (int64, error) {
+				var num int64
+				for _, table := range []string{TableScene, TableGroup, TableRegion} {
+					count, err := backfillGeo(table, dry)
+					num += count
+					if err != nil {
+						return num, err
+					}
+				}
+				return num, nil
+			},
+			down: func(dry bool) (int64, error) {
+				var num int64
+				for _, table := range []string{TableScene, TableGroup, TableRegion} {
+					filter := bson.M{"geo": bson.M{"$exists": true}}
+					var count int64
+					var err error
+					if dry {
+						count, err = getCountBy(table, filter)
+					} else {
+						count, err = updateMany(table, filter, bson.M{"$unset": bson.M{"geo": ""}})
+					}
+					num += count
+					if err != nil {
+						return num, err
+					}
+				}
+				return num, nil
+			}},
+	}
+}
+
+// legacySceneFields 已经废弃的字段移动到legacy下，保留数据以便回滚
+func legacySceneFields(reverse bool) map[string]string {
+	list := []string{"bucket", "exhibitions", "displays", "domains"}
+	pairs := make(map[string]string, len(list))
+	for _, field := range list {
+		if reverse {
+			pairs["legacy."+field] = field
+		} else {
+			pairs[field] = "legacy." + field
+		}
+	}
+	return pairs
+}
+
+// skipMigration nil和空数组解码后一致，回滚时不需要处理
+func skipMigration(dry bool) (int64, error) {
+	return 0, nil
+}
+
+// Migrate 迁移到指定的版本，target小于0时迁移到最新版本，小于当前版本时回滚
+func Migrate(target int, dry bool) ([]*MigrationResult, error) {
+	records, err := GetMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]*MigrationRecord, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	all := migrations()
+	if target < 0 {
+		target = all[len(all)-1].version
+	}
+	list := make([]*MigrationResult, 0, len(all))
+	for _, item := range all {
+		if _, ok := applied[item.version]; ok || item.version > target {
+			continue
+		}
+		num, er := item.up(dry)
+		if er != nil {
+			return list, errors.New("migrate " + item.name + " failed that " + er.Error())
+		}
+		list = append(list, &MigrationResult{Version: item.version, Name: item.name, Direction: MigrateUp, Affected: num, Dry: dry})
+		if !dry {
+			record := &MigrationRecord{UID: primitive.NewObjectID(), Version: item.version, Name: item.name, AppliedTime: time.Now()}
+			_, er = insertOne(context.Background(), TableMigration, record)
+			if er != nil {
+				return list, er
+			}
+		}
+	}
+	for i := len(all) - 1; i >= 0; i-- {
+		item := all[i]
+		record, ok := applied[item.version]
+		if !ok || item.version <= target {
+			continue
+		}
+		num, er := item.down(dry)
+		if er != nil {
+			return list, errors.New("rollback " + item.name + " failed that " + er.Error())
+		}
+		list = append(list, &MigrationResult{Version: item.version, Name: item.name, Direction: MigrateDown, Affected: num, Dry: dry})
+		if !dry {
+			_, er = deleteOne(TableMigration, record.UID.Hex())
+			if er != nil {
+				return list, er
+			}
+		}
+	}
+	return list, nil
+}
+
+// GetMigrations 已经执行的迁移，按照版本排序
+func GetMigrations() ([]*MigrationRecord, error) {
+	cursor, err1 := findMany(TableMigration, bson.M{}, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	var items = make([]*MigrationRecord, 0, 10)
+	for cursor.Next(context.Background()) {
+		var node = new(MigrationRecord)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		}
+		items = append(items, node)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Version < items[j].Version
+	})
+	return items, nil
+}
+
+// backfillArrays 把不存在或者为null的数组字段设置为空数组，返回修改的字段数量
+func backfillArrays(table string, fields []string, dry bool) (int64, error) {
+	var num int64
+	for _, field := range fields {
+		filter := bson.M{field: nil}
+		if dry {
+			count, err := getCountBy(table, filter)
+			if err != nil {
+				return num, err
+			}
+			num += count
+			continue
+		}
+		count, err := updateMany(table, filter, bson.M{"$set": bson.M{field: bson.A{}}})
+		if err != nil {
+			return num, err
+		}
+		num += count
+	}
+	return num, nil
+}
+
+// renameFields 重命名字段，返回包含这些字段的文档数量
+func renameFields(table string, pairs map[string]string, dry bool) (int64, error) {
+	or := make(bson.A, 0, len(pairs))
+	for from := range pairs {
+		or = append(or, bson.M{from: bson.M{"$exists": true}})
+	}
+	filter := bson.M{"$or": or}
+	if dry {
+		return getCountBy(table, filter)
+	}
+	return updateMany(table, filter, bson.M{"$rename": pairs})
+}
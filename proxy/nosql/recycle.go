@@ -0,0 +1,117 @@
+package nosql
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+/**
+回收站，软删除的文档可以列出、恢复或者超过保留期后彻底删除
+*/
+
+// RecycleInfo 回收站中的一条记录
+type RecycleInfo struct {
+	Table    string    `json:"table" bson:"-"`
+	UID      string    `json:"uid" bson:"-"`
+	Name     string    `json:"name" bson:"name"`
+	Scene    string    `json:"scene" bson:"scene"`
+	Operator string    `json:"operator" bson:"operator"`
+	Deleted  time.Time `json:"deleted" bson:"deleteAt"`
+}
+
+type recycleDoc struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	RecycleInfo `bson:",inline"`
+}
+
+// RecycleTables 支持回收站的表
+func RecycleTables() []string {
+	return []string{TableScene, TableGroup, TableRoom, TableRegion, TableArea, TableDevice, TableMaintain}
+}
+
+func IsRecycleTable(table string) bool {
+	for _, item := range RecycleTables() {
+		if item == table {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRecycles 场景下已经删除的文档，包括场景本身
+func GetRecycles(scene string) ([]*RecycleInfo, error) {
+	if len(scene) < 1 {
+		return nil, errors.New("the scene uid is empty")
+	}
+	list := make([]*RecycleInfo, 0, 20)
+	for _, table := range RecycleTables() {
+		filter := bson.M{"scene": scene, "deleteAt": bson.M{"$gt": new(time.Time)}}
+		if table == TableScene {
+			objID, err := primitive.ObjectIDFromHex(scene)
+			if err != nil {
+				return nil, err
+			}
+			filter = bson.M{"_id": objID, "deleteAt": bson.M{"$gt": new(time.Time)}}
+		}
+		arr, err := findRecycles(table, filter)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, arr...)
+	}
+	return list, nil
+}
+
+// GetRecyclesBefore 删除时间早于stamp的文档
+func GetRecyclesBefore(stamp time.Time) ([]*RecycleInfo, error) {
+	list := make([]*RecycleInfo, 0, 20)
+	for _, table := range RecycleTables() {
+		arr, err := findRecycles(table, bson.M{"deleteAt": bson.M{"$gt": new(time.Time), "$lt": stamp}})
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, arr...)
+	}
+	return list, nil
+}
+
+func RestoreRecycle(ctx context.Context, table, uid, operator string) error {
+	if !IsRecycleTable(table) {
+		return errors.New("the table not support recycle of " + table)
+	}
+	msg := bson.M{"deleteAt": new(time.Time), "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(ctx, table, uid, msg)
+	return err
+}
+
+func PurgeRecycle(ctx context.Context, table, uid string) error {
+	if !IsRecycleTable(table) {
+		return errors.New("the table not support recycle of " + table)
+	}
+	_, err := deleteOne(table, uid)
+	return err
+}
+
+func findRecycles(table string, filter bson.M) ([]*RecycleInfo, error) {
+	cursor, err1 := findMany(table, filter, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	var items = make([]*RecycleInfo, 0, 10)
+	for cursor.Next(context.Background()) {
+		var node = new(recycleDoc)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		}
+		node.Table = table
+		node.RecycleInfo.UID = node.UID.Hex()
+		if table == TableScene {
+			node.Scene = node.RecycleInfo.UID
+		}
+		items = append(items, &node.RecycleInfo)
+	}
+	return items, nil
+}
@@ -16,6 +16,7 @@ type Region struct {
 	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
 	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Version     uint32             `json:"version" bson:"version"` //每次修改加1，用于乐观锁
 
 	Creator  string `json:"creator" bson:"creator"`
 	Operator string `json:"operator" bson:"operator"`
@@ -26,21 +27,21 @@ type Region struct {
 	Parent   string `json:"parent" bson:"parent"`
 	Master   string `json:"master" bson:"master"`
 	Location  string      `json:"location" bson:"location"`
+	Geo       *GeoPoint   `json:"geo,omitempty" bson:"geo,omitempty"`
 	Address   AddressInfo `json:"address" bson:"address"`
 	Members  []string `json:"members" bson:"members"`
 }
 
-func CreateRegion(info *Region) error {
-	_, err := insertOne(TableRegion, info)
+func CreateRegion(ctx context.Context, info *Region) error {
+	_, err := insertOne(ctx, TableRegion, info)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetRegionNextID() uint64 {
-	num, _ := getSequenceNext(TableRegion)
-	return num
+func GetRegionNextID() (uint64, error) {
+	return getSequenceNext(TableRegion)
 }
 
 func GetRegionCount() int64 {
@@ -75,8 +76,8 @@ func GetRegionByID(id uint64) (*Region, error) {
 	return model, nil
 }
 
-func RemoveRegion(uid,operator string) error {
-	_, err := removeOne(TableRegion, uid, operator)
+func RemoveRegion(ctx context.Context, uid,operator string) error {
+	_, err := removeOne(ctx, TableRegion, uid, operator)
 	return err
 }
 
@@ -131,57 +132,58 @@ func GetRegionsByParent(parent string) ([]*Region, error) {
 	return items, nil
 }
 
-func UpdateRegionBase(uid, name, remark, operator string) error {
+func UpdateRegionBase(ctx context.Context, uid, name, remark, operator string) error {
 	msg := bson.M{"name": name, "remark": remark, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableRegion, uid, msg)
+	_, err := updateOne(ctx, TableRegion, uid, msg)
 	return err
 }
 
-func UpdateRegionMaster(uid, master, operator string) error {
+func UpdateRegionMaster(ctx context.Context, uid, master, operator string) error {
 	msg := bson.M{"master": master, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableRegion, uid, msg)
+	_, err := updateOne(ctx, TableRegion, uid, msg)
 	return err
 }
 
-func UpdateRegionEntity(uid, entity, operator string) error {
+func UpdateRegionEntity(ctx context.Context, uid, entity, operator string) error {
 	msg := bson.M{"entity": entity, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableRegion, uid, msg)
+	_, err := updateOne(ctx, TableRegion, uid, msg)
 	return err
 }
 
-func UpdateRegionParent(uid, parent, operator string) error {
+func UpdateRegionParent(ctx context.Context, uid, parent, operator string) error {
 	msg := bson.M{"parent": parent, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableRegion, uid, msg)
+	_, err := updateOne(ctx, TableRegion, uid, msg)
 	return err
 }
 
-func UpdateRegionAddress(uid, operator string, address AddressInfo) error {
+func UpdateRegionAddress(ctx context.Context, uid, operator string, address AddressInfo) error {
 	msg := bson.M{"operator": operator, "address": address, "updatedAt": time.Now()}
-	_, err := updateOne(TableRegion, uid, msg)
+	_, err := updateOne(ctx, TableRegion, uid, msg)
 	return err
 }
 
-func UpdateRegionLocation(uid, location, operator string) error {
-	msg := bson.M{"location": location,"operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableRegion, uid, msg)
+func UpdateRegionLocation(ctx context.Context, uid, location, operator string) error {
+	geo, _ := ParseGeoPoint(location)
+	msg := bson.M{"location": location, "geo": geo, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(ctx, TableRegion, uid, msg)
 	return err
 }
 
-func AppendRegionMember(uid string, member string) error {
+func AppendRegionMember(ctx context.Context, uid string, member string) error {
 	if len(uid) < 1 {
 		return errors.New("the uid is empty")
 	}
 	msg := bson.M{"members": member}
-	_, err := appendElement(TableRegion, uid, msg)
+	_, err := appendElement(ctx, TableRegion, uid, msg)
 	return err
 }
 
-func SubtractRegionMember(uid, member string) error {
+func SubtractRegionMember(ctx context.Context, uid, member string) error {
 	if len(uid) < 1 {
 		return errors.New("the uid is empty")
 	}
 	msg := bson.M{"members": member}
-	_, err := removeElement(TableRegion, uid, msg)
+	_, err := removeElement(ctx, TableRegion, uid, msg)
 	return err
 }
 
@@ -0,0 +1,103 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+/**
+历史版本，场景、房间以及区域每次修改后保存一份完整的文档，用于查看以及恢复
+*/
+
+// Revision 修改后的文档，Data为json格式
+type Revision struct {
+	UID         primitive.ObjectID `json:"uid" bson:"_id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	Table       string             `json:"table" bson:"table"`
+	Target      string             `json:"target" bson:"target"`
+	Scene       string             `json:"scene" bson:"scene"`
+	Version     uint32             `json:"version" bson:"version"`
+	Action      string             `json:"action" bson:"action"`
+	Operator    string             `json:"operator" bson:"operator"`
+	Path        string             `json:"path" bson:"path"`
+	Data        string             `json:"data" bson:"data"`
+}
+
+// RevisionFilter Before不为空时只查询之前的版本，按照时间倒序
+type RevisionFilter struct {
+	Table  string
+	Target string
+	Before time.Time
+	Limit  int64
+}
+
+// RevisionTables 保存历史版本的表
+func RevisionTables() []string {
+	return []string{TableScene, TableRoom, TableRegion, TableArea}
+}
+
+func IsRevisionTable(table string) bool {
+	for _, item := range RevisionTables() {
+		if item == table {
+			return true
+		}
+	}
+	return false
+}
+
+// Match 内存存储使用的过滤
+func (mine *RevisionFilter) Match(info *Revision) bool {
+	if info.Table != mine.Table || info.Target != mine.Target {
+		return false
+	}
+	if !mine.Before.IsZero() && info.CreatedTime.After(mine.Before) {
+		return false
+	}
+	return true
+}
+
+func CreateRevision(info *Revision) error {
+	_, err := insertOne(context.Background(), TableRevision, info)
+	return err
+}
+
+func GetRevision(uid string) (*Revision, error) {
+	result, err := findOne(TableRevision, uid)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Revision)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetRevisions(filter *RevisionFilter) ([]*Revision, error) {
+	query := bson.M{"table": filter.Table, "target": filter.Target}
+	if !filter.Before.IsZero() {
+		query["createdAt"] = bson.M{"$lte": filter.Before}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+	cursor, err1 := findManyByOpts(TableRevision, query, opts)
+	if err1 != nil {
+		return nil, err1
+	}
+	var items = make([]*Revision, 0, 20)
+	for cursor.Next(context.Background()) {
+		var node = new(Revision)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
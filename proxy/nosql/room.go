@@ -15,6 +15,7 @@ type Room struct {
 	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
 	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Version     uint32             `json:"version" bson:"version"` //每次修改加1，用于乐观锁
 
 	Creator  string `json:"creator" bson:"creator"`
 	Operator string `json:"operator" bson:"operator"`
@@ -23,17 +24,16 @@ type Room struct {
 	Quotes   []string `json:"quotes" bson:"quotes"`
 }
 
-func CreateRoom(info *Room) error {
-	_, err := insertOne(TableRoom, info)
+func CreateRoom(ctx context.Context, info *Room) error {
+	_, err := insertOne(ctx, TableRoom, info)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetRoomNextID() uint64 {
-	num, _ := getSequenceNext(TableRoom)
-	return num
+func GetRoomNextID() (uint64, error) {
+	return getSequenceNext(TableRoom)
 }
 
 func GetRoomCount() int64 {
@@ -68,8 +68,8 @@ func GetRoomByID(id uint64) (*Room, error) {
 	return model, nil
 }
 
-func RemoveRoom(uid,operator string) error {
-	_, err := removeOne(TableRoom, uid, operator)
+func RemoveRoom(ctx context.Context, uid,operator string) error {
+	_, err := removeOne(ctx, TableRoom, uid, operator)
 	return err
 }
 
@@ -107,21 +107,26 @@ func GetRoomsByScene(scene string) ([]*Room, error) {
 	return items, nil
 }
 
-func UpdateRoomBase(uid, name, remark, operator string) error {
+func UpdateRoomBase(ctx context.Context, uid, name, remark, operator string) error {
 	msg := bson.M{"name": name, "remark": remark, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableRoom, uid, msg)
+	_, err := updateOne(ctx, TableRoom, uid, msg)
 	return err
 }
 
-func UpdateRoomDisplays(uid, operator string, list []*proxy.DisplayInfo) error {
+func UpdateRoomDisplays(ctx context.Context, uid, operator string, list []*proxy.DisplayInfo) error {
 	msg := bson.M{"displays": list, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableRoom, uid, msg)
+	_, err := updateOne(ctx, TableRoom, uid, msg)
+	return err
+}
+
+// AppendRoomQuotes 已经存在的引用不重复添加
+func AppendRoomQuotes(ctx context.Context, uid, operator string, arr []string) error {
+	_, err := updateElements(ctx, TableRoom, uid, "$addToSet", bson.M{"quotes": bson.M{"$each": arr}}, operator)
 	return err
 }
 
-func UpdateRoomQuotes(uid, operator string, arr []string) error {
-	msg := bson.M{"operator": operator, "quotes": arr, "updatedAt": time.Now()}
-	_, err := updateOne(TableRoom, uid, msg)
+func SubtractRoomQuotes(ctx context.Context, uid, operator string, arr []string) error {
+	_, err := updateElements(ctx, TableRoom, uid, "$pull", bson.M{"quotes": bson.M{"$in": arr}}, operator)
 	return err
 }
 
@@ -14,20 +14,22 @@ type Scene struct {
 	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
 	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Version     uint32             `json:"version" bson:"version"` //每次修改加1，用于乐观锁
 	Creator     string             `json:"creator" bson:"creator"`
 	Operator    string             `json:"operator" bson:"operator"`
 
-	Name      string `json:"name" bson:"name"`
-	Type      uint8  `json:"type" bson:"type"`
-	Status    uint8  `json:"status" bson:"status"`
-	Limit     uint16 `json:"limit" bson:"limit"`
-	Short     string `json:"short" bson:"short"`
-	Cover     string `json:"cover" bson:"cover"`
-	Master    string `json:"master" bson:"master"`
-	Remark    string `json:"remark" bson:"remark"`
-	Entity    string `json:"entity" bson:"entity"`
-	Location  string `json:"location" bson:"location"`
-	Supporter string `json:"supporter" bson:"supporter"`
+	Name      string    `json:"name" bson:"name"`
+	Type      uint8     `json:"type" bson:"type"`
+	Status    uint8     `json:"status" bson:"status"`
+	Limit     uint16    `json:"limit" bson:"limit"`
+	Short     string    `json:"short" bson:"short"`
+	Cover     string    `json:"cover" bson:"cover"`
+	Master    string    `json:"master" bson:"master"`
+	Remark    string    `json:"remark" bson:"remark"`
+	Entity    string    `json:"entity" bson:"entity"`
+	Location  string    `json:"location" bson:"location"`
+	Geo       *GeoPoint `json:"geo,omitempty" bson:"geo,omitempty"` //根据location生成，用于地理位置查询
+	Supporter string    `json:"supporter" bson:"supporter"`
 	//Bucket    string      `json:"bucket" bson:"bucket"`
 	Address AddressInfo `json:"address" bson:"address"`
 	//Exhibitions []string            `json:"exhibitions" bson:"exhibitions"`
@@ -38,17 +40,16 @@ type Scene struct {
 	//Domains   []proxy.DomainInfo `json:"domains" bson:"domains"`
 }
 
-func CreateScene(info *Scene) error {
-	_, err := insertOne(TableScene, info)
+func CreateScene(ctx context.Context, info *Scene) error {
+	_, err := insertOne(ctx, TableScene, info)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetSceneNextID() uint64 {
-	num, _ := getSequenceNext(TableScene)
-	return num
+func GetSceneNextID() (uint64, error) {
+	return getSequenceNext(TableScene)
 }
 
 func GetScene(uid string) (*Scene, error) {
@@ -96,116 +97,122 @@ func GetAllScenes() ([]*Scene, error) {
 	return items, nil
 }
 
-func UpdateSceneBase(uid, name, remark, operator string) error {
+func UpdateSceneBase(ctx context.Context, uid, name, remark, operator string) error {
 	msg := bson.M{"name": name, "remark": remark, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+	_, err := updateOne(ctx, TableScene, uid, msg)
 	return err
 }
 
-func UpdateSceneMaster(uid, master, operator string) error {
+func UpdateSceneMaster(ctx context.Context, uid, master, operator string) error {
 	msg := bson.M{"master": master, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+	_, err := updateOne(ctx, TableScene, uid, msg)
 	return err
 }
 
-func UpdateSceneCover(uid, icon, operator string) error {
+func UpdateSceneCover(ctx context.Context, uid, icon, operator string) error {
 	msg := bson.M{"cover": icon, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+	_, err := updateOne(ctx, TableScene, uid, msg)
 	return err
 }
 
-func UpdateSceneType(uid, operator string, tp uint8) error {
+func UpdateSceneType(ctx context.Context, uid, operator string, tp uint8) error {
 	msg := bson.M{"type": tp, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+	_, err := updateOne(ctx, TableScene, uid, msg)
 	return err
 }
 
-func UpdateSceneLocal(uid, local, operator string) error {
-	msg := bson.M{"location": local, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+func UpdateSceneLocal(ctx context.Context, uid, local, operator string) error {
+	geo, _ := ParseGeoPoint(local)
+	msg := bson.M{"location": local, "geo": geo, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(ctx, TableScene, uid, msg)
 	return err
 }
 
-func UpdateSceneAddress(uid, operator string, address AddressInfo) error {
+func UpdateSceneAddress(ctx context.Context, uid, operator string, address AddressInfo) error {
 	msg := bson.M{"address": address, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+	_, err := updateOne(ctx, TableScene, uid, msg)
 	return err
 }
 
-func UpdateSceneStatus(uid string, status uint8, operator string) error {
+func UpdateSceneStatus(ctx context.Context, uid string, status uint8, operator string) error {
 	msg := bson.M{"status": status, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+	_, err := updateOne(ctx, TableScene, uid, msg)
 	return err
 }
 
 //func UpdateSceneDomains(uid, operator string, domains []proxy.DomainInfo) error {
 //	msg := bson.M{"domains": domains, "operator": operator, "updatedAt": time.Now()}
-//	_, err := updateOne(TableScene, uid, msg)
+//	_, err := updateOne(ctx, TableScene, uid, msg)
 //	return err
 //}
 
-func UpdateSceneQuestions(uid, operator string, arr []string) error {
-	msg := bson.M{"questions": arr, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+// AppendSceneQuestions 已经存在的问题不重复添加
+func AppendSceneQuestions(ctx context.Context, uid, operator string, arr []string) error {
+	_, err := updateElements(ctx, TableScene, uid, "$addToSet", bson.M{"questions": bson.M{"$each": arr}}, operator)
 	return err
 }
 
-func UpdateSceneLimit(uid, operator string, limit uint16) error {
+func SubtractSceneQuestions(ctx context.Context, uid, operator string, arr []string) error {
+	_, err := updateElements(ctx, TableScene, uid, "$pull", bson.M{"questions": bson.M{"$in": arr}}, operator)
+	return err
+}
+
+func UpdateSceneLimit(ctx context.Context, uid, operator string, limit uint16) error {
 	msg := bson.M{"limit": limit, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+	_, err := updateOne(ctx, TableScene, uid, msg)
 	return err
 }
 
-func UpdateSceneShort(uid, operator, name string) error {
+func UpdateSceneShort(ctx context.Context, uid, operator, name string) error {
 	msg := bson.M{"short": name, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+	_, err := updateOne(ctx, TableScene, uid, msg)
 	return err
 }
 
-func UpdateSceneSupporter(uid, supporter, operator string) error {
+func UpdateSceneSupporter(ctx context.Context, uid, supporter, operator string) error {
 	msg := bson.M{"supporter": supporter, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+	_, err := updateOne(ctx, TableScene, uid, msg)
 	return err
 }
 
 //func UpdateSceneBucket(uid, bucket, operator string) error {
 //	msg := bson.M{"bucket": bucket, "operator": operator, "updatedAt": time.Now()}
-//	_, err := updateOne(TableScene, uid, msg)
+//	_, err := updateOne(ctx, TableScene, uid, msg)
 //	return err
 //}
 
-func UpdateSceneParents(uid, operator string, list []string) error {
+func UpdateSceneParents(ctx context.Context, uid, operator string, list []string) error {
 	msg := bson.M{"parents": list, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableScene, uid, msg)
+	_, err := updateOne(ctx, TableScene, uid, msg)
 	return err
 }
 
-func RemoveScene(uid, operator string) error {
-	_, err := removeOne(TableScene, uid, operator)
+func RemoveScene(ctx context.Context, uid, operator string) error {
+	_, err := removeOne(ctx, TableScene, uid, operator)
 	return err
 }
 
-func AppendSceneMember(uid string, member string) error {
+func AppendSceneMember(ctx context.Context, uid string, member string) error {
 	if len(uid) < 1 {
 		return errors.New("the uid is empty")
 	}
 	msg := bson.M{"members": member}
-	_, err := appendElement(TableScene, uid, msg)
+	_, err := appendElement(ctx, TableScene, uid, msg)
 	return err
 }
 
-func SubtractSceneMember(uid, member string) error {
+func SubtractSceneMember(ctx context.Context, uid, member string) error {
 	if len(uid) < 1 {
 		return errors.New("the uid is empty")
 	}
 	msg := bson.M{"members": member}
-	_, err := removeElement(TableScene, uid, msg)
+	_, err := removeElement(ctx, TableScene, uid, msg)
 	return err
 }
 
 //func UpdateSceneDisplay(uid, operator string, list []proxy.ShowingInfo) error {
 //	msg := bson.M{"displays": list, "operator": operator, "updatedAt": time.Now()}
-//	_, err := updateOne(TableScene, uid, msg)
+//	_, err := updateOne(ctx, TableScene, uid, msg)
 //	return err
 //}
 //
@@ -214,7 +221,7 @@ func SubtractSceneMember(uid, member string) error {
 //		return errors.New("the uid is empty")
 //	}
 //	msg := bson.M{"displays": display}
-//	_, err := appendElement(TableScene, uid, msg)
+//	_, err := appendElement(ctx, TableScene, uid, msg)
 //	return err
 //}
 //
@@ -223,6 +230,6 @@ func SubtractSceneMember(uid, member string) error {
 //		return errors.New("the uid is empty")
 //	}
 //	msg := bson.M{"displays": bson.M{"uid": display}}
-//	_, err := removeElement(TableScene, uid, msg)
+//	_, err := removeElement(ctx, TableScene, uid, msg)
 //	return err
 //}
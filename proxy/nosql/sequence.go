@@ -1,8 +1,12 @@
 package nosql
 
 import (
+	"context"
+	"errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
 )
 
@@ -15,31 +19,46 @@ type Sequence struct {
 	Count       uint64             `json:"count" bson:"count"`
 }
 
-func createSequence(name string) error {
-	var db = new(Sequence)
-	db.Count = 0
-	db.UID = primitive.NewObjectID()
-	db.Name = name
-	db.CreatedTime = time.Now()
-	_, err := insertOne(TableSequence, db)
-	if err != nil {
-		return err
-	}
-	return nil
+// SequenceRepair 启动检查时修复的计数，Count为修复前的值，Max为表中已有的最大ID
+type SequenceRepair struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+	Max   uint64 `json:"max"`
+}
+
+// SequenceTables 使用自增ID的表，计数的名字和表名一致
+func SequenceTables() []string {
+	return []string{TableScene, TableGroup, TableRoom, TableRegion, TableArea, TableDevice, TableMaintain}
 }
 
 func getSequenceNext(name string) (uint64, error) {
-	num, _ := getSequenceCount(name)
+	return getSequenceBlock(name, 1)
+}
+
+// getSequenceBlock 原子的预留num个连续的ID，返回第一个，计数不存在时自动创建
+func getSequenceBlock(name string, num uint64) (uint64, error) {
+	if len(name) < 1 {
+		return 0, errors.New("the sequence name is empty")
+	}
 	if num < 1 {
-		_ = createSequence(name)
+		return 0, errors.New("the sequence number is zero")
 	}
 	filter := bson.M{"name": name}
-	update := bson.M{"$inc": bson.M{"count": 1}, "$set": bson.M{"updatedAt": time.Now()}}
-	_, err := updateOneBy(TableSequence, filter, update)
+	update := bson.M{"$inc": bson.M{"count": num}, "$set": bson.M{"updatedAt": time.Now()},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "createdAt": time.Now(), "deleteAt": time.Time{}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	model := new(Sequence)
+	err := noSql.Collection(TableSequence).FindOneAndUpdate(ctx, filter, update, opts).Decode(model)
+	if err != nil && isDuplicateKey(err) {
+		//并发创建时唯一索引冲突，此时文档已经存在，再执行一次即可
+		err = noSql.Collection(TableSequence).FindOneAndUpdate(ctx, filter, update, opts).Decode(model)
+	}
 	if err != nil {
 		return 0, err
 	}
-	return num + 1, nil
+	return model.Count - num + 1, nil
 }
 
 func getSequenceCount(name string) (uint64, error) {
@@ -55,3 +74,101 @@ func getSequenceCount(name string) (uint64, error) {
 	}
 	return model.Count, nil
 }
+
+func isDuplicateKey(err error) bool {
+	var cmd mongo.CommandError
+	if errors.As(err, &cmd) && cmd.Code == 11000 {
+		return true
+	}
+	var write mongo.WriteException
+	if errors.As(err, &write) {
+		for _, item := range write.WriteErrors {
+			if item.Code == 11000 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// repairSequences 合并重复的计数文档，创建name的唯一索引，并把落后于表中最大ID的计数追上
+func repairSequences() ([]*SequenceRepair, error) {
+	err := mergeSequences()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	index := mongo.IndexModel{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true).SetName("uni_name")}
+	_, err = noSql.Collection(TableSequence).Indexes().CreateOne(ctx, index)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*SequenceRepair, 0, 2)
+	for _, name := range SequenceTables() {
+		top, er := getMaxID(name)
+		if er != nil {
+			return list, er
+		}
+		count, _ := getSequenceCount(name)
+		if count >= top {
+			continue
+		}
+		filter := bson.M{"name": name}
+		update := bson.M{"$max": bson.M{"count": top}, "$set": bson.M{"updatedAt": time.Now()},
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "createdAt": time.Now(), "deleteAt": time.Time{}}}
+		_, er = noSql.Collection(TableSequence).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if er != nil {
+			return list, er
+		}
+		list = append(list, &SequenceRepair{Name: name, Count: count, Max: top})
+	}
+	return list, nil
+}
+
+// mergeSequences 旧的实现可能创建了重复的计数文档，保留计数最大的一个
+func mergeSequences() error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "count", Value: -1}})
+	cursor, err := noSql.Collection(TableSequence).Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	last := ""
+	removes := make([]primitive.ObjectID, 0, 2)
+	for cursor.Next(ctx) {
+		node := new(Sequence)
+		if er := cursor.Decode(node); er != nil {
+			return er
+		}
+		if node.Name == last {
+			removes = append(removes, node.UID)
+		}
+		last = node.Name
+	}
+	if len(removes) < 1 {
+		return nil
+	}
+	_, err = noSql.Collection(TableSequence).DeleteMany(ctx, bson.M{"_id": bson.M{"$in": removes}})
+	return err
+}
+
+func getMaxID(collection string) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	opts := options.FindOne().SetSort(bson.D{{Key: "id", Value: -1}}).SetProjection(bson.M{"id": 1})
+	result := noSql.Collection(collection).FindOne(ctx, bson.M{}, opts)
+	if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	var node struct {
+		ID uint64 `bson:"id"`
+	}
+	err := result.Decode(&node)
+	if err != nil {
+		return 0, err
+	}
+	return node.ID, nil
+}
@@ -0,0 +1,316 @@
+package nosql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"omo.msa.organization/tool"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/**
+数据库快照，每个表导出为一个ndjson文件（mongo扩展json格式，保留类型），
+manifest记录每个表的数量以及sha256校验值，恢复之前先校验，
+恢复时先把所有选中的表写入临时的位置，全部成功后再替换，失败时原来的数据不变
+*/
+
+const SnapshotManifestFile = "manifest.json"
+
+const snapshotBatch = 500
+
+type SnapshotTable struct {
+	Name     string `json:"name"`
+	File     string `json:"file"`
+	Count    int64  `json:"count"`
+	Checksum string `json:"checksum"`
+}
+
+type SnapshotManifest struct {
+	Name     string          `json:"name"`
+	Database string          `json:"database"`
+	Created  time.Time       `json:"createdAt"`
+	Tables   []SnapshotTable `json:"tables"`
+}
+
+// SnapshotStore 支持快照的存储，mongo以及内存存储实现
+type SnapshotStore interface {
+	DatabaseName() string
+	// DumpTable 依次读取表中的全部文档，包含已经软删除的
+	DumpTable(table string, fun func(doc bson.Raw) error) error
+	// ReplaceTables 全部的表都准备成功后才替换，docs和tables一一对应
+	ReplaceTables(tables []string, docs [][]interface{}) error
+}
+
+// SnapshotTables 快照包含的所有表，版本以及迁移记录和数据一起恢复，避免恢复后重复迁移；
+// 不包含audits、revisions（只追加的历史记录，恢复数据不回滚历史）以及resumes（每个实例的同步位置，恢复后重新全量加载）
+func SnapshotTables() []string {
+	return []string{TableSequence, TableVersion, TableMigration, TableAddress, TableScene, TableGroup, TableRoom,
+		TableRegion, TableDevice, TableArea, TableMaintain}
+}
+
+// BackupDatabase 把所有表导出到root下以时间命名的目录中，包含已经软删除的数据
+func BackupDatabase(source SnapshotStore, root string) (*SnapshotManifest, error) {
+	if source == nil {
+		return nil, errors.New("the database not connected")
+	}
+	timeStr := time.Now().Format("20060102150405")
+	path := filepath.Join(root, timeStr)
+	if tool.PathIsExist(path) {
+		return nil, errors.New("the snapshot existed of " + timeStr)
+	}
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &SnapshotManifest{Name: timeStr, Database: source.DatabaseName(), Created: time.Now()}
+	for _, table := range SnapshotTables() {
+		info, er := dumpTable(source, path, table)
+		if er != nil {
+			_ = os.RemoveAll(path)
+			return nil, errors.New("backup table " + table + " failed: " + er.Error())
+		}
+		manifest.Tables = append(manifest.Tables, *info)
+	}
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+	err = os.WriteFile(filepath.Join(path, SnapshotManifestFile), data, 0644)
+	if err != nil {
+		_ = os.RemoveAll(path)
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func dumpTable(source SnapshotStore, path, table string) (*SnapshotTable, error) {
+	info := &SnapshotTable{Name: table, File: table + ".ndjson"}
+	f, err := os.Create(filepath.Join(path, info.File))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	writer := bufio.NewWriter(io.MultiWriter(f, hash))
+	err = source.DumpTable(table, func(doc bson.Raw) error {
+		line, er := bson.MarshalExtJSON(doc, true, false)
+		if er != nil {
+			return er
+		}
+		_, _ = writer.Write(line)
+		_ = writer.WriteByte('\n')
+		info.Count += 1
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = writer.Flush(); err != nil {
+		return nil, err
+	}
+	info.Checksum = hex.EncodeToString(hash.Sum(nil))
+	return info, nil
+}
+
+// ReadSnapshot 读取快照的manifest
+func ReadSnapshot(root, name string) (*SnapshotManifest, error) {
+	if len(name) < 1 {
+		return nil, errors.New("the snapshot name is empty")
+	}
+	data, err := os.ReadFile(filepath.Join(root, filepath.Base(name), SnapshotManifestFile))
+	if err != nil {
+		return nil, errors.New("read the snapshot manifest failed: " + err.Error())
+	}
+	manifest := new(SnapshotManifest)
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// RecoveryDatabase 把快照恢复到数据库，tables为空时恢复全部的表，
+// 所有选中的文件校验通过后才会替换表中的数据
+func RecoveryDatabase(target SnapshotStore, root, name string, tables []string) (*SnapshotManifest, error) {
+	if target == nil {
+		return nil, errors.New("the database not connected")
+	}
+	manifest, err := ReadSnapshot(root, name)
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]SnapshotTable, 0, len(manifest.Tables))
+	if len(tables) < 1 {
+		selected = append(selected, manifest.Tables...)
+	} else {
+		for _, table := range tables {
+			info := manifest.getTable(table)
+			if info == nil {
+				return nil, errors.New("not found the table in snapshot of " + table)
+			}
+			selected = append(selected, *info)
+		}
+	}
+	path := filepath.Join(root, manifest.Name)
+	names := make([]string, 0, len(selected))
+	list := make([][]interface{}, 0, len(selected))
+	for _, info := range selected {
+		docs, er := loadTable(path, info)
+		if er != nil {
+			return nil, errors.New("check table " + info.Name + " failed: " + er.Error())
+		}
+		names = append(names, info.Name)
+		list = append(list, docs)
+	}
+	err = target.ReplaceTables(names, list)
+	if err != nil {
+		return nil, errors.New("recovery tables failed: " + err.Error())
+	}
+	return manifest, nil
+}
+
+func (mine *SnapshotManifest) getTable(name string) *SnapshotTable {
+	for i := 0; i < len(mine.Tables); i += 1 {
+		if mine.Tables[i].Name == name {
+			return &mine.Tables[i]
+		}
+	}
+	return nil
+}
+
+func loadTable(path string, info SnapshotTable) ([]interface{}, error) {
+	data, err := os.ReadFile(filepath.Join(path, filepath.Base(info.File)))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != info.Checksum {
+		return nil, errors.New("the checksum not match")
+	}
+	docs := make([]interface{}, 0, info.Count)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) < 1 {
+			continue
+		}
+		var doc bson.D
+		err = bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if int64(len(docs)) != info.Count {
+		return nil, errors.New("the count not match")
+	}
+	return docs, nil
+}
+
+var _ SnapshotStore = (*mongoStorage)(nil)
+
+func (mine *mongoStorage) DatabaseName() string {
+	return noSql.Name()
+}
+
+func (mine *mongoStorage) DumpTable(table string, fun func(doc bson.Raw) error) error {
+	cursor, err := noSql.Collection(table).Find(context.Background(), bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		if er := fun(cursor.Current); er != nil {
+			return er
+		}
+	}
+	return cursor.Err()
+}
+
+func restoreName(table string) string {
+	return table + "_restore"
+}
+
+// ReplaceTables 先写入临时集合并且复制原来的索引，全部成功后再重命名覆盖原来的集合，
+// 单个集合的重命名是原子的，写入失败或者进程退出时原来的数据不变
+func (mine *mongoStorage) ReplaceTables(tables []string, docs [][]interface{}) error {
+	if len(tables) != len(docs) {
+		return errors.New("the tables not match the documents")
+	}
+	for i, table := range tables {
+		err := stageTable(table, docs[i])
+		if err != nil {
+			for _, name := range tables[:i+1] {
+				_ = dropOne(restoreName(name))
+			}
+			return errors.New("stage table " + table + " failed: " + err.Error())
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*timeOut)
+	defer cancel()
+	for _, table := range tables {
+		cmd := bson.D{{Key: "renameCollection", Value: noSql.Name() + "." + restoreName(table)},
+			{Key: "to", Value: noSql.Name() + "." + table}, {Key: "dropTarget", Value: true}}
+		err := noSql.Client().Database("admin").RunCommand(ctx, cmd).Err()
+		if err != nil {
+			return errors.New("rename table " + table + " failed: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// stageTable 写入临时集合，之前残留的临时集合先删除
+func stageTable(table string, docs []interface{}) error {
+	name := restoreName(table)
+	if err := dropOne(name); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*timeOut)
+	defer cancel()
+	err := noSql.CreateCollection(ctx, name)
+	if err != nil {
+		return err
+	}
+	indexes, err := listIndexes(table)
+	if err != nil {
+		return err
+	}
+	c := noSql.Collection(name)
+	for key, info := range indexes {
+		if key == "_id_" {
+			continue
+		}
+		opts := options.Index().SetName(info.Name)
+		if info.Unique {
+			opts.SetUnique(true)
+		}
+		if info.Partial != nil {
+			opts.SetPartialFilterExpression(info.Partial)
+		}
+		_, err = c.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: info.Key, Options: opts})
+		if err != nil {
+			return err
+		}
+	}
+	for i := 0; i < len(docs); i += snapshotBatch {
+		end := i + snapshotBatch
+		if end > len(docs) {
+			end = len(docs)
+		}
+		_, err = c.InsertMany(ctx, docs[i:end])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,813 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"omo.msa.organization/proxy"
+	"time"
+)
+
+/**
+存储接口，cache层只依赖这些接口，具体实现可以是mongo或者内存
+*/
+
+type SceneStore interface {
+	CreateScene(ctx context.Context, info *Scene) error
+	GetSceneNextID() (uint64, error)
+	GetScene(uid string) (*Scene, error)
+	GetSceneByMaster(user string) (*Scene, error)
+	GetAllScenes() ([]*Scene, error)
+	UpdateSceneBase(ctx context.Context, uid, name, remark, operator string) error
+	UpdateSceneMaster(ctx context.Context, uid, master, operator string) error
+	UpdateSceneCover(ctx context.Context, uid, icon, operator string) error
+	UpdateSceneType(ctx context.Context, uid, operator string, tp uint8) error
+	UpdateSceneLocal(ctx context.Context, uid, local, operator string) error
+	UpdateSceneAddress(ctx context.Context, uid, operator string, address AddressInfo) error
+	UpdateSceneStatus(ctx context.Context, uid string, status uint8, operator string) error
+	// AppendSceneQuestions 以及SubtractSceneQuestions为数组元素的原子操作，不替换整个数组
+	AppendSceneQuestions(ctx context.Context, uid, operator string, arr []string) error
+	SubtractSceneQuestions(ctx context.Context, uid, operator string, arr []string) error
+	UpdateSceneLimit(ctx context.Context, uid, operator string, limit uint16) error
+	UpdateSceneShort(ctx context.Context, uid, operator, name string) error
+	UpdateSceneSupporter(ctx context.Context, uid, supporter, operator string) error
+	UpdateSceneParents(ctx context.Context, uid, operator string, list []string) error
+	RemoveScene(ctx context.Context, uid, operator string) error
+	// RemoveSceneCascade 使用同一个操作者以及时间删除场景以及依赖对象，detach为true时设备恢复为未绑定
+	RemoveSceneCascade(ctx context.Context, depends *SceneDepends, detach bool, operator string, stamp time.Time) error
+	AppendSceneMember(ctx context.Context, uid string, member string) error
+	SubtractSceneMember(ctx context.Context, uid, member string) error
+}
+
+type GroupStore interface {
+	CreateGroup(ctx context.Context, info *Group) error
+	GetGroupNextID() (uint64, error)
+	GetGroupCount() int64
+	GetGroup(uid string) (*Group, error)
+	GetGroupByID(id uint64) (*Group, error)
+	RemoveGroup(ctx context.Context, uid, operator string) error
+	GetAllGroups() ([]*Group, error)
+	GetGroupsByScene(scene string) ([]*Group, error)
+	UpdateGroupBase(ctx context.Context, uid, name, remark, operator string) error
+	UpdateGroupCover(ctx context.Context, uid, cover, operator string) error
+	UpdateGroupMembers(ctx context.Context, uid, operator string, members []string) error
+	UpdateGroupAddress(ctx context.Context, uid, operator string, address AddressInfo) error
+	UpdateGroupLocation(ctx context.Context, uid, location, operator string) error
+	UpdateGroupContact(ctx context.Context, uid, phone, operator string) error
+	UpdateGroupMaster(ctx context.Context, uid, member, operator string) error
+	UpdateGroupAssistant(ctx context.Context, uid, member, operator string) error
+	AppendGroupMember(ctx context.Context, uid, member string) error
+	SubtractGroupMember(ctx context.Context, uid string, member string) error
+}
+
+type RoomStore interface {
+	CreateRoom(ctx context.Context, info *Room) error
+	GetRoomNextID() (uint64, error)
+	GetRoomCount() int64
+	GetRoom(uid string) (*Room, error)
+	GetRoomByID(id uint64) (*Room, error)
+	RemoveRoom(ctx context.Context, uid, operator string) error
+	GetAllRooms() ([]*Room, error)
+	GetRoomsByScene(scene string) ([]*Room, error)
+	UpdateRoomBase(ctx context.Context, uid, name, remark, operator string) error
+	UpdateRoomDisplays(ctx context.Context, uid, operator string, list []*proxy.DisplayInfo) error
+	AppendRoomQuotes(ctx context.Context, uid, operator string, arr []string) error
+	SubtractRoomQuotes(ctx context.Context, uid, operator string, arr []string) error
+}
+
+type RegionStore interface {
+	CreateRegion(ctx context.Context, info *Region) error
+	GetRegionNextID() (uint64, error)
+	GetRegionCount() int64
+	GetRegion(uid string) (*Region, error)
+	GetRegionByID(id uint64) (*Region, error)
+	RemoveRegion(ctx context.Context, uid, operator string) error
+	GetAllRegions() ([]*Region, error)
+	GetRegionsByScene(scene string) ([]*Region, error)
+	GetRegionsByParent(parent string) ([]*Region, error)
+	UpdateRegionBase(ctx context.Context, uid, name, remark, operator string) error
+	UpdateRegionMaster(ctx context.Context, uid, master, operator string) error
+	UpdateRegionEntity(ctx context.Context, uid, entity, operator string) error
+	UpdateRegionParent(ctx context.Context, uid, parent, operator string) error
+	UpdateRegionAddress(ctx context.Context, uid, operator string, address AddressInfo) error
+	UpdateRegionLocation(ctx context.Context, uid, location, operator string) error
+	AppendRegionMember(ctx context.Context, uid string, member string) error
+	SubtractRegionMember(ctx context.Context, uid, member string) error
+}
+
+type AreaStore interface {
+	CreateArea(ctx context.Context, info *Area) error
+	GetAreaNextID() (uint64, error)
+	GetArea(uid string) (*Area, error)
+	GetAreaByDevice(uid string) (*Area, error)
+	GetAreasByOwner(owner string) ([]*Area, error)
+	GetAreasByTemplate(owner, template string) ([]*Area, error)
+	GetAreasByParent(parent string) ([]*Area, error)
+	GetAreasBy(owner, parent string) ([]*Area, error)
+	GetAllAreas() ([]*Area, error)
+	UpdateAreaBase(ctx context.Context, uid, name, remark, operator string) error
+	UpdateAreaAssets(ctx context.Context, uid, operator string, assets []string) error
+	UpdateAreaTemplate(ctx context.Context, uid, template, operator string) error
+	UpdateAreaDevice(ctx context.Context, uid, device, operator string, tp uint32) error
+	UpdateAreaCatalog(ctx context.Context, uid, catalog, operator string) error
+	UpdateAreaDevice2(ctx context.Context, uid, device, operator string) error
+	UpdateAreaType(ctx context.Context, uid, operator string, tp uint32) error
+	UpdateAreaQuestion(ctx context.Context, uid, question, operator string) error
+	UpdateAreaLimit(ctx context.Context, uid, operator string, num uint32) error
+	UpdateAreaDisplays(ctx context.Context, uid, operator string, displays []string) error
+	// SetAreaModule 按照key修改或者追加一个元素
+	SetAreaModule(ctx context.Context, uid, operator, key, value string) error
+	SetAreaSource(ctx context.Context, uid, operator, key, value string) error
+	RemoveArea(ctx context.Context, uid, operator string) error
+}
+
+type DeviceStore interface {
+	CreateDevice(ctx context.Context, info *Invite) error
+	GetDeviceNextID() (uint64, error)
+	GetDeviceCount() int64
+	GetDeviceBySN(sn string) (*Invite, error)
+	GetDevice(uid string) (*Invite, error)
+	GetDeviceByID(id uint64) (*Invite, error)
+	RemoveDevice(ctx context.Context, uid, operator string) error
+	GetAllDevices() ([]*Invite, error)
+	GetAllDevicesExcept(st uint8) ([]*Invite, error)
+	GetDevicesByScene(scene string) ([]*Invite, error)
+	GetDevicesByStatus(st uint8) ([]*Invite, error)
+	UpdateDeviceBase(ctx context.Context, uid, name, remark, operator string) error
+	UpdateDeviceTime(ctx context.Context, uid, operator string, act, expiry uint64) error
+	UpdateDeviceCertificate(ctx context.Context, uid, data, operator string) error
+	UpdateDeviceScene(ctx context.Context, uid, data, operator string) error
+	UpdateDeviceAspect(ctx context.Context, uid, data, operator string) error
+	BindDevice(ctx context.Context, uid, quote, os, operator string, act, expiry uint64) error
+	UpdateDeviceStatus(ctx context.Context, uid, operator string, st uint8) error
+	UpdateDeviceMeta(ctx context.Context, uid, meta, operator string) error
+	UpdateDeviceAuto(ctx context.Context, uid, operator string, auto proxy.AutoInfo) error
+	UpdateDeviceType(ctx context.Context, uid, operator string, tp uint8) error
+}
+
+type MaintainStore interface {
+	CreateMaintain(ctx context.Context, info *Maintain) error
+	GetMaintainNextID() (uint64, error)
+	RemoveMaintain(ctx context.Context, uid, operator string) error
+	GetMaintain(uid string) (*Maintain, error)
+	GetMaintainsByOwner(owner string) ([]*Maintain, error)
+	GetMaintainsByArea(scene, area string) ([]*Maintain, error)
+	// GetMaintainsByFilter 场景中满足组合条件的记录，mongo在数据库中计算，其他存储读取场景的记录后使用FilterModels
+	GetMaintainsByFilter(scene string, filter bson.M, sorts bson.D) ([]*Maintain, error)
+	GetMaintainCount() int64
+}
+
+type RecycleStore interface {
+	GetRecycles(scene string) ([]*RecycleInfo, error)
+	GetRecyclesBefore(stamp time.Time) ([]*RecycleInfo, error)
+	RestoreRecycle(ctx context.Context, table, uid, operator string) error
+	// PurgeRecycle 彻底删除，不可恢复
+	PurgeRecycle(ctx context.Context, table, uid string) error
+}
+
+type TransactionStore interface {
+	// RunTransaction 多个文档的写操作，全部成功或者全部不生效
+	RunTransaction(ctx context.Context, ops []*WriteOp) error
+}
+
+// BatchStore 可选的批量写入，不支持时返回ErrBatchUnsupported，failed为每一行的错误
+type BatchStore interface {
+	InsertMany(ctx context.Context, table string, list []interface{}) (map[int]string, error)
+}
+
+type VersionStore interface {
+	GetVersion(table, uid string) (uint32, error)
+}
+
+type AuditStore interface {
+	// CreateAudit 只追加，不修改以及删除
+	CreateAudit(info *Audit) error
+	GetAudits(filter *AuditFilter) ([]*Audit, error)
+}
+
+type RevisionStore interface {
+	CreateRevision(info *Revision) error
+	GetRevision(uid string) (*Revision, error)
+	GetRevisions(filter *RevisionFilter) ([]*Revision, error)
+}
+
+type ChangeStore interface {
+	// GetChangedSince updatedAt或者deleteAt晚于stamp的文档，包含已经删除的
+	GetChangedSince(table string, stamp time.Time) ([]string, error)
+}
+
+type HealthStore interface {
+	// Ping 检查数据库是否可以访问
+	Ping() error
+}
+
+type SequenceStore interface {
+	GetSequenceNext(name string) (uint64, error)
+	GetSequenceCount(name string) (uint64, error)
+	// GetSequenceBlock 预留num个连续的ID，返回第一个
+	GetSequenceBlock(name string, num uint64) (uint64, error)
+	// RepairSequences 把落后于表中最大ID的计数追上
+	RepairSequences() ([]*SequenceRepair, error)
+}
+
+type Storage interface {
+	SceneStore
+	GroupStore
+	RoomStore
+	RegionStore
+	AreaStore
+	DeviceStore
+	MaintainStore
+	SequenceStore
+	RecycleStore
+	TransactionStore
+	HealthStore
+	VersionStore
+	AuditStore
+	RevisionStore
+	ChangeStore
+}
+
+type mongoStorage struct{}
+
+var mongoStore = new(mongoStorage)
+
+// MongoStorage 返回基于mongo的存储实现，需要先调用InitDB
+func MongoStorage() Storage {
+	return mongoStore
+}
+
+//region Scene
+func (mine *mongoStorage) CreateScene(ctx context.Context, info *Scene) error {
+	return CreateScene(ctx, info)
+}
+
+func (mine *mongoStorage) GetSceneNextID() (uint64, error) {
+	return GetSceneNextID()
+}
+
+func (mine *mongoStorage) GetScene(uid string) (*Scene, error) {
+	return GetScene(uid)
+}
+
+func (mine *mongoStorage) GetSceneByMaster(user string) (*Scene, error) {
+	return GetSceneByMaster(user)
+}
+
+func (mine *mongoStorage) GetAllScenes() ([]*Scene, error) {
+	return GetAllScenes()
+}
+
+func (mine *mongoStorage) UpdateSceneBase(ctx context.Context, uid, name, remark, operator string) error {
+	return UpdateSceneBase(ctx, uid, name, remark, operator)
+}
+
+func (mine *mongoStorage) UpdateSceneMaster(ctx context.Context, uid, master, operator string) error {
+	return UpdateSceneMaster(ctx, uid, master, operator)
+}
+
+func (mine *mongoStorage) UpdateSceneCover(ctx context.Context, uid, icon, operator string) error {
+	return UpdateSceneCover(ctx, uid, icon, operator)
+}
+
+func (mine *mongoStorage) UpdateSceneType(ctx context.Context, uid, operator string, tp uint8) error {
+	return UpdateSceneType(ctx, uid, operator, tp)
+}
+
+func (mine *mongoStorage) UpdateSceneLocal(ctx context.Context, uid, local, operator string) error {
+	return UpdateSceneLocal(ctx, uid, local, operator)
+}
+
+func (mine *mongoStorage) UpdateSceneAddress(ctx context.Context, uid, operator string, address AddressInfo) error {
+	return UpdateSceneAddress(ctx, uid, operator, address)
+}
+
+func (mine *mongoStorage) UpdateSceneStatus(ctx context.Context, uid string, status uint8, operator string) error {
+	return UpdateSceneStatus(ctx, uid, status, operator)
+}
+
+func (mine *mongoStorage) AppendSceneQuestions(ctx context.Context, uid, operator string, arr []string) error {
+	return AppendSceneQuestions(ctx, uid, operator, arr)
+}
+
+func (mine *mongoStorage) SubtractSceneQuestions(ctx context.Context, uid, operator string, arr []string) error {
+	return SubtractSceneQuestions(ctx, uid, operator, arr)
+}
+
+func (mine *mongoStorage) UpdateSceneLimit(ctx context.Context, uid, operator string, limit uint16) error {
+	return UpdateSceneLimit(ctx, uid, operator, limit)
+}
+
+func (mine *mongoStorage) UpdateSceneShort(ctx context.Context, uid, operator, name string) error {
+	return UpdateSceneShort(ctx, uid, operator, name)
+}
+
+func (mine *mongoStorage) UpdateSceneSupporter(ctx context.Context, uid, supporter, operator string) error {
+	return UpdateSceneSupporter(ctx, uid, supporter, operator)
+}
+
+func (mine *mongoStorage) UpdateSceneParents(ctx context.Context, uid, operator string, list []string) error {
+	return UpdateSceneParents(ctx, uid, operator, list)
+}
+
+func (mine *mongoStorage) RemoveScene(ctx context.Context, uid, operator string) error {
+	return RemoveScene(ctx, uid, operator)
+}
+
+func (mine *mongoStorage) RemoveSceneCascade(ctx context.Context, depends *SceneDepends, detach bool, operator string, stamp time.Time) error {
+	return RemoveSceneCascade(ctx, depends, detach, operator, stamp)
+}
+
+func (mine *mongoStorage) AppendSceneMember(ctx context.Context, uid string, member string) error {
+	return AppendSceneMember(ctx, uid, member)
+}
+
+func (mine *mongoStorage) SubtractSceneMember(ctx context.Context, uid, member string) error {
+	return SubtractSceneMember(ctx, uid, member)
+}
+
+//endregion
+
+//region Group
+func (mine *mongoStorage) CreateGroup(ctx context.Context, info *Group) error {
+	return CreateGroup(ctx, info)
+}
+
+func (mine *mongoStorage) GetGroupNextID() (uint64, error) {
+	return GetGroupNextID()
+}
+
+func (mine *mongoStorage) GetGroupCount() int64 {
+	return GetGroupCount()
+}
+
+func (mine *mongoStorage) GetGroup(uid string) (*Group, error) {
+	return GetGroup(uid)
+}
+
+func (mine *mongoStorage) GetGroupByID(id uint64) (*Group, error) {
+	return GetGroupByID(id)
+}
+
+func (mine *mongoStorage) RemoveGroup(ctx context.Context, uid, operator string) error {
+	return RemoveGroup(ctx, uid, operator)
+}
+
+func (mine *mongoStorage) GetAllGroups() ([]*Group, error) {
+	return GetAllGroups()
+}
+
+func (mine *mongoStorage) GetGroupsByScene(scene string) ([]*Group, error) {
+	return GetGroupsByScene(scene)
+}
+
+func (mine *mongoStorage) UpdateGroupBase(ctx context.Context, uid, name, remark, operator string) error {
+	return UpdateGroupBase(ctx, uid, name, remark, operator)
+}
+
+func (mine *mongoStorage) UpdateGroupCover(ctx context.Context, uid, cover, operator string) error {
+	return UpdateGroupCover(ctx, uid, cover, operator)
+}
+
+func (mine *mongoStorage) UpdateGroupMembers(ctx context.Context, uid, operator string, members []string) error {
+	return UpdateGroupMembers(ctx, uid, operator, members)
+}
+
+func (mine *mongoStorage) UpdateGroupAddress(ctx context.Context, uid, operator string, address AddressInfo) error {
+	return UpdateGroupAddress(ctx, uid, operator, address)
+}
+
+func (mine *mongoStorage) UpdateGroupLocation(ctx context.Context, uid, location, operator string) error {
+	return UpdateGroupLocation(ctx, uid, location, operator)
+}
+
+func (mine *mongoStorage) UpdateGroupContact(ctx context.Context, uid, phone, operator string) error {
+	return UpdateGroupContact(ctx, uid, phone, operator)
+}
+
+func (mine *mongoStorage) UpdateGroupMaster(ctx context.Context, uid, member, operator string) error {
+	return UpdateGroupMaster(ctx, uid, member, operator)
+}
+
+func (mine *mongoStorage) UpdateGroupAssistant(ctx context.Context, uid, member, operator string) error {
+	return UpdateGroupAssistant(ctx, uid, member, operator)
+}
+
+func (mine *mongoStorage) AppendGroupMember(ctx context.Context, uid, member string) error {
+	return AppendGroupMember(ctx, uid, member)
+}
+
+func (mine *mongoStorage) SubtractGroupMember(ctx context.Context, uid string, member string) error {
+	return SubtractGroupMember(ctx, uid, member)
+}
+
+//endregion
+
+//region Room
+func (mine *mongoStorage) CreateRoom(ctx context.Context, info *Room) error {
+	return CreateRoom(ctx, info)
+}
+
+func (mine *mongoStorage) GetRoomNextID() (uint64, error) {
+	return GetRoomNextID()
+}
+
+func (mine *mongoStorage) GetRoomCount() int64 {
+	return GetRoomCount()
+}
+
+func (mine *mongoStorage) GetRoom(uid string) (*Room, error) {
+	return GetRoom(uid)
+}
+
+func (mine *mongoStorage) GetRoomByID(id uint64) (*Room, error) {
+	return GetRoomByID(id)
+}
+
+func (mine *mongoStorage) RemoveRoom(ctx context.Context, uid, operator string) error {
+	return RemoveRoom(ctx, uid, operator)
+}
+
+func (mine *mongoStorage) GetAllRooms() ([]*Room, error) {
+	return GetAllRooms()
+}
+
+func (mine *mongoStorage) GetRoomsByScene(scene string) ([]*Room, error) {
+	return GetRoomsByScene(scene)
+}
+
+func (mine *mongoStorage) UpdateRoomBase(ctx context.Context, uid, name, remark, operator string) error {
+	return UpdateRoomBase(ctx, uid, name, remark, operator)
+}
+
+func (mine *mongoStorage) UpdateRoomDisplays(ctx context.Context, uid, operator string, list []*proxy.DisplayInfo) error {
+	return UpdateRoomDisplays(ctx, uid, operator, list)
+}
+
+func (mine *mongoStorage) AppendRoomQuotes(ctx context.Context, uid, operator string, arr []string) error {
+	return AppendRoomQuotes(ctx, uid, operator, arr)
+}
+
+func (mine *mongoStorage) SubtractRoomQuotes(ctx context.Context, uid, operator string, arr []string) error {
+	return SubtractRoomQuotes(ctx, uid, operator, arr)
+}
+
+//endregion
+
+//region Region
+func (mine *mongoStorage) CreateRegion(ctx context.Context, info *Region) error {
+	return CreateRegion(ctx, info)
+}
+
+func (mine *mongoStorage) GetRegionNextID() (uint64, error) {
+	return GetRegionNextID()
+}
+
+func (mine *mongoStorage) GetRegionCount() int64 {
+	return GetRegionCount()
+}
+
+func (mine *mongoStorage) GetRegion(uid string) (*Region, error) {
+	return GetRegion(uid)
+}
+
+func (mine *mongoStorage) GetRegionByID(id uint64) (*Region, error) {
+	return GetRegionByID(id)
+}
+
+func (mine *mongoStorage) RemoveRegion(ctx context.Context, uid, operator string) error {
+	return RemoveRegion(ctx, uid, operator)
+}
+
+func (mine *mongoStorage) GetAllRegions() ([]*Region, error) {
+	return GetAllRegions()
+}
+
+func (mine *mongoStorage) GetRegionsByScene(scene string) ([]*Region, error) {
+	return GetRegionsByScene(scene)
+}
+
+func (mine *mongoStorage) GetRegionsByParent(parent string) ([]*Region, error) {
+	return GetRegionsByParent(parent)
+}
+
+func (mine *mongoStorage) UpdateRegionBase(ctx context.Context, uid, name, remark, operator string) error {
+	return UpdateRegionBase(ctx, uid, name, remark, operator)
+}
+
+func (mine *mongoStorage) UpdateRegionMaster(ctx context.Context, uid, master, operator string) error {
+	return UpdateRegionMaster(ctx, uid, master, operator)
+}
+
+func (mine *mongoStorage) UpdateRegionEntity(ctx context.Context, uid, entity, operator string) error {
+	return UpdateRegionEntity(ctx, uid, entity, operator)
+}
+
+func (mine *mongoStorage) UpdateRegionParent(ctx context.Context, uid, parent, operator string) error {
+	return UpdateRegionParent(ctx, uid, parent, operator)
+}
+
+func (mine *mongoStorage) UpdateRegionAddress(ctx context.Context, uid, operator string, address AddressInfo) error {
+	return UpdateRegionAddress(ctx, uid, operator, address)
+}
+
+func (mine *mongoStorage) UpdateRegionLocation(ctx context.Context, uid, location, operator string) error {
+	return UpdateRegionLocation(ctx, uid, location, operator)
+}
+
+func (mine *mongoStorage) AppendRegionMember(ctx context.Context, uid string, member string) error {
+	return AppendRegionMember(ctx, uid, member)
+}
+
+func (mine *mongoStorage) SubtractRegionMember(ctx context.Context, uid, member string) error {
+	return SubtractRegionMember(ctx, uid, member)
+}
+
+//endregion
+
+//region Area
+func (mine *mongoStorage) CreateArea(ctx context.Context, info *Area) error {
+	return CreateArea(ctx, info)
+}
+
+func (mine *mongoStorage) GetAreaNextID() (uint64, error) {
+	return GetAreaNextID()
+}
+
+func (mine *mongoStorage) GetArea(uid string) (*Area, error) {
+	return GetArea(uid)
+}
+
+func (mine *mongoStorage) GetAreaByDevice(uid string) (*Area, error) {
+	return GetAreaByDevice(uid)
+}
+
+func (mine *mongoStorage) GetAreasByOwner(owner string) ([]*Area, error) {
+	return GetAreasByOwner(owner)
+}
+
+func (mine *mongoStorage) GetAreasByTemplate(owner, template string) ([]*Area, error) {
+	return GetAreasByTemplate(owner, template)
+}
+
+func (mine *mongoStorage) GetAreasByParent(parent string) ([]*Area, error) {
+	return GetAreasByParent(parent)
+}
+
+func (mine *mongoStorage) GetAreasBy(owner, parent string) ([]*Area, error) {
+	return GetAreasBy(owner, parent)
+}
+
+func (mine *mongoStorage) GetAllAreas() ([]*Area, error) {
+	return GetAllAreas()
+}
+
+func (mine *mongoStorage) UpdateAreaBase(ctx context.Context, uid, name, remark, operator string) error {
+	return UpdateAreaBase(ctx, uid, name, remark, operator)
+}
+
+func (mine *mongoStorage) UpdateAreaAssets(ctx context.Context, uid, operator string, assets []string) error {
+	return UpdateAreaAssets(ctx, uid, operator, assets)
+}
+
+func (mine *mongoStorage) UpdateAreaTemplate(ctx context.Context, uid, template, operator string) error {
+	return UpdateAreaTemplate(ctx, uid, template, operator)
+}
+
+func (mine *mongoStorage) UpdateAreaDevice(ctx context.Context, uid, device, operator string, tp uint32) error {
+	return UpdateAreaDevice(ctx, uid, device, operator, tp)
+}
+
+func (mine *mongoStorage) UpdateAreaCatalog(ctx context.Context, uid, catalog, operator string) error {
+	return UpdateAreaCatalog(ctx, uid, catalog, operator)
+}
+
+func (mine *mongoStorage) UpdateAreaDevice2(ctx context.Context, uid, device, operator string) error {
+	return UpdateAreaDevice2(ctx, uid, device, operator)
+}
+
+func (mine *mongoStorage) UpdateAreaType(ctx context.Context, uid, operator string, tp uint32) error {
+	return UpdateAreaType(ctx, uid, operator, tp)
+}
+
+func (mine *mongoStorage) UpdateAreaQuestion(ctx context.Context, uid, question, operator string) error {
+	return UpdateAreaQuestion(ctx, uid, question, operator)
+}
+
+func (mine *mongoStorage) UpdateAreaLimit(ctx context.Context, uid, operator string, num uint32) error {
+	return UpdateAreaLimit(ctx, uid, operator, num)
+}
+
+func (mine *mongoStorage) UpdateAreaDisplays(ctx context.Context, uid, operator string, displays []string) error {
+	return UpdateAreaDisplays(ctx, uid, operator, displays)
+}
+
+func (mine *mongoStorage) SetAreaModule(ctx context.Context, uid, operator, key, value string) error {
+	return SetAreaModule(ctx, uid, operator, key, value)
+}
+
+func (mine *mongoStorage) SetAreaSource(ctx context.Context, uid, operator, key, value string) error {
+	return SetAreaSource(ctx, uid, operator, key, value)
+}
+
+func (mine *mongoStorage) RemoveArea(ctx context.Context, uid, operator string) error {
+	return RemoveArea(ctx, uid, operator)
+}
+
+//endregion
+
+//region Device
+func (mine *mongoStorage) CreateDevice(ctx context.Context, info *Invite) error {
+	return CreateDevice(ctx, info)
+}
+
+func (mine *mongoStorage) GetDeviceNextID() (uint64, error) {
+	return GetDeviceNextID()
+}
+
+func (mine *mongoStorage) GetDeviceCount() int64 {
+	return GetDeviceCount()
+}
+
+func (mine *mongoStorage) GetDeviceBySN(sn string) (*Invite, error) {
+	return GetDeviceBySN(sn)
+}
+
+func (mine *mongoStorage) GetDevice(uid string) (*Invite, error) {
+	return GetDevice(uid)
+}
+
+func (mine *mongoStorage) GetDeviceByID(id uint64) (*Invite, error) {
+	return GetDeviceByID(id)
+}
+
+func (mine *mongoStorage) RemoveDevice(ctx context.Context, uid, operator string) error {
+	return RemoveDevice(ctx, uid, operator)
+}
+
+func (mine *mongoStorage) GetAllDevices() ([]*Invite, error) {
+	return GetAllDevices()
+}
+
+func (mine *mongoStorage) GetAllDevicesExcept(st uint8) ([]*Invite, error) {
+	return GetAllDevicesExcept(st)
+}
+
+func (mine *mongoStorage) GetDevicesByScene(scene string) ([]*Invite, error) {
+	return GetDevicesByScene(scene)
+}
+
+func (mine *mongoStorage) GetDevicesByStatus(st uint8) ([]*Invite, error) {
+	return GetDevicesByStatus(st)
+}
+
+func (mine *mongoStorage) UpdateDeviceBase(ctx context.Context, uid, name, remark, operator string) error {
+	return UpdateDeviceBase(ctx, uid, name, remark, operator)
+}
+
+func (mine *mongoStorage) UpdateDeviceTime(ctx context.Context, uid, operator string, act, expiry uint64) error {
+	return UpdateDeviceTime(ctx, uid, operator, act, expiry)
+}
+
+func (mine *mongoStorage) UpdateDeviceCertificate(ctx context.Context, uid, data, operator string) error {
+	return UpdateDeviceCertificate(ctx, uid, data, operator)
+}
+
+func (mine *mongoStorage) UpdateDeviceScene(ctx context.Context, uid, data, operator string) error {
+	return UpdateDeviceScene(ctx, uid, data, operator)
+}
+
+func (mine *mongoStorage) UpdateDeviceAspect(ctx context.Context, uid, data, operator string) error {
+	return UpdateDeviceAspect(ctx, uid, data, operator)
+}
+
+func (mine *mongoStorage) BindDevice(ctx context.Context, uid, quote, os, operator string, act, expiry uint64) error {
+	return BindDevice(ctx, uid, quote, os, operator, act, expiry)
+}
+
+func (mine *mongoStorage) UpdateDeviceStatus(ctx context.Context, uid, operator string, st uint8) error {
+	return UpdateDeviceStatus(ctx, uid, operator, st)
+}
+
+func (mine *mongoStorage) UpdateDeviceMeta(ctx context.Context, uid, meta, operator string) error {
+	return UpdateDeviceMeta(ctx, uid, meta, operator)
+}
+
+func (mine *mongoStorage) UpdateDeviceAuto(ctx context.Context, uid, operator string, auto proxy.AutoInfo) error {
+	return UpdateDeviceAuto(ctx, uid, operator, auto)
+}
+
+func (mine *mongoStorage) UpdateDeviceType(ctx context.Context, uid, operator string, tp uint8) error {
+	return UpdateDeviceType(ctx, uid, operator, tp)
+}
+
+//endregion
+
+//region Maintain
+func (mine *mongoStorage) CreateMaintain(ctx context.Context, info *Maintain) error {
+	return CreateMaintain(ctx, info)
+}
+
+func (mine *mongoStorage) GetMaintainNextID() (uint64, error) {
+	return GetMaintainNextID()
+}
+
+func (mine *mongoStorage) RemoveMaintain(ctx context.Context, uid, operator string) error {
+	return RemoveMaintain(ctx, uid, operator)
+}
+
+func (mine *mongoStorage) GetMaintain(uid string) (*Maintain, error) {
+	return GetMaintain(uid)
+}
+
+func (mine *mongoStorage) GetMaintainsByOwner(owner string) ([]*Maintain, error) {
+	return GetMaintainsByOwner(owner)
+}
+
+func (mine *mongoStorage) GetMaintainsByArea(scene, area string) ([]*Maintain, error) {
+	return GetMaintainsByArea(scene, area)
+}
+
+func (mine *mongoStorage) GetMaintainsByFilter(scene string, filter bson.M, sorts bson.D) ([]*Maintain, error) {
+	return GetMaintainsByFilter(bson.M{"$and": bson.A{bson.M{"scene": scene}, filter}}, sorts)
+}
+
+func (mine *mongoStorage) GetMaintainCount() int64 {
+	return GetMaintainCount()
+}
+
+//endregion
+
+//region Sequence
+func (mine *mongoStorage) GetSequenceNext(name string) (uint64, error) {
+	return getSequenceNext(name)
+}
+
+func (mine *mongoStorage) GetSequenceCount(name string) (uint64, error) {
+	return getSequenceCount(name)
+}
+
+func (mine *mongoStorage) GetSequenceBlock(name string, num uint64) (uint64, error) {
+	return getSequenceBlock(name, num)
+}
+
+func (mine *mongoStorage) RepairSequences() ([]*SequenceRepair, error) {
+	return repairSequences()
+}
+
+//endregion
+
+func (mine *mongoStorage) GetRecycles(scene string) ([]*RecycleInfo, error) {
+	return GetRecycles(scene)
+}
+
+func (mine *mongoStorage) GetRecyclesBefore(stamp time.Time) ([]*RecycleInfo, error) {
+	return GetRecyclesBefore(stamp)
+}
+
+func (mine *mongoStorage) RestoreRecycle(ctx context.Context, table, uid, operator string) error {
+	return RestoreRecycle(ctx, table, uid, operator)
+}
+
+func (mine *mongoStorage) PurgeRecycle(ctx context.Context, table, uid string) error {
+	return PurgeRecycle(ctx, table, uid)
+}
+
+func (mine *mongoStorage) RunTransaction(ctx context.Context, ops []*WriteOp) error {
+	return RunTransaction(ctx, ops)
+}
+
+func (mine *mongoStorage) InsertMany(ctx context.Context, table string, list []interface{}) (map[int]string, error) {
+	return insertMany(ctx, table, list)
+}
+
+func (mine *mongoStorage) Ping() error {
+	return Ping()
+}
+
+func (mine *mongoStorage) GetVersion(table, uid string) (uint32, error) {
+	return GetVersion(table, uid)
+}
+
+func (mine *mongoStorage) CreateAudit(info *Audit) error {
+	return CreateAudit(info)
+}
+
+func (mine *mongoStorage) GetAudits(filter *AuditFilter) ([]*Audit, error) {
+	return GetAudits(filter)
+}
+
+func (mine *mongoStorage) CreateRevision(info *Revision) error {
+	return CreateRevision(info)
+}
+
+func (mine *mongoStorage) GetRevision(uid string) (*Revision, error) {
+	return GetRevision(uid)
+}
+
+func (mine *mongoStorage) GetRevisions(filter *RevisionFilter) ([]*Revision, error) {
+	return GetRevisions(filter)
+}
+
+func (mine *mongoStorage) GetChangedSince(table string, stamp time.Time) ([]string, error) {
+	return GetChangedSince(table, stamp)
+}
@@ -6,6 +6,23 @@ const (
 	*/
 	TableSequence = "sequences"
 
+	/**
+	索引以及数据结构的版本记录
+	*/
+	TableVersion   = "versions"
+	TableMigration = "migrations"
+
+	/**
+	缓存同步的恢复位置，每个实例每个表一条
+	*/
+	TableResume = "resumes"
+
+	/**
+	审计记录以及历史版本，只追加
+	*/
+	TableAudit    = "audits"
+	TableRevision = "revisions"
+
 	/**
 	用户地址表
 	*/
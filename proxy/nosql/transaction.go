@@ -0,0 +1,253 @@
+package nosql
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sync"
+	"time"
+)
+
+/**
+多个文档的写操作，副本集以及分片集群使用会话事务，
+单节点不支持事务时逐个写入，失败后使用写入前的值以及版本进行补偿，
+请求期望的版本在全部写入成功后才修改
+*/
+
+// WriteOp 一个文档的写操作，Fields为需要设置的字段，
+// Adds以及Pulls为数组字段追加以及移除的元素，同一个数组只能使用其中一种
+type WriteOp struct {
+	Table  string
+	UID    string
+	Fields bson.M
+	Adds   map[string][]string
+	Pulls  map[string][]string
+}
+
+// txSupport 只缓存成功的检查结果，检查失败时下一次重新检查
+var txSupport struct {
+	lock    sync.Mutex
+	checked bool
+	enable  bool
+}
+
+func RemoveOp(table, uid, operator string, stamp time.Time) *WriteOp {
+	return &WriteOp{Table: table, UID: uid, Fields: bson.M{"operator": operator, "deleteAt": stamp}}
+}
+
+func DeviceBindOp(uid, quote, os, operator string, act, expiry uint64, st uint8) *WriteOp {
+	return &WriteOp{Table: TableDevice, UID: uid, Fields: bson.M{"quote": quote, "os": os, "activated": act,
+		"expiry": expiry, "status": st, "operator": operator, "updatedAt": time.Now()}}
+}
+
+func DeviceSceneOp(uid, scene, operator string, st uint8) *WriteOp {
+	return &WriteOp{Table: TableDevice, UID: uid, Fields: bson.M{"scene": scene, "status": st,
+		"operator": operator, "updatedAt": time.Now()}}
+}
+
+func RestoreOp(table, uid, operator string) *WriteOp {
+	return &WriteOp{Table: table, UID: uid, Fields: bson.M{"operator": operator, "deleteAt": time.Time{},
+		"updatedAt": time.Now()}}
+}
+
+func AreaDeviceOp(uid, device, operator string, tp uint32) *WriteOp {
+	return &WriteOp{Table: TableArea, UID: uid, Fields: bson.M{"device": device, "type": tp, "operator": operator,
+		"updatedAt": time.Now()}}
+}
+
+func RoomQuotesAddOp(uid, operator string, quotes []string) *WriteOp {
+	return &WriteOp{Table: TableRoom, UID: uid, Fields: bson.M{"operator": operator, "updatedAt": time.Now()},
+		Adds: map[string][]string{"quotes": quotes}}
+}
+
+func RoomQuotesPullOp(uid, operator string, quotes []string) *WriteOp {
+	return &WriteOp{Table: TableRoom, UID: uid, Fields: bson.M{"operator": operator, "updatedAt": time.Now()},
+		Pulls: map[string][]string{"quotes": quotes}}
+}
+
+// update 对应的mongo更新，数组使用$addToSet以及$pull
+func (mine *WriteOp) update() bson.M {
+	update := bson.M{"$set": mine.Fields, "$inc": versionInc}
+	if len(mine.Adds) > 0 {
+		adds := bson.M{}
+		for key, list := range mine.Adds {
+			adds[key] = bson.M{"$each": list}
+		}
+		update["$addToSet"] = adds
+	}
+	if len(mine.Pulls) > 0 {
+		pulls := bson.M{}
+		for key, list := range mine.Pulls {
+			pulls[key] = bson.M{"$in": list}
+		}
+		update["$pull"] = pulls
+	}
+	return update
+}
+
+// RunTransaction 执行所有的写操作，要么全部成功，要么全部不生效
+func RunTransaction(ctx context.Context, ops []*WriteOp) error {
+	if len(ops) < 1 {
+		return nil
+	}
+	if !supportTransaction() {
+		return runCompensate(ctx, ops)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeOut*time.Duration(len(ops)))
+	defer cancel()
+	session, err := dbClient.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	var tx *ExpectTx
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		//回调在重试时会再次执行，每次重新计数
+		var tc context.Context
+		tc, tx = WithExpectTx(sc)
+		for _, op := range ops {
+			er := applyOp(tc, op, op.update())
+			if er != nil {
+				return nil, er
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	tx.Commit()
+	return nil
+}
+
+// supportTransaction 只有副本集或者mongos支持事务，检查失败时按照不支持处理
+func supportTransaction() bool {
+	enable, _ := checkTransaction()
+	return enable
+}
+
+// checkTransaction 检查失败时返回错误，不缓存结果
+func checkTransaction() (bool, error) {
+	txSupport.lock.Lock()
+	defer txSupport.lock.Unlock()
+	if txSupport.checked {
+		return txSupport.enable, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	var result bson.M
+	err := dbClient.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&result)
+	if err != nil {
+		log.Warnf("check the transaction support failed that err = %s", err.Error())
+		return false, err
+	}
+	_, replica := result["setName"]
+	txSupport.enable = replica || result["msg"] == "isdbgrid"
+	txSupport.checked = true
+	return txSupport.enable, nil
+}
+
+// runCompensate 逐个写入，失败时倒序恢复已经写入的文档
+func runCompensate(ctx context.Context, ops []*WriteOp) error {
+	undos := make([]*WriteOp, 0, len(ops))
+	ctx, tx := WithExpectTx(ctx)
+	var err error
+	for _, op := range ops {
+		var undo *WriteOp
+		undo, err = readPrevious(op)
+		if err != nil {
+			break
+		}
+		tmp, cancel := context.WithTimeout(ctx, timeOut)
+		err = applyOp(tmp, op, op.update())
+		cancel()
+		if err != nil {
+			break
+		}
+		undos = append(undos, undo)
+	}
+	if err == nil {
+		tx.Commit()
+		return nil
+	}
+	for i := len(undos) - 1; i >= 0; i-- {
+		undo := undos[i]
+		update := bson.M{"$set": undo.Fields}
+		unset := bson.M{}
+		for key, value := range undo.Fields {
+			if value == nil {
+				unset[key] = ""
+				delete(undo.Fields, key)
+			}
+		}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		if len(undo.Fields) < 1 {
+			delete(update, "$set")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+		er := applyOp(ctx, undo, update)
+		cancel()
+		if er != nil {
+			log.Errorf("compensate the %s of %s failed that err = %s", undo.Table, undo.UID, er.Error())
+		}
+	}
+	return err
+}
+
+// readPrevious 读取写入前的字段值以及版本，不存在的字段为nil
+func readPrevious(op *WriteOp) (*WriteOp, error) {
+	keys := make([]string, 0, len(op.Fields)+len(op.Adds)+len(op.Pulls)+1)
+	keys = append(keys, "version")
+	for key := range op.Fields {
+		keys = append(keys, key)
+	}
+	for key := range op.Adds {
+		keys = append(keys, key)
+	}
+	for key := range op.Pulls {
+		keys = append(keys, key)
+	}
+	selector := bson.M{}
+	for _, key := range keys {
+		selector[key] = 1
+	}
+	result, err := findOneOfField(op.Table, op.UID, selector)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	err = result.Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	undo := &WriteOp{Table: op.Table, UID: op.UID, Fields: bson.M{}}
+	for _, key := range keys {
+		undo.Fields[key] = doc[key]
+	}
+	return undo, nil
+}
+
+func applyOp(ctx context.Context, op *WriteOp, update bson.M) error {
+	objID, err := primitive.ObjectIDFromHex(op.UID)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": objID}
+	exp := expectFilter(ctx, op.Table, op.UID, filter)
+	matched, err := updateAfter(ctx, noSql.Collection(op.Table), op.Table, filter, update)
+	if err != nil {
+		return err
+	}
+	if exp != nil {
+		return expectResult(ctx, exp, op.Table, op.UID, matched)
+	}
+	if matched < 1 {
+		return errors.New("not found the document of " + op.UID)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	versionIndexes = "indexes"
+)
+
+type Version struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	Name        string             `json:"name" bson:"name"`
+	Version     int                `json:"version" bson:"version"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// getVersion 没有记录时返回0
+func getVersion(name string) (int, error) {
+	result, err := findOneBy(TableVersion, bson.M{"name": name})
+	if err != nil {
+		return 0, err
+	}
+	info := new(Version)
+	err = result.Decode(info)
+	if err != nil {
+		return 0, err
+	}
+	return info.Version, nil
+}
+
+func setVersion(name string, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	filter := bson.M{"name": name}
+	update := bson.M{"$set": bson.M{"version": version, "updatedAt": time.Now()},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID()}}
+	_, err := noSql.Collection(TableVersion).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,294 @@
+package nosql
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+/**
+监听表的变化用于多个实例之间的缓存同步，
+副本集以及分片集群使用change stream，单节点按照updatedAt以及deleteAt轮询，
+恢复位置保存在resumes表中，重启后从上次的位置继续
+*/
+
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+	// ChangeReload 恢复位置已经失效，需要重新加载整个表
+	ChangeReload = "reload"
+)
+
+const (
+	watchPollInterval = 2 * time.Second
+	watchSaveInterval = time.Second
+	watchRetryDelay   = 5 * time.Second
+	//轮询时向前重叠的时间，容忍多个实例之间的时钟误差以及同一毫秒内后提交的写入
+	watchPollOverlap = 5 * time.Second
+)
+
+// ChangeEvent 文档的变化，处理时需要重新读取文档
+type ChangeEvent struct {
+	Table     string
+	UID       string
+	Operation string
+}
+
+type ChangeHandler func(event *ChangeEvent)
+
+// Resume 监听的恢复位置，change stream使用token，轮询使用stamp
+type Resume struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	Name        string             `json:"name" bson:"name"`
+	Token       bson.Raw           `json:"token" bson:"token"`
+	Stamp       time.Time          `json:"stamp" bson:"stamp"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+type changeDoc struct {
+	Operation   string `bson:"operationType"`
+	DocumentKey struct {
+		UID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+}
+
+type stampDoc struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	UpdatedTime time.Time          `bson:"updatedAt"`
+	DeleteTime  time.Time          `bson:"deleteAt"`
+}
+
+// WatchTables 每个表一个协程，stop关闭后退出，不能确定是否支持变化流时稍后重新检查
+func WatchTables(instance string, tables []string, handler ChangeHandler, stop <-chan struct{}) {
+	go func() {
+		stream, err := checkTransaction()
+		for err != nil {
+			if stopped(stop, watchRetryDelay) {
+				return
+			}
+			stream, err = checkTransaction()
+		}
+		for _, table := range tables {
+			name := instance + ":" + table
+			if stream {
+				go watchStream(name, table, handler, stop)
+			} else {
+				go watchPoll(name, table, handler, stop)
+			}
+		}
+	}()
+}
+
+func getResume(name string) (*Resume, error) {
+	result, err := findOneBy(TableResume, bson.M{"name": name})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	info := new(Resume)
+	err = result.Decode(info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func setResume(name string, token bson.Raw, stamp time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	filter := bson.M{"name": name}
+	update := bson.M{"$set": bson.M{"token": token, "stamp": stamp, "updatedAt": time.Now()},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID()}}
+	_, err := noSql.Collection(TableResume).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func stopped(stop <-chan struct{}, delay time.Duration) bool {
+	select {
+	case <-stop:
+		return true
+	case <-time.After(delay):
+		return false
+	}
+}
+
+// watchStream 恢复位置失效时从当前位置开始并且通知重新加载
+func watchStream(name, table string, handler ChangeHandler, stop <-chan struct{}) {
+	var token bson.Raw
+	resume, err := getResume(name)
+	if err != nil {
+		log.Warnf("get the resume of %s failed that err = %s", name, err.Error())
+	} else if resume != nil {
+		token = resume.Token
+	}
+	for {
+		token, err = streamOnce(name, table, token, handler, stop)
+		if len(token) > 0 {
+			_ = setResume(name, token, time.Now())
+		}
+		if err == nil {
+			return
+		}
+		log.Warnf("watch the %s failed that err = %s", table, err.Error())
+		if isHistoryLost(err) {
+			token = nil
+			_ = setResume(name, nil, time.Now())
+			handler(&ChangeEvent{Table: table, Operation: ChangeReload})
+		}
+		if stopped(stop, watchRetryDelay) {
+			return
+		}
+	}
+}
+
+// isHistoryLost oplog中已经没有token对应的记录
+func isHistoryLost(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Code == 286 || cmdErr.Code == 280 || cmdErr.Code == 260
+	}
+	return false
+}
+
+// streamOnce 返回最后处理的token，stop关闭时返回nil错误
+func streamOnce(name, table string, token bson.Raw, handler ChangeHandler, stop <-chan struct{}) (bson.Raw, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	opt := options.ChangeStream()
+	if len(token) > 0 {
+		opt.SetResumeAfter(token)
+	}
+	ops := bson.A{"insert", "update", "replace", "delete"}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": ops}}}}}
+	stream, err := noSql.Collection(table).Watch(ctx, pipeline, opt)
+	if err != nil {
+		return token, err
+	}
+	defer stream.Close(context.Background())
+	saved := time.Now()
+	for stream.Next(ctx) {
+		doc := new(changeDoc)
+		er := stream.Decode(doc)
+		if er == nil {
+			event := &ChangeEvent{Table: table, UID: doc.DocumentKey.UID.Hex(), Operation: ChangeUpdate}
+			if doc.Operation == "insert" {
+				event.Operation = ChangeInsert
+			} else if doc.Operation == "delete" {
+				event.Operation = ChangeDelete
+			}
+			handler(event)
+		} else {
+			log.Warnf("decode the change of %s failed that err = %s", table, er.Error())
+		}
+		token = stream.ResumeToken()
+		if time.Since(saved) > watchSaveInterval {
+			saved = time.Now()
+			_ = setResume(name, token, saved)
+		}
+	}
+	if ctx.Err() != nil {
+		return token, nil
+	}
+	return token, stream.Err()
+}
+
+// watchPoll 单节点没有oplog，只能发现软删除，彻底删除的文档由回收站清理时已经不在缓存中
+func watchPoll(name, table string, handler ChangeHandler, stop <-chan struct{}) {
+	stamp := time.Now()
+	resume, err := getResume(name)
+	if err != nil {
+		log.Warnf("get the resume of %s failed that err = %s", name, err.Error())
+	} else if resume != nil && !resume.Stamp.IsZero() {
+		stamp = resume.Stamp
+	}
+	seen := make(map[string]time.Time, 20)
+	for !stopped(stop, watchPollInterval) {
+		last, er := pollOnce(table, stamp, seen, handler)
+		if er != nil {
+			log.Warnf("poll the %s failed that err = %s", table, er.Error())
+			continue
+		}
+		if last.After(stamp) {
+			stamp = last
+			_ = setResume(name, nil, stamp)
+		}
+	}
+}
+
+// pollOnce 按照$gte查询并且向前重叠一段时间，seen记录已经处理过的文档以及修改时间用于去重，返回处理过的最大时间
+func pollOnce(table string, stamp time.Time, seen map[string]time.Time, handler ChangeHandler) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	from := stamp.Add(-watchPollOverlap)
+	filter := bson.M{"$or": bson.A{bson.M{"updatedAt": bson.M{"$gte": from}}, bson.M{"deleteAt": bson.M{"$gte": from}}}}
+	opt := options.Find().SetProjection(bson.M{"updatedAt": 1, "deleteAt": 1})
+	cursor, err := noSql.Collection(table).Find(ctx, filter, opt)
+	if err != nil {
+		return stamp, err
+	}
+	defer cursor.Close(context.Background())
+	last := stamp
+	for cursor.Next(ctx) {
+		doc := new(stampDoc)
+		if er := cursor.Decode(doc); er != nil {
+			continue
+		}
+		changed := doc.UpdatedTime
+		if doc.DeleteTime.After(changed) {
+			changed = doc.DeleteTime
+		}
+		uid := doc.UID.Hex()
+		if at, ok := seen[uid]; ok && !changed.After(at) {
+			continue
+		}
+		seen[uid] = changed
+		handler(&ChangeEvent{Table: table, UID: uid, Operation: ChangeUpdate})
+		if changed.After(last) {
+			last = changed
+		}
+	}
+	//超出重叠时间的记录不会再被查询到
+	for uid, at := range seen {
+		if at.Before(last.Add(-watchPollOverlap)) {
+			delete(seen, uid)
+		}
+	}
+	return last, cursor.Err()
+}
+
+// GetChangedSince 修改时间晚于stamp的文档，只返回文档的uid，调用者需要自己处理时钟误差
+func GetChangedSince(table string, stamp time.Time) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	filter := bson.M{"$or": bson.A{bson.M{"updatedAt": bson.M{"$gt": stamp}}, bson.M{"deleteAt": bson.M{"$gt": stamp}}}}
+	opt := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := noSql.Collection(table).Find(ctx, filter, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+	list := make([]string, 0, 20)
+	for cursor.Next(ctx) {
+		doc := new(stampDoc)
+		if er := cursor.Decode(doc); er != nil {
+			return nil, er
+		}
+		list = append(list, doc.UID.Hex())
+	}
+	return list, cursor.Err()
+}
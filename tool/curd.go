@@ -24,6 +24,23 @@ func HasItem(array []string, value string) bool {
 	return false
 }
 
+// DiffItems 从from变为to需要移除以及追加的元素
+func DiffItems(from, to []string) ([]string, []string) {
+	removes := make([]string, 0, 2)
+	for _, item := range from {
+		if !HasItem(to, item) {
+			removes = append(removes, item)
+		}
+	}
+	adds := make([]string, 0, 2)
+	for _, item := range to {
+		if !HasItem(from, item) && !HasItem(adds, item) {
+			adds = append(adds, item)
+		}
+	}
+	return removes, adds
+}
+
 func HasItemByUint(array []uint, value uint) bool {
 	for i := 0; i < len(array); i++ {
 		if array[i] == value {
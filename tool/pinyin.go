@@ -0,0 +1,57 @@
+package tool
+
+import (
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"unicode"
+)
+
+// pinyinBounds GB2312一级汉字按照拼音排序，每个声母开始的区位码
+var pinyinBounds = []struct {
+	code   int
+	letter rune
+}{
+	{1601, 'a'}, {1637, 'b'}, {1833, 'c'}, {2078, 'd'}, {2274, 'e'}, {2302, 'f'},
+	{2433, 'g'}, {2594, 'h'}, {2787, 'j'}, {3106, 'k'}, {3212, 'l'}, {3472, 'm'},
+	{3635, 'n'}, {3722, 'o'}, {3730, 'p'}, {3858, 'q'}, {4027, 'r'}, {4086, 's'},
+	{4390, 't'}, {4558, 'w'}, {4684, 'x'}, {4925, 'y'}, {5249, 'z'},
+}
+
+const pinyinEnd = 5590
+
+// PinyinInitials 每个字符对应一个字符，汉字替换为拼音首字母，其他字符转为小写，
+// 二级汉字以及生僻字没有首字母时保持不变
+func PinyinInitials(source string) string {
+	runes := []rune(source)
+	encoder := simplifiedchinese.GBK.NewEncoder()
+	for i, r := range runes {
+		if !unicode.Is(unicode.Han, r) {
+			runes[i] = unicode.ToLower(r)
+			continue
+		}
+		data, err := encoder.Bytes([]byte(string(r)))
+		if err != nil || len(data) != 2 {
+			continue
+		}
+		code := (int(data[0])-0xA0)*100 + int(data[1]) - 0xA0
+		if code < pinyinBounds[0].code || code >= pinyinEnd {
+			continue
+		}
+		for j := len(pinyinBounds) - 1; j >= 0; j -= 1 {
+			if code >= pinyinBounds[j].code {
+				runes[i] = pinyinBounds[j].letter
+				break
+			}
+		}
+	}
+	return string(runes)
+}
+
+// HasHan 是否包含汉字
+func HasHan(source string) bool {
+	for _, r := range source {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
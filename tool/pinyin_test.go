@@ -0,0 +1,22 @@
+package tool
+
+import "testing"
+
+func TestPinyinInitials(t *testing.T) {
+	cases := map[string]string{
+		"北京博物馆ABC":    "bjbwgabc",
+		"中国 Museum-1": "zg museum-1",
+		"":            "",
+		//二级汉字以及扩展区的字没有首字母
+		"鑫淼": "鑫淼",
+		"㐀":  "㐀",
+	}
+	for source, target := range cases {
+		if result := PinyinInitials(source); result != target {
+			t.Fatalf("the initials of %s should be %s but %s", source, target, result)
+		}
+	}
+	if !HasHan("museum博物馆") || HasHan("museum") {
+		t.Fatal("the han check is error")
+	}
+}